@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// readiness tracks whether each namespace has successfully parsed at least
+// one log line
+type readiness struct {
+	mu     sync.RWMutex
+	parsed map[string]*atomic.Bool
+}
+
+func newReadiness() *readiness {
+	return &readiness{parsed: make(map[string]*atomic.Bool)}
+}
+
+// track returns the flag that is set once the given namespace parsed a line.
+// The flag of a namespace is kept when it is restarted.
+func (r *readiness) track(namespace string) *atomic.Bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p, ok := r.parsed[namespace]; ok {
+		return p
+	}
+
+	p := &atomic.Bool{}
+	r.parsed[namespace] = p
+	return p
+}
+
+// setNamespaces stops tracking all namespaces that are not in namespaces
+func (r *readiness) setNamespaces(namespaces map[string]struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for name := range r.parsed {
+		if _, ok := namespaces[name]; !ok {
+			delete(r.parsed, name)
+		}
+	}
+}
+
+// ServeHTTP responds with 200 if all namespaces parsed at least one line,
+// and with 503 (listing the namespaces that did not) otherwise
+func (r *readiness) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	r.mu.RLock()
+	var waiting []string
+	for name, parsed := range r.parsed {
+		if !parsed.Load() {
+			waiting = append(waiting, name)
+		}
+	}
+	r.mu.RUnlock()
+
+	if len(waiting) > 0 {
+		sort.Strings(waiting)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "waiting for first log line of namespaces %v\n", waiting)
+		return
+	}
+
+	fmt.Fprintln(w, "ok")
+}
+
+// liveness responds with 200 as long as the HTTP server is running
+func liveness(w http.ResponseWriter, _ *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
@@ -17,34 +17,57 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"flag"
 	"fmt"
-	"time"
+	"io"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/log"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/auth"
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/discovery"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/errorlog"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/geoip"
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/metrics"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/nginxconfig"
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/parser"
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/prof"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/push"
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/relabeling"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/relabeling/regexcache"
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/syslog"
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/tail"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/version"
+	gosyslog "gopkg.in/mcuadros/go-syslog.v2"
 )
 
 const maxStaticLabels = 128
 
+// labelValuesPool holds the slices for label values that are only needed
+// while a single log line is processed; they have room for all labels and one
+// additional label (like the path or response size)
+var labelValuesPool = metrics.NewLabelValuesPool(maxStaticLabels + 1)
+
 func main() {
 	var opts config.StartupFlags
 	var cfg = config.Config{
@@ -57,30 +80,82 @@ func main() {
 
 	versionMetrics := prometheus.NewRegistry()
 	versionMetrics.MustRegister(version.NewCollector("prometheus_nginxlog_exporter"))
-
-	gatherers := prometheus.Gatherers{versionMetrics}
+	versionMetrics.MustRegister(regexcache.RegexCacheHitsTotal, regexcache.RegexCacheMissesTotal)
+	versionMetrics.MustRegister(syslog.SyslogActiveConnectionsGauge, syslog.SyslogReconnectsTotal)
+	versionMetrics.MustRegister(metrics.NamespaceMetricsUnregisteredTotal)
 
 	flag.IntVar(&opts.ListenPort, "listen-port", 4040, "HTTP port to listen on")
 	flag.StringVar(&opts.ListenAddress, "listen-address", "0.0.0.0", "IP-address to bind")
-	flag.StringVar(&opts.Parser, "parser", "text", "NGINX access log format parser. One of: [text, json]")
+	flag.StringVar(&opts.Parser, "parser", "text", "NGINX access log format parser. One of: [text, json, logfmt, regex, cloud_run, apache]")
 	flag.StringVar(&opts.Format, "format", `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_x_forwarded_for"`, "NGINX access log format")
 	flag.StringVar(&opts.Namespace, "namespace", "nginx", "namespace to use for metric names")
 	flag.StringVar(&opts.ConfigFile, "config-file", "", "Configuration file to read from")
 	flag.BoolVar(&opts.EnableExperimentalFeatures, "enable-experimental", false, "Set this flag to enable experimental features")
 	flag.StringVar(&opts.CPUProfile, "cpuprofile", "", "write cpu profile to `file`")
 	flag.StringVar(&opts.MemProfile, "memprofile", "", "write memory profile to `file`")
+	flag.StringVar(&opts.TLSCertFile, "tls-cert-file", "", "certificate `file` for serving metrics via HTTPS")
+	flag.StringVar(&opts.TLSKeyFile, "tls-key-file", "", "private key `file` for serving metrics via HTTPS")
+	flag.StringVar(&opts.TLSClientCAFile, "tls-client-ca", "", "CA certificate `file` that clients need to present a certificate of (enables mutual TLS)")
 	flag.StringVar(&opts.MetricsEndpoint, "metrics-endpoint", cfg.Listen.MetricsEndpoint, "URL path at which to serve metrics")
 	flag.StringVar(&opts.LogLevel, "log-level", "info", "level of logs. Allowed values: error, warning, info, debug")
 	flag.StringVar(&opts.LogFormat, "log-format", "console", "Define log format. Allowed values: console, json")
+	flag.BoolVar(&opts.AutoRegister, "auto-register", false, "set to register the exporter at the service discovery backend detected from the environment (Consul, etcd or Kubernetes)")
 	flag.BoolVar(&opts.VerifyConfig, "verify-config", false, "Enable this flag to check config file loads, then exit")
+	flag.BoolVar(&opts.ValidateConfig, "validate-config", false, "set to validate the config file against the config schema and report all problems, then exit (with status 2 if the config is invalid)")
+	flag.BoolVar(&opts.NoEnvExpand, "no-env-expand", false, "set to not replace references to environment variables (like ${LISTEN_ADDR}) in the config file with their values")
 	flag.BoolVar(&opts.Version, "version", false, "set to print version information")
+	flag.BoolVar(&opts.ExportConfigSchema, "export-config-schema", false, "set to print a JSON schema of the YAML config file format, then exit")
+	flag.StringVar(&opts.NginxConfig, "nginx-config", "", "NGINX configuration `file` to read the log format from (instead of -format)")
+	flag.StringVar(&opts.NginxLogFormatName, "nginx-log-format-name", "combined", "name of the log_format to use from the NGINX configuration file")
+	flag.BoolVar(&opts.MigrateConfig, "migrate-config", false, "set to convert a config file (first argument) into another format, writing it to the second argument (or stdout), then exit")
+	flag.StringVar(&opts.MigrateFrom, "from", "hcl", "format of the config file to convert with -migrate-config. One of: [hcl, yaml]")
+	flag.StringVar(&opts.MigrateTo, "to", "yaml", "format to convert the config file into with -migrate-config. One of: [yaml]")
+	flag.StringVar(&opts.PrintLabels, "print-labels", "", "set to print the distinct label value combinations of a `namespace` of the running exporter, then exit")
+	flag.IntVar(&opts.DryRun, "dry-run", 0, "set to read this number of lines from the log sources and print the label value combinations that they would produce (instead of exporting metrics), then exit")
+	flag.IntVar(&opts.DebugBufferSize, "debug-buffer-size", 0, "set to keep this number of the most recent raw log lines of each namespace in memory, and serve them at /debug/recent-lines?namespace=<namespace>")
+	flag.StringVar(&opts.PushGatewayURL, "push-gateway-url", "", "URL of a Prometheus Pushgateway to push metrics to; without -push-interval, the log files are read once and the exporter exits after pushing")
+	flag.StringVar(&opts.PushInterval, "push-interval", "", "interval at which metrics are pushed to the Pushgateway while the log files are tailed (for example, 30s)")
+	flag.StringVar(&opts.OTLPEndpoint, "otlp-endpoint", "", "URL of an OTLP receiver to export metrics to, in addition to serving them (for example, http://otel-collector:4317)")
+	flag.StringVar(&opts.OTLPProtocol, "otlp-protocol", "", "protocol to export metrics to the OTLP receiver with. One of: [grpc, http/protobuf] (default grpc)")
 	flag.Parse()
 
+	if err := opts.FromEnvironment(flag.CommandLine); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	if opts.Version {
 		fmt.Println(version.Print("prometheus-nginxlog-exporter"))
 		os.Exit(0)
 	}
 
+	if opts.ExportConfigSchema {
+		schema, err := config.JSONSchema()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Println(string(schema))
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "hash-password" {
+		if err := hashPassword(flag.Args()[1:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if opts.MigrateConfig {
+		if err := migrateConfig(&opts, flag.Args()); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	logger, err := log.New(opts.LogLevel, opts.LogFormat)
 	if err != nil {
 		fmt.Println(err)
@@ -119,6 +194,15 @@ func main() {
 
 	logger.Debugf("using configuration %+v", cfg)
 
+	if opts.PrintLabels != "" {
+		if err := printLabels(&cfg, opts.PrintLabels); err != nil {
+			logger.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	regexcache.Default.Resize(cfg.RegexCacheSizeOrDefault())
+
 	if stabilityError := cfg.StabilityWarnings(); stabilityError != nil && !opts.EnableExperimentalFeatures {
 		logger.Error("Your configuration file contains an option that is explicitly labeled as experimental feature")
 		logger.Error(stabilityError.Error())
@@ -127,345 +211,1793 @@ func main() {
 		os.Exit(1)
 	}
 
-	if cfg.Consul.Enable {
-		setupConsul(logger, &cfg, stopChan, &stopHandlers)
+	if opts.DryRun > 0 {
+		if err := dryRun(logger, &cfg, opts.DryRun, stopChan, &stopHandlers); err != nil {
+			logger.Fatal(err)
+		}
+		os.Exit(0)
 	}
 
-	for i := range cfg.Namespaces {
-		namespace := &cfg.Namespaces[i]
+	if opts.AutoRegister {
+		registrator, err := discovery.AutoDetect(&cfg)
+		if err != nil {
+			logger.Fatal(err)
+		}
 
-		nsMetrics := metrics.NewForNamespace(namespace)
-		gatherers = append(gatherers, nsMetrics.Gatherer())
+		if registrator != nil {
+			setupRegistration(logger, registrator, stopChan, &stopHandlers)
+		} else {
+			logger.Info("no service discovery backend detected; skipping registration")
+		}
+	} else if cfg.Consul.Enable {
+		registrator, err := discovery.NewConsulRegistrator(&cfg)
+		if err != nil {
+			logger.Fatal(err)
+		}
 
-		logger.Infof("starting listener for namespace %s", namespace.Name)
-		go func(ns *config.NamespaceConfig) {
-			processNamespace(logger, ns, &(nsMetrics.Collection), stopChan, &stopHandlers)
-		}(namespace)
+		setupRegistration(logger, registrator, stopChan, &stopHandlers)
 	}
 
-	listenAddr := fmt.Sprintf("%s:%d", cfg.Listen.Address, cfg.Listen.Port)
-	endpoint := cfg.Listen.MetricsEndpointOrDefault()
-
-	logger.Infof("running HTTP server on address %s, serving metrics at %s", listenAddr, endpoint)
-
-	nsHandler := promhttp.InstrumentMetricHandler(
-		prometheus.DefaultRegisterer,
-		promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}),
-	)
-
-	http.Handle(endpoint, nsHandler)
-
-	logger.Fatal(http.ListenAndServe(listenAddr, nil))
-}
+	pushInterval, err := cfg.PushGatewayIntervalOrDefault()
+	if err != nil {
+		logger.Fatalf("invalid Pushgateway push interval: %s", err.Error())
+	}
 
-func loadConfig(logger *log.Logger, opts *config.StartupFlags, cfg *config.Config) {
-	if opts.ConfigFile != "" {
-		logger.Infof("loading configuration file %s", opts.ConfigFile)
-		if err := config.LoadConfigFromFile(logger, cfg, opts.ConfigFile); err != nil {
+	oneShot := cfg.PushGatewayURL != "" && pushInterval == 0
+	if oneShot {
+		if err := cfg.OneShotSourceError(); err != nil {
 			logger.Fatal(err)
 		}
-	} else if err := config.LoadConfigFromFlags(cfg, opts); err != nil {
-		logger.Fatal(err)
 	}
 
-	if opts.VerifyConfig {
-		fmt.Printf("Configuration is valid")
-		os.Exit(0)
+	gatherers := &dynamicGatherers{static: prometheus.Gatherers{versionMetrics}}
+	namespaces := newNamespaceManager(logger, gatherers, stopChan, &stopHandlers)
+	namespaces.readToEOF = oneShot
+	namespaces.debugBufferSize = opts.DebugBufferSize
+
+	if len(cfg.EtcdEndpoints) > 0 {
+		setupEtcdDiscovery(logger, &cfg, namespaces, stopChan, &stopHandlers)
 	}
-}
 
-func setupConsul(logger *log.Logger, cfg *config.Config, stopChan <-chan bool, stopHandlers *sync.WaitGroup) {
-	registrator, err := discovery.NewConsulRegistrator(cfg)
-	if err != nil {
-		logger.Fatal(err)
+	if cfg.Kubernetes != nil {
+		setupKubernetesDiscovery(logger, cfg.Kubernetes, namespaces, stopChan, &stopHandlers)
 	}
 
-	logger.Info("registering service in Consul")
-	if err = registrator.RegisterConsul(); err != nil {
+	if err := namespaces.apply(&cfg); err != nil {
 		logger.Fatal(err)
 	}
 
-	go func() {
-		<-stopChan
-		logger.Info("unregistering service in Consul")
-
-		if err := registrator.UnregisterConsul(); err != nil {
-			logger.Errorf("error while unregistering from consul: %s", err.Error())
-		}
-
-		stopHandlers.Done()
-	}()
-
-	stopHandlers.Add(1)
-}
-
-func processNamespace(logger *log.Logger, nsCfg *config.NamespaceConfig, metrics *metrics.Collection, stopChan <-chan bool, stopHandlers *sync.WaitGroup) error {
-	var followers []tail.Follower
-
-	logParser := parser.NewParser(nsCfg)
+	if oneShot {
+		namespaces.wait()
 
-	for _, f := range nsCfg.SourceData.Files {
-		t, err := tail.NewFileFollower(logger, f)
-		if err != nil {
+		logger.Infof("pushing metrics to Pushgateway at %s", cfg.PushGatewayURL)
+		if err := push.NewPushGatewayPusher(cfg.PushGatewayURL, gatherers).Push(); err != nil {
 			logger.Fatal(err)
 		}
 
-		t.OnError(func(err error) {
-			logger.Fatal(err)
-		})
+		return
+	}
 
-		followers = append(followers, t)
+	if cfg.PushGatewayURL != "" {
+		setupPushGateway(logger, &cfg, pushInterval, gatherers, stopChan, &stopHandlers)
 	}
 
-	if nsCfg.SourceData.Syslog != nil {
-		slCfg := nsCfg.SourceData.Syslog
+	if cfg.OTLPEndpoint != "" {
+		setupOTLP(logger, &cfg, gatherers, stopChan, &stopHandlers)
+	}
 
-		logger.Infof("running Syslog server on address %s", slCfg.ListenAddress)
-		channel, server, closeServer, err := syslog.Listen(slCfg.ListenAddress, slCfg.Format)
-		if err != nil {
-			panic(err)
-		}
+	if opts.ConfigFile != "" {
+		setupReload(logger, &opts, namespaces)
+	}
 
-		stopHandlers.Add(1)
+	if cfg.VictoriaMetrics.PushURL != "" {
+		setupVictoriaMetrics(logger, &cfg, gatherers, stopChan, &stopHandlers)
+	}
 
-		go func() {
-			<-stopChan
+	if cfg.RemoteWrite != nil {
+		setupRemoteWrite(logger, cfg.RemoteWrite, gatherers, stopChan, &stopHandlers)
+	}
 
-			if err := closeServer(); err != nil {
-				fmt.Printf("error while closing syslog server: %s\n", err.Error())
-			}
+	listenAddr := fmt.Sprintf("%s:%d", cfg.Listen.Address, cfg.Listen.Port)
+	endpoint := cfg.Listen.MetricsEndpointOrDefault()
 
-			stopHandlers.Done()
-		}()
+	tlsConfig, err := cfg.Listen.TLS.ServerTLSConfig()
+	if err != nil {
+		logger.Fatal(err)
+	}
 
-		for _, f := range slCfg.Tags {
-			t, err := tail.NewSyslogFollower(f, server, channel)
-			if err != nil {
-				logger.Fatal(err)
-			}
+	if tlsConfig != nil {
+		logger.Infof("running HTTPS server on address %s, serving metrics at %s", listenAddr, endpoint)
+	} else {
+		logger.Infof("running HTTP server on address %s, serving metrics at %s", listenAddr, endpoint)
+	}
 
-			t.OnError(func(err error) {
-				logger.Fatal(err)
-			})
+	var nsHandler http.Handler = promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		namespaces.scrapeHandler(promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{})),
+	)
 
-			followers = append(followers, t)
+	// the label values and raw log lines reveal as much as the metrics, so
+	// they are protected in the same way
+	protect := func(handler http.Handler) http.Handler {
+		if b := cfg.Listen.BasicAuth; b != nil {
+			return auth.BasicAuth(handler, b.Username, b.PasswordHash)
 		}
+		return handler
 	}
 
-	// determine once if there are any relabeling configurations for only the response counter
-	hasCounterOnlyLabels := false
-	for _, r := range nsCfg.RelabelConfigs {
-		if r.OnlyCounter {
-			hasCounterOnlyLabels = true
-			break
+	if b := cfg.Listen.BasicAuth; b != nil {
+		if err := b.Validate(); err != nil {
+			logger.Fatal(err)
 		}
 	}
 
-	errs := make(chan error)
-	defer close(errs)
+	http.Handle(endpoint, protect(nsHandler))
+	http.Handle(labelsAPIPrefix, protect(metrics.LabelsHandler(labelsAPIPrefix)))
 
-	for _, follower := range followers {
-		go func(f tail.Follower) {
-			if err := processSource(logger, nsCfg, f, logParser, metrics, hasCounterOnlyLabels); err != nil {
-				errs <- err
-			}
-		}(follower)
+	if opts.DebugBufferSize > 0 {
+		http.Handle(recentLinesEndpoint, protect(metrics.RecentLinesHandler()))
 	}
+	http.HandleFunc(cfg.Listen.LivenessEndpointOrDefault(), liveness)
+	http.Handle(cfg.Listen.ReadinessEndpointOrDefault(), namespaces.readiness)
 
-	return <-errs
+	handler := namespaceEndpointsHandler(cfg.Listen.BasicAuth, gatherers, namespaces, http.DefaultServeMux)
+
+	if tlsConfig != nil {
+		server := &http.Server{Addr: listenAddr, TLSConfig: tlsConfig, Handler: handler}
+		logger.Fatal(server.ListenAndServeTLS("", ""))
+	}
+
+	logger.Fatal(http.ListenAndServe(listenAddr, handler))
 }
 
-type UsersUpdated struct {
-	users map[string]int64
-	mu   sync.Mutex
+// namespaceEndpointsHandler serves the metrics of namespaces that have their
+// own metrics_endpoint and passes all other requests on to next. Since these
+// endpoints may change when the configuration is reloaded, they are looked up
+// for each request instead of being registered at the ServeMux.
+func namespaceEndpointsHandler(basicAuth *config.BasicAuthConfig, gatherers *dynamicGatherers, namespaces *namespaceManager, next http.Handler) http.Handler {
+	var nsHandler http.Handler = namespaces.scrapeHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gatherer, _ := gatherers.endpoint(r.URL.Path)
+		promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}))
+
+	if basicAuth != nil {
+		nsHandler = auth.BasicAuth(nsHandler, basicAuth.Username, basicAuth.PasswordHash)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := gatherers.endpoint(r.URL.Path); ok {
+			nsHandler.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
 }
 
-func processSource(logger *log.Logger, nsCfg *config.NamespaceConfig, t tail.Follower, parser parser.Parser, metrics *metrics.Collection, hasCounterOnlyLabels bool) error {
-	relabelings := relabeling.NewRelabelings(nsCfg.RelabelConfigs)
-	relabelings = append(relabelings, relabeling.DefaultRelabelings...)
-	relabelings = relabeling.UniqueRelabelings(relabelings)
-	relabelings = relabeling.StripExcluded(relabelings)
+const labelsAPIPrefix = "/api/v1/namespaces/"
 
-	staticLabelValues := nsCfg.OrderedLabelValues
+// recentLinesEndpoint serves the most recent raw log lines of a namespace
+// (with -debug-buffer-size)
+const recentLinesEndpoint = "/debug/recent-lines"
 
-	totalLabelCount := len(staticLabelValues) + len(relabelings)
-	relabelLabelOffset := len(staticLabelValues)
+// labelsPasswordEnv is the environment variable that printLabels reads the
+// basic auth password from; without it, the password is read from stdin
+const labelsPasswordEnv = "NGINXLOG_EXPORTER_PASSWORD"
 
-	if totalLabelCount > maxStaticLabels {
-		return errors.Errorf("configured label count exceeds the maximum count of %d", maxStaticLabels)
+// printLabels queries the label value combinations of a namespace from an
+// exporter running with the same configuration and prints them as a table
+func printLabels(cfg *config.Config, namespace string) error {
+	host := cfg.Listen.Address
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
 	}
 
-	labelValues := make([]string, totalLabelCount)
+	u := url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(host, strconv.Itoa(cfg.Listen.Port)),
+		Path:   labelsAPIPrefix + namespace + "/labels",
+	}
 
-	copy(labelValues, staticLabelValues)
+	client := http.DefaultClient
+	if cfg.Listen.TLS != nil && cfg.Listen.TLS.CertFile != "" {
+		// the exporter's certificate is usually not issued for the loopback
+		// address that is connected to here
+		u.Scheme = "https"
+		client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	}
 
-	usersUpdated := UsersUpdated{
-		users: make(map[string]int64),
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
 	}
-	var ticker *time.Ticker
 
-	for line := range t.Lines() {
-		if nsCfg.PrintLog {
-			fmt.Println(line)
+	if b := cfg.Listen.BasicAuth; b != nil {
+		password, ok := os.LookupEnv(labelsPasswordEnv)
+		if !ok {
+			if password, err = readPassword(); err != nil {
+				return err
+			}
 		}
 
-		fields, err := parser.ParseString(line)
-		if err != nil {
-			logger.Errorf("error while parsing line '%s': %s", line, err)
-			metrics.ParseErrorsTotal.Inc()
-			continue
-		}
-		fields = filterFields(fields, nsCfg)
+		req.SetBasicAuth(b.Username, password)
+	}
 
-		for i := range relabelings {
-			if str, ok := fields[relabelings[i].SourceValue]; ok {
-				mapped, err := relabelings[i].Map(str)
-				if err == nil {
-					labelValues[i+relabelLabelOffset] = mapped
-				}
-			}
-		}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not connect to running exporter: %w", err)
+	}
+	defer resp.Body.Close()
 
-		var notCounterValues []string
-		if hasCounterOnlyLabels {
-			notCounterValues = relabeling.StripOnlyCounterValues(labelValues, relabelings)
-		} else {
-			notCounterValues = labelValues
-		}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected response from %s: %s %s", u.String(), resp.Status, strings.TrimSpace(string(body)))
+	}
 
-		if nsCfg.MetricsConfig.DisableCountTotal != true {
-			metrics.CountTotal.WithLabelValues(labelValues...).Inc()
-		}
+	var combinations []metrics.LabelCombination
+	if err := json.NewDecoder(resp.Body).Decode(&combinations); err != nil {
+		return err
+	}
 
-		if nsCfg.MetricsConfig.CurrentUserInterval > 0 {
-			if v, ok := observeCurrentUsers(fields, &usersUpdated, metrics.ParseErrorsTotal); ok {
-				metrics.CurrentUsers.WithLabelValues(notCounterValues...).Set(v)
-			}
-			if ticker == nil {
-				ticker = time.NewTicker(15 * time.Second)
-				defer ticker.Stop()
-				go func() {
-					for {
-						<-ticker.C
-						usersUpdated.mu.Lock()
-						for user, lastSeen := range usersUpdated.users {
-							if time.Now().Unix()-lastSeen > int64(nsCfg.MetricsConfig.CurrentUserInterval) {
-								delete(usersUpdated.users, user)
-							}
-						}
-						usersUpdated.mu.Unlock()
-						metrics.CurrentUsers.WithLabelValues(notCounterValues...).Set(float64(len(usersUpdated.users)))
-					}
-				}()
-			}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "LABELS\tMETRICS")
+	for _, c := range combinations {
+		pairs := make([]string, 0, len(c.Labels))
+		for name, value := range c.Labels {
+			pairs = append(pairs, name+"="+strconv.Quote(value))
 		}
+		sort.Strings(pairs)
 
-		if v, ok := observeMetrics(logger, fields, "body_bytes_sent", floatFromFields, metrics.ParseErrorsTotal); ok {
-			metrics.ResponseBytesTotal.WithLabelValues(notCounterValues...).Add(v)
-		}
+		fmt.Fprintf(w, "%s\t%d\n", strings.Join(pairs, ","), c.Metrics)
+	}
 
-		if v, ok := observeMetrics(logger, fields, "request_length", floatFromFields, metrics.ParseErrorsTotal); ok {
-			metrics.RequestBytesTotal.WithLabelValues(notCounterValues...).Add(v)
-		}
+	return w.Flush()
+}
 
-		if v, ok := observeMetrics(logger, fields, "upstream_response_time", floatFromFieldsMulti, metrics.ParseErrorsTotal); ok {
-			metrics.UpstreamSeconds.WithLabelValues(notCounterValues...).Observe(v)
-			metrics.UpstreamSecondsHist.WithLabelValues(notCounterValues...).Observe(v)
+// dryRun reads up to lines log lines from the sources of each namespace and
+// processes them as usual, but instead of exporting metrics, it prints the
+// label value combinations that the lines produced as a table
+func dryRun(logger *log.Logger, cfg *config.Config, lines int, stopChan <-chan bool, stopHandlers *sync.WaitGroup) error {
+	namespaces := newNamespaceManager(logger, &dynamicGatherers{}, stopChan, stopHandlers)
+	namespaces.readToEOF = true
+	namespaces.lineLimit = lines
+	namespaces.dryRun = true
+
+	if err := namespaces.apply(cfg); err != nil {
+		return err
+	}
+
+	namespaces.wait()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for i, ns := range cfg.Namespaces {
+		namespaces.mu.Lock()
+		r := namespaces.running[ns.Name]
+		namespaces.mu.Unlock()
+
+		recorder := r.metrics.Collection.DryRun
+		combinations := recorder.Combinations()
+
+		counted := 0
+		for _, c := range combinations {
+			counted += c.Lines
 		}
 
-		if v, ok := observeMetrics(logger, fields, "upstream_connect_time", floatFromFieldsMulti, metrics.ParseErrorsTotal); ok {
-			metrics.UpstreamConnectSeconds.WithLabelValues(notCounterValues...).Observe(v)
-			metrics.UpstreamConnectSecondsHist.WithLabelValues(notCounterValues...).Observe(v)
+		if i > 0 {
+			fmt.Fprintln(w)
 		}
 
-		if v, ok := observeMetrics(logger, fields, "request_time", floatFromFields, metrics.ParseErrorsTotal); ok {
-			metrics.ResponseSeconds.WithLabelValues(notCounterValues...).Observe(v)
-			metrics.ResponseSecondsHist.WithLabelValues(notCounterValues...).Observe(v)
+		fmt.Fprintf(w, "namespace %s: %d lines read, %d lines counted\n", ns.Name, recorder.LinesRead(), counted)
+		fmt.Fprintln(w, "LABELS\tLINES")
+		for _, c := range combinations {
+			pairs := make([]string, 0, len(c.Labels))
+			for name, value := range c.Labels {
+				pairs = append(pairs, name+"="+strconv.Quote(value))
+			}
+			sort.Strings(pairs)
+
+			fmt.Fprintf(w, "%s\t%d\n", strings.Join(pairs, ","), c.Lines)
 		}
 	}
 
-	return nil
+	return w.Flush()
 }
 
-func filterFields(fields map[string]string, nsCfg *config.NamespaceConfig) map[string]string {
-	result := make(map[string]string)
-	for field, value := range fields {
-		disabled := false
-		switch field {
-		case "body_bytes_sent":
-			disabled = nsCfg.MetricsConfig.DisableResponseBytesTotal
-		case "request_length":
-			disabled = nsCfg.MetricsConfig.DisableRequestBytesTotal
-		case "upstream_response_time":
-			disabled = nsCfg.MetricsConfig.DisableUpstreamSeconds
-		case "upstream_connect_time":
-			disabled = nsCfg.MetricsConfig.DisableUpstreamConnectSeconds
-		case "request_time":
-			disabled = nsCfg.MetricsConfig.DisableResponseSeconds
-		}
-		if !disabled {
-			result[field] = value
+// hashPassword prints the bcrypt hash of a password, which is either passed
+// as argument or read from stdin (so that it does not end up in the shell's
+// history)
+func hashPassword(args []string) error {
+	var password string
+
+	switch len(args) {
+	case 0:
+		var err error
+		if password, err = readPassword(); err != nil {
+			return err
 		}
+	case 1:
+		password = args[0]
+	default:
+		return fmt.Errorf("usage: hash-password [<password>]")
 	}
-	return result
-}
 
-func observeCurrentUsers(fields map[string]string, usersUpdated *UsersUpdated, parseErrors prometheus.Counter) (float64, bool) {
-	remoteAddr, ok := fields["remote_addr"]
-	if !ok || remoteAddr == "" {
-		return 0, false
+	if password == "" {
+		return fmt.Errorf("password must not be empty")
 	}
-	userAgent, ok := fields["http_user_agent"]
-	if !ok || userAgent == "" {
-		return 0, false
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
 	}
-	userId := remoteAddr + "::" + userAgent
-	usersUpdated.mu.Lock()
-	defer usersUpdated.mu.Unlock()
-	usersUpdated.users[userId] = time.Now().Unix()
-	return float64(len(usersUpdated.users)), true
+
+	fmt.Println(hash)
+	return nil
 }
 
-func observeMetrics(logger *log.Logger, fields map[string]string, name string, extractor func(map[string]string, string) (float64, bool, error), parseErrors prometheus.Counter) (float64, bool) {
-	if observation, ok, err := extractor(fields, name); ok {
-		return observation, true
-	} else if err != nil {
-		logger.Errorf("error while parsing $%s: %v", name, err)
-		parseErrors.Inc()
+// readPassword reads a password from the first line of stdin
+func readPassword() (string, error) {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
 	}
 
-	return 0, false
+	return strings.TrimRight(line, "\r\n"), nil
 }
 
-func floatFromFieldsMulti(fields map[string]string, name string) (float64, bool, error) {
-	f, ok, err := floatFromFields(fields, name)
-	if err == nil {
-		return f, ok, nil
+func migrateConfig(opts *config.StartupFlags, args []string) error {
+	formats := map[string]config.FileFormat{"hcl": config.TypeHCL, "yaml": config.TypeYAML}
+
+	from, ok := formats[opts.MigrateFrom]
+	if !ok {
+		return fmt.Errorf("unsupported config format '%s'", opts.MigrateFrom)
 	}
 
-	val, ok := fields[name]
+	to, ok := formats[opts.MigrateTo]
 	if !ok {
-		return 0, false, nil
+		return fmt.Errorf("unsupported config format '%s'", opts.MigrateTo)
 	}
 
-	sum := float64(0)
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: -migrate-config -from=hcl -to=yaml <input-file> [<output-file>]")
+	}
 
-	for _, v := range strings.FieldsFunc(val, func(r rune) bool { return r == ',' || r == ':' }) {
-		v = strings.TrimSpace(v)
+	in, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer in.Close()
 
-		if v == "-" {
-			continue
+	out := os.Stdout
+	if len(args) == 2 {
+		out, err = os.Create(args[1])
+		if err != nil {
+			return err
 		}
+		defer out.Close()
+	}
 
-		f, err := strconv.ParseFloat(v, 64)
+	return config.MigrateConfig(in, from, out, to)
+}
+
+func loadConfig(logger *log.Logger, opts *config.StartupFlags, cfg *config.Config) {
+	if opts.NginxConfig != "" {
+		formats, err := nginxconfig.LogFormats(opts.NginxConfig)
 		if err != nil {
-			return 0, false, fmt.Errorf("value '%s' could not be parsed into float", val)
+			logger.Fatalf("error while reading NGINX configuration: %s", err)
 		}
 
-		sum += f
+		format, ok := formats[opts.NginxLogFormatName]
+		if !ok {
+			logger.Fatalf("log format '%s' is not defined in NGINX configuration %s", opts.NginxLogFormatName, opts.NginxConfig)
+		}
+
+		logger.Infof("using log format '%s' from NGINX configuration %s", opts.NginxLogFormatName, opts.NginxConfig)
+		opts.Format = format
+	}
+
+	if opts.ConfigFile != "" {
+		logger.Infof("loading configuration file %s", opts.ConfigFile)
+		if err := config.LoadConfigFromFile(logger, cfg, opts.ConfigFile, !opts.NoEnvExpand); err != nil {
+			logger.Fatal(err)
+		}
+	} else if err := config.LoadConfigFromFlags(cfg, opts); err != nil {
+		logger.Fatal(err)
+	}
+
+	applyNginxFormat(cfg, opts)
+
+	if opts.PushGatewayURL != "" {
+		cfg.PushGatewayURL = opts.PushGatewayURL
+	}
+
+	if opts.PushInterval != "" {
+		cfg.PushGatewayInterval = opts.PushInterval
+	}
+
+	if opts.OTLPEndpoint != "" {
+		cfg.OTLPEndpoint = opts.OTLPEndpoint
+	}
+
+	if opts.OTLPProtocol != "" {
+		cfg.OTLPProtocol = opts.OTLPProtocol
+	}
+
+	if opts.VerifyConfig {
+		for i := range cfg.Namespaces {
+			if notice := cfg.Namespaces[i].SamplingNotice(); notice != "" {
+				fmt.Println("Note: " + notice)
+			}
+		}
+
+		fmt.Printf("Configuration is valid")
+		os.Exit(0)
+	}
+
+	if opts.ValidateConfig {
+		errs := cfg.ValidationErrors()
+		for _, err := range errs {
+			fmt.Println(err)
+		}
+
+		if len(errs) > 0 {
+			fmt.Printf("Configuration is invalid (%d problems)\n", len(errs))
+			os.Exit(2)
+		}
+
+		fmt.Println("Configuration is valid")
+		os.Exit(0)
+	}
+}
+
+// applyNginxFormat uses the log format read from the NGINX configuration for
+// all namespaces that do not define their own format
+func applyNginxFormat(cfg *config.Config, opts *config.StartupFlags) {
+	if opts.NginxConfig == "" {
+		return
+	}
+
+	for i := range cfg.Namespaces {
+		if cfg.Namespaces[i].Format == "" {
+			cfg.Namespaces[i].Format = opts.Format
+		}
+	}
+}
+
+// setupReload reloads the configuration file when the exporter receives a
+// SIGHUP. Only the namespaces (and namespace groups) are reloaded; other
+// settings (like the listen address) require a restart.
+func setupReload(logger *log.Logger, opts *config.StartupFlags, namespaces *namespaceManager) {
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+
+	go func() {
+		for range hupChan {
+			logger.Infof("caught SIGHUP. reloading configuration file %s", opts.ConfigFile)
+
+			cfg := config.Config{}
+			if err := config.LoadConfigFromFile(logger, &cfg, opts.ConfigFile, !opts.NoEnvExpand); err != nil {
+				logger.Errorf("error while reloading configuration file: %s", err.Error())
+				continue
+			}
+
+			applyNginxFormat(&cfg, opts)
+
+			if err := geoip.ReloadAll(); err != nil {
+				logger.Errorf("error while reloading GeoIP databases: %s", err.Error())
+			}
+
+			if err := errorlog.ReopenAll(); err != nil {
+				logger.Errorf("error while reopening parse error logs: %s", err.Error())
+			}
+
+			if err := namespaces.apply(&cfg); err != nil {
+				logger.Errorf("error while applying reloaded configuration: %s", err.Error())
+			}
+		}
+	}()
+}
+
+func setupRegistration(logger *log.Logger, registrator discovery.Registrator, stopChan <-chan bool, stopHandlers *sync.WaitGroup) {
+	logger.Infof("registering service in %s", registrator.Name())
+	if err := registrator.Register(); err != nil {
+		logger.Fatal(err)
+	}
+
+	go func() {
+		<-stopChan
+		logger.Infof("unregistering service in %s", registrator.Name())
+
+		if err := registrator.Unregister(); err != nil {
+			logger.Errorf("error while unregistering from %s: %s", registrator.Name(), err.Error())
+		}
+
+		stopHandlers.Done()
+	}()
+
+	stopHandlers.Add(1)
+}
+
+// setupEtcdDiscovery reads additional namespaces from etcd and updates them
+// whenever their keys in etcd change
+func setupEtcdDiscovery(logger *log.Logger, cfg *config.Config, namespaces *namespaceManager, stopChan <-chan bool, stopHandlers *sync.WaitGroup) {
+	d, err := discovery.NewEtcdNamespaceDiscovery(logger, cfg)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	discovered, err := d.Namespaces()
+	if err != nil {
+		logger.Fatalf("error while reading namespaces from etcd: %s", err.Error())
+	}
+
+	logger.Infof("read %d namespaces from etcd prefix %s", len(discovered), cfg.EtcdPrefixOrDefault())
+	if err := namespaces.setDiscovered("etcd", discovered); err != nil {
+		logger.Fatal(err)
+	}
+
+	go func() {
+		d.Watch(stopChan, func(discovered []config.NamespaceConfig) {
+			logger.Infof("namespaces in etcd changed; applying %d namespaces", len(discovered))
+
+			if err := namespaces.setDiscovered("etcd", discovered); err != nil {
+				logger.Errorf("error while applying namespaces from etcd: %s", err.Error())
+			}
+		}, func(err error) {
+			logger.Errorf("error while watching etcd: %s", err.Error())
+		})
+
+		stopHandlers.Done()
+	}()
+
+	stopHandlers.Add(1)
+}
+
+// setupKubernetesDiscovery discovers additional namespaces from the
+// annotations of Kubernetes pods and updates them whenever pods are added,
+// removed or re-annotated
+func setupKubernetesDiscovery(logger *log.Logger, cfg *config.KubernetesDiscoveryConfig, namespaces *namespaceManager, stopChan <-chan bool, stopHandlers *sync.WaitGroup) {
+	d, err := discovery.NewKubernetesNamespaceDiscovery(logger, cfg)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	discovered, err := d.Namespaces()
+	if err != nil {
+		logger.Fatalf("error while discovering namespaces from Kubernetes pods: %s", err.Error())
+	}
+
+	logger.Infof("discovered %d namespaces from Kubernetes pods", len(discovered))
+	if err := namespaces.setDiscovered("kubernetes", discovered); err != nil {
+		logger.Fatal(err)
+	}
+
+	go func() {
+		d.Watch(stopChan, func(discovered []config.NamespaceConfig) {
+			logger.Infof("Kubernetes pods changed; applying %d namespaces", len(discovered))
+
+			if err := namespaces.setDiscovered("kubernetes", discovered); err != nil {
+				logger.Errorf("error while applying namespaces from Kubernetes pods: %s", err.Error())
+			}
+		}, func(err error) {
+			logger.Errorf("error while watching Kubernetes pods: %s", err.Error())
+		})
+
+		stopHandlers.Done()
+	}()
+
+	stopHandlers.Add(1)
+}
+
+func setupVictoriaMetrics(logger *log.Logger, cfg *config.Config, gatherer prometheus.Gatherer, stopChan <-chan bool, stopHandlers *sync.WaitGroup) {
+	interval, err := cfg.VictoriaMetrics.PushIntervalOrDefault()
+	if err != nil {
+		logger.Fatalf("invalid VictoriaMetrics push interval: %s", err.Error())
+	}
+
+	pusher := push.NewVictoriaMetricsPusher(&cfg.VictoriaMetrics, gatherer)
+
+	logger.Infof("pushing metrics to VictoriaMetrics at %s every %s", cfg.VictoriaMetrics.PushURL, interval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := pusher.Push(); err != nil {
+					logger.Errorf("error while pushing metrics: %s", err.Error())
+				}
+			case <-stopChan:
+				logger.Info("pushing final metrics to VictoriaMetrics")
+
+				if err := pusher.Push(); err != nil {
+					logger.Errorf("error while pushing metrics: %s", err.Error())
+				}
+
+				stopHandlers.Done()
+				return
+			}
+		}
+	}()
+
+	stopHandlers.Add(1)
+}
+
+func setupRemoteWrite(logger *log.Logger, cfg *config.RemoteWriteConfig, gatherer prometheus.Gatherer, stopChan <-chan bool, stopHandlers *sync.WaitGroup) {
+	if err := cfg.Validate(); err != nil {
+		logger.Fatal(err)
+	}
+
+	// the interval has already been validated
+	interval, _ := cfg.FlushIntervalOrDefault()
+
+	pusher, err := push.NewRemoteWritePusher(cfg, gatherer)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Infof("sending metrics to remote-write endpoint at %s every %s", cfg.URL, interval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := pusher.Push(); err != nil {
+					logger.Errorf("error while sending metrics: %s", err.Error())
+				}
+			case <-stopChan:
+				logger.Info("sending final metrics to remote-write endpoint")
+
+				if err := pusher.Push(); err != nil {
+					logger.Errorf("error while sending metrics: %s", err.Error())
+				}
+
+				stopHandlers.Done()
+				return
+			}
+		}
+	}()
+
+	stopHandlers.Add(1)
+}
+
+func setupPushGateway(logger *log.Logger, cfg *config.Config, interval time.Duration, gatherer prometheus.Gatherer, stopChan <-chan bool, stopHandlers *sync.WaitGroup) {
+	pusher := push.NewPushGatewayPusher(cfg.PushGatewayURL, gatherer)
+
+	logger.Infof("pushing metrics to Pushgateway at %s every %s", cfg.PushGatewayURL, interval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := pusher.Push(); err != nil {
+					logger.Errorf("error while pushing metrics: %s", err.Error())
+				}
+			case <-stopChan:
+				logger.Info("pushing final metrics to Pushgateway")
+
+				if err := pusher.Push(); err != nil {
+					logger.Errorf("error while pushing metrics: %s", err.Error())
+				}
+
+				stopHandlers.Done()
+				return
+			}
+		}
+	}()
+
+	stopHandlers.Add(1)
+}
+
+func setupOTLP(logger *log.Logger, cfg *config.Config, gatherer prometheus.Gatherer, stopChan <-chan bool, stopHandlers *sync.WaitGroup) {
+	exporter, err := push.NewOTLPExporter(context.Background(), cfg, gatherer)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	protocol, _ := cfg.OTLPProtocolOrDefault()
+	logger.Infof("exporting metrics to OTLP receiver at %s via %s", cfg.OTLPEndpoint, protocol)
+
+	go func() {
+		<-stopChan
+
+		logger.Info("exporting final metrics to OTLP receiver")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := exporter.Shutdown(ctx); err != nil {
+			logger.Errorf("error while exporting metrics: %s", err.Error())
+		}
+
+		stopHandlers.Done()
+	}()
+
+	stopHandlers.Add(1)
+}
+
+// processNamespace processes all log sources of a namespace until stopChan is
+// closed. With readToEOF, log files are read once instead of being followed,
+// and processNamespace returns once all sources reached their end. With a
+// lineLimit, all sources are stopped once that many lines have been read.
+// If the sources cannot be started, the ones that were already started are
+// stopped and an error is returned, so that a reload with a broken namespace
+// does not stop the exporter.
+func processNamespace(logger *log.Logger, nsCfg *config.NamespaceConfig, metrics *metrics.Collection, parsed *atomic.Bool, readToEOF bool, lineLimit int, stopChan <-chan bool, stopHandlers *sync.WaitGroup) error {
+	// stop is closed when stopChan is closed or processNamespace returns, so
+	// that the sources that run until a channel is closed (like syslog) do not
+	// outlive a namespace that could not be started
+	stop := make(chan bool)
+	var stopOnce sync.Once
+	stopSources := func() {
+		stopOnce.Do(func() {
+			close(stop)
+		})
+	}
+	defer stopSources()
+
+	go func() {
+		select {
+		case <-stopChan:
+			stopSources()
+		case <-stop:
+		}
+	}()
+
+	var followers []tail.Follower
+
+	// until all followers are started, returning stops the ones that were
+	// already created
+	started := false
+	defer func() {
+		if !started {
+			for _, f := range followers {
+				_ = f.Stop()
+			}
+		}
+	}()
+
+	// fileLabels contains the value of the log_file label for each follower
+	var fileLabels []string
+
+	// fileFollowers contains the followers of the log files by file name, so
+	// that they can be stopped when a watched file is removed
+	fileFollowers := make(map[string]tail.Follower)
+
+	logParser := parser.NewParser(nsCfg)
+
+	// the files that the lines are processed with are opened before the
+	// followers are created, so that no follower is started in vain
+	var geo *geoip.Database
+	if nsCfg.GeoIP != nil {
+		var err error
+		if geo, err = geoip.Open(nsCfg.GeoIP.DatabasePath); err != nil {
+			return err
+		}
+	}
+
+	var errLog *errorlog.File
+	if nsCfg.ParseErrorLog != nil && nsCfg.ParseErrorLog.Enabled {
+		var err error
+		if errLog, err = errorlog.Open(nsCfg.ParseErrorLog.File); err != nil {
+			return err
+		}
+
+		// all sources have ended when processNamespace returns
+		defer errLog.Close()
+	}
+
+	var deadLetters *errorlog.Queue
+	if nsCfg.DeadLetterFile != "" {
+		f, err := errorlog.OpenRotating(nsCfg.DeadLetterFile, nsCfg.MaxDeadLetterFileSize())
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		deadLetters = errorlog.NewQueue(f, config.ParseErrorLogFormatJSON, errorlog.DefaultQueueSize, func(err error) {
+			logger.Errorf("error while writing to dead letter file of namespace %s: %s", nsCfg.Name, err)
+		})
+
+		// the queue writes its remaining records before the file is closed
+		defer deadLetters.Close()
+	}
+
+	for _, f := range nsCfg.SourceData.Files {
+		var t tail.Follower
+		var err error
+		if readToEOF {
+			t, err = tail.NewFileReaderFollower(f)
+		} else {
+			t, err = tail.NewFileFollower(logger, f, nsCfg.SourceData.CursorFile(f))
+		}
+		if err != nil {
+			return fmt.Errorf("could not follow file %s: %w", f, err)
+		}
+
+		if nsCfg.CompiledMultilineStartPattern != nil {
+			t = tail.NewMultilineFollower(t, nsCfg.CompiledMultilineStartPattern)
+		}
+
+		path := f
+		t.OnError(func(err error) {
+			logger.Errorf("error while following file %s: %s", path, err.Error())
+		})
+
+		followers = append(followers, t)
+		fileLabels = append(fileLabels, nsCfg.FileLabelValue(f))
+		fileFollowers[f] = t
+	}
+
+	if nsCfg.SourceData.Syslog != nil {
+		slCfg := nsCfg.SourceData.Syslog
+
+		logger.Infof("running Syslog server on address %s", slCfg.ListenAddress)
+
+		reconnectDelay, err := slCfg.ReconnectDelayOrDefault()
+		if err != nil {
+			return err
+		}
+
+		listen := func() (gosyslog.LogPartsChannel, *gosyslog.Server, func() error, error) {
+			return syslog.Listen(slCfg.ListenAddress, slCfg.Format, slCfg.MaxConnections)
+		}
+
+		onReconnect := func() {
+			logger.Warnf("syslog server on address %s stopped unexpectedly; restarting in %s", slCfg.ListenAddress, reconnectDelay)
+			syslog.SyslogReconnectsTotal.WithLabelValues(slCfg.ListenAddress).Inc()
+		}
+
+		syslogFollowers, err := tail.NewSyslogFollowers(slCfg.Tags, listen, reconnectDelay, onReconnect, stop, stopHandlers)
+		if err != nil {
+			return fmt.Errorf("could not run syslog server on address %s: %w", slCfg.ListenAddress, err)
+		}
+
+		for _, t := range syslogFollowers {
+			t.OnError(func(err error) {
+				logger.Errorf("error in syslog server on address %s: %s", slCfg.ListenAddress, err.Error())
+			})
+
+			followers = append(followers, t)
+			fileLabels = append(fileLabels, "")
+		}
+	}
+
+	if nsCfg.SourceData.Kafka != nil {
+		kCfg := nsCfg.SourceData.Kafka
+
+		logger.Infof("consuming Kafka topic %s as consumer group %s", kCfg.Topic, kCfg.GroupID)
+
+		fromEarliest, err := kCfg.ConsumeFromEarliest()
+		if err != nil {
+			return err
+		}
+
+		var tlsConfig *tls.Config
+		if kCfg.TLS != nil {
+			if tlsConfig, err = kCfg.TLS.TLSConfig(); err != nil {
+				return err
+			}
+		}
+
+		t, err := tail.NewKafkaFollower(kCfg.Brokers, kCfg.Topic, kCfg.GroupID, fromEarliest, tlsConfig, stop, stopHandlers)
+		if err != nil {
+			return fmt.Errorf("could not consume Kafka topic %s: %w", kCfg.Topic, err)
+		}
+
+		t.OnError(func(err error) {
+			logger.Errorf("error while consuming Kafka topic %s: %s", kCfg.Topic, err.Error())
+		})
+
+		followers = append(followers, t)
+		fileLabels = append(fileLabels, "")
+	}
+
+	if nsCfg.SourceData.HTTP != nil {
+		hCfg := nsCfg.SourceData.HTTP
+
+		pollInterval, err := hCfg.PollIntervalOrDefault()
+		if err != nil {
+			return err
+		}
+
+		logger.Infof("polling log lines from %s every %s", hCfg.URL, pollInterval)
+
+		t := tail.NewHTTPFollower(hCfg.URL, hCfg.BearerToken, hCfg.TLSSkipVerify, pollInterval, stop)
+		t.OnError(func(err error) {
+			logger.Errorf("error while polling log lines from %s: %s", hCfg.URL, err.Error())
+		})
+
+		followers = append(followers, t)
+		fileLabels = append(fileLabels, "")
+	}
+
+	if nsCfg.SourceData.Journal != nil {
+		jCfg := nsCfg.SourceData.Journal
+
+		logger.Infof("reading journal messages of unit %s", jCfg.Unit)
+
+		t, err := tail.NewJournalFollower(jCfg.Unit, jCfg.CursorFile, stop)
+		if err != nil {
+			return fmt.Errorf("could not read journal messages of unit %s: %w", jCfg.Unit, err)
+		}
+
+		t.OnError(func(err error) {
+			logger.Errorf("error while reading journal messages of unit %s: %s", jCfg.Unit, err.Error())
+		})
+
+		followers = append(followers, t)
+		fileLabels = append(fileLabels, "")
+	}
+
+	if nsCfg.SourceData.Stdin {
+		logger.Infof("reading log lines of namespace %s from stdin", nsCfg.Name)
+
+		t := tail.NewStdinFollower(stop)
+		t.OnError(func(err error) {
+			logger.Errorf("error while reading from stdin: %s", err.Error())
+		})
+
+		followers = append(followers, t)
+		fileLabels = append(fileLabels, "")
+	}
+
+	// determine once if there are any relabeling configurations for only the response counter
+	hasCounterOnlyLabels := false
+	for _, r := range nsCfg.RelabelConfigs {
+		if r.OnlyCounter {
+			hasCounterOnlyLabels = true
+			break
+		}
+	}
+
+	var loki *push.LokiPusher
+	if nsCfg.Loki != nil {
+		logger.Infof("forwarding log lines of namespace %s to Loki at %s", nsCfg.Name, nsCfg.Loki.PushURL)
+
+		loki = push.NewLokiPusher(nsCfg.Loki)
+		loki.OnError(func(err error) {
+			logger.Errorf("error while forwarding log lines to Loki: %s", err.Error())
+		})
+		loki.OnPushFailed(func(lines int) {
+			metrics.LokiPushErrorsTotal.Inc()
+			metrics.LokiDroppedLinesTotal.Add(float64(lines))
+		})
+		loki.OnLinesDropped(func(lines int) {
+			metrics.LokiDroppedLinesTotal.Add(float64(lines))
+		})
+
+		stopHandlers.Add(1)
+		go loki.Run(stop, stopHandlers)
+	}
+
+	if notice := nsCfg.SamplingNotice(); notice != "" {
+		logger.Warn(notice)
+	}
+
+	// done is closed when all sources of the namespace have ended
+	done := make(chan struct{})
+	defer close(done)
+
+	if nsCfg.LabelExpirySeconds > 0 && len(metrics.CustomGauges) > 0 {
+		go func() {
+			expiryTicker := time.NewTicker(15 * time.Second)
+			defer expiryTicker.Stop()
+
+			for {
+				select {
+				case <-done:
+					return
+				case <-expiryTicker.C:
+				}
+
+				metrics.ScrapeGate.WaitForScrapes()
+				for _, g := range metrics.CustomGauges {
+					g.Expire(time.Duration(nsCfg.LabelExpirySeconds) * time.Second)
+				}
+			}
+		}()
+	}
+
+	errs := make(chan error, 1)
+	wg := sync.WaitGroup{}
+
+	// running contains the followers that are being processed; with
+	// watch_dir, followers are added and removed while the namespace runs
+	var runningMu sync.Mutex
+	running := make(map[tail.Follower]struct{})
+	stopping := false
+
+	var limit *tail.LineLimit
+	if lineLimit > 0 {
+		limit = tail.NewLineLimit(lineLimit)
+	}
+
+	startFollower := func(f tail.Follower, fileLabel string) {
+		runningMu.Lock()
+		defer runningMu.Unlock()
+
+		if stopping {
+			_ = f.Stop()
+			return
+		}
+
+		if limit != nil {
+			f = limit.Follow(f)
+		}
+
+		running[f] = struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := processSource(logger, nsCfg, f, fileLabel, logParser, metrics, parsed, hasCounterOnlyLabels, loki, geo, errLog, deadLetters); err != nil {
+				// all sources fail for the same reason; keep the first error
+				select {
+				case errs <- err:
+				default:
+				}
+			}
+
+			runningMu.Lock()
+			delete(running, f)
+			runningMu.Unlock()
+		}()
+	}
+
+	// the watcher is created before any source is processed, so that only
+	// the followers need to be stopped if this fails
+	var watcher *tail.GlobWatcher
+	if nsCfg.SourceData.WatchDir && len(nsCfg.FileGlobs) > 0 && !readToEOF {
+		var err error
+		if watcher, err = tail.NewGlobWatcher(nsCfg.FileGlobs); err != nil {
+			return fmt.Errorf("could not watch the log directories of namespace %s: %w", nsCfg.Name, err)
+		}
+	}
+
+	started = true
+	for i, follower := range followers {
+		startFollower(follower, fileLabels[i])
+	}
+
+	if watcher != nil {
+		watcher.OnError(func(err error) {
+			logger.Errorf("error while watching the log directories of namespace %s: %s", nsCfg.Name, err.Error())
+		})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer watcher.Close()
+
+			for {
+				select {
+				case <-stop:
+					return
+				case ev, ok := <-watcher.Events():
+					if !ok {
+						return
+					}
+
+					if ev.Removed {
+						if f, ok := fileFollowers[ev.Path]; ok {
+							logger.Infof("stopping to follow removed file %s", ev.Path)
+							delete(fileFollowers, ev.Path)
+							_ = f.Stop()
+						}
+						continue
+					}
+
+					if _, ok := fileFollowers[ev.Path]; ok {
+						continue
+					}
+
+					t, err := tail.NewCreatedFileFollower(logger, ev.Path, nsCfg.SourceData.CursorFile(ev.Path))
+					if err != nil {
+						logger.Errorf("error while following created file %s: %s", ev.Path, err.Error())
+						continue
+					}
+
+					if nsCfg.CompiledMultilineStartPattern != nil {
+						t = tail.NewMultilineFollower(t, nsCfg.CompiledMultilineStartPattern)
+					}
+
+					path := ev.Path
+					t.OnError(func(err error) {
+						logger.Errorf("error while following file %s: %s", path, err.Error())
+					})
+
+					logger.Infof("following created file %s", ev.Path)
+					fileFollowers[ev.Path] = t
+					startFollower(t, nsCfg.FileLabelValue(ev.Path))
+				}
+			}
+		}()
+	}
+
+	// stopping the followers closes their line channels, which ends processSource
+	go func() {
+		<-stop
+
+		runningMu.Lock()
+		stopping = true
+		toStop := make([]tail.Follower, 0, len(running))
+		for f := range running {
+			toStop = append(toStop, f)
+		}
+		runningMu.Unlock()
+
+		for _, f := range toStop {
+			if err := f.Stop(); err != nil {
+				logger.Errorf("error while stopping follower of namespace %s: %s", nsCfg.Name, err.Error())
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
+
+type UsersUpdated struct {
+	users map[string]int64
+	mu    sync.Mutex
+}
+
+// ConnectionsUpdated tracks when each NGINX connection (identified by the
+// $connection serial number) has last been seen
+type ConnectionsUpdated struct {
+	connections map[string]int64
+	mu          sync.Mutex
+}
+
+func processSource(logger *log.Logger, nsCfg *config.NamespaceConfig, t tail.Follower, fileLabel string, logParser parser.Parser, metrics *metrics.Collection, parsed *atomic.Bool, hasCounterOnlyLabels bool, loki *push.LokiPusher, geo *geoip.Database, errLog *errorlog.File, deadLetters *errorlog.Queue) error {
+	filters := relabeling.NewFilters(nsCfg.RelabelConfigs)
+
+	relabelings := relabeling.NewRelabelings(nsCfg.RelabelConfigs)
+	relabelings = append(relabelings, relabeling.NewRelabelings(nsCfg.GeoIP.RelabelConfigs())...)
+	relabelings = append(relabelings, relabeling.NewRelabelings(nsCfg.OptionalRelabelConfigs())...)
+	relabelings = append(relabelings, relabeling.DefaultRelabelings...)
+	relabelings = relabeling.UniqueRelabelings(relabelings)
+	relabelings = relabeling.StripExcluded(relabelings)
+
+	staticLabelValues := nsCfg.OrderedLabelValues
+	if nsCfg.InjectFileLabel {
+		// the log_file label is always the last of the static labels
+		staticLabelValues = append(append([]string{}, staticLabelValues[:len(staticLabelValues)-1]...), fileLabel)
+	}
+
+	totalLabelCount := len(staticLabelValues) + len(relabelings)
+	relabelLabelOffset := len(staticLabelValues)
+
+	if totalLabelCount > maxStaticLabels {
+		return errors.Errorf("configured label count exceeds the maximum count of %d", maxStaticLabels)
+	}
+
+	stripper := relabeling.NewStripper(relabelings)
+
+	// done is closed when the source has ended, which stops the goroutines
+	// that update the current users and connections
+	done := make(chan struct{})
+	defer close(done)
+
+	usersUpdated := UsersUpdated{
+		users: make(map[string]int64),
+	}
+	var tickerOnce sync.Once
+
+	connectionsUpdated := ConnectionsUpdated{
+		connections: make(map[string]int64),
+	}
+	var connectionsTickerOnce sync.Once
+	connectionWindow := int64(nsCfg.MetricsConfig.ConnectionWindowSecondsOrDefault())
+
+	// the stream module logs the transferred bytes in different variables
+	responseBytesField, requestBytesField := "body_bytes_sent", "request_length"
+	if nsCfg.StreamMode {
+		responseBytesField, requestBytesField = "bytes_sent", "bytes_received"
+	}
+
+	// the timezone has already been validated when compiling the config
+	timestampLocation, _ := nsCfg.TimestampLocation()
+	timestampFormat := nsCfg.MetricsConfig.TimestampFormatOrDefault()
+
+	// a $time_local value that does not match the timestamp format usually
+	// means that all lines use another format, so this is only logged once;
+	// the lines themselves were parsed and counted
+	var timestampWarning sync.Once
+
+	upstreamAggregation := nsCfg.MetricsConfig.UpstreamResponseTimeAggregationOrDefault()
+	upstreamResponseTime := func(fields map[string]string, name string) (float64, bool, error) {
+		return floatFromFieldsMultiAgg(fields, name, upstreamAggregation)
+	}
+	upstreamTimeAggregation := nsCfg.MetricsConfig.UpstreamTimeAggregation()
+	upstreamTime := func(fields map[string]string, name string) (float64, bool, error) {
+		return floatFromFieldsMultiAgg(fields, name, upstreamTimeAggregation)
+	}
+	upstreamSum := func(fields map[string]string, name string) (float64, bool, error) {
+		return floatFromFieldsMultiAgg(fields, name, "sum")
+	}
+
+	// when sampling, counters are scaled by the inverse sample rate to
+	// compensate for the skipped lines
+	sampleRate := nsCfg.SampleRateOrDefault()
+	counterScale := 1 / sampleRate
+
+	// processLines processes the lines of the source in a single worker; the
+	// state that is modified for every line is local to the worker
+	processLines := func(lines chan string, seed int64) {
+		labelValues := make([]string, totalLabelCount)
+		copy(labelValues, staticLabelValues)
+		strippedLabelValues := make([]string, 0, totalLabelCount)
+
+		var sampler *rand.Rand
+		if sampleRate < 1 {
+			sampler = rand.New(rand.NewSource(seed))
+		}
+
+		// with a batch flush interval, counter increments and observations are
+		// collected and applied at that interval
+		batch := metrics.NewBatch()
+
+		addCounter := func(vec *prometheus.CounterVec, labelValues []string, v float64) {
+			if batch != nil {
+				batch.Add(vec, labelValues, v)
+				return
+			}
+
+			vec.WithLabelValues(labelValues...).Add(v)
+		}
+
+		observe := func(vec prometheus.ObserverVec, labelValues []string, v float64) {
+			if batch != nil {
+				batch.Observe(vec, labelValues, v)
+				return
+			}
+
+			vec.WithLabelValues(labelValues...).Observe(v)
+		}
+
+		// processLine handles a single log line; a panic while doing so must not
+		// stop the processing of the following lines
+		processLine := func(line string) {
+			if metrics.RecentLines != nil {
+				metrics.RecentLines.Add(line)
+			}
+
+			if metrics.DryRun != nil {
+				metrics.DryRun.Read()
+			}
+
+			if sampler != nil && sampler.Float64() >= sampleRate {
+				return
+			}
+
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Errorf("recovered from panic while processing line '%s': %v", line, r)
+					metrics.PanicsRecoveredTotal.Inc()
+				}
+			}()
+
+			if nsCfg.PrintLog {
+				fmt.Println(line)
+			}
+
+			fields, err := logParser.ParseString(line)
+			if metrics.ParseErrorRate != nil {
+				metrics.ParseErrorRate.Observe(err != nil)
+			}
+
+			if err != nil {
+				metrics.ParseErrorsTotal.Inc()
+
+				if deadLetters != nil {
+					record := errorlog.Record{Timestamp: time.Now(), Namespace: nsCfg.Name, RawLine: line, Error: err.Error()}
+					if !deadLetters.Enqueue(record) {
+						logger.Warnf("dead letter queue of namespace %s is full; dropping line '%s'", nsCfg.Name, line)
+					}
+					return
+				}
+
+				if errLog == nil {
+					logger.Errorf("error while parsing line '%s': %s", line, err)
+					return
+				}
+
+				record := errorlog.Record{Timestamp: time.Now(), Namespace: nsCfg.Name, RawLine: line, Error: err.Error()}
+				if err := errLog.Write(record, nsCfg.ParseErrorLog.FormatOrDefault()); err != nil {
+					logger.Errorf("error while writing to parse error log: %s", err)
+				}
+				return
+			}
+			fields = filterFields(fields, nsCfg)
+
+			if nsCfg.DecomposeRequest {
+				parser.DecomposeRequest(fields)
+			}
+
+			if !parsed.Load() {
+				parsed.Store(true)
+			}
+
+			if !relabeling.KeepLine(filters, fields) {
+				return
+			}
+
+			if loki != nil {
+				loki.Enqueue(fields)
+			}
+
+			if geo != nil {
+				geo.Enrich(fields, nsCfg.GeoIP.Labels)
+			}
+
+			for i := range relabelings {
+				if str, ok := fields[relabelings[i].SourceValue]; ok {
+					mapped, err := relabelings[i].Map(str)
+					if err == relabeling.ErrSkipLine {
+						return
+					}
+					if err == nil {
+						labelValues[i+relabelLabelOffset] = mapped
+					}
+				}
+			}
+
+			if metrics.LabelLimiter != nil {
+				if limited, first := metrics.LabelLimiter.Limit(labelValues); limited && first {
+					logger.Warnf("namespace %s exceeded max_label_combinations (%d); the dynamic labels of further label combinations are replaced", nsCfg.Name, nsCfg.MetricsConfig.MaxLabelCombinations)
+				}
+			}
+
+			var notCounterValues []string
+			if hasCounterOnlyLabels {
+				notCounterValues = stripper.Strip(labelValues, strippedLabelValues)
+			} else {
+				notCounterValues = labelValues
+			}
+
+			histogramLabelValues := labelValuesPool.Get()
+			defer labelValuesPool.Put(histogramLabelValues)
+
+			histogramValues := metrics.AppendHistogramLabelValues(*histogramLabelValues, notCounterValues)
+
+			if metrics.DryRun != nil {
+				metrics.DryRun.Observe(labelValues)
+			}
+
+			if nsCfg.MetricsConfig.DisableCountTotal != true {
+				addCounter(metrics.CountTotal, labelValues, counterScale)
+			}
+
+			if metrics.StatusCodeCounters != nil {
+				metrics.StatusCodeCounters.Add(fields["status"], counterScale)
+			}
+
+			if metrics.CacheHitTotal != nil {
+				switch fields["upstream_cache_status"] {
+				case "HIT":
+					addCounter(metrics.CacheHitTotal, notCounterValues, counterScale)
+				case "MISS":
+					addCounter(metrics.CacheMissTotal, notCounterValues, counterScale)
+				}
+			}
+
+			if v, ok := fields["time_local"]; ok {
+				if ts, err := parseTimeLocal(v, timestampFormat, timestampLocation); err == nil {
+					metrics.LastLineTimestampSeconds.Set(float64(ts.Unix()))
+				} else {
+					timestampWarning.Do(func() {
+						logger.Warnf("could not parse $time_local value '%s' with timestamp format '%s' (%s); lines with such values do not update the last line timestamp", v, timestampFormat, err)
+					})
+				}
+			}
+
+			for _, g := range metrics.CustomGauges {
+				if err := g.Observe(fields); err != nil {
+					logger.Errorf("error while observing custom gauge: %s", err)
+					metrics.ParseErrorsTotal.Inc()
+				}
+			}
+
+			if nsCfg.MetricsConfig.CurrentUserInterval > 0 && !nsCfg.StreamMode {
+				if v, ok := observeCurrentUsers(fields, &usersUpdated, metrics.ParseErrorsTotal); ok {
+					metrics.CurrentUsers.WithLabelValues(notCounterValues...).Set(v)
+				}
+				tickerOnce.Do(func() {
+					// the label values belong to the buffers of the worker,
+					// which are reused for the next line
+					userLabelValues := append([]string{}, notCounterValues...)
+					go func() {
+						ticker := time.NewTicker(15 * time.Second)
+						defer ticker.Stop()
+
+						for {
+							select {
+							case <-done:
+								return
+							case <-ticker.C:
+							}
+
+							metrics.ScrapeGate.WaitForScrapes()
+							usersUpdated.mu.Lock()
+							for user, lastSeen := range usersUpdated.users {
+								if time.Now().Unix()-lastSeen > int64(nsCfg.MetricsConfig.CurrentUserInterval) {
+									delete(usersUpdated.users, user)
+								}
+							}
+							usersUpdated.mu.Unlock()
+							metrics.CurrentUsers.WithLabelValues(userLabelValues...).Set(float64(len(usersUpdated.users)))
+						}
+					}()
+				})
+			}
+
+			if nsCfg.MetricsConfig.TrackConnections {
+				if v, ok := observeConnections(fields, &connectionsUpdated); ok {
+					metrics.ConcurrentConnectionsGauge.WithLabelValues(notCounterValues...).Set(v)
+				}
+				connectionsTickerOnce.Do(func() {
+					connectionLabelValues := append([]string{}, notCounterValues...)
+					go func() {
+						ticker := time.NewTicker(15 * time.Second)
+						defer ticker.Stop()
+
+						for {
+							select {
+							case <-done:
+								return
+							case <-ticker.C:
+							}
+
+							metrics.ScrapeGate.WaitForScrapes()
+							connectionsUpdated.mu.Lock()
+							for connection, lastSeen := range connectionsUpdated.connections {
+								if time.Now().Unix()-lastSeen > connectionWindow {
+									delete(connectionsUpdated.connections, connection)
+								}
+							}
+							connectionsUpdated.mu.Unlock()
+							metrics.ConcurrentConnectionsGauge.WithLabelValues(connectionLabelValues...).Set(float64(len(connectionsUpdated.connections)))
+						}
+					}()
+				})
+			}
+
+			if v, ok := observeMetrics(logger, fields, responseBytesField, floatFromFields, metrics.ParseErrorsTotal); ok {
+				addCounter(metrics.ResponseBytesTotal, notCounterValues, v*counterScale)
+
+				if nsCfg.MetricsConfig.TrackResponseBytesPercentile {
+					p := metrics.ResponseBytesWindows.Observe(notCounterValues, v)
+					metrics.ResponseBytesP99.WithLabelValues(notCounterValues...).Set(p)
+				}
+
+				if nsCfg.MetricsConfig.TrackResponseSizeBuckets {
+					sizeLabelValues := labelValuesPool.Get()
+					*sizeLabelValues = append(append(*sizeLabelValues, notCounterValues...), metrics.ResponseSizeBuckets.Name(v))
+					addCounter(metrics.ResponseSizeBucket, *sizeLabelValues, counterScale)
+					labelValuesPool.Put(sizeLabelValues)
+				}
+			}
+
+			if v, ok := observeMetrics(logger, fields, requestBytesField, floatFromFields, metrics.ParseErrorsTotal); ok {
+				addCounter(metrics.RequestBytesTotal, notCounterValues, v*counterScale)
+
+				// $request_length includes the request body; if its length is
+				// logged separately, the size of the headers can be derived
+				if body, ok := observeMetrics(logger, fields, "request_body_length", floatFromFields, metrics.ParseErrorsTotal); ok {
+					if header := v - body; header >= 0 {
+						addCounter(metrics.RequestHeaderBytesTotal, notCounterValues, header*counterScale)
+					} else {
+						logger.Debugf("$request_body_length (%v) is larger than $%s (%v); check your log format", body, requestBytesField, v)
+					}
+				}
+			}
+
+			// like the upstream times, these contain one value per upstream that
+			// NGINX tried
+			if v, ok := observeMetrics(logger, fields, "upstream_bytes_sent", upstreamSum, metrics.ParseErrorsTotal); ok {
+				addCounter(metrics.UpstreamBytesSentTotal, notCounterValues, v*counterScale)
+			}
+
+			if v, ok := observeMetrics(logger, fields, "upstream_bytes_received", upstreamSum, metrics.ParseErrorsTotal); ok {
+				addCounter(metrics.UpstreamBytesReceivedTotal, notCounterValues, v*counterScale)
+			}
+
+			if v, ok := observeMetrics(logger, fields, "upstream_response_time", upstreamResponseTime, metrics.ParseErrorsTotal); ok {
+				observe(metrics.UpstreamSeconds, notCounterValues, v)
+				if metrics.UpstreamSecondsAdaptiveHist != nil {
+					metrics.UpstreamSecondsAdaptiveHist.Observe(histogramValues, v)
+				} else {
+					observe(metrics.UpstreamSecondsHist, histogramValues, v)
+				}
+			}
+
+			if v, ok := observeMetrics(logger, fields, "upstream_connect_time", upstreamTime, metrics.ParseErrorsTotal); ok {
+				observe(metrics.UpstreamConnectSeconds, notCounterValues, v)
+				observe(metrics.UpstreamConnectSecondsHist, histogramValues, v)
+			}
+
+			if v, ok := observeMetrics(logger, fields, "upstream_header_time", upstreamTime, metrics.ParseErrorsTotal); ok {
+				observe(metrics.UpstreamHeaderSeconds, notCounterValues, v)
+				observe(metrics.UpstreamHeaderSecondsHist, histogramValues, v)
+			}
+
+			// $ssl_handshake_time is "-" for plain HTTP requests, which are
+			// skipped by floatFromFields
+			if v, ok := observeMetrics(logger, fields, "ssl_handshake_time", floatFromFields, metrics.ParseErrorsTotal); ok {
+				observe(metrics.SSLHandshakeSeconds, notCounterValues, v)
+				observe(metrics.SSLHandshakeSecondsHist, histogramValues, v)
+			}
+
+			// $gzip_ratio is "-" for responses that were not compressed
+			if v, ok := observeMetrics(logger, fields, "gzip_ratio", floatFromFields, metrics.ParseErrorsTotal); ok {
+				observe(metrics.GzipRatio, histogramValues, v)
+				addCounter(metrics.GzipRatioSum, notCounterValues, v*counterScale)
+			}
+
+			if nsCfg.MetricsConfig.TrackUpstreamConnectByPeer {
+				observeUpstreamConnectByPeer(fields, histogramValues, metrics)
+			}
+
+			if v, ok := observeMetrics(logger, fields, "request_time", floatFromFields, metrics.ParseErrorsTotal); ok {
+				observe(metrics.ResponseSeconds, notCounterValues, v)
+				observe(metrics.ResponseSecondsHist, histogramValues, v)
+
+				if metrics.PathNormalizer != nil {
+					if path, ok := metrics.PathNormalizer.Normalize(fields["request"]); ok {
+						pathLabelValues := labelValuesPool.Get()
+						*pathLabelValues = append(append(*pathLabelValues, histogramValues...), path)
+						observe(metrics.PathResponseSecondsHist, *pathLabelValues, v)
+						labelValuesPool.Put(pathLabelValues)
+					}
+				}
+			}
+
+			if nsCfg.StreamMode {
+				if v, ok := observeMetrics(logger, fields, "session_time", floatFromFields, metrics.ParseErrorsTotal); ok {
+					observe(metrics.SessionSeconds, notCounterValues, v)
+					observe(metrics.SessionSecondsHist, histogramValues, v)
+				}
+			}
+		}
+
+		if batch == nil {
+			for line := range lines {
+				processLine(line)
+			}
+
+			return
+		}
+
+		flushTicker := time.NewTicker(metrics.BatchFlushInterval)
+		defer flushTicker.Stop()
+
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					batch.Flush()
+					return
+				}
+
+				processLine(line)
+			case <-flushTicker.C:
+				batch.Flush()
+			}
+		}
+	}
+
+	// the lines of a source can be processed by several workers in parallel;
+	// the order in which the metrics are updated does not matter
+	lines := t.Lines()
+	seed := time.Now().UnixNano()
+
+	var workers sync.WaitGroup
+	for i := 0; i < nsCfg.WorkerCountOrDefault(); i++ {
+		workers.Add(1)
+		go func(seed int64) {
+			defer workers.Done()
+			processLines(lines, seed)
+		}(seed + int64(i))
+	}
+	workers.Wait()
+
+	return nil
+}
+
+func filterFields(fields map[string]string, nsCfg *config.NamespaceConfig) map[string]string {
+	result := make(map[string]string)
+	for field, value := range fields {
+		disabled := false
+		switch field {
+		case "body_bytes_sent":
+			disabled = nsCfg.MetricsConfig.DisableResponseBytesTotal
+		case "request_length":
+			disabled = nsCfg.MetricsConfig.DisableRequestBytesTotal
+		case "bytes_sent":
+			disabled = nsCfg.StreamMode && nsCfg.MetricsConfig.DisableResponseBytesTotal
+		case "bytes_received":
+			disabled = nsCfg.StreamMode && nsCfg.MetricsConfig.DisableRequestBytesTotal
+		case "upstream_response_time":
+			disabled = nsCfg.MetricsConfig.DisableUpstreamSeconds
+		case "upstream_connect_time":
+			disabled = nsCfg.MetricsConfig.DisableUpstreamConnectSeconds
+		case "upstream_header_time":
+			disabled = nsCfg.MetricsConfig.DisableUpstreamHeaderSeconds
+		case "request_time":
+			disabled = nsCfg.MetricsConfig.DisableResponseSeconds
+		case "upstream_bytes_sent":
+			disabled = nsCfg.MetricsConfig.DisableUpstreamBytesSent
+		case "upstream_bytes_received":
+			disabled = nsCfg.MetricsConfig.DisableUpstreamBytesReceived
+		case "ssl_handshake_time":
+			disabled = nsCfg.MetricsConfig.DisableSSLHandshakeSeconds
+		case "gzip_ratio":
+			disabled = nsCfg.MetricsConfig.DisableGzipRatio
+		}
+		if !disabled {
+			result[field] = value
+		}
+	}
+	return result
+}
+
+// parseTimeLocal parses a $time_local value using the given layout. Values
+// that lack a UTC offset (because it was stripped from the log format or is
+// not part of the layout) are interpreted in loc.
+func parseTimeLocal(value string, layout string, loc *time.Location) (time.Time, error) {
+	ts, err := time.ParseInLocation(layout, value, loc)
+	if err != nil && layout == config.DefaultTimestampFormat {
+		return time.ParseInLocation("02/Jan/2006:15:04:05", value, loc)
+	}
+
+	return ts, err
+}
+
+// observeUpstreamConnectByPeer records the connect time of each upstream
+// server that NGINX tried for a request. When multiple servers were contacted,
+// $upstream_addr and $upstream_connect_time contain matching lists of values.
+func observeUpstreamConnectByPeer(fields map[string]string, labelValues []string, metrics *metrics.Collection) {
+	addrs := splitUpstreamValues(fields["upstream_addr"])
+	times := splitUpstreamValues(fields["upstream_connect_time"])
+
+	if len(addrs) == 0 || len(addrs) != len(times) {
+		return
+	}
+
+	for i, addr := range addrs {
+		if addr == "" || times[i] == "-" {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(times[i], 64)
+		if err != nil {
+			metrics.ParseErrorsTotal.Inc()
+			continue
+		}
+
+		peerLabelValues := append(append([]string{}, labelValues...), addr)
+		metrics.UpstreamConnectByPeerSeconds.WithLabelValues(peerLabelValues...).Observe(v)
+	}
+}
+
+// splitUpstreamValues splits an $upstream_* variable into its values; NGINX
+// separates the servers of one upstream group with ", " and the values of
+// different groups (after an internal redirect) with " : "
+func splitUpstreamValues(val string) []string {
+	if val == "" {
+		return nil
+	}
+
+	values := strings.Split(strings.ReplaceAll(val, " : ", ", "), ",")
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+
+	return values
+}
+
+func observeCurrentUsers(fields map[string]string, usersUpdated *UsersUpdated, parseErrors prometheus.Counter) (float64, bool) {
+	remoteAddr, ok := fields["remote_addr"]
+	if !ok || remoteAddr == "" {
+		return 0, false
+	}
+	userAgent, ok := fields["http_user_agent"]
+	if !ok || userAgent == "" {
+		return 0, false
+	}
+	userId := remoteAddr + "::" + userAgent
+	usersUpdated.mu.Lock()
+	defer usersUpdated.mu.Unlock()
+	usersUpdated.users[userId] = time.Now().Unix()
+	return float64(len(usersUpdated.users)), true
+}
+
+func observeConnections(fields map[string]string, connectionsUpdated *ConnectionsUpdated) (float64, bool) {
+	connection, ok := fields["connection"]
+	if !ok || connection == "" || connection == "-" {
+		return 0, false
+	}
+	connectionsUpdated.mu.Lock()
+	defer connectionsUpdated.mu.Unlock()
+	connectionsUpdated.connections[connection] = time.Now().Unix()
+	return float64(len(connectionsUpdated.connections)), true
+}
+
+func observeMetrics(logger *log.Logger, fields map[string]string, name string, extractor func(map[string]string, string) (float64, bool, error), parseErrors prometheus.Counter) (float64, bool) {
+	if observation, ok, err := extractor(fields, name); ok {
+		return observation, true
+	} else if err != nil {
+		logger.Errorf("error while parsing $%s: %v", name, err)
+		parseErrors.Inc()
+	}
+
+	return 0, false
+}
+
+// floatFromFieldsMultiAgg parses a field that may contain multiple
+// comma- or colon-separated values (like $upstream_response_time when NGINX
+// tried several upstreams) and aggregates them according to mode, which is
+// one of "sum", "max", "last" or "first". Values of "-" are skipped.
+func floatFromFieldsMultiAgg(fields map[string]string, name string, mode string) (float64, bool, error) {
+	f, ok, err := floatFromFields(fields, name)
+	if err == nil {
+		return f, ok, nil
+	}
+
+	val, ok := fields[name]
+	if !ok {
+		return 0, false, nil
+	}
+
+	result := float64(0)
+	count := 0
+
+	for _, v := range strings.FieldsFunc(val, func(r rune) bool { return r == ',' || r == ':' }) {
+		v = strings.TrimSpace(v)
+
+		if v == "-" {
+			continue
+		}
+
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("value '%s' could not be parsed into float", val)
+		}
+
+		switch mode {
+		case "max":
+			if count == 0 || f > result {
+				result = f
+			}
+		case "last":
+			result = f
+		case "first":
+			if count == 0 {
+				result = f
+			}
+		default:
+			result += f
+		}
+
+		count++
+	}
+
+	// values that are "-" do not count towards the average
+	if mode == "avg" && count > 0 {
+		result /= float64(count)
 	}
 
-	return sum, true, nil
+	return result, true, nil
 }
 
 func floatFromFields(fields map[string]string, name string) (float64, bool, error) {
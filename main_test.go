@@ -0,0 +1,200 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/log"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/metrics"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/parser"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/tail"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// processTestLines processes the given lines as a single source of the
+// namespace (using logParser, or the parser of the namespace if nil) and
+// returns the metrics of the namespace
+func processTestLines(t *testing.T, nsCfg *config.NamespaceConfig, logParser parser.Parser, lines ...string) *metrics.NamespaceMetrics {
+	t.Helper()
+
+	require.NoError(t, nsCfg.Compile())
+
+	m, err := metrics.NewForNamespace(nsCfg)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = metrics.ResetForNamespace(nsCfg)
+	})
+
+	logger, err := log.New("panic", "console")
+	require.NoError(t, err)
+
+	if logParser == nil {
+		logParser = parser.NewParser(nsCfg)
+	}
+
+	follower := tail.NewReaderFollower(strings.NewReader(strings.Join(lines, "\n")))
+
+	var parsed atomic.Bool
+	require.NoError(t, processSource(logger, nsCfg, follower, "", logParser, &m.Collection, &parsed, false, nil, nil, nil, nil))
+
+	return m
+}
+
+func TestStreamModeReadsStreamVariables(t *testing.T) {
+	nsCfg := &config.NamespaceConfig{Name: "test_stream_mode", Parser: "json", StreamMode: true}
+
+	m := processTestLines(t, nsCfg, nil,
+		`{"status": "200", "bytes_sent": "100", "bytes_received": "40", "body_bytes_sent": "999", "request_length": "999", "session_time": "1.500"}`,
+		`{"status": "200", "bytes_sent": "50", "bytes_received": "10", "session_time": "0.500"}`,
+	)
+
+	assert.Equal(t, 150.0, testutil.ToFloat64(m.ResponseBytesTotal))
+	assert.Equal(t, 50.0, testutil.ToFloat64(m.RequestBytesTotal))
+
+	snapshot, err := m.Snapshot()
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, snapshot[`test_stream_mode_stream_session_time_seconds_count{method="",status="200"}`])
+	assert.Equal(t, 2.0, snapshot[`test_stream_mode_stream_session_time_seconds_sum{method="",status="200"}`])
+}
+
+func TestHTTPModeIgnoresStreamVariables(t *testing.T) {
+	nsCfg := &config.NamespaceConfig{Name: "test_http_mode", Parser: "json"}
+
+	m := processTestLines(t, nsCfg, nil,
+		`{"status": "200", "bytes_sent": "100", "bytes_received": "40", "body_bytes_sent": "80", "request_length": "30", "session_time": "1.500"}`,
+	)
+
+	assert.Equal(t, 80.0, testutil.ToFloat64(m.ResponseBytesTotal))
+	assert.Equal(t, 30.0, testutil.ToFloat64(m.RequestBytesTotal))
+	assert.Equal(t, 0, testutil.CollectAndCount(m.SessionSeconds))
+}
+
+func TestObserveConnectionsCountsDistinctConnections(t *testing.T) {
+	connectionsUpdated := ConnectionsUpdated{connections: make(map[string]int64)}
+
+	v, ok := observeConnections(map[string]string{"connection": "1"}, &connectionsUpdated)
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, v)
+
+	v, ok = observeConnections(map[string]string{"connection": "2"}, &connectionsUpdated)
+	assert.True(t, ok)
+	assert.Equal(t, 2.0, v)
+
+	// several requests can be served over the same connection
+	v, ok = observeConnections(map[string]string{"connection": "1"}, &connectionsUpdated)
+	assert.True(t, ok)
+	assert.Equal(t, 2.0, v)
+
+	for _, fields := range []map[string]string{{}, {"connection": ""}, {"connection": "-"}} {
+		_, ok = observeConnections(fields, &connectionsUpdated)
+		assert.False(t, ok)
+	}
+}
+
+func TestTrackConnectionsSetsConcurrentConnectionsGauge(t *testing.T) {
+	nsCfg := &config.NamespaceConfig{
+		Name:          "test_track_connections",
+		Parser:        "json",
+		MetricsConfig: config.MetricsConfig{TrackConnections: true},
+	}
+
+	m := processTestLines(t, nsCfg, nil,
+		`{"status": "200", "connection": "10"}`,
+		`{"status": "200", "connection": "11"}`,
+		`{"status": "200", "connection": "10"}`,
+		`{"status": "200", "connection": "-"}`,
+	)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.ConcurrentConnectionsGauge))
+}
+
+// panickingParser is a parser that panics on lines equal to panicLine and
+// parses all other lines with next
+type panickingParser struct {
+	next      parser.Parser
+	panicLine string
+}
+
+func (p *panickingParser) ParseString(line string) (map[string]string, error) {
+	if line == p.panicLine {
+		panic("unexpected line")
+	}
+	return p.next.ParseString(line)
+}
+
+func TestPanicWhileProcessingLineIsRecovered(t *testing.T) {
+	nsCfg := &config.NamespaceConfig{
+		Name:   "test_panic_recovery",
+		Parser: "json",
+	}
+
+	logParser := &panickingParser{next: parser.NewParser(nsCfg), panicLine: "boom"}
+
+	m := processTestLines(t, nsCfg, logParser,
+		`{"status": "200"}`,
+		"boom",
+		`{"status": "200"}`,
+		`{"status": "200"}`,
+	)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.PanicsRecoveredTotal))
+	assert.Equal(t, 3.0, testutil.ToFloat64(m.CountTotal))
+}
+
+func TestProcessNamespaceReturnsErrorIfSyslogAddressIsInUse(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	logFile := filepath.Join(t.TempDir(), "access.log")
+	require.NoError(t, os.WriteFile(logFile, nil, 0o644))
+
+	nsCfg := &config.NamespaceConfig{
+		Name: "test_syslog_in_use",
+		SourceData: config.SourceData{
+			Files:  config.FileSource{logFile},
+			Syslog: &config.SyslogSource{ListenAddress: "tcp://" + l.Addr().String(), Tags: []string{"nginx"}},
+		},
+	}
+	require.NoError(t, nsCfg.Compile())
+
+	m, err := metrics.NewForNamespace(nsCfg)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = metrics.ResetForNamespace(nsCfg)
+	})
+
+	logger, err := log.New("panic", "console")
+	require.NoError(t, err)
+
+	stopChan := make(chan bool)
+	defer close(stopChan)
+
+	var parsed atomic.Bool
+	var stopHandlers sync.WaitGroup
+
+	err = processNamespace(logger, nsCfg, &m.Collection, &parsed, false, 0, stopChan, &stopHandlers)
+	assert.ErrorContains(t, err, "could not run syslog server on address tcp://"+l.Addr().String())
+}
+
+func TestUnparseableTimestampIsNoParseError(t *testing.T) {
+	nsCfg := &config.NamespaceConfig{Name: "test_unparseable_timestamp", Parser: "json"}
+
+	m := processTestLines(t, nsCfg, nil,
+		`{"status": "200", "time_local": "03/Feb/2021:11:22:33 +0000"}`,
+		`{"status": "200", "time_local": "2021-02-03T11:22:34Z"}`,
+	)
+
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.ParseErrorsTotal))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.CountTotal))
+	assert.Equal(t, 1612351353.0, testutil.ToFloat64(m.LastLineTimestampSeconds))
+}
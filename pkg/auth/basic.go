@@ -0,0 +1,43 @@
+// Package auth contains authentication middleware for the exporter's HTTP
+// endpoints
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BasicAuth wraps handler so that it only serves requests whose Authorization
+// header contains the given username and a password matching passwordHash (a
+// bcrypt hash). Other requests are answered with 401 Unauthorized.
+func BasicAuth(handler http.Handler, username string, passwordHash string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+
+		// the password is checked even if the username does not match, so
+		// that the response time does not tell whether a username exists
+		userOK := subtle.ConstantTimeCompare([]byte(user), []byte(username)) == 1
+		passwordOK := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)) == nil
+
+		if !ok || !userOK || !passwordOK {
+			w.Header().Set("WWW-Authenticate", `Basic realm="prometheus-nginxlog-exporter"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// HashPassword returns the bcrypt hash of a password, for use as
+// password_hash in the basic_auth configuration
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBasicAuthChecksCredentials(t *testing.T) {
+	t.Parallel()
+
+	hash, err := HashPassword("secret")
+	require.NoError(t, err)
+
+	handler := BasicAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), "prometheus", hash)
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		noAuth   bool
+		expected int
+	}{
+		{name: "valid", user: "prometheus", password: "secret", expected: http.StatusOK},
+		{name: "wrong password", user: "prometheus", password: "wrong", expected: http.StatusUnauthorized},
+		{name: "wrong user", user: "grafana", password: "secret", expected: http.StatusUnauthorized},
+		{name: "no credentials", noAuth: true, expected: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if !tt.noAuth {
+			req.SetBasicAuth(tt.user, tt.password)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, tt.expected, rec.Code, tt.name)
+		if tt.expected == http.StatusUnauthorized {
+			assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"), tt.name)
+		}
+	}
+}
@@ -1,12 +1,19 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/log"
+	"gopkg.in/yaml.v3"
 )
 
 // FileFormat describes which kind of configuration file the exporter was started with
@@ -19,32 +26,346 @@ const (
 	TypeYAML
 )
 
+// ReaderOptions describe how LoadConfigFromReader reads a configuration
+type ReaderOptions struct {
+	// Format is the format of the configuration
+	Format FileFormat
+
+	// ExpandEnv replaces references to environment variables (like
+	// "${LISTEN_ADDR}") with their values before the configuration is parsed
+	ExpandEnv bool
+
+	// Filename is the name of the file that the configuration was read from
+	// (if any). Included files are resolved relative to its directory (or the
+	// working directory, if not set), and it is used to infer the namespace
+	// labels if infer_namespace_label_from_file is set.
+	Filename string
+
+	// SkipCompile leaves compiling the namespaces to the caller
+	SkipCompile bool
+}
+
 // LoadConfigFromFile fills a configuration object (passed as parameter) with
 // values read from a configuration file (pass as parameter by filename). The
-// configuration file needs to be in HCL format.
-func LoadConfigFromFile(logger *log.Logger, config *Config, filename string) error {
-	var typ FileFormat
+// configuration file needs to be in HCL format. If expandEnv is set,
+// references to environment variables (like "${LISTEN_ADDR}") are replaced
+// with their values before the file is parsed. The namespaces of the files
+// that are included by the configuration file are added to its namespaces.
+// The namespaces are not compiled.
+func LoadConfigFromFile(logger *log.Logger, config *Config, filename string, expandEnv bool) error {
+	typ, err := fileFormat(filename)
+	if err != nil {
+		return err
+	}
 
-	reader, err := os.Open(filename)
+	file, err := os.Open(filename)
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 
-	defer reader.Close()
+	return LoadConfigFromReader(logger, config, file, ReaderOptions{
+		Format:      typ,
+		ExpandEnv:   expandEnv,
+		Filename:    filename,
+		SkipCompile: true,
+	})
+}
 
+// fileFormat determines the format of a configuration file by its extension
+func fileFormat(filename string) (FileFormat, error) {
 	if strings.HasSuffix(filename, ".hcl") {
-		typ = TypeHCL
+		return TypeHCL, nil
 	} else if strings.HasSuffix(filename, ".yaml") || strings.HasSuffix(filename, ".yml") {
-		typ = TypeYAML
-	} else {
-		return fmt.Errorf("config file '%s' has unsupported file type", filename)
+		return TypeYAML, nil
 	}
 
-	return LoadConfigFromStream(logger, config, reader, typ)
+	return 0, fmt.Errorf("config file '%s' has unsupported file type", filename)
+}
+
+// loadConfigFile loads a single configuration file and the files it includes;
+// including contains the (absolute) names of the files that (directly or
+// indirectly) include the file
+func loadConfigFile(logger *log.Logger, config *Config, filename string, expandEnv bool, including []string) error {
+	typ, err := fileFormat(filename)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return loadConfig(logger, config, file, ReaderOptions{Format: typ, ExpandEnv: expandEnv, Filename: filename}, including)
+}
+
+// loadConfig loads a configuration and the files it includes; including
+// contains the (absolute) names of the files that (directly or indirectly)
+// include the configuration
+func loadConfig(logger *log.Logger, config *Config, reader io.Reader, opts ReaderOptions, including []string) error {
+	var abs string
+	if opts.Filename != "" {
+		var err error
+		if abs, err = filepath.Abs(opts.Filename); err != nil {
+			return err
+		}
+
+		for _, f := range including {
+			if f == abs {
+				return fmt.Errorf("config file '%s' is included by itself (via %s)", opts.Filename, strings.Join(including, " -> "))
+			}
+		}
+
+		including = append(including, abs)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	if opts.ExpandEnv {
+		if data, err = ExpandEnvironment(data); err != nil {
+			if opts.Filename != "" {
+				return fmt.Errorf("config file '%s': %s", opts.Filename, err.Error())
+			}
+			return err
+		}
+	}
+
+	if err := LoadConfigFromStream(logger, config, bytes.NewReader(data), opts.Format); err != nil {
+		return err
+	}
+
+	if config.InferNamespaceLabelFromFile && opts.Filename != "" {
+		inferNamespaceLabels(config, opts.Filename)
+	}
+
+	return includeConfigFiles(logger, config, abs, opts.ExpandEnv, including)
+}
+
+// includeConfigFiles loads the files that match the include patterns of a
+// configuration file (relative to its directory) and adds their namespaces.
+// Each included file is validated on its own before it is merged.
+func includeConfigFiles(logger *log.Logger, config *Config, filename string, expandEnv bool, including []string) error {
+	names := make(map[string]struct{}, len(config.Namespaces))
+	for i := range config.Namespaces {
+		names[config.Namespaces[i].Name] = struct{}{}
+	}
+
+	for _, pattern := range config.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(filename), pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid include pattern '%s': %s", pattern, err.Error())
+		}
+
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return fmt.Errorf("included config file '%s' does not exist", pattern)
+		}
+
+		for _, match := range matches {
+			included := Config{InferNamespaceLabelFromFile: config.InferNamespaceLabelFromFile}
+			if err := loadConfigFile(logger, &included, match, expandEnv, including); err != nil {
+				return err
+			}
+
+			if err := config.applyIncludedNamespaceDefaults(logger, included.Namespaces); err != nil {
+				return fmt.Errorf("included config file '%s': %s", match, err.Error())
+			}
+
+			if err := validateIncludedConfig(&included); err != nil {
+				return fmt.Errorf("included config file '%s': %s", match, err.Error())
+			}
+
+			for _, ns := range included.Namespaces {
+				if _, ok := names[ns.Name]; ok {
+					return fmt.Errorf("included config file '%s': namespace '%s' is already defined", match, ns.Name)
+				}
+
+				names[ns.Name] = struct{}{}
+				config.Namespaces = append(config.Namespaces, ns)
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyIncludedNamespaceDefaults merges the defaults of the including
+// configuration into the namespaces of an included file (which have already
+// been merged with the defaults of the included file itself). Log files that
+// are only set by the defaults still need to be resolved.
+func (c *Config) applyIncludedNamespaceDefaults(logger *log.Logger, namespaces []NamespaceConfig) error {
+	if c.Defaults == nil {
+		return nil
+	}
+
+	for i := range namespaces {
+		ns := &namespaces[i]
+		inheritsFiles := len(ns.SourceData.Files) == 0
+
+		ns.ApplyDefaults(c.Defaults)
+
+		if inheritsFiles {
+			ns.ResolveDeprecations()
+
+			if err := ns.ResolveGlobs(logger); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateIncludedConfig makes sure that the namespaces of an included file
+// are valid, so that errors can be reported together with the file name
+func validateIncludedConfig(config *Config) error {
+	// the namespaces are compiled again after all files were loaded
+	return CompileNamespaces(append([]NamespaceConfig{}, config.Namespaces...))
+}
+
+// CompileNamespaces compiles the given namespaces concurrently, using at most
+// one goroutine per CPU. The errors of all invalid namespaces are returned
+// together, in the order of the namespaces.
+func CompileNamespaces(namespaces []NamespaceConfig) error {
+	errs := make([]error, len(namespaces))
+	workers := make(chan struct{}, runtime.GOMAXPROCS(0))
+
+	var wg sync.WaitGroup
+	for i := range namespaces {
+		wg.Add(1)
+		workers <- struct{}{}
+
+		go func(i int) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+
+			ns := &namespaces[i]
+			if err := ns.Compile(); err != nil {
+				errs[i] = fmt.Errorf("invalid configuration of namespace '%s': %s", ns.Name, err.Error())
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// environmentReferencePattern matches references to environment variables in
+// configuration files. Only the "${VAR}" form is supported, since "$var" is
+// used for the variables of log formats.
+var environmentReferencePattern = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+// ExpandEnvironment replaces all references to environment variables (like
+// "${LISTEN_ADDR}") in a configuration file with their values. Referencing a
+// variable that is not set is an error.
+func ExpandEnvironment(data []byte) ([]byte, error) {
+	var missing []string
+
+	expanded := environmentReferencePattern.ReplaceAllFunc(data, func(ref []byte) []byte {
+		name := string(ref[2 : len(ref)-1])
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+
+		return []byte(value)
+	})
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("referenced environment variables are not set: %s", strings.Join(missing, ", "))
+	}
+
+	return expanded, nil
+}
+
+// inferNamespaceLabels sets the namespace label of all namespaces (that do
+// not have an explicitly configured one) to the base name of the config file
+// that they were defined in
+func inferNamespaceLabels(config *Config, filename string) {
+	base := filepath.Base(filename)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+
+	for i := range config.Namespaces {
+		if config.Namespaces[i].NamespaceLabelName != "" {
+			continue
+		}
+
+		config.Namespaces[i].NamespaceLabelName = "config_file"
+		config.Namespaces[i].NamespaceLabelValue = base
+	}
+}
+
+// LoadConfigFromReader fills a configuration object (passed as parameter) with
+// values read from a configuration, which may come from any source (like a
+// string or an HTTP response body). Without options, the configuration is
+// read as YAML document. In contrast to LoadConfigFromStream, the files that
+// the configuration includes are loaded as well, and the namespaces are
+// compiled (unless opts.SkipCompile is set), so that invalid settings are
+// reported immediately.
+func LoadConfigFromReader(logger *log.Logger, config *Config, reader io.Reader, opts ...ReaderOptions) error {
+	o := ReaderOptions{Format: TypeYAML}
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	if err := loadConfig(logger, config, reader, o, nil); err != nil {
+		return err
+	}
+
+	if err := validateStdinSources(config); err != nil {
+		return err
+	}
+
+	if err := validateDeadLetterFiles(config); err != nil {
+		return err
+	}
+
+	if err := validateMetricsEndpoints(config); err != nil {
+		return err
+	}
+
+	if o.SkipCompile {
+		return nil
+	}
+
+	return CompileNamespaces(config.Namespaces)
+}
+
+// LoadNamespaceFromYAML fills a namespace configuration with values read from
+// a YAML document that contains a single namespace (like the entries of the
+// "namespaces" list of a configuration file). The namespace is also compiled.
+func LoadNamespaceFromYAML(logger *log.Logger, ns *NamespaceConfig, data []byte) error {
+	if err := yaml.Unmarshal(data, ns); err != nil {
+		return err
+	}
+
+	ns.ResolveDeprecations()
+
+	if err := ns.ResolveGlobs(logger); err != nil {
+		return err
+	}
+
+	if err := ns.Compile(); err != nil {
+		return fmt.Errorf("invalid configuration of namespace '%s': %s", ns.Name, err.Error())
+	}
+
+	return nil
 }
 
 // LoadConfigFromStream fills a configuration object (passed as parameter) with
-// values read from a Reader interface (passed as parameter).
+// values read from a Reader interface (passed as parameter). The defaults of
+// the configuration are merged into its namespaces.
 func LoadConfigFromStream(logger *log.Logger, config *Config, stream io.Reader, typ FileFormat) error {
 	switch typ {
 	case TypeHCL:
@@ -60,6 +381,10 @@ func LoadConfigFromStream(logger *log.Logger, config *Config, stream io.Reader,
 	}
 
 	for i := range config.Namespaces {
+		if config.Defaults != nil {
+			config.Namespaces[i].ApplyDefaults(config.Defaults)
+		}
+
 		config.Namespaces[i].ResolveDeprecations()
 
 		if err := config.Namespaces[i].ResolveGlobs(logger); err != nil {
@@ -67,5 +392,100 @@ func LoadConfigFromStream(logger *log.Logger, config *Config, stream io.Reader,
 		}
 	}
 
+	if err := validateStdinSources(config); err != nil {
+		return err
+	}
+
+	if err := validateDeadLetterFiles(config); err != nil {
+		return err
+	}
+
+	return validateMetricsEndpoints(config)
+}
+
+// validateStdinSources makes sure that at most one namespace reads from
+// stdin, since every line can only be read once
+func validateStdinSources(config *Config) error {
+	stdinNamespace := ""
+
+	for i := range config.Namespaces {
+		if !config.Namespaces[i].SourceData.Stdin {
+			continue
+		}
+
+		if stdinNamespace != "" {
+			return fmt.Errorf("namespaces '%s' and '%s' both read from stdin; only one namespace may use the stdin source", stdinNamespace, config.Namespaces[i].Name)
+		}
+
+		stdinNamespace = config.Namespaces[i].Name
+	}
+
+	return nil
+}
+
+// validateDeadLetterFiles makes sure that namespaces that share a dead letter
+// file use the same size limit for it, and that no dead letter file is also
+// used as parse error log, since each file is only opened once
+func validateDeadLetterFiles(config *Config) error {
+	type deadLetterFile struct {
+		namespace string
+		maxSize   int
+	}
+
+	deadLetterFiles := make(map[string]deadLetterFile)
+	for i := range config.Namespaces {
+		ns := &config.Namespaces[i]
+		if ns.DeadLetterFile == "" {
+			continue
+		}
+
+		if other, ok := deadLetterFiles[ns.DeadLetterFile]; ok && other.maxSize != ns.MaxDeadLetterFileSizeMB {
+			return fmt.Errorf("namespaces '%s' and '%s' use different values of max_dead_letter_file_size_mb for dead letter file '%s'", other.namespace, ns.Name, ns.DeadLetterFile)
+		}
+
+		deadLetterFiles[ns.DeadLetterFile] = deadLetterFile{namespace: ns.Name, maxSize: ns.MaxDeadLetterFileSizeMB}
+	}
+
+	for i := range config.Namespaces {
+		ns := &config.Namespaces[i]
+		if ns.ParseErrorLog == nil || !ns.ParseErrorLog.Enabled {
+			continue
+		}
+
+		if other, ok := deadLetterFiles[ns.ParseErrorLog.File]; ok {
+			return fmt.Errorf("parse error log of namespace '%s' is already used as dead letter file by namespace '%s'", ns.Name, other.namespace)
+		}
+	}
+
+	return nil
+}
+
+// validateMetricsEndpoints makes sure that the metrics endpoints of the
+// namespaces are distinct from each other and from the endpoints of the
+// built-in webserver
+func validateMetricsEndpoints(config *Config) error {
+	reserved := map[string]string{
+		config.Listen.MetricsEndpointOrDefault():   "the metrics endpoint",
+		config.Listen.LivenessEndpointOrDefault():  "the liveness endpoint",
+		config.Listen.ReadinessEndpointOrDefault(): "the readiness endpoint",
+	}
+
+	for i := range config.Namespaces {
+		ns := &config.Namespaces[i]
+		if ns.MetricsEndpoint == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(ns.MetricsEndpoint, "/") {
+			return fmt.Errorf("metrics_endpoint of namespace '%s' must start with a slash, got '%s'", ns.Name, ns.MetricsEndpoint)
+		}
+
+		if usedBy, ok := reserved[ns.MetricsEndpoint]; ok {
+			return fmt.Errorf("metrics_endpoint '%s' of namespace '%s' is already used by %s", ns.MetricsEndpoint, ns.Name, usedBy)
+		}
+
+		reserved[ns.MetricsEndpoint] = "namespace '" + ns.Name + "'"
+	}
+
 	return nil
 }
@@ -8,6 +8,14 @@ func LoadConfigFromFlags(config *Config, flags *StartupFlags) error {
 		Address:         flags.ListenAddress,
 		MetricsEndpoint: flags.MetricsEndpoint,
 	}
+
+	if flags.TLSCertFile != "" || flags.TLSKeyFile != "" || flags.TLSClientCAFile != "" {
+		config.Listen.TLS = &ListenTLSConfig{
+			CertFile:     flags.TLSCertFile,
+			KeyFile:      flags.TLSKeyFile,
+			ClientCAFile: flags.TLSClientCAFile,
+		}
+	}
 	config.Namespaces = []NamespaceConfig{
 		{
 			Format: flags.Format,
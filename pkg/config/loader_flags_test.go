@@ -41,3 +41,22 @@ func TestConfigContainsFilenamesFromFlags(t *testing.T) {
 	require.Len(t, cfg.Namespaces, 1)
 	require.Equal(t, FileSource(sf), cfg.Namespaces[0].SourceData.Files)
 }
+
+func TestConfigContainsTLSSettingsFromFlags(t *testing.T) {
+	t.Parallel()
+
+	cfg := configFromFlags(t, StartupFlags{})
+	require.Nil(t, cfg.Listen.TLS)
+
+	cfg = configFromFlags(t, StartupFlags{
+		TLSCertFile:     "/etc/exporter/cert.pem",
+		TLSKeyFile:      "/etc/exporter/key.pem",
+		TLSClientCAFile: "/etc/exporter/ca.pem",
+	})
+
+	require.Equal(t, &ListenTLSConfig{
+		CertFile:     "/etc/exporter/cert.pem",
+		KeyFile:      "/etc/exporter/key.pem",
+		ClientCAFile: "/etc/exporter/ca.pem",
+	}, cfg.Listen.TLS)
+}
@@ -1,9 +1,11 @@
 package config
 
 import (
+	"errors"
 	"io"
 
 	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
 )
 
 func loadConfigFromHCLStream(config *Config, file io.Reader) error {
@@ -14,7 +16,16 @@ func loadConfigFromHCLStream(config *Config, file io.Reader) error {
 
 	hclText := string(buf)
 
-	err = hcl.Decode(config, hclText)
+	root, err := hcl.Parse(hclText)
+	if err != nil {
+		return err
+	}
+
+	if list, ok := root.Node.(*ast.ObjectList); ok && len(list.Filter("defaults").Items) > 0 {
+		return errors.New("the 'defaults' block is only supported in YAML configuration files")
+	}
+
+	err = hcl.DecodeObject(config, root)
 	if err != nil {
 		return err
 	}
@@ -2,6 +2,9 @@ package config
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/log"
@@ -165,6 +168,191 @@ func TestLoadsYAMLConfigFile(t *testing.T) {
 	assertConfigContents(t, cfg)
 }
 
+func TestLoadsConfigFromReader(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{}
+
+	logger, _ := log.New("panic", "console")
+	err := LoadConfigFromReader(logger, &cfg, strings.NewReader(YAMLInput))
+	require.NoError(t, err)
+	assertConfigContents(t, cfg)
+
+	assert.Equal(t, []string{"app", "foo"}, cfg.Namespaces[0].OrderedLabelNames)
+}
+
+func TestLoadConfigFromReaderReportsInvalidNamespaces(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{}
+	input := `
+namespaces:
+  - name: broken
+    timestamp_timezone: "Not/AZone"
+`
+
+	logger, _ := log.New("panic", "console")
+	err := LoadConfigFromReader(logger, &cfg, strings.NewReader(input))
+	assert.ErrorContains(t, err, "namespace 'broken'")
+}
+
+func TestLoadConfigRejectsMultipleStdinSources(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{}
+	input := `
+namespaces:
+  - name: first
+    source:
+      stdin: true
+  - name: second
+    source:
+      stdin: true
+`
+
+	logger, _ := log.New("panic", "console")
+	err := LoadConfigFromStream(logger, &cfg, strings.NewReader(input), TypeYAML)
+	assert.ErrorContains(t, err, "'first' and 'second' both read from stdin")
+}
+
+func TestNamespaceMetricsEndpointsAreValidated(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		second  string
+		message string
+	}{
+		{second: "tenant", message: "must start with a slash"},
+		{second: "/metrics", message: "already used by the metrics endpoint"},
+		{second: "/tenant", message: "already used by namespace 'first'"},
+	}
+
+	logger, _ := log.New("panic", "console")
+
+	for _, tt := range tests {
+		input := `
+namespaces:
+  - name: first
+    metrics_endpoint: /tenant
+  - name: second
+    metrics_endpoint: ` + tt.second + `
+`
+
+		cfg := Config{}
+		err := LoadConfigFromStream(logger, &cfg, strings.NewReader(input), TypeYAML)
+		assert.ErrorContains(t, err, tt.message)
+	}
+}
+
+func TestDeadLetterFilesAreValidated(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		second  string
+		message string
+	}{
+		{second: `{name: second, dead_letter_file: /tmp/dead.log}`, message: ""},
+		{second: `{name: second, dead_letter_file: /tmp/dead.log, max_dead_letter_file_size_mb: 20}`, message: "use different values of max_dead_letter_file_size_mb"},
+		{second: `{name: second, parse_error_log: {enabled: true, file: /tmp/dead.log}}`, message: "already used as dead letter file by namespace 'first'"},
+	}
+
+	logger, _ := log.New("panic", "console")
+
+	for _, tt := range tests {
+		input := `
+namespaces:
+  - name: first
+    dead_letter_file: /tmp/dead.log
+  - ` + tt.second + `
+`
+
+		cfg := Config{}
+		err := LoadConfigFromStream(logger, &cfg, strings.NewReader(input), TypeYAML)
+		if tt.message == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorContains(t, err, tt.message)
+		}
+	}
+}
+
+func TestLoadsNormalizeRelabelingFromHCLAndYAML(t *testing.T) {
+	t.Parallel()
+
+	hclInput := `
+namespace "app" {
+  relabel "request_uri" {
+    from = "request_uri"
+    action = "normalize"
+
+    pattern "/users/[0-9]+" {
+      replacement = "/users/:id"
+    }
+  }
+}
+`
+
+	yamlInput := `
+namespaces:
+  - name: app
+    relabel_configs:
+      - target_label: request_uri
+        from: request_uri
+        action: normalize
+        patterns:
+          - regexp: "/users/[0-9]+"
+            replacement: "/users/:id"
+`
+
+	logger, _ := log.New("panic", "console")
+
+	for typ, input := range map[FileFormat]string{TypeHCL: hclInput, TypeYAML: yamlInput} {
+		cfg := Config{}
+		require.NoError(t, LoadConfigFromStream(logger, &cfg, strings.NewReader(input), typ))
+		require.NoError(t, cfg.Namespaces[0].Compile())
+
+		r := cfg.Namespaces[0].RelabelConfigs[0]
+		assert.Equal(t, "normalize", r.Action)
+		require.Len(t, r.Patterns, 1)
+		assert.Equal(t, "/users/[0-9]+", r.Patterns[0].RegexpString)
+		assert.Equal(t, "/users/:id", r.Patterns[0].Replacement)
+	}
+}
+
+func TestLoadsHistogramBucketsByMetricFromHCLAndYAML(t *testing.T) {
+	t.Parallel()
+
+	hclInput := `
+namespace "app" {
+  histogram_buckets = [0.1, 1, 10]
+
+  histogram_buckets_by_metric {
+    upstream_seconds_buckets = [0.01, 0.05, 0.1]
+  }
+}
+`
+
+	yamlInput := `
+namespaces:
+  - name: app
+    histogram_buckets: [0.1, 1, 10]
+    histogram_buckets_by_metric:
+      upstream_seconds_buckets: [0.01, 0.05, 0.1]
+`
+
+	logger, _ := log.New("panic", "console")
+
+	for typ, input := range map[FileFormat]string{TypeHCL: hclInput, TypeYAML: yamlInput} {
+		cfg := Config{}
+		require.NoError(t, LoadConfigFromStream(logger, &cfg, strings.NewReader(input), typ))
+		require.NoError(t, cfg.Namespaces[0].Compile())
+
+		ns := &cfg.Namespaces[0]
+		assert.Equal(t, []float64{0.01, 0.05, 0.1}, ns.HistogramBucketsFor(HistogramBucketsUpstreamSeconds))
+		assert.Equal(t, []float64{0.1, 1, 10}, ns.HistogramBucketsFor(HistogramBucketsResponseSeconds))
+	}
+}
+
 const HCLLabeledInput = `
 listen {
   address = "10.0.0.1"
@@ -260,6 +448,34 @@ func assertLabeledConfigContents(t *testing.T, cfg Config) {
 	}
 }
 
+func TestMetricsOverrideSuffixIsAppendedToPrefix(t *testing.T) {
+	t.Parallel()
+
+	const input = `
+namespaces:
+  - name: myapp
+    format: "$status"
+    metrics_override:
+      suffix: v2
+  - name: other
+    format: "$status"
+    metrics_override:
+      prefix: nginx
+      suffix: v2
+`
+
+	cfg := Config{}
+	logger, _ := log.New("panic", "console")
+	require.NoError(t, LoadConfigFromStream(logger, &cfg, bytes.NewBufferString(input), TypeYAML))
+	require.Len(t, cfg.Namespaces, 2)
+
+	require.NoError(t, cfg.Namespaces[0].Compile())
+	assert.Equal(t, "myapp_v2", cfg.Namespaces[0].NamespacePrefix)
+
+	require.NoError(t, cfg.Namespaces[1].Compile())
+	assert.Equal(t, "nginx_v2", cfg.Namespaces[1].NamespacePrefix)
+}
+
 func TestLoadsNSLabeledHCLConfigFile(t *testing.T) {
 	t.Parallel()
 
@@ -283,3 +499,291 @@ func TestLoadsNSLabeledYAMLConfigFile(t *testing.T) {
 	assert.Nil(t, err, "unexpected error: %v", err)
 	assertLabeledConfigContents(t, cfg)
 }
+
+func TestInfersNamespaceLabelFromFileName(t *testing.T) {
+	t.Parallel()
+
+	filename := filepath.Join(t.TempDir(), "team-a.yaml")
+	err := os.WriteFile(filename, []byte(`
+infer_namespace_label_from_file: true
+namespaces:
+  - name: nginx
+    format: "$remote_addr"
+  - name: explicit
+    format: "$remote_addr"
+    namespace_label: vhost
+`), 0o644)
+	require.NoError(t, err)
+
+	cfg := Config{}
+	logger, _ := log.New("panic", "console")
+	require.NoError(t, LoadConfigFromFile(logger, &cfg, filename, true))
+
+	require.NoError(t, cfg.Namespaces[0].Compile())
+	assert.Equal(t, map[string]string{"config_file": "team-a"}, cfg.Namespaces[0].NamespaceLabels)
+
+	require.NoError(t, cfg.Namespaces[1].Compile())
+	assert.Equal(t, map[string]string{"vhost": "explicit"}, cfg.Namespaces[1].NamespaceLabels)
+}
+
+func TestLoadConfigFromFileExpandsEnvironment(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(filename, []byte(`
+listen:
+  address: "${TEST_LISTEN_ADDR}"
+namespaces:
+  - name: nginx
+    format: "$remote_addr ${TEST_FORMAT_SUFFIX}"
+`), 0o644)
+	require.NoError(t, err)
+
+	t.Setenv("TEST_LISTEN_ADDR", "10.0.0.1")
+	t.Setenv("TEST_FORMAT_SUFFIX", "$status")
+
+	logger, _ := log.New("panic", "console")
+
+	cfg := Config{}
+	require.NoError(t, LoadConfigFromFile(logger, &cfg, filename, true))
+	assert.Equal(t, "10.0.0.1", cfg.Listen.Address)
+	assert.Equal(t, "$remote_addr $status", cfg.Namespaces[0].Format)
+
+	cfg = Config{}
+	require.NoError(t, LoadConfigFromFile(logger, &cfg, filename, false))
+	assert.Equal(t, "${TEST_LISTEN_ADDR}", cfg.Listen.Address)
+}
+
+func TestExpandEnvironmentRejectsUnsetVariables(t *testing.T) {
+	t.Setenv("TEST_SET", "x")
+
+	_, err := ExpandEnvironment([]byte("a: ${TEST_SET}\nb: ${TEST_UNSET_VARIABLE}\n"))
+	assert.ErrorContains(t, err, "TEST_UNSET_VARIABLE")
+}
+
+func TestLoadConfigFromFileMergesIncludedNamespaces(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "conf.d"), 0o755))
+
+	files := map[string]string{
+		"main.yaml": `
+include: ["conf.d/*.yaml"]
+namespaces:
+  - name: main
+    format: "$status"
+`,
+		"conf.d/a.yaml": `
+namespaces:
+  - name: a
+    format: "$status"
+`,
+		"conf.d/b.yaml": `
+include: ["../extra.yml"]
+namespaces:
+  - name: b
+    format: "$status"
+`,
+		"extra.yml": `
+namespaces:
+  - name: extra
+    format: "$status"
+`,
+	}
+
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+
+	logger, _ := log.New("panic", "console")
+
+	cfg := Config{}
+	require.NoError(t, LoadConfigFromFile(logger, &cfg, filepath.Join(dir, "main.yaml"), true))
+
+	names := make([]string, len(cfg.Namespaces))
+	for i := range cfg.Namespaces {
+		names[i] = cfg.Namespaces[i].Name
+	}
+
+	assert.Equal(t, []string{"main", "a", "b", "extra"}, names)
+}
+
+func TestLoadConfigFromReaderAppliesOptions(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "included.yaml"), []byte(`
+namespaces:
+  - name: included
+    format: "$status"
+`), 0o644))
+
+	t.Setenv("TEST_READER_FORMAT", "$remote_addr $status")
+
+	logger, _ := log.New("panic", "console")
+
+	cfg := Config{}
+	err := LoadConfigFromReader(logger, &cfg, strings.NewReader(`
+include = ["included.yaml"]
+infer_namespace_label_from_file = true
+
+namespace "main" {
+  format = "${TEST_READER_FORMAT}"
+}
+`), ReaderOptions{Format: TypeHCL, ExpandEnv: true, Filename: filepath.Join(dir, "team-a.hcl")})
+	require.NoError(t, err)
+
+	require.Len(t, cfg.Namespaces, 2)
+	assert.Equal(t, "$remote_addr $status", cfg.Namespaces[0].Format)
+	assert.Equal(t, map[string]string{"config_file": "team-a"}, cfg.Namespaces[0].NamespaceLabels)
+	assert.Equal(t, "included", cfg.Namespaces[1].Name)
+	assert.Equal(t, map[string]string{"config_file": "included"}, cfg.Namespaces[1].NamespaceLabels)
+}
+
+func TestLoadConfigFromFileRejectsIncludeCycles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.yaml"), []byte(`include: ["b.yaml"]`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.yaml"), []byte(`include: ["a.yaml"]`), 0o644))
+
+	logger, _ := log.New("panic", "console")
+
+	cfg := Config{}
+	err := LoadConfigFromFile(logger, &cfg, filepath.Join(dir, "a.yaml"), true)
+	assert.ErrorContains(t, err, "is included by itself")
+}
+
+func TestLoadConfigFromFileValidatesIncludedFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.yaml"), []byte(`
+include: ["broken.yaml", "missing.yaml"]
+`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.yaml"), []byte(`
+namespaces:
+  - name: broken
+    parser: csv
+`), 0o644))
+
+	logger, _ := log.New("panic", "console")
+
+	cfg := Config{}
+	err := LoadConfigFromFile(logger, &cfg, filepath.Join(dir, "main.yaml"), true)
+	assert.ErrorContains(t, err, "broken.yaml")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.yaml"), []byte(`
+namespaces:
+  - name: fixed
+    format: "$status"
+`), 0o644))
+
+	cfg = Config{}
+	err = LoadConfigFromFile(logger, &cfg, filepath.Join(dir, "main.yaml"), true)
+	assert.ErrorContains(t, err, "missing.yaml")
+}
+
+func TestLoadConfigMergesNamespaceDefaults(t *testing.T) {
+	cfg := Config{}
+	require.NoError(t, LoadConfigFromStream(nil, &cfg, strings.NewReader(`
+defaults:
+  format: "$remote_addr $status"
+  histogram_buckets: [0.1, 1]
+  labels:
+    team: web
+  relabel_configs:
+    - target_label: status_class
+      from: status
+  metrics:
+    disable_count_total: true
+namespaces:
+  - name: a
+  - name: b
+    format: "$status"
+    labels:
+      team: api
+`), TypeYAML))
+
+	a, b := cfg.Namespaces[0], cfg.Namespaces[1]
+	assert.Equal(t, "a", a.Name)
+	assert.Equal(t, "$remote_addr $status", a.Format)
+	assert.Equal(t, []float64{0.1, 1}, a.HistogramBuckets)
+	assert.Equal(t, map[string]string{"team": "web"}, a.Labels)
+	assert.Equal(t, "status_class", a.RelabelConfigs[0].TargetLabel)
+	assert.True(t, a.MetricsConfig.DisableCountTotal)
+
+	assert.Equal(t, "b", b.Name)
+	assert.Equal(t, "$status", b.Format)
+	assert.Equal(t, map[string]string{"team": "api"}, b.Labels)
+	assert.True(t, b.MetricsConfig.DisableCountTotal)
+
+	// the namespaces get their own copies of the defaults
+	a.Labels["team"] = "changed"
+	assert.Equal(t, "web", cfg.Defaults.Labels["team"])
+}
+
+func TestLoadConfigRejectsNamespaceDefaultsInHCL(t *testing.T) {
+	cfg := Config{}
+	err := LoadConfigFromStream(nil, &cfg, strings.NewReader(`
+defaults {
+  parser = "json"
+}
+
+namespace "a" {
+}
+`), TypeHCL)
+
+	assert.ErrorContains(t, err, "only supported in YAML")
+}
+
+func TestIncludedNamespacesUseDefaults(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.yaml"), []byte(`
+include: ["included.yaml"]
+defaults:
+  parser: csv
+  csv_header: [status]
+`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "included.yaml"), []byte(`
+namespaces:
+  - name: included
+`), 0o644))
+
+	logger, _ := log.New("panic", "console")
+
+	cfg := Config{}
+	require.NoError(t, LoadConfigFromFile(logger, &cfg, filepath.Join(dir, "main.yaml"), true))
+	assert.Equal(t, "csv", cfg.Namespaces[0].Parser)
+	assert.Equal(t, []string{"status"}, cfg.Namespaces[0].CSVHeader)
+}
+
+func TestCompileNamespacesCompilesSharedRelabelConfigs(t *testing.T) {
+	cfg := Config{}
+	require.NoError(t, LoadConfigFromStream(nil, &cfg, strings.NewReader(`
+defaults:
+  format: "$request_uri $status"
+  relabel_configs:
+    - target_label: path
+      from: request_uri
+      matches:
+        - regexp: "^/users/.*"
+          replacement: "/users/:id"
+namespaces:
+  - name: a
+  - name: b
+  - name: c
+`), TypeYAML))
+
+	require.NoError(t, CompileNamespaces(cfg.Namespaces))
+
+	for _, ns := range cfg.Namespaces {
+		require.NotNil(t, ns.RelabelConfigs[0].Matches[0].CompiledRegexp, ns.Name)
+	}
+}
+
+func TestCompileNamespacesReportsAllErrors(t *testing.T) {
+	namespaces := []NamespaceConfig{
+		{Name: "a", SampleRate: 2},
+		{Name: "b"},
+		{Name: "c", WorkerCount: -1},
+	}
+
+	err := CompileNamespaces(namespaces)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "namespace 'a'")
+	assert.NotContains(t, err.Error(), "namespace 'b'")
+	assert.Contains(t, err.Error(), "namespace 'c'")
+	assert.Less(t, strings.Index(err.Error(), "'a'"), strings.Index(err.Error(), "'c'"))
+}
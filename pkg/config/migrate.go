@@ -0,0 +1,160 @@
+package config
+
+import (
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MigrateConfig reads a configuration file in the given format from in and
+// writes it to out as YAML. Deprecated settings are converted into their
+// current equivalents (with a comment pointing out the change), and settings
+// that are not set are omitted from the output.
+func MigrateConfig(in io.Reader, from FileFormat, out io.Writer, to FileFormat) error {
+	if to != TypeYAML {
+		return fmt.Errorf("unsupported target config type %d; only YAML is supported", to)
+	}
+
+	var cfg Config
+	switch from {
+	case TypeHCL:
+		if err := loadConfigFromHCLStream(&cfg, in); err != nil {
+			return err
+		}
+	case TypeYAML:
+		if err := loadConfigFromYAMLStream(&cfg, in); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported config type %d", from)
+	}
+
+	var comments []migrationComment
+
+	if cfg.EnableExperimentalFeaturesOld {
+		cfg.EnableExperimentalFeatures = true
+		cfg.EnableExperimentalFeaturesOld = false
+		comments = append(comments, migrationComment{
+			path:    []string{"enable_experimental"},
+			comment: "migrated from the deprecated 'enableexperimentalfeatures' parameter",
+		})
+	}
+
+	for i := range cfg.Namespaces {
+		ns := &cfg.Namespaces[i]
+		if len(ns.SourceFiles) > 0 {
+			ns.ResolveDeprecations()
+			ns.SourceFiles = nil
+			comments = append(comments, migrationComment{
+				path:    []string{"namespaces", fmt.Sprint(i), "source"},
+				comment: "migrated from the deprecated 'source_files' parameter",
+			})
+		}
+	}
+
+	var doc yaml.Node
+	if err := doc.Encode(&cfg); err != nil {
+		return err
+	}
+
+	pruneEmptyValues(&doc)
+
+	for _, c := range comments {
+		if n := lookupKey(&doc, c.path); n != nil {
+			n.HeadComment = c.comment
+		}
+	}
+
+	enc := yaml.NewEncoder(out)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+type migrationComment struct {
+	path    []string
+	comment string
+}
+
+// pruneEmptyValues removes all mapping entries with zero values (which are
+// equivalent to not setting them at all) from a YAML node
+func pruneEmptyValues(n *yaml.Node) {
+	for _, c := range n.Content {
+		pruneEmptyValues(c)
+	}
+
+	if n.Kind != yaml.MappingNode {
+		return
+	}
+
+	content := make([]*yaml.Node, 0, len(n.Content))
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if isEmptyNode(n.Content[i+1]) {
+			continue
+		}
+
+		content = append(content, n.Content[i], n.Content[i+1])
+	}
+
+	n.Content = content
+}
+
+func isEmptyNode(n *yaml.Node) bool {
+	switch n.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		return len(n.Content) == 0
+	case yaml.ScalarNode:
+		switch n.Tag {
+		case "!!null":
+			return true
+		case "!!bool":
+			return n.Value == "false"
+		case "!!int", "!!float":
+			return n.Value == "0"
+		case "!!str":
+			return n.Value == ""
+		}
+	}
+
+	return false
+}
+
+// lookupKey returns the key node at the given path (consisting of mapping
+// keys and sequence indices) in a YAML document
+func lookupKey(n *yaml.Node, path []string) *yaml.Node {
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+
+	var key *yaml.Node
+	for _, p := range path {
+		key = nil
+
+		switch n.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == p {
+					key, n = n.Content[i], n.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			var idx int
+			if _, err := fmt.Sscan(p, &idx); err == nil && idx < len(n.Content) {
+				n = n.Content[idx]
+				key = n
+			}
+		}
+
+		if key == nil {
+			return nil
+		}
+	}
+
+	return key
+}
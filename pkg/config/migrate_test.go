@@ -0,0 +1,51 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigratesHCLConfigToYAML(t *testing.T) {
+	t.Parallel()
+
+	out := bytes.Buffer{}
+	err := MigrateConfig(bytes.NewBufferString(HCLInput), TypeHCL, &out, TypeYAML)
+	require.NoError(t, err)
+
+	assert.Contains(t, out.String(), "# migrated from the deprecated 'source_files' parameter")
+	assert.NotContains(t, out.String(), "source_files:")
+	assert.NotContains(t, out.String(), "enable_experimental")
+
+	cfg := Config{}
+	logger, _ := log.New("panic", "console")
+	err = LoadConfigFromStream(logger, &cfg, &out, TypeYAML)
+	require.NoError(t, err)
+
+	n := cfg.Namespaces[0]
+	assert.Equal(t, "nginx", n.Name)
+	assert.Equal(t, "10.0.0.1", cfg.Listen.Address)
+	assert.Equal(t, []string{"foo", "bar"}, cfg.Consul.Service.Tags)
+	assert.Equal(t, "magicapp", n.Labels["app"])
+	assert.Equal(t, FileSource{"test.log", "foo.log", "test/file_pattern_1.txt", "test/file_pattern_2.txt", "test/file_3.txt"}, n.SourceData.Files)
+
+	require.Len(t, n.RelabelConfigs, 2)
+	assert.Equal(t, "request_uri", n.RelabelConfigs[1].TargetLabel)
+	assert.Equal(t, 2, n.RelabelConfigs[1].Split)
+	assert.Equal(t, "/users/:id", n.RelabelConfigs[1].Matches[0].Replacement)
+}
+
+func TestMigrationIsIdempotent(t *testing.T) {
+	t.Parallel()
+
+	first := bytes.Buffer{}
+	require.NoError(t, MigrateConfig(bytes.NewBufferString(HCLInput), TypeHCL, &first, TypeYAML))
+
+	second := bytes.Buffer{}
+	require.NoError(t, MigrateConfig(bytes.NewBufferString(HCLInput), TypeHCL, &second, TypeYAML))
+
+	assert.Equal(t, first.String(), second.String())
+}
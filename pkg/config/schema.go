@@ -0,0 +1,133 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// schemaDescriptions contains the descriptions of the configuration structs
+// that are included in the JSON schema (mirroring their doc comments)
+var schemaDescriptions = map[string]string{
+	"Config":                "Configuration of the prometheus-nginxlog-exporter",
+	"ListenConfig":          "Configuration of the built-in webserver",
+	"ConsulConfig":          "Connection to a Consul server that the exporter should register itself at",
+	"ConsulServiceConfig":   "Consul service that the exporter should use",
+	"VictoriaMetricsConfig": "VictoriaMetrics instance that the exporter should periodically push its metrics to",
+	"RemoteWriteConfig":     "Prometheus remote-write endpoint that the exporter should periodically send its metrics to",
+	"NamespaceGroup":        "Group of namespaces whose metrics should additionally be exported in aggregated form",
+	"NamespaceConfig":       "A single metric namespace",
+	"SourceData":            "Log sources of a namespace",
+	"SyslogSource":          "Syslog server that log lines are received on",
+	"MetricsConfig":         "Settings for the metrics of a namespace",
+	"LokiConfig":            "Grafana Loki instance that parsed log lines should be forwarded to",
+	"RelabelConfig":         "Re-labeling configuration for taking over label values from an access log line into a metric",
+	"RelabelValueMatch":     "A single label match statement",
+}
+
+// JSONSchema generates a JSON schema (draft-07) for the YAML configuration
+// file format. Property names are taken from the `yaml` struct tags and
+// constraints from the `validate` struct tags.
+func JSONSchema() ([]byte, error) {
+	schema := schemaForType(reflect.TypeOf(Config{}))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "prometheus-nginxlog-exporter configuration"
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func schemaForType(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	schema := make(map[string]interface{})
+
+	switch t.Kind() {
+	case reflect.String:
+		schema["type"] = "string"
+	case reflect.Bool:
+		schema["type"] = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema["type"] = "integer"
+	case reflect.Float32, reflect.Float64:
+		schema["type"] = "number"
+	case reflect.Slice, reflect.Array:
+		schema["type"] = "array"
+		schema["items"] = schemaForType(t.Elem())
+	case reflect.Map:
+		schema["type"] = "object"
+		schema["additionalProperties"] = schemaForType(t.Elem())
+	case reflect.Struct:
+		schema["type"] = "object"
+		if d, ok := schemaDescriptions[t.Name()]; ok {
+			schema["description"] = d
+		}
+
+		properties := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+
+			name := yamlFieldName(f)
+			if name == "" {
+				continue
+			}
+
+			property := schemaForType(f.Type)
+			applyValidateTag(property, f.Tag.Get("validate"))
+			properties[name] = property
+		}
+
+		schema["properties"] = properties
+	}
+
+	return schema
+}
+
+// yamlFieldName returns the name under which yaml.v3 expects a struct field,
+// or an empty string if the field is ignored
+func yamlFieldName(f reflect.StructField) string {
+	tag := f.Tag.Get("yaml")
+	if tag == "-" {
+		return ""
+	}
+
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name
+	}
+
+	return strings.ToLower(f.Name)
+}
+
+func applyValidateTag(schema map[string]interface{}, tag string) {
+	if tag == "" {
+		return
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(rule, "=")
+
+		switch key {
+		case "min", "max":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+
+			if schema["type"] == "string" {
+				schema[key+"Length"] = n
+			} else if key == "min" {
+				schema["minimum"] = n
+			} else {
+				schema["maximum"] = n
+			}
+		case "oneof":
+			schema["enum"] = strings.Fields(value)
+		}
+	}
+}
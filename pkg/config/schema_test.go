@@ -0,0 +1,49 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONSchemaUsesYAMLPropertyNames(t *testing.T) {
+	t.Parallel()
+
+	out, err := JSONSchema()
+	require.NoError(t, err)
+
+	var schema map[string]interface{}
+	require.NoError(t, json.Unmarshal(out, &schema))
+
+	assert.Equal(t, "http://json-schema.org/draft-07/schema#", schema["$schema"])
+
+	properties := schema["properties"].(map[string]interface{})
+	assert.Contains(t, properties, "listen")
+	assert.Contains(t, properties, "enable_experimental")
+
+	namespace := properties["namespaces"].(map[string]interface{})["items"].(map[string]interface{})
+	nsProperties := namespace["properties"].(map[string]interface{})
+
+	assert.Contains(t, nsProperties, "name")
+	assert.Contains(t, nsProperties, "relabel_configs")
+	assert.NotContains(t, nsProperties, "orderedlabelnames")
+	assert.Equal(t, map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "number"}}, nsProperties["histogram_buckets"])
+}
+
+func TestJSONSchemaAppliesValidateTags(t *testing.T) {
+	t.Parallel()
+
+	out, err := JSONSchema()
+	require.NoError(t, err)
+
+	var schema map[string]interface{}
+	require.NoError(t, json.Unmarshal(out, &schema))
+
+	listen := schema["properties"].(map[string]interface{})["listen"].(map[string]interface{})
+	port := listen["properties"].(map[string]interface{})["port"].(map[string]interface{})
+
+	assert.Equal(t, float64(0), port["minimum"])
+	assert.Equal(t, float64(65535), port["maximum"])
+}
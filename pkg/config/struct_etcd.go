@@ -0,0 +1,58 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// DefaultEtcdPrefix is the key prefix under which the namespace
+// configurations are read from etcd if no other prefix is configured
+const DefaultEtcdPrefix = "/nginxlog-exporter/namespaces/"
+
+// EtcdTLSConfig describes how to connect to etcd using TLS
+type EtcdTLSConfig struct {
+	CAFile             string `hcl:"ca_file" yaml:"ca_file"`
+	CertFile           string `hcl:"cert_file" yaml:"cert_file"`
+	KeyFile            string `hcl:"key_file" yaml:"key_file"`
+	InsecureSkipVerify bool   `hcl:"insecure_skip_verify" yaml:"insecure_skip_verify"`
+}
+
+// EtcdPrefixOrDefault returns the configured etcd key prefix or the default
+// value if no configuration was provided.
+func (c *Config) EtcdPrefixOrDefault() string {
+	if c.EtcdPrefix == "" {
+		return DefaultEtcdPrefix
+	}
+
+	return c.EtcdPrefix
+}
+
+// TLSConfig builds the TLS client configuration for connecting to etcd
+func (t *EtcdTLSConfig) TLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+
+	if t.CAFile != "" {
+		ca, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read etcd CA file: %s", err.Error())
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("could not parse etcd CA file '%s'", t.CAFile)
+		}
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load etcd client certificate: %s", err.Error())
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The values that can be looked up in a GeoIP database
+const (
+	GeoIPCountryCode = "country_code"
+	GeoIPCity        = "city"
+	GeoIPASN         = "asn"
+	GeoIPOrg         = "org"
+)
+
+// GeoIPFieldPrefix is prepended to the names of the fields that the looked up
+// values are stored in, so that they do not collide with the fields of the
+// log format
+const GeoIPFieldPrefix = "geoip_"
+
+// GeoIPConfig describes how to label metrics with the location of the client
+// address ($remote_addr) of a request, looked up in a MaxMind database
+type GeoIPConfig struct {
+	DatabasePath string   `hcl:"database_path" yaml:"database_path"`
+	Labels       []string `hcl:"labels" yaml:"labels"`
+}
+
+// Validate checks that a database is configured and that all labels can be
+// looked up
+func (g *GeoIPConfig) Validate() error {
+	if g.DatabasePath == "" {
+		return errors.New("geoip requires a database_path")
+	}
+
+	if len(g.Labels) == 0 {
+		return errors.New("geoip requires at least one label")
+	}
+
+	for _, l := range g.Labels {
+		switch l {
+		case GeoIPCountryCode, GeoIPCity, GeoIPASN, GeoIPOrg:
+		default:
+			return fmt.Errorf("unsupported geoip label '%s'; must be one of [%s, %s, %s, %s]", l, GeoIPCountryCode, GeoIPCity, GeoIPASN, GeoIPOrg)
+		}
+	}
+
+	return nil
+}
+
+// RelabelConfigs returns a relabeling configuration for each label, which
+// maps the looked up value to a label of the same name
+func (g *GeoIPConfig) RelabelConfigs() []RelabelConfig {
+	if g == nil {
+		return nil
+	}
+
+	cfgs := make([]RelabelConfig, len(g.Labels))
+	for i, l := range g.Labels {
+		cfgs[i] = RelabelConfig{TargetLabel: l, SourceValue: GeoIPFieldPrefix + l}
+	}
+
+	return cfgs
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// KafkaSource describes a Kafka topic whose messages contain log lines
+type KafkaSource struct {
+	Brokers []string `hcl:"brokers" yaml:"brokers"`
+	Topic   string   `hcl:"topic" yaml:"topic"`
+	GroupID string   `hcl:"group_id" yaml:"group_id"`
+
+	// InitialOffset determines where to start consuming if the consumer
+	// group has no committed offset yet
+	InitialOffset string `hcl:"initial_offset" yaml:"initial_offset" validate:"oneof=earliest latest"`
+
+	TLS *KafkaTLSConfig `hcl:"tls" yaml:"tls"`
+}
+
+// KafkaTLSConfig describes how to connect to Kafka brokers using TLS
+type KafkaTLSConfig struct {
+	CAFile             string `hcl:"ca_file" yaml:"ca_file"`
+	CertFile           string `hcl:"cert_file" yaml:"cert_file"`
+	KeyFile            string `hcl:"key_file" yaml:"key_file"`
+	InsecureSkipVerify bool   `hcl:"insecure_skip_verify" yaml:"insecure_skip_verify"`
+}
+
+// Validate checks that all required settings of the Kafka source are present
+func (k *KafkaSource) Validate() error {
+	if len(k.Brokers) == 0 {
+		return errors.New("kafka source requires at least one broker")
+	}
+
+	if k.Topic == "" {
+		return errors.New("kafka source requires a topic")
+	}
+
+	if k.GroupID == "" {
+		return errors.New("kafka source requires a group_id")
+	}
+
+	if _, err := k.ConsumeFromEarliest(); err != nil {
+		return err
+	}
+
+	if k.TLS != nil {
+		if _, err := k.TLS.TLSConfig(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ConsumeFromEarliest returns true if the consumer group should start at the
+// earliest available message when it has no committed offset yet, and false
+// if it should only consume new messages (the default).
+func (k *KafkaSource) ConsumeFromEarliest() (bool, error) {
+	switch k.InitialOffset {
+	case "earliest":
+		return true, nil
+	case "latest", "":
+		return false, nil
+	default:
+		return false, fmt.Errorf("initial_offset must be one of 'earliest' or 'latest', got '%s'", k.InitialOffset)
+	}
+}
+
+// TLSConfig builds the TLS client configuration for connecting to the brokers
+func (t *KafkaTLSConfig) TLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+
+	if t.CAFile != "" {
+		ca, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read Kafka CA file: %s", err.Error())
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("could not parse Kafka CA file '%s'", t.CAFile)
+		}
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load Kafka client certificate: %s", err.Error())
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"os"
+)
+
+// Defaults of the Kubernetes namespace discovery
+const (
+	DefaultKubernetesPathAnnotation   = "prometheus.io/nginxlog-path"
+	DefaultKubernetesFormatAnnotation = "prometheus.io/nginxlog-format"
+	DefaultKubernetesMetricsPrefix    = "nginx"
+	DefaultKubernetesPodLabel         = "pod"
+)
+
+// KubernetesDiscoveryConfig describes how namespaces are discovered from the
+// annotations of Kubernetes pods. Each pod with a log path annotation becomes
+// a namespace that is named after the pod.
+type KubernetesDiscoveryConfig struct {
+	// Namespaces are the Kubernetes namespaces in which pods are watched; if
+	// empty, pods are watched in all namespaces
+	Namespaces []string `hcl:"namespaces" yaml:"namespaces"`
+
+	// LabelSelector restricts the watched pods (like "app=nginx")
+	LabelSelector string `hcl:"label_selector" yaml:"label_selector"`
+
+	// NodeName restricts the watched pods to the pods of a single node (the
+	// value of the NODE_NAME environment variable by default), which is what
+	// a DaemonSet needs
+	NodeName string `hcl:"node_name" yaml:"node_name"`
+
+	// PathAnnotation contains the log file path(s) of a pod (separated by
+	// commas), and FormatAnnotation its log format; pods without a format
+	// annotation use Format
+	PathAnnotation   string `hcl:"path_annotation" yaml:"path_annotation"`
+	FormatAnnotation string `hcl:"format_annotation" yaml:"format_annotation"`
+	Format           string `hcl:"format" yaml:"format"`
+
+	// MetricsPrefix is the common metrics prefix of all discovered namespaces,
+	// which are distinguished by the PodLabel label (since pod names are no
+	// valid metric names)
+	MetricsPrefix string `hcl:"metrics_prefix" yaml:"metrics_prefix"`
+	PodLabel      string `hcl:"pod_label" yaml:"pod_label"`
+}
+
+// NodeNameOrDefault returns the configured node name or the value of the
+// NODE_NAME environment variable if no configuration was provided.
+func (k *KubernetesDiscoveryConfig) NodeNameOrDefault() string {
+	if k.NodeName == "" {
+		return os.Getenv("NODE_NAME")
+	}
+
+	return k.NodeName
+}
+
+// PathAnnotationOrDefault returns the configured log path annotation or the
+// default value if no configuration was provided.
+func (k *KubernetesDiscoveryConfig) PathAnnotationOrDefault() string {
+	if k.PathAnnotation == "" {
+		return DefaultKubernetesPathAnnotation
+	}
+
+	return k.PathAnnotation
+}
+
+// FormatAnnotationOrDefault returns the configured log format annotation or
+// the default value if no configuration was provided.
+func (k *KubernetesDiscoveryConfig) FormatAnnotationOrDefault() string {
+	if k.FormatAnnotation == "" {
+		return DefaultKubernetesFormatAnnotation
+	}
+
+	return k.FormatAnnotation
+}
+
+// MetricsPrefixOrDefault returns the configured metrics prefix or the default
+// value if no configuration was provided.
+func (k *KubernetesDiscoveryConfig) MetricsPrefixOrDefault() string {
+	if k.MetricsPrefix == "" {
+		return DefaultKubernetesMetricsPrefix
+	}
+
+	return k.MetricsPrefix
+}
+
+// PodLabelOrDefault returns the configured name of the pod label or the
+// default value if no configuration was provided.
+func (k *KubernetesDiscoveryConfig) PodLabelOrDefault() string {
+	if k.PodLabel == "" {
+		return DefaultKubernetesPodLabel
+	}
+
+	return k.PodLabel
+}
@@ -1,52 +1,287 @@
 package config
 
 import (
+	"crypto/sha256"
 	"errors"
+	"fmt"
+	"math"
+	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/log"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/relabeling/regexcache"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // NamespaceConfig is a struct describing single metric namespaces
 type NamespaceConfig struct {
 	Name string `hcl:",key"`
 
-	NamespaceLabelName string `hcl:"namespace_label" yaml:"namespace_label"`
-	NamespaceLabels    map[string]string
+	NamespaceLabelName string            `hcl:"namespace_label" yaml:"namespace_label"`
+	NamespaceLabels    map[string]string `yaml:"-"`
+
+	// NamespaceLabelValue overrides the value of the namespace label, which
+	// is the namespace name by default
+	NamespaceLabelValue string `yaml:"-"`
 
 	MetricsOverride *struct {
 		Prefix string `hcl:"prefix" yaml:"prefix"`
+		Suffix string `hcl:"suffix" yaml:"suffix"`
 	} `hcl:"metrics_override" yaml:"metrics_override"`
-	NamespacePrefix string
+	NamespacePrefix string `yaml:"-"`
 
 	SourceFiles      []string          `hcl:"source_files" yaml:"source_files"`
 	SourceData       SourceData        `hcl:"source" yaml:"source"`
-	Parser           string            `hcl:"parser" yaml:"parser"`
+	Parser           string            `hcl:"parser" yaml:"parser" validate:"oneof=text json logfmt regex csv tsv cloud_run apache"`
 	Format           string            `hcl:"format" yaml:"format"`
 	Labels           map[string]string `hcl:"labels" yaml:"labels"`
 	RelabelConfigs   []RelabelConfig   `hcl:"relabel" yaml:"relabel_configs"`
 	HistogramBuckets []float64         `hcl:"histogram_buckets" yaml:"histogram_buckets"`
-	MetricsConfig    MetricsConfig     `hcl:"metrics" yaml:"metrics"`
+	SLOThresholds    []float64         `hcl:"slo_thresholds" yaml:"slo_thresholds"`
+
+	// CompiledFormatRegexp is the compiled format of the regex parser
+	CompiledFormatRegexp *regexp.Regexp `yaml:"-"`
+
+	// JSONFieldMap maps the canonical (NGINX variable) field names to the
+	// keys that are actually used in JSON log lines; only used by the json
+	// parser
+	JSONFieldMap map[string]string `hcl:"json_field_map" yaml:"json_field_map"`
+
+	// CSVHeader contains the field names of the columns for the csv and tsv
+	// parsers; CSVDelimiter overrides their default delimiter (a comma or a
+	// tab, respectively)
+	CSVHeader    []string `hcl:"csv_header" yaml:"csv_header"`
+	CSVDelimiter string   `hcl:"csv_delimiter" yaml:"csv_delimiter"`
+
+	// MultilineStartPattern matches the first line of log records that span
+	// multiple lines; if set, the lines of log files are joined to records
+	// before they are parsed
+	MultilineStartPattern         string         `hcl:"multiline_start_pattern" yaml:"multiline_start_pattern"`
+	CompiledMultilineStartPattern *regexp.Regexp `yaml:"-"`
+
+	// DecomposeRequest splits $request into the request_method, request_uri
+	// and server_protocol fields, so that they can be used for relabeling
+	DecomposeRequest bool `hcl:"decompose_request" yaml:"decompose_request"`
+
+	// HistogramBucketsByMetric overrides HistogramBuckets for single
+	// histograms; the keys are the HistogramBuckets* constants
+	HistogramBucketsByMetric map[string][]float64 `hcl:"histogram_buckets_by_metric" yaml:"histogram_buckets_by_metric"`
+
+	// MetricHelp overrides the help strings of single metrics; the keys are
+	// the metric names without the namespace prefix
+	MetricHelp map[string]string `hcl:"metric_help" yaml:"metric_help"`
+
+	// HistogramLabels restricts the labels of histogram metrics to the given
+	// label names; if empty, histograms use all labels
+	HistogramLabels []string      `hcl:"histogram_labels" yaml:"histogram_labels"`
+	MetricsConfig   MetricsConfig `hcl:"metrics" yaml:"metrics"`
 
 	PrintLog bool `hcl:"print_log" yaml:"print_log"`
 
-	OrderedLabelNames  []string
-	OrderedLabelValues []string
+	// MetricsEndpoint is an additional URL path at which only the metrics of
+	// this namespace are served
+	MetricsEndpoint string `hcl:"metrics_endpoint" yaml:"metrics_endpoint"`
+
+	PathHistogram         bool                   `hcl:"path_histogram" yaml:"path_histogram"`
+	PathHistogramPatterns []PathNormalizePattern `hcl:"path_pattern" yaml:"path_histogram_patterns"`
+	MaxPathHistogramPaths int                    `hcl:"max_path_histogram_paths" yaml:"max_path_histogram_paths"`
+
+	CustomGaugeMetrics []CustomGaugeConfig `hcl:"custom_gauge" yaml:"custom_gauge_metrics"`
+
+	// LabelExpirySeconds is the number of seconds after which label
+	// combinations of custom gauges are removed if they were not observed
+	// again; if not set, they are never removed
+	LabelExpirySeconds int `hcl:"label_expiry_seconds" yaml:"label_expiry_seconds"`
+
+	// TimestampTimezone is the timezone that $time_local values without an
+	// UTC offset were written in (for example, "Europe/Berlin")
+	TimestampTimezone string `hcl:"timestamp_timezone" yaml:"timestamp_timezone"`
+
+	// InjectFileLabel adds a "log_file" label to all metrics, containing the
+	// name of the log file that a line was read from (the full path if
+	// FilenameLabelFull is set)
+	InjectFileLabel   bool `hcl:"inject_file_label" yaml:"inject_file_label"`
+	FilenameLabelFull bool `hcl:"filename_label_full" yaml:"filename_label_full"`
+
+	Loki *LokiConfig `hcl:"loki" yaml:"loki"`
+
+	// GeoIP adds labels with the location of the client address
+	GeoIP *GeoIPConfig `hcl:"geoip" yaml:"geoip"`
+
+	// ParseErrorLog writes lines that failed to parse to a file
+	ParseErrorLog *ParseErrorLogConfig `hcl:"parse_error_log" yaml:"parse_error_log"`
+
+	// DeadLetterFile is a file that lines which failed to parse are written
+	// to (as JSON lines) in the background, so that writing them does not
+	// slow down processing; the file is rotated when it exceeds
+	// MaxDeadLetterFileSizeMB megabytes (if set)
+	DeadLetterFile          string `hcl:"dead_letter_file" yaml:"dead_letter_file"`
+	MaxDeadLetterFileSizeMB int    `hcl:"max_dead_letter_file_size_mb" yaml:"max_dead_letter_file_size_mb" validate:"min=0"`
+
+	// SampleRate is the fraction of log lines that are processed (between 0
+	// and 1); all other lines are skipped without being parsed. Counters are
+	// scaled up to compensate for the skipped lines.
+	SampleRate float64 `hcl:"sample_rate" yaml:"sample_rate"`
+
+	// WorkerCount is the number of goroutines that process the log lines of
+	// each source of this namespace in parallel (1 if not set)
+	WorkerCount int `hcl:"worker_count" yaml:"worker_count" validate:"min=0"`
+
+	// StreamMode indicates that the access log was written by the NGINX
+	// stream module (TCP/UDP proxying) instead of the HTTP module
+	StreamMode bool `hcl:"stream_mode" yaml:"stream_mode"`
+
+	OrderedLabelNames  []string `yaml:"-"`
+	OrderedLabelValues []string `yaml:"-"`
+
+	// FileGlobs contains the glob patterns of the file sources, which are
+	// replaced with the matching files by ResolveGlobs
+	FileGlobs []string `yaml:"-"`
+}
+
+// LokiConfig describes a Grafana Loki instance that parsed log lines should be
+// forwarded to
+type LokiConfig struct {
+	PushURL    string            `hcl:"push_url" yaml:"push_url"`
+	Labels     map[string]string `hcl:"labels" yaml:"labels"`
+	BatchSize  int               `hcl:"batch_size" yaml:"batch_size"`
+	LokiFields []string          `hcl:"fields" yaml:"fields"`
+}
+
+// PathNormalizePattern describes a replacement that is applied to request
+// paths before they are used as label values (for example, for replacing
+// numeric IDs with a placeholder)
+type PathNormalizePattern struct {
+	RegexpString string `hcl:",key" yaml:"regexp"`
+	Replacement  string `hcl:"replacement" yaml:"replacement"`
+
+	CompiledRegexp *regexp.Regexp `yaml:"-"`
+}
+
+// CustomGaugeConfig describes a gauge that exposes the most recently observed
+// value of a log field
+type CustomGaugeConfig struct {
+	Name        string   `hcl:",key" yaml:"name"`
+	SourceField string   `hcl:"source_field" yaml:"source_field"`
+	Help        string   `hcl:"help" yaml:"help"`
+	Labels      []string `hcl:"labels" yaml:"labels"`
 }
 
 type SourceData struct {
 	Files  FileSource    `hcl:"files" yaml:"files"`
 	Syslog *SyslogSource `hcl:"syslog" yaml:"syslog"`
+	Kafka  *KafkaSource  `hcl:"kafka" yaml:"kafka"`
+	HTTP   *HTTPSource   `hcl:"http" yaml:"http"`
+
+	// Journal reads the log lines that a systemd unit wrote to the journal;
+	// this requires a build with the "journal" build tag
+	Journal *JournalSource `hcl:"journal" yaml:"journal"`
+
+	// Stdin reads log lines from the exporter's standard input; only one
+	// namespace may do so
+	Stdin bool `hcl:"stdin" yaml:"stdin"`
+
+	// WatchDir watches the directories of glob patterns in Files, so that
+	// files that are created later are followed, too
+	WatchDir bool `hcl:"watch_dir" yaml:"watch_dir"`
+
+	// CursorDir is a directory in which the position of the last processed
+	// line of each followed file is stored, so that following continues
+	// there after a restart
+	CursorDir string `hcl:"cursor_dir" yaml:"cursor_dir"`
+}
+
+// CursorFile returns the file in CursorDir that the position in a followed
+// file is stored in, or an empty string if no CursorDir is configured. The
+// name contains a hash of the file's absolute path, so that files with the
+// same name in different directories do not share a cursor.
+func (s *SourceData) CursorFile(filename string) string {
+	if s.CursorDir == "" {
+		return ""
+	}
+
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+
+	hash := sha256.Sum256([]byte(filename))
+	return filepath.Join(s.CursorDir, fmt.Sprintf("%s-%x.json", filepath.Base(filename), hash[:8]))
 }
 
 type FileSource []string
 
+// JournalSource describes a systemd unit whose journal messages are log lines
+type JournalSource struct {
+	Unit string `hcl:"unit" yaml:"unit"`
+
+	// CursorFile is the file that the position of the last processed message
+	// is stored in, so that reading can continue after a restart
+	CursorFile string `hcl:"cursor_file" yaml:"cursor_file"`
+}
+
 type SyslogSource struct {
-	ListenAddress string   `hcl:"listen_address" yaml:"listen_address"`
-	Format        string   `hcl:"format" yaml:"format"`
-	Tags          []string `hcl:"tags" yaml:"tags"`
+	ListenAddress  string   `hcl:"listen_address" yaml:"listen_address"`
+	Format         string   `hcl:"format" yaml:"format" validate:"oneof=rfc3164 rfc5424 rfc6587 auto"`
+	Tags           []string `hcl:"tags" yaml:"tags"`
+	MaxConnections int      `hcl:"max_connections" yaml:"max_connections"`
+
+	// ReconnectDelay is the time to wait before restarting a syslog server
+	// that stopped unexpectedly
+	ReconnectDelay string `hcl:"reconnect_delay" yaml:"reconnect_delay"`
+}
+
+// ReconnectDelayOrDefault returns the configured time to wait before
+// restarting the syslog server, or the default value (5 seconds) if no
+// configuration was provided.
+func (s *SyslogSource) ReconnectDelayOrDefault() (time.Duration, error) {
+	if s.ReconnectDelay == "" {
+		return 5 * time.Second, nil
+	}
+
+	d, err := time.ParseDuration(s.ReconnectDelay)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse reconnect_delay '%s': %s", s.ReconnectDelay, err.Error())
+	}
+
+	if d < 0 {
+		return 0, fmt.Errorf("reconnect_delay must not be negative, got '%s'", s.ReconnectDelay)
+	}
+
+	return d, nil
+}
+
+// HTTPSource describes an HTTP endpoint that is periodically polled for new
+// log lines
+type HTTPSource struct {
+	URL           string `hcl:"url" yaml:"url"`
+	PollInterval  string `hcl:"poll_interval" yaml:"poll_interval"`
+	BearerToken   string `hcl:"bearer_token" yaml:"bearer_token"`
+	TLSSkipVerify bool   `hcl:"tls_skip_verify" yaml:"tls_skip_verify"`
+}
+
+// PollIntervalOrDefault returns the configured time between two requests to
+// the HTTP endpoint, or the default value (10 seconds) if no configuration
+// was provided.
+func (h *HTTPSource) PollIntervalOrDefault() (time.Duration, error) {
+	if h.PollInterval == "" {
+		return 10 * time.Second, nil
+	}
+
+	d, err := time.ParseDuration(h.PollInterval)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse poll_interval '%s': %s", h.PollInterval, err.Error())
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("poll_interval must be positive, got '%s'", h.PollInterval)
+	}
+
+	return d, nil
 }
 
 type MetricsConfig struct {
@@ -56,12 +291,323 @@ type MetricsConfig struct {
 	DisableRequestBytesTotal      bool `hcl:"disable_request_bytes_total" yaml:"disable_request_bytes_total"`
 	DisableUpstreamSeconds        bool `hcl:"disable_upstream_seconds" yaml:"disable_upstream_seconds"`
 	DisableUpstreamConnectSeconds bool `hcl:"disable_upstream_connect_seconds" yaml:"disable_upstream_connect_seconds"`
-	DisableResponseSeconds		  bool `hcl:"disable_response_seconds" yaml:"disable_response_seconds"`
+	DisableUpstreamHeaderSeconds  bool `hcl:"disable_upstream_header_seconds" yaml:"disable_upstream_header_seconds"`
+	DisableResponseSeconds        bool `hcl:"disable_response_seconds" yaml:"disable_response_seconds"`
+	DisableUpstreamBytesSent      bool `hcl:"disable_upstream_bytes_sent" yaml:"disable_upstream_bytes_sent"`
+	DisableUpstreamBytesReceived  bool `hcl:"disable_upstream_bytes_received" yaml:"disable_upstream_bytes_received"`
+	DisableSSLHandshakeSeconds    bool `hcl:"disable_ssl_handshake_seconds" yaml:"disable_ssl_handshake_seconds"`
+	DisableGzipRatio              bool `hcl:"disable_gzip_ratio" yaml:"disable_gzip_ratio"`
+
+	// PerStatusCodeCounters exports a separate counter per HTTP status code
+	// instead of the status label of the response count metric
+	PerStatusCodeCounters bool `hcl:"per_status_code_counters" yaml:"per_status_code_counters"`
+
+	// EnableCacheMetrics adds a cache_status label (from
+	// $upstream_cache_status) and counters of cache hits and misses
+	EnableCacheMetrics bool `hcl:"enable_cache_metrics" yaml:"enable_cache_metrics"`
+
+	// EnableRequestCompletionLabel adds a request_completion label (from
+	// $request_completion) that tells complete and interrupted requests apart
+	EnableRequestCompletionLabel bool `hcl:"enable_request_completion_label" yaml:"enable_request_completion_label"`
+
+	// GroupStatusCodes replaces the status label with a status_class label
+	// ("2xx", "3xx", ...) to reduce the cardinality of all metrics
+	GroupStatusCodes bool `hcl:"group_status_codes" yaml:"group_status_codes"`
+
+	// UpstreamResponseTimeAggregation controls how multiple upstream response
+	// times (for example, when NGINX retried a request) are combined into one
+	// observation
+	UpstreamResponseTimeAggregation string `hcl:"upstream_response_time_aggregation" yaml:"upstream_response_time_aggregation" validate:"oneof=sum max last first"`
+
+	// AverageUpstreamTimes makes the upstream response, connect and header
+	// times of requests that were passed to multiple upstreams the average
+	// instead of the sum of the individual times
+	AverageUpstreamTimes bool `hcl:"average_upstream_times" yaml:"average_upstream_times"`
+
+	// AdaptiveBuckets adds larger buckets to the upstream time histogram
+	// when more than AdaptiveBucketsOverflowPct percent of the observations
+	// exceed its largest bucket (up to AdaptiveBucketsMaxValue)
+	AdaptiveBuckets            bool    `hcl:"adaptive_buckets" yaml:"adaptive_buckets"`
+	AdaptiveBucketsOverflowPct float64 `hcl:"adaptive_buckets_overflow_pct" yaml:"adaptive_buckets_overflow_pct" validate:"min=0,max=100"`
+	AdaptiveBucketsMaxValue    float64 `hcl:"adaptive_buckets_max_value" yaml:"adaptive_buckets_max_value"`
+
+	// NativeHistograms additionally exposes the response and upstream time
+	// histograms as native (sparse) histograms
+	NativeHistograms bool `hcl:"native_histograms" yaml:"native_histograms"`
+
+	TrackUpstreamConnectByPeer bool      `hcl:"track_upstream_connect_by_peer" yaml:"track_upstream_connect_by_peer"`
+	UpstreamPeerBuckets        []float64 `hcl:"upstream_peer_buckets" yaml:"upstream_peer_buckets"`
+
+	GzipRatioBuckets []float64 `hcl:"gzip_ratio_buckets" yaml:"gzip_ratio_buckets"`
+
+	TrackResponseSizeBuckets bool    `hcl:"track_response_size_buckets" yaml:"track_response_size_buckets"`
+	ResponseSizeBucketBytes  []int64 `hcl:"response_size_bucket_bytes" yaml:"response_size_bucket_bytes"`
+
+	TrackConnections        bool `hcl:"track_connections" yaml:"track_connections"`
+	ConnectionWindowSeconds int  `hcl:"connection_window_seconds" yaml:"connection_window_seconds"`
+
+	// TimestampFormat is the layout (as understood by Go's time.Parse) of
+	// $time_local values
+	TimestampFormat string `hcl:"timestamp_format" yaml:"timestamp_format"`
+
+	SummaryMaxAge     string `hcl:"summary_max_age" yaml:"summary_max_age"`
+	SummaryAgeBuckets int    `hcl:"summary_age_buckets" yaml:"summary_age_buckets"`
+
+	// SummaryQuantiles are the quantiles that the time summaries export; if
+	// empty, the median, 90th and 99th percentiles are exported
+	SummaryQuantiles []float64 `hcl:"summary_quantiles" yaml:"summary_quantiles"`
+
+	TrackResponseBytesPercentile  bool    `hcl:"track_response_bytes_percentile" yaml:"track_response_bytes_percentile"`
+	ResponseBytesPercentile       float64 `hcl:"response_bytes_percentile" yaml:"response_bytes_percentile" validate:"min=0,max=1"`
+	ResponseBytesPercentileWindow int     `hcl:"response_bytes_percentile_window" yaml:"response_bytes_percentile_window"`
+
+	// MaxLabelCombinations limits the number of distinct label value
+	// combinations; further combinations are counted in a shared overflow
+	// series. If not set, the number is not limited.
+	MaxLabelCombinations int `hcl:"max_label_combinations" yaml:"max_label_combinations" validate:"min=0"`
+
+	// ParseErrorThreshold is the fraction of the lines of the last minute
+	// that may fail to parse before the parse_error_rate_threshold_exceeded
+	// gauge is set to 1. If not set, the gauge is not exported.
+	ParseErrorThreshold float64 `hcl:"parse_error_threshold" yaml:"parse_error_threshold" validate:"min=0,max=1"`
+
+	// ScrapeTimeoutBudgetMs is the time (in milliseconds) for which the
+	// periodic cleanup work of the namespace is paused while its metrics are
+	// scraped. If not set, the cleanup work is not paused.
+	ScrapeTimeoutBudgetMs int `hcl:"scrape_timeout_budget_ms" yaml:"scrape_timeout_budget_ms" validate:"min=0"`
+
+	// BatchFlushInterval makes the counters and histograms (and summaries)
+	// collect their updates and apply them at this interval, instead of
+	// updating them for every log line
+	BatchFlushInterval string `hcl:"batch_flush_interval" yaml:"batch_flush_interval"`
+
+	// AggregateHistograms makes the histograms (and summaries) collect their
+	// observations and apply them at the batch flush interval (or every
+	// second, if no interval is configured), while the counters are still
+	// updated for every log line
+	AggregateHistograms bool `hcl:"aggregate_histograms" yaml:"aggregate_histograms"`
+}
+
+// ScrapeTimeoutBudget returns the maximum time for which the periodic
+// cleanup work is paused during a scrape, or 0 if it is not paused
+func (m *MetricsConfig) ScrapeTimeoutBudget() time.Duration {
+	return time.Duration(m.ScrapeTimeoutBudgetMs) * time.Millisecond
+}
+
+// ConnectionWindowSecondsOrDefault returns the configured number of seconds
+// after which a connection is no longer considered active, or the default
+// value (75 seconds, which is NGINX's default keepalive_timeout) if no
+// configuration was provided.
+func (m *MetricsConfig) ConnectionWindowSecondsOrDefault() int {
+	if m.ConnectionWindowSeconds <= 0 {
+		return 75
+	}
+
+	return m.ConnectionWindowSeconds
+}
+
+// UpstreamPeerBucketsOrDefault returns the configured histogram buckets for
+// the per-upstream-peer connect time histogram, or a coarse default set of
+// buckets if no configuration was provided. As there is one series per peer
+// for each bucket, the default is deliberately kept small.
+func (m *MetricsConfig) UpstreamPeerBucketsOrDefault() []float64 {
+	if len(m.UpstreamPeerBuckets) == 0 {
+		return []float64{0.005, 0.05, 0.5, 5}
+	}
+
+	return m.UpstreamPeerBuckets
+}
+
+// GzipRatioBucketsOrDefault returns the configured histogram buckets for the
+// gzip compression ratio, or a default set of buckets covering typical
+// compression ratios if no configuration was provided.
+func (m *MetricsConfig) GzipRatioBucketsOrDefault() []float64 {
+	if len(m.GzipRatioBuckets) == 0 {
+		return []float64{1, 1.5, 2, 3, 5, 10}
+	}
+
+	return m.GzipRatioBuckets
+}
+
+// AdaptiveBucketsOverflowPctOrDefault returns the configured percentage of
+// observations exceeding the largest bucket that causes an adaptive histogram
+// to be expanded, or the default value (10 percent) if no configuration was
+// provided.
+func (m *MetricsConfig) AdaptiveBucketsOverflowPctOrDefault() float64 {
+	if m.AdaptiveBucketsOverflowPct <= 0 {
+		return 10
+	}
+
+	return m.AdaptiveBucketsOverflowPct
+}
+
+// AdaptiveBucketsMaxValueOrDefault returns the configured upper limit for
+// buckets added to adaptive histograms, or the default value (300 seconds) if
+// no configuration was provided.
+func (m *MetricsConfig) AdaptiveBucketsMaxValueOrDefault() float64 {
+	if m.AdaptiveBucketsMaxValue <= 0 {
+		return 300
+	}
+
+	return m.AdaptiveBucketsMaxValue
+}
+
+// UpstreamResponseTimeAggregationOrDefault returns the configured aggregation
+// mode for multiple upstream response times, or the mode of the other
+// upstream times (see UpstreamTimeAggregation) if no configuration was
+// provided.
+func (m *MetricsConfig) UpstreamResponseTimeAggregationOrDefault() string {
+	if m.UpstreamResponseTimeAggregation == "" {
+		return m.UpstreamTimeAggregation()
+	}
+
+	return m.UpstreamResponseTimeAggregation
+}
+
+// UpstreamTimeAggregation returns the aggregation mode for multiple upstream
+// connect and header times; "avg" if average_upstream_times is set, "sum"
+// otherwise.
+func (m *MetricsConfig) UpstreamTimeAggregation() string {
+	if m.AverageUpstreamTimes {
+		return "avg"
+	}
+
+	return "sum"
+}
+
+// DefaultResponseSizeBucketBytes are the upper bounds of the default response
+// size categories (1KB, 10KB, 100KB and 1MB)
+var DefaultResponseSizeBucketBytes = []int64{1024, 10240, 102400, 1048576}
+
+// ResponseSizeBucketBytesOrDefault returns the configured upper bounds of the
+// response size categories, or DefaultResponseSizeBucketBytes if no
+// configuration was provided.
+func (m *MetricsConfig) ResponseSizeBucketBytesOrDefault() []int64 {
+	if len(m.ResponseSizeBucketBytes) == 0 {
+		return DefaultResponseSizeBucketBytes
+	}
+
+	return m.ResponseSizeBucketBytes
+}
+
+// DefaultTimestampFormat is the layout of NGINX's default $time_local format
+const DefaultTimestampFormat = "02/Jan/2006:15:04:05 -0700"
+
+// TimestampFormatOrDefault returns the configured layout of $time_local
+// values, or DefaultTimestampFormat if no configuration was provided.
+func (m *MetricsConfig) TimestampFormatOrDefault() string {
+	if m.TimestampFormat == "" {
+		return DefaultTimestampFormat
+	}
+
+	return m.TimestampFormat
+}
+
+// SummaryMaxAgeOrDefault returns the configured duration for which
+// observations are kept in summaries, or the default value (10 minutes) if
+// no configuration was provided.
+func (m *MetricsConfig) SummaryMaxAgeOrDefault() (time.Duration, error) {
+	if m.SummaryMaxAge == "" {
+		return 10 * time.Minute, nil
+	}
+
+	d, err := time.ParseDuration(m.SummaryMaxAge)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse summary_max_age '%s': %s", m.SummaryMaxAge, err.Error())
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("summary_max_age must be positive, got '%s'", m.SummaryMaxAge)
+	}
+
+	return d, nil
+}
+
+// BatchFlushIntervalOrDefault returns the configured interval at which
+// batched metric updates are applied, or 0 if metrics are updated for every
+// log line (the default).
+func (m *MetricsConfig) BatchFlushIntervalOrDefault() (time.Duration, error) {
+	if m.BatchFlushInterval == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(m.BatchFlushInterval)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse batch_flush_interval '%s': %s", m.BatchFlushInterval, err.Error())
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("batch_flush_interval must be positive, got '%s'", m.BatchFlushInterval)
+	}
+
+	return d, nil
+}
+
+// SummaryAgeBucketsOrDefault returns the configured number of buckets used to
+// expire summary observations, or the default value (5) if no configuration
+// was provided.
+func (m *MetricsConfig) SummaryAgeBucketsOrDefault() uint32 {
+	if m.SummaryAgeBuckets <= 0 {
+		return 5
+	}
+
+	return uint32(m.SummaryAgeBuckets)
+}
+
+// SummaryObjectivesOrDefault returns the objectives (quantiles with their
+// allowed absolute error) of the time summaries. The error of each quantile
+// is a tenth of its distance to 0 or 1, so the default quantiles get the
+// Prometheus client library's usual objectives.
+func (m *MetricsConfig) SummaryObjectivesOrDefault() map[float64]float64 {
+	quantiles := m.SummaryQuantiles
+	if len(quantiles) == 0 {
+		quantiles = []float64{0.5, 0.9, 0.99}
+	}
+
+	objectives := make(map[float64]float64, len(quantiles))
+	for _, q := range quantiles {
+		objectives[q] = math.Min(q, 1-q) / 10
+	}
+
+	return objectives
+}
+
+// ResponseBytesPercentileOrDefault returns the configured response size
+// percentile or the default value (0.99) if no configuration was provided.
+func (m *MetricsConfig) ResponseBytesPercentileOrDefault() float64 {
+	if m.ResponseBytesPercentile <= 0 || m.ResponseBytesPercentile > 1 {
+		return 0.99
+	}
+
+	return m.ResponseBytesPercentile
+}
+
+// ResponseBytesPercentileWindowOrDefault returns the configured number of
+// observations that the response size percentile is computed over, or the
+// default value (1000) if no configuration was provided.
+func (m *MetricsConfig) ResponseBytesPercentileWindowOrDefault() int {
+	if m.ResponseBytesPercentileWindow <= 0 {
+		return 1000
+	}
+
+	return m.ResponseBytesPercentileWindow
 }
 
 // StabilityWarnings tests if the NamespaceConfig uses any configuration settings
 // that are not yet declared "stable"
 func (c *NamespaceConfig) StabilityWarnings() error {
+	if c.SourceData.Kafka != nil {
+		return fmt.Errorf("namespace %s: the 'kafka' log source is experimental", c.Name)
+	}
+
+	if c.SourceData.Journal != nil {
+		return fmt.Errorf("namespace %s: the 'journal' log source is experimental", c.Name)
+	}
+
+	if c.MetricsConfig.NativeHistograms {
+		return fmt.Errorf("namespace %s: the 'native_histograms' option is experimental", c.Name)
+	}
+
 	return nil
 }
 
@@ -92,6 +638,54 @@ func (c *NamespaceConfig) ResolveDeprecations() {
 	}
 }
 
+// ApplyDefaults sets all settings of the namespace that are not explicitly
+// set (that is, that have their zero value) to the settings of defaults.
+// Nested settings (like the metrics settings) are merged individually, and
+// the name of the namespace is never taken from the defaults.
+func (c *NamespaceConfig) ApplyDefaults(defaults *NamespaceConfig) {
+	target := reflect.ValueOf(c).Elem()
+	source := reflect.ValueOf(defaults).Elem()
+
+	for i := 0; i < target.NumField(); i++ {
+		f := target.Type().Field(i)
+		if f.Name == "Name" || f.Tag.Get("yaml") == "-" {
+			continue
+		}
+
+		applyDefaultValue(target.Field(i), source.Field(i))
+	}
+}
+
+// applyDefaultValue sets target to a copy of source if target has its zero
+// value; structs are merged field by field
+func applyDefaultValue(target reflect.Value, source reflect.Value) {
+	switch target.Kind() {
+	case reflect.Struct:
+		for i := 0; i < target.NumField(); i++ {
+			if target.Type().Field(i).IsExported() {
+				applyDefaultValue(target.Field(i), source.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if target.Len() == 0 && source.Len() > 0 {
+			target.Set(reflect.AppendSlice(reflect.MakeSlice(source.Type(), 0, source.Len()), source))
+		}
+	case reflect.Map:
+		if target.Len() == 0 && source.Len() > 0 {
+			copied := reflect.MakeMapWithSize(source.Type(), source.Len())
+			for _, k := range source.MapKeys() {
+				copied.SetMapIndex(k, source.MapIndex(k))
+			}
+
+			target.Set(copied)
+		}
+	default:
+		if target.IsZero() {
+			target.Set(source)
+		}
+	}
+}
+
 // ResolveGlobs finds globs in file sources and expand them to the actual
 // list of files
 func (c *NamespaceConfig) ResolveGlobs(logger *log.Logger) error {
@@ -99,6 +693,8 @@ func (c *NamespaceConfig) ResolveGlobs(logger *log.Logger) error {
 		resolvedFiles := make([]string, 0)
 		for _, sf := range c.SourceData.Files {
 			if strings.Contains(sf, "*") {
+				c.FileGlobs = append(c.FileGlobs, sf)
+
 				matches, err := filepath.Glob(sf)
 				if err != nil {
 					return err
@@ -121,25 +717,495 @@ func (c *NamespaceConfig) ResolveGlobs(logger *log.Logger) error {
 // Compile compiles the configuration (mostly regular expressions that are used
 // in configuration variables) for later use
 func (c *NamespaceConfig) Compile() error {
+	// namespaces may share the underlying arrays of their lists (for example,
+	// when they were copied from the defaults); the compiled values are
+	// stored in copies, so that namespaces can be compiled concurrently
+	c.RelabelConfigs = append([]RelabelConfig(nil), c.RelabelConfigs...)
+	c.PathHistogramPatterns = append([]PathNormalizePattern(nil), c.PathHistogramPatterns...)
+
 	for i := range c.RelabelConfigs {
 		if err := c.RelabelConfigs[i].Compile(); err != nil {
 			return err
 		}
 	}
+
+	if _, err := c.MetricsConfig.SummaryMaxAgeOrDefault(); err != nil {
+		return err
+	}
+
+	if _, err := c.MetricsConfig.BatchFlushIntervalOrDefault(); err != nil {
+		return err
+	}
+
+	if t := c.MetricsConfig.ParseErrorThreshold; t < 0 || t >= 1 {
+		return fmt.Errorf("parse_error_threshold must be at least 0 and less than 1, got %v", t)
+	}
+
+	if dir := c.SourceData.CursorDir; dir != "" {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("cursor_dir '%s' is not a directory", dir)
+		}
+	}
+
+	if c.MetricsConfig.ScrapeTimeoutBudgetMs < 0 {
+		return fmt.Errorf("scrape_timeout_budget_ms must not be negative, got %d", c.MetricsConfig.ScrapeTimeoutBudgetMs)
+	}
+
+	for _, q := range c.MetricsConfig.SummaryQuantiles {
+		if q <= 0 || q >= 1 {
+			return fmt.Errorf("summary_quantiles must be between 0 and 1 (exclusive), got %g", q)
+		}
+	}
+
+	if _, err := c.TimestampLocation(); err != nil {
+		return err
+	}
+
+	if len(c.JSONFieldMap) > 0 && c.Parser != "json" {
+		return fmt.Errorf("json_field_map can only be used with the json parser")
+	}
+
+	if c.Parser == "regex" {
+		if err := c.compileFormatRegexp(); err != nil {
+			return err
+		}
+	}
+
+	if c.MultilineStartPattern != "" {
+		r, err := regexcache.Compile(c.MultilineStartPattern)
+		if err != nil {
+			return fmt.Errorf("could not compile multiline_start_pattern '%s': %s", c.MultilineStartPattern, err.Error())
+		}
+
+		c.CompiledMultilineStartPattern = r
+	}
+
+	if c.Parser == "csv" || c.Parser == "tsv" {
+		if len(c.CSVHeader) == 0 {
+			return fmt.Errorf("the %s parser requires a csv_header", c.Parser)
+		}
+
+		if _, err := c.CSVDelimiterOrDefault(); err != nil {
+			return err
+		}
+	} else if len(c.CSVHeader) > 0 || c.CSVDelimiter != "" {
+		return fmt.Errorf("csv_header and csv_delimiter can only be used with the csv and tsv parsers")
+	}
+
+	for metric := range c.HistogramBucketsByMetric {
+		known := false
+		for _, k := range histogramBucketsKeys {
+			known = known || k == metric
+		}
+
+		if !known {
+			return fmt.Errorf("histogram_buckets_by_metric: unknown histogram '%s' (must be one of %s)", metric, strings.Join(histogramBucketsKeys, ", "))
+		}
+	}
+
+	if c.InjectFileLabel {
+		if _, ok := c.Labels[FileLabelName]; ok {
+			return fmt.Errorf("label '%s' cannot be used together with inject_file_label", FileLabelName)
+		}
+
+		for i := range c.RelabelConfigs {
+			for _, l := range c.RelabelConfigs[i].TargetLabels() {
+				if l == FileLabelName {
+					return fmt.Errorf("label '%s' cannot be used together with inject_file_label", FileLabelName)
+				}
+			}
+		}
+	}
+
+	if c.SourceData.Syslog != nil {
+		if _, err := c.SourceData.Syslog.ReconnectDelayOrDefault(); err != nil {
+			return err
+		}
+	}
+
+	if c.SourceData.Kafka != nil {
+		if err := c.SourceData.Kafka.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.SourceData.Journal != nil && c.SourceData.Journal.Unit == "" {
+		return errors.New("journal source requires a unit")
+	}
+
+	if c.SourceData.HTTP != nil {
+		if c.SourceData.HTTP.URL == "" {
+			return errors.New("http source requires a url")
+		}
+
+		if _, err := c.SourceData.HTTP.PollIntervalOrDefault(); err != nil {
+			return err
+		}
+	}
+
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return fmt.Errorf("sample_rate must be between 0 and 1, got %v", c.SampleRate)
+	}
+
+	if c.WorkerCount < 0 {
+		return fmt.Errorf("worker_count must not be negative, got %d", c.WorkerCount)
+	}
+
+	if c.ParseErrorLog != nil {
+		if err := c.ParseErrorLog.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.DeadLetterFile != "" && c.ParseErrorLog != nil && c.ParseErrorLog.Enabled {
+		return errors.New("dead_letter_file cannot be combined with parse_error_log")
+	}
+
+	if c.MaxDeadLetterFileSizeMB < 0 {
+		return fmt.Errorf("max_dead_letter_file_size_mb must not be negative, got %d", c.MaxDeadLetterFileSizeMB)
+	}
+
+	if c.GeoIP != nil {
+		if err := c.GeoIP.Validate(); err != nil {
+			return err
+		}
+
+		for _, l := range c.GeoIP.Labels {
+			for i := range c.RelabelConfigs {
+				for _, target := range c.RelabelConfigs[i].TargetLabels() {
+					if target == l {
+						return fmt.Errorf("label '%s' cannot be used both as geoip label and as relabeling target", l)
+					}
+				}
+			}
+		}
+	}
+
+	for i := range c.PathHistogramPatterns {
+		p := &c.PathHistogramPatterns[i]
+		r, err := regexcache.Compile(p.RegexpString)
+		if err != nil {
+			return fmt.Errorf("could not compile regexp '%s': %s", p.RegexpString, err.Error())
+		}
+
+		p.CompiledRegexp = r
+	}
+
+	for _, g := range c.CustomGaugeMetrics {
+		if g.Name == "" || g.SourceField == "" {
+			return fmt.Errorf("custom gauge metrics need a name and a source_field")
+		}
+	}
+
+	switch c.MetricsConfig.UpstreamResponseTimeAggregation {
+	case "", "sum", "max", "last", "first":
+	default:
+		return fmt.Errorf("upstream_response_time_aggregation must be one of sum, max, last or first, got '%s'", c.MetricsConfig.UpstreamResponseTimeAggregation)
+	}
+
+	if a := c.MetricsConfig.UpstreamResponseTimeAggregation; c.MetricsConfig.AverageUpstreamTimes && a != "" {
+		return fmt.Errorf("average_upstream_times cannot be combined with upstream_response_time_aggregation '%s'", a)
+	}
+
+	bounds := c.MetricsConfig.ResponseSizeBucketBytes
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i] <= bounds[i-1] {
+			return fmt.Errorf("response_size_bucket_bytes must be in ascending order, got %v", bounds)
+		}
+	}
+
 	if c.NamespaceLabelName != "" {
 		c.NamespaceLabels = make(map[string]string)
 		c.NamespaceLabels[c.NamespaceLabelName] = c.Name
+		if c.NamespaceLabelValue != "" {
+			c.NamespaceLabels[c.NamespaceLabelName] = c.NamespaceLabelValue
+		}
 	}
 
 	c.OrderLabels()
 	c.NamespacePrefix = c.Name
-	if c.MetricsOverride != nil {
-		c.NamespacePrefix = c.MetricsOverride.Prefix
+	if o := c.MetricsOverride; o != nil {
+		// with only a suffix, the suffix is appended to the namespace name
+		if o.Prefix != "" || o.Suffix == "" {
+			c.NamespacePrefix = o.Prefix
+		}
+
+		if o.Suffix != "" {
+			c.NamespacePrefix += "_" + o.Suffix
+		}
+	}
+
+	if c.MetricsConfig.PerStatusCodeCounters {
+		// metric names must not start with a digit
+		if c.NamespacePrefix == "" {
+			return errors.New("per_status_code_counters cannot be used with an empty metrics prefix")
+		}
+
+		// the per-status-code counters make the response count redundant
+		c.MetricsConfig.DisableCountTotal = true
 	}
 
 	return nil
 }
 
+// HistogramBucketsWithSLOThresholds returns the configured histogram buckets
+// (or the Prometheus default buckets), extended by the configured SLO
+// thresholds so that each threshold is a bucket boundary
+func (c *NamespaceConfig) HistogramBucketsWithSLOThresholds() []float64 {
+	return c.withSLOThresholds(c.HistogramBuckets)
+}
+
+// Keys of histogram_buckets_by_metric
+const (
+	HistogramBucketsResponseSeconds        = "response_seconds_buckets"
+	HistogramBucketsUpstreamSeconds        = "upstream_seconds_buckets"
+	HistogramBucketsUpstreamConnectSeconds = "upstream_connect_seconds_buckets"
+	HistogramBucketsUpstreamHeaderSeconds  = "upstream_header_seconds_buckets"
+	HistogramBucketsPathResponseSeconds    = "path_response_seconds_buckets"
+	HistogramBucketsSessionSeconds         = "session_seconds_buckets"
+	HistogramBucketsSSLHandshakeSeconds    = "ssl_handshake_seconds_buckets"
+)
+
+var histogramBucketsKeys = []string{
+	HistogramBucketsResponseSeconds,
+	HistogramBucketsUpstreamSeconds,
+	HistogramBucketsUpstreamConnectSeconds,
+	HistogramBucketsUpstreamHeaderSeconds,
+	HistogramBucketsPathResponseSeconds,
+	HistogramBucketsSessionSeconds,
+	HistogramBucketsSSLHandshakeSeconds,
+}
+
+// HistogramBucketsFor returns the buckets of a single histogram (identified
+// by one of the HistogramBuckets* constants): the buckets configured for this
+// histogram in histogram_buckets_by_metric, or else the histogram_buckets of
+// the namespace, extended by the configured SLO thresholds. If neither is
+// configured, nil is returned so that the Prometheus default buckets are used.
+func (c *NamespaceConfig) HistogramBucketsFor(metric string) []float64 {
+	if buckets := c.HistogramBucketsByMetric[metric]; len(buckets) > 0 {
+		return c.withSLOThresholds(buckets)
+	}
+
+	return c.HistogramBucketsWithSLOThresholds()
+}
+
+// CSVDelimiterOrDefault returns the configured csv_delimiter, or the default
+// delimiter of the parser (a tab for tsv, a comma otherwise).
+func (c *NamespaceConfig) CSVDelimiterOrDefault() (rune, error) {
+	if c.CSVDelimiter == "" {
+		if c.Parser == "tsv" {
+			return '\t', nil
+		}
+
+		return ',', nil
+	}
+
+	delimiter := []rune(c.CSVDelimiter)
+	if len(delimiter) != 1 || strings.ContainsRune("\"\r\n", delimiter[0]) {
+		return 0, fmt.Errorf("invalid csv_delimiter '%s': must be a single character other than a quote or line break", c.CSVDelimiter)
+	}
+
+	return delimiter[0], nil
+}
+
+func (c *NamespaceConfig) compileFormatRegexp() error {
+	r, err := regexcache.Compile(c.Format)
+	if err != nil {
+		return fmt.Errorf("could not compile format regexp '%s': %s", c.Format, err.Error())
+	}
+
+	for _, name := range r.SubexpNames() {
+		if name != "" {
+			c.CompiledFormatRegexp = r
+			return nil
+		}
+	}
+
+	return fmt.Errorf("format regexp '%s' does not contain any named capture groups", c.Format)
+}
+
+// MetricHelpFor returns the help string configured in metric_help for the
+// metric with the given name (without the namespace prefix), or def if there
+// is none.
+func (c *NamespaceConfig) MetricHelpFor(name string, def string) string {
+	if help, ok := c.MetricHelp[name]; ok && help != "" {
+		return help
+	}
+
+	return def
+}
+
+func (c *NamespaceConfig) withSLOThresholds(buckets []float64) []float64 {
+	if len(c.SLOThresholds) == 0 {
+		return buckets
+	}
+
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+
+	seen := make(map[float64]struct{})
+	result := make([]float64, 0, len(buckets)+len(c.SLOThresholds))
+
+	for _, b := range append(append([]float64{}, buckets...), c.SLOThresholds...) {
+		if _, ok := seen[b]; !ok {
+			seen[b] = struct{}{}
+			result = append(result, b)
+		}
+	}
+
+	sort.Float64s(result)
+	return result
+}
+
+// MaxPathHistogramPathsOrDefault returns the configured maximum number of
+// distinct paths in the path histogram, or the default value (100) if no
+// configuration was provided.
+func (c *NamespaceConfig) MaxPathHistogramPathsOrDefault() int {
+	if c.MaxPathHistogramPaths <= 0 {
+		return 100
+	}
+
+	return c.MaxPathHistogramPaths
+}
+
+// TimestampLocation returns the timezone that is assumed for log timestamps
+// that do not contain an UTC offset. If no timezone was configured, the local
+// timezone of the exporter is used.
+func (c *NamespaceConfig) TimestampLocation() (*time.Location, error) {
+	if c.TimestampTimezone == "" {
+		return time.Local, nil
+	}
+
+	loc, err := time.LoadLocation(c.TimestampTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("could not load timestamp_timezone '%s': %s", c.TimestampTimezone, err.Error())
+	}
+
+	return loc, nil
+}
+
+// SampleRateOrDefault returns the configured sample rate, or 1 (all lines are
+// processed) if no sample rate was configured
+func (c *NamespaceConfig) SampleRateOrDefault() float64 {
+	if c.SampleRate == 0 {
+		return 1
+	}
+
+	return c.SampleRate
+}
+
+// MaxDeadLetterFileSize returns the size (in bytes) at which the dead letter
+// file is rotated, or 0 if it is never rotated
+func (c *NamespaceConfig) MaxDeadLetterFileSize() int64 {
+	return int64(c.MaxDeadLetterFileSizeMB) * 1024 * 1024
+}
+
+// WorkerCountOrDefault returns the configured number of workers, or 1 if no
+// worker count was configured
+func (c *NamespaceConfig) WorkerCountOrDefault() int {
+	if c.WorkerCount <= 0 {
+		return 1
+	}
+
+	return c.WorkerCount
+}
+
+// SamplingNotice describes the statistical implications of the configured
+// sample rate, or returns an empty string if all lines are processed
+func (c *NamespaceConfig) SamplingNotice() string {
+	rate := c.SampleRateOrDefault()
+	if rate >= 1 {
+		return ""
+	}
+
+	return fmt.Sprintf("namespace %s only processes a random %.4g%% of all log lines. "+
+		"Counters (like http_response_count_total and the byte counters) are scaled by %.4g and are estimates, "+
+		"whose relative error grows for label combinations with few requests. "+
+		"Histograms and summaries are not scaled: their quantiles stay unbiased, but their _count and _sum only reflect the sampled lines. "+
+		"Gauges that are derived from individual lines (like the last line timestamp) may lag behind, "+
+		"and lines that are forwarded to Loki are sampled, too.",
+		c.Name, rate*100, 1/rate)
+}
+
+// SameLabels tests if another (compiled) NamespaceConfig results in metrics
+// with exactly the same label names (in the same order) as this one. Label
+// values that are derived from log lines may change, but the static label
+// values and the namespace label are part of the metric descriptors and need
+// to match, too. Since the static labels are sorted when compiling, a
+// different order of their definitions does not make a difference; the
+// order of the relabelings does, since it determines the order of the labels.
+func (c *NamespaceConfig) SameLabels(other *NamespaceConfig) bool {
+	return reflect.DeepEqual(c.labelSignature(), other.labelSignature())
+}
+
+// SameMetrics tests if another (compiled) NamespaceConfig results in exactly
+// the same metrics as this one: besides the labels, this includes the metric
+// names, buckets, help texts and all other metric settings.
+func (c *NamespaceConfig) SameMetrics(other *NamespaceConfig) bool {
+	return c.SameLabels(other) && reflect.DeepEqual(c.metricSignature(), other.metricSignature())
+}
+
+func (c *NamespaceConfig) labelSignature() []string {
+	signature := make([]string, 0)
+	for i, name := range c.OrderedLabelNames {
+		signature = append(signature, "static:"+name+"="+c.OrderedLabelValues[i])
+	}
+
+	namespaceLabels := make([]string, 0, len(c.NamespaceLabels))
+	for name, value := range c.NamespaceLabels {
+		namespaceLabels = append(namespaceLabels, "namespace:"+name+"="+value)
+	}
+	sort.Strings(namespaceLabels)
+	signature = append(signature, namespaceLabels...)
+
+	for i := range c.RelabelConfigs {
+		r := &c.RelabelConfigs[i]
+		signature = append(signature, fmt.Sprintf("relabel:%s:%t:%t", strings.Join(r.TargetLabels(), ","), r.OnlyCounter, r.Exclude))
+	}
+
+	if c.GeoIP != nil {
+		signature = append(signature, "geoip:"+strings.Join(c.GeoIP.Labels, ","))
+	}
+
+	for _, r := range c.OptionalRelabelConfigs() {
+		signature = append(signature, fmt.Sprintf("optional:%s:%t", r.TargetLabel, r.Exclude))
+	}
+
+	for _, l := range c.HistogramLabels {
+		signature = append(signature, "histogram:"+l)
+	}
+
+	for _, g := range c.CustomGaugeMetrics {
+		signature = append(signature, "gauge:"+g.Name+":"+strings.Join(g.Labels, ","))
+	}
+
+	return signature
+}
+
+// metricSignature contains all settings (except for the labels) that the
+// metrics of the namespace are created from
+func (c *NamespaceConfig) metricSignature() []interface{} {
+	patterns := make([]string, 0, len(c.PathHistogramPatterns))
+	for _, p := range c.PathHistogramPatterns {
+		patterns = append(patterns, p.RegexpString+"="+p.Replacement)
+	}
+
+	return []interface{}{
+		c.NamespacePrefix,
+		c.MetricsConfig,
+		c.HistogramBuckets,
+		c.HistogramBucketsByMetric,
+		c.SLOThresholds,
+		c.MetricHelp,
+		c.PathHistogram,
+		c.MaxPathHistogramPaths,
+		patterns,
+		c.CustomGaugeMetrics,
+		c.StreamMode,
+	}
+}
+
 // OrderLabels builds two lists of label keys and values, ordered by label name
 func (c *NamespaceConfig) OrderLabels() {
 	keys := make([]string, 0, len(c.Labels))
@@ -155,6 +1221,79 @@ func (c *NamespaceConfig) OrderLabels() {
 		values[i] = c.Labels[k]
 	}
 
+	if c.InjectFileLabel {
+		// the value is set for each source file separately
+		keys = append(keys, FileLabelName)
+		values = append(values, "")
+	}
+
 	c.OrderedLabelNames = keys
 	c.OrderedLabelValues = values
 }
+
+// CacheStatusLabelName is the name of the label that contains the
+// $upstream_cache_status of a request when EnableCacheMetrics is set
+const CacheStatusLabelName = "cache_status"
+
+// RequestCompletionLabelName is the name of the label that tells complete
+// ("ok") and interrupted ("incomplete") requests apart when
+// EnableRequestCompletionLabel is set
+const RequestCompletionLabelName = "request_completion"
+
+// StatusClassLabelName is the name of the label that replaces the status label
+// when GroupStatusCodes is set
+const StatusClassLabelName = "status_class"
+
+// OptionalRelabelConfigs returns the relabeling configurations of the
+// built-in labels that need to be enabled in the metrics configuration
+func (c *NamespaceConfig) OptionalRelabelConfigs() []RelabelConfig {
+	var cfgs []RelabelConfig
+
+	if c.MetricsConfig.EnableCacheMetrics {
+		cfgs = append(cfgs, RelabelConfig{TargetLabel: CacheStatusLabelName, SourceValue: "upstream_cache_status"})
+	}
+
+	if c.MetricsConfig.EnableRequestCompletionLabel {
+		// $request_completion is "OK" for complete requests and empty
+		// (logged as "-") otherwise
+		cfgs = append(cfgs, RelabelConfig{
+			TargetLabel: RequestCompletionLabelName,
+			SourceValue: "request_completion",
+			Matches: []RelabelValueMatch{
+				{RegexpString: "^OK$", Replacement: "ok", CompiledRegexp: regexp.MustCompile("^OK$")},
+				{RegexpString: "^.*$", Replacement: "incomplete", CompiledRegexp: regexp.MustCompile("^.*$")},
+			},
+		})
+	}
+
+	if c.MetricsConfig.GroupStatusCodes {
+		// invalid status codes result in an empty status class
+		cfgs = append(cfgs, RelabelConfig{
+			TargetLabel: StatusClassLabelName,
+			SourceValue: "status",
+			Matches: []RelabelValueMatch{
+				{RegexpString: "^([1-5])[0-9][0-9]$", Replacement: "${1}xx", CompiledRegexp: regexp.MustCompile("^([1-5])[0-9][0-9]$")},
+			},
+		})
+
+		// excludes the default status relabeling (but not one configured
+		// explicitly, which comes first)
+		cfgs = append(cfgs, RelabelConfig{TargetLabel: "status", Exclude: true})
+	}
+
+	return cfgs
+}
+
+// FileLabelName is the name of the label that contains the source file of a
+// log line when InjectFileLabel is set
+const FileLabelName = "log_file"
+
+// FileLabelValue returns the value of the log_file label for lines read from
+// a file
+func (c *NamespaceConfig) FileLabelValue(filename string) string {
+	if c.FilenameLabelFull {
+		return filename
+	}
+
+	return filepath.Base(filename)
+}
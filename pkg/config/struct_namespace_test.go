@@ -1,8 +1,12 @@
 package config
 
 import (
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
 )
 
@@ -16,3 +20,548 @@ func TestSourceFilesAreMappedToNewSourceConfig(t *testing.T) {
 
 	require.Equal(t, FileSource{"bar.log", "baz.log"}, c.SourceData.Files)
 }
+
+func TestSummaryMaxAgeDefaultsToTenMinutes(t *testing.T) {
+	m := MetricsConfig{}
+
+	d, err := m.SummaryMaxAgeOrDefault()
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Minute, d)
+}
+
+func TestCompileRejectsInvalidSummaryMaxAge(t *testing.T) {
+	c := &NamespaceConfig{
+		Name:          "foo",
+		MetricsConfig: MetricsConfig{SummaryMaxAge: "ten minutes"},
+	}
+
+	require.Error(t, c.Compile())
+}
+
+func TestUpstreamPeerBucketsDefaultToCoarseBuckets(t *testing.T) {
+	m := MetricsConfig{}
+	require.Equal(t, []float64{0.005, 0.05, 0.5, 5}, m.UpstreamPeerBucketsOrDefault())
+
+	m.UpstreamPeerBuckets = []float64{0.1, 1}
+	require.Equal(t, []float64{0.1, 1}, m.UpstreamPeerBucketsOrDefault())
+}
+
+func TestTimestampLocationDefaultsToLocal(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo"}
+
+	loc, err := c.TimestampLocation()
+	require.NoError(t, err)
+	require.Equal(t, time.Local, loc)
+}
+
+func TestCompileRejectsUnknownTimestampTimezone(t *testing.T) {
+	c := &NamespaceConfig{
+		Name:              "foo",
+		TimestampTimezone: "Mars/Olympus_Mons",
+	}
+
+	require.Error(t, c.Compile())
+}
+
+func TestCompileRejectsUnorderedResponseSizeBuckets(t *testing.T) {
+	c := &NamespaceConfig{
+		Name:          "foo",
+		MetricsConfig: MetricsConfig{ResponseSizeBucketBytes: []int64{10240, 1024}},
+	}
+
+	require.Error(t, c.Compile())
+}
+
+func TestSLOThresholdsAreAddedToHistogramBuckets(t *testing.T) {
+	c := &NamespaceConfig{
+		HistogramBuckets: []float64{0.1, 1, 10},
+		SLOThresholds:    []float64{0.5, 1},
+	}
+
+	require.Equal(t, []float64{0.1, 0.5, 1, 10}, c.HistogramBucketsWithSLOThresholds())
+}
+
+func TestHistogramBucketsAreUnchangedWithoutSLOThresholds(t *testing.T) {
+	c := &NamespaceConfig{}
+
+	require.Nil(t, c.HistogramBucketsWithSLOThresholds())
+}
+
+func TestHistogramBucketsByMetricFallBackToHistogramBuckets(t *testing.T) {
+	c := &NamespaceConfig{
+		HistogramBucketsByMetric: map[string][]float64{
+			HistogramBucketsUpstreamSeconds: {0.01, 0.1},
+		},
+		SLOThresholds: []float64{0.5},
+	}
+
+	require.Equal(t, []float64{0.01, 0.1, 0.5}, c.HistogramBucketsFor(HistogramBucketsUpstreamSeconds))
+	require.Equal(t, prometheus.DefBuckets, c.HistogramBucketsFor(HistogramBucketsResponseSeconds))
+
+	c.SLOThresholds = nil
+	require.Nil(t, c.HistogramBucketsFor(HistogramBucketsResponseSeconds))
+
+	c.HistogramBuckets = []float64{1, 10}
+	require.Equal(t, []float64{1, 10}, c.HistogramBucketsFor(HistogramBucketsResponseSeconds))
+}
+
+func TestHistogramBucketsByMetricRejectsUnknownHistograms(t *testing.T) {
+	c := &NamespaceConfig{
+		Name:                     "foo",
+		HistogramBucketsByMetric: map[string][]float64{"response_buckets": {1}},
+	}
+
+	require.ErrorContains(t, c.Compile(), "unknown histogram 'response_buckets'")
+}
+
+func TestSummaryObjectivesDefaultToClientLibraryObjectives(t *testing.T) {
+	m := MetricsConfig{}
+	objectives := m.SummaryObjectivesOrDefault()
+
+	require.Len(t, objectives, 3)
+	require.InDelta(t, 0.05, objectives[0.5], 1e-9)
+	require.InDelta(t, 0.01, objectives[0.9], 1e-9)
+	require.InDelta(t, 0.001, objectives[0.99], 1e-9)
+}
+
+func TestSummaryQuantilesAreValidated(t *testing.T) {
+	c := &NamespaceConfig{
+		Name:          "foo",
+		MetricsConfig: MetricsConfig{SummaryQuantiles: []float64{0.75, 0.999}},
+	}
+	require.NoError(t, c.Compile())
+
+	objectives := c.MetricsConfig.SummaryObjectivesOrDefault()
+	require.Len(t, objectives, 2)
+	require.InDelta(t, 0.0001, objectives[0.999], 1e-9)
+
+	c.MetricsConfig.SummaryQuantiles = []float64{1}
+	require.ErrorContains(t, c.Compile(), "summary_quantiles")
+}
+
+func TestParseErrorLogIsValidated(t *testing.T) {
+	c := &NamespaceConfig{
+		Name:          "foo",
+		ParseErrorLog: &ParseErrorLogConfig{Enabled: true},
+	}
+	require.ErrorContains(t, c.Compile(), "requires a file")
+
+	c.ParseErrorLog.File = "/var/log/nginxlog/parse_errors.log"
+	c.ParseErrorLog.Format = "xml"
+	require.ErrorContains(t, c.Compile(), "unsupported parse_error_log format")
+
+	c.ParseErrorLog.Format = ""
+	require.NoError(t, c.Compile())
+	require.Equal(t, ParseErrorLogFormatJSON, c.ParseErrorLog.FormatOrDefault())
+}
+
+func TestPerStatusCodeCountersDisableCountTotal(t *testing.T) {
+	c := &NamespaceConfig{
+		Name:          "foo",
+		MetricsConfig: MetricsConfig{PerStatusCodeCounters: true},
+	}
+
+	require.NoError(t, c.Compile())
+	require.True(t, c.MetricsConfig.DisableCountTotal)
+}
+
+func TestSameLabelsIgnoresLabelOrder(t *testing.T) {
+	a := &NamespaceConfig{Name: "foo", Labels: map[string]string{"app": "shop", "env": "prod"}}
+	b := &NamespaceConfig{Name: "foo", Labels: map[string]string{"env": "prod", "app": "shop"}}
+
+	require.NoError(t, a.Compile())
+	require.NoError(t, b.Compile())
+
+	require.True(t, a.SameLabels(b))
+}
+
+func TestSameLabelsDetectsChangedLabels(t *testing.T) {
+	a := &NamespaceConfig{Name: "foo", Labels: map[string]string{"app": "shop"}}
+	b := &NamespaceConfig{Name: "foo", Labels: map[string]string{"app": "shop"}, RelabelConfigs: []RelabelConfig{{TargetLabel: "user", SourceValue: "remote_user"}}}
+	c := &NamespaceConfig{Name: "foo", Labels: map[string]string{"app": "blog"}}
+
+	require.NoError(t, a.Compile())
+	require.NoError(t, b.Compile())
+	require.NoError(t, c.Compile())
+
+	require.False(t, a.SameLabels(b))
+	require.False(t, a.SameLabels(c))
+}
+
+func TestSameLabelsDetectsReorderedRelabelings(t *testing.T) {
+	user := RelabelConfig{TargetLabel: "user", SourceValue: "remote_user"}
+	host := RelabelConfig{TargetLabel: "host", SourceValue: "host"}
+
+	a := &NamespaceConfig{Name: "foo", RelabelConfigs: []RelabelConfig{user, host}}
+	b := &NamespaceConfig{Name: "foo", RelabelConfigs: []RelabelConfig{host, user}}
+
+	require.NoError(t, a.Compile())
+	require.NoError(t, b.Compile())
+
+	require.False(t, a.SameLabels(b))
+}
+
+func TestSameMetricsDetectsChangedMetricSettings(t *testing.T) {
+	a := &NamespaceConfig{Name: "foo", HistogramBuckets: []float64{0.1, 1}}
+	b := &NamespaceConfig{Name: "foo", HistogramBuckets: []float64{0.1, 1}}
+	c := &NamespaceConfig{Name: "foo", HistogramBuckets: []float64{0.5, 5}}
+	d := &NamespaceConfig{Name: "foo", HistogramBuckets: []float64{0.1, 1}, MetricsOverride: &struct {
+		Prefix string `hcl:"prefix" yaml:"prefix"`
+		Suffix string `hcl:"suffix" yaml:"suffix"`
+	}{Prefix: "bar"}}
+
+	for _, ns := range []*NamespaceConfig{a, b, c, d} {
+		require.NoError(t, ns.Compile())
+	}
+
+	require.True(t, a.SameMetrics(b))
+	require.True(t, a.SameLabels(c))
+	require.False(t, a.SameMetrics(c))
+	require.False(t, a.SameMetrics(d))
+}
+
+func TestCacheMetricsAddCacheStatusLabel(t *testing.T) {
+	a := &NamespaceConfig{Name: "foo"}
+	b := &NamespaceConfig{Name: "foo", MetricsConfig: MetricsConfig{EnableCacheMetrics: true}}
+
+	require.NoError(t, a.Compile())
+	require.NoError(t, b.Compile())
+
+	require.Nil(t, a.OptionalRelabelConfigs())
+	require.Equal(t, []RelabelConfig{{TargetLabel: "cache_status", SourceValue: "upstream_cache_status"}}, b.OptionalRelabelConfigs())
+	require.False(t, a.SameLabels(b))
+}
+
+func TestRequestCompletionLabelMapsCompletion(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo", MetricsConfig: MetricsConfig{EnableRequestCompletionLabel: true}}
+
+	cfgs := c.OptionalRelabelConfigs()
+	require.Len(t, cfgs, 1)
+	require.Equal(t, "request_completion", cfgs[0].TargetLabel)
+
+	matches := cfgs[0].Matches
+	require.True(t, matches[0].CompiledRegexp.MatchString("OK"))
+	require.False(t, matches[0].CompiledRegexp.MatchString("-"))
+	require.True(t, matches[1].CompiledRegexp.MatchString(""))
+}
+
+func TestParseErrorThresholdIsValidated(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo", MetricsConfig: MetricsConfig{ParseErrorThreshold: 0.05}}
+	require.NoError(t, c.Compile())
+
+	c.MetricsConfig.ParseErrorThreshold = 1
+	require.ErrorContains(t, c.Compile(), "parse_error_threshold")
+}
+
+func TestScrapeTimeoutBudgetIsValidated(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo", MetricsConfig: MetricsConfig{ScrapeTimeoutBudgetMs: 250}}
+	require.NoError(t, c.Compile())
+	require.Equal(t, 250*time.Millisecond, c.MetricsConfig.ScrapeTimeoutBudget())
+
+	c.MetricsConfig.ScrapeTimeoutBudgetMs = -1
+	require.ErrorContains(t, c.Compile(), "scrape_timeout_budget_ms")
+}
+
+func TestCursorFileIsOnlySetWithCursorDir(t *testing.T) {
+	s := &SourceData{}
+	require.Equal(t, "", s.CursorFile("/var/log/nginx/access.log"))
+
+	s.CursorDir = "/var/lib/nginxlog-exporter"
+	a := s.CursorFile("/var/log/nginx/access.log")
+	b := s.CursorFile("/var/log/other/access.log")
+
+	require.Equal(t, "/var/lib/nginxlog-exporter", filepath.Dir(a))
+	require.True(t, strings.HasPrefix(filepath.Base(a), "access.log-"))
+	require.NotEqual(t, a, b)
+}
+
+func TestCompileRequiresExistingCursorDir(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo", SourceData: SourceData{CursorDir: t.TempDir()}}
+	require.NoError(t, c.Compile())
+
+	c.SourceData.CursorDir = filepath.Join(c.SourceData.CursorDir, "missing")
+	require.ErrorContains(t, c.Compile(), "cursor_dir")
+}
+
+func TestBatchFlushIntervalIsValidated(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo"}
+	require.NoError(t, c.Compile())
+
+	interval, err := c.MetricsConfig.BatchFlushIntervalOrDefault()
+	require.NoError(t, err)
+	require.Equal(t, time.Duration(0), interval)
+
+	c.MetricsConfig.BatchFlushInterval = "0s"
+	require.ErrorContains(t, c.Compile(), "batch_flush_interval")
+
+	c.MetricsConfig.BatchFlushInterval = "500ms"
+	require.NoError(t, c.Compile())
+}
+
+func TestUpstreamResponseTimeAggregationDefaultsToSum(t *testing.T) {
+	m := MetricsConfig{}
+	require.Equal(t, "sum", m.UpstreamResponseTimeAggregationOrDefault())
+}
+
+func TestCompileRejectsUnknownUpstreamResponseTimeAggregation(t *testing.T) {
+	ns := &NamespaceConfig{Name: "foo", MetricsConfig: MetricsConfig{UpstreamResponseTimeAggregation: "avg"}}
+	require.Error(t, ns.Compile())
+
+	ns = &NamespaceConfig{Name: "foo", MetricsConfig: MetricsConfig{UpstreamResponseTimeAggregation: "last"}}
+	require.NoError(t, ns.Compile())
+}
+
+func TestAverageUpstreamTimes(t *testing.T) {
+	m := MetricsConfig{AverageUpstreamTimes: true}
+	require.Equal(t, "avg", m.UpstreamResponseTimeAggregationOrDefault())
+	require.Equal(t, "avg", m.UpstreamTimeAggregation())
+
+	ns := &NamespaceConfig{Name: "foo", MetricsConfig: m}
+	require.NoError(t, ns.Compile())
+
+	ns.MetricsConfig.UpstreamResponseTimeAggregation = "max"
+	require.Error(t, ns.Compile())
+}
+
+func TestTimestampFormatDefaultsToNginxTimeLocal(t *testing.T) {
+	m := MetricsConfig{}
+	require.Equal(t, "02/Jan/2006:15:04:05 -0700", m.TimestampFormatOrDefault())
+
+	m.TimestampFormat = "2006-01-02T15:04:05-07:00"
+	require.Equal(t, "2006-01-02T15:04:05-07:00", m.TimestampFormatOrDefault())
+}
+
+func TestInjectFileLabelAddsLastStaticLabel(t *testing.T) {
+	ns := &NamespaceConfig{Name: "foo", Labels: map[string]string{"app": "shop"}, InjectFileLabel: true}
+	require.NoError(t, ns.Compile())
+
+	require.Equal(t, []string{"app", "log_file"}, ns.OrderedLabelNames)
+	require.Equal(t, []string{"shop", ""}, ns.OrderedLabelValues)
+
+	require.Equal(t, "shop.access.log", ns.FileLabelValue("/var/log/nginx/shop.access.log"))
+
+	ns.FilenameLabelFull = true
+	require.Equal(t, "/var/log/nginx/shop.access.log", ns.FileLabelValue("/var/log/nginx/shop.access.log"))
+}
+
+func TestInjectFileLabelRejectsConflictingLabel(t *testing.T) {
+	ns := &NamespaceConfig{Name: "foo", Labels: map[string]string{"log_file": "x"}, InjectFileLabel: true}
+	require.Error(t, ns.Compile())
+
+	ns = &NamespaceConfig{Name: "foo", RelabelConfigs: []RelabelConfig{{TargetLabel: "log_file", SourceValue: "x"}}, InjectFileLabel: true}
+	require.Error(t, ns.Compile())
+}
+
+func TestCompileValidatesKafkaSource(t *testing.T) {
+	kafka := &KafkaSource{Brokers: []string{"localhost:9092"}, Topic: "nginx", GroupID: "exporter"}
+	ns := &NamespaceConfig{Name: "foo", SourceData: SourceData{Kafka: kafka}}
+	require.NoError(t, ns.Compile())
+
+	kafka.InitialOffset = "oldest"
+	require.Error(t, ns.Compile())
+
+	kafka.InitialOffset = "earliest"
+	kafka.Topic = ""
+	require.Error(t, ns.Compile())
+}
+
+func TestKafkaSourceIsExperimental(t *testing.T) {
+	ns := &NamespaceConfig{Name: "foo"}
+	require.NoError(t, ns.StabilityWarnings())
+
+	ns.SourceData.Kafka = &KafkaSource{}
+	require.Error(t, ns.StabilityWarnings())
+}
+
+func TestNativeHistogramsAreExperimental(t *testing.T) {
+	ns := &NamespaceConfig{Name: "foo"}
+	ns.MetricsConfig.NativeHistograms = true
+	require.Error(t, ns.StabilityWarnings())
+}
+
+func TestHTTPSourcePollIntervalDefaultsToTenSeconds(t *testing.T) {
+	h := HTTPSource{}
+	d, err := h.PollIntervalOrDefault()
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Second, d)
+}
+
+func TestCompileValidatesHTTPSource(t *testing.T) {
+	ns := &NamespaceConfig{Name: "foo", SourceData: SourceData{HTTP: &HTTPSource{PollInterval: "5s"}}}
+	require.Error(t, ns.Compile())
+
+	ns.SourceData.HTTP.URL = "http://logs.example.com/nginx"
+	require.NoError(t, ns.Compile())
+
+	ns.SourceData.HTTP.PollInterval = "0s"
+	require.Error(t, ns.Compile())
+}
+
+func TestCompileRequiresSourceForFilterRelabeling(t *testing.T) {
+	ns := &NamespaceConfig{Name: "foo", RelabelConfigs: []RelabelConfig{{TargetLabel: "healthcheck", Action: "drop_if", CaptureRegexp: "^/healthz"}}}
+	require.ErrorContains(t, ns.Compile(), "requires a 'from' field")
+
+	ns.RelabelConfigs[0].SourceValue = "request_uri"
+	require.NoError(t, ns.Compile())
+	require.Empty(t, ns.RelabelConfigs[0].TargetLabels())
+}
+
+func TestCompileRejectsCaptureRelabelingWithoutNamedGroups(t *testing.T) {
+	ns := &NamespaceConfig{Name: "foo", RelabelConfigs: []RelabelConfig{{SourceValue: "request_uri", Action: "capture", CaptureRegexp: `^/api/(v\d+)`}}}
+	require.Error(t, ns.Compile())
+
+	ns.RelabelConfigs[0].CaptureRegexp = `^/api/(?P<version>v\d+)`
+	require.NoError(t, ns.Compile())
+	require.Equal(t, []string{"version"}, ns.RelabelConfigs[0].TargetLabels())
+
+	ns.RelabelConfigs[0].OnNoMatch = "drop"
+	require.Error(t, ns.Compile())
+}
+
+func TestCompileValidatesGeoIPLabels(t *testing.T) {
+	ns := &NamespaceConfig{Name: "foo", GeoIP: &GeoIPConfig{DatabasePath: "GeoLite2-City.mmdb", Labels: []string{"country_code", "region"}}}
+	require.Error(t, ns.Compile())
+
+	ns.GeoIP.Labels = []string{"country_code", "city"}
+	require.NoError(t, ns.Compile())
+
+	ns.RelabelConfigs = []RelabelConfig{{TargetLabel: "city", SourceValue: "http_x_city"}}
+	require.Error(t, ns.Compile())
+}
+
+func TestGeoIPLabelsChangeLabelSignature(t *testing.T) {
+	ns := &NamespaceConfig{Name: "foo"}
+	other := &NamespaceConfig{Name: "foo", GeoIP: &GeoIPConfig{DatabasePath: "GeoLite2-City.mmdb", Labels: []string{"country_code"}}}
+
+	require.False(t, ns.SameLabels(other))
+
+	ns.GeoIP = &GeoIPConfig{DatabasePath: "GeoLite2-Country.mmdb", Labels: []string{"country_code"}}
+	require.True(t, ns.SameLabels(other))
+}
+
+func TestCompileValidatesSampleRate(t *testing.T) {
+	ns := &NamespaceConfig{Name: "foo", SampleRate: 1.5}
+	require.Error(t, ns.Compile())
+
+	ns.SampleRate = -0.1
+	require.Error(t, ns.Compile())
+
+	ns.SampleRate = 0.1
+	require.NoError(t, ns.Compile())
+}
+
+func TestCompileValidatesWorkerCount(t *testing.T) {
+	ns := &NamespaceConfig{Name: "foo", WorkerCount: -1}
+	require.Error(t, ns.Compile())
+
+	ns.WorkerCount = 0
+	require.NoError(t, ns.Compile())
+	require.Equal(t, 1, ns.WorkerCountOrDefault())
+
+	ns.WorkerCount = 4
+	require.NoError(t, ns.Compile())
+	require.Equal(t, 4, ns.WorkerCountOrDefault())
+}
+
+func TestCompileValidatesDeadLetterFile(t *testing.T) {
+	ns := &NamespaceConfig{Name: "foo", DeadLetterFile: "/tmp/dead_letters.log", MaxDeadLetterFileSizeMB: 10}
+	require.NoError(t, ns.Compile())
+	require.Equal(t, int64(10*1024*1024), ns.MaxDeadLetterFileSize())
+
+	ns.MaxDeadLetterFileSizeMB = -1
+	require.Error(t, ns.Compile())
+
+	ns.MaxDeadLetterFileSizeMB = 0
+	ns.ParseErrorLog = &ParseErrorLogConfig{Enabled: true, File: "/tmp/parse_errors.log"}
+	require.Error(t, ns.Compile())
+}
+
+func TestSamplingNoticeOnlyForPartialSampling(t *testing.T) {
+	ns := &NamespaceConfig{Name: "foo"}
+	require.Equal(t, float64(1), ns.SampleRateOrDefault())
+	require.Empty(t, ns.SamplingNotice())
+
+	ns.SampleRate = 1
+	require.Empty(t, ns.SamplingNotice())
+
+	ns.SampleRate = 0.25
+	require.Contains(t, ns.SamplingNotice(), "25%")
+	require.Contains(t, ns.SamplingNotice(), "scaled by 4")
+}
+
+func TestJournalSourceRequiresUnitAndIsExperimental(t *testing.T) {
+	ns := &NamespaceConfig{Name: "foo", SourceData: SourceData{Journal: &JournalSource{}}}
+	require.Error(t, ns.Compile())
+	require.Error(t, ns.StabilityWarnings())
+
+	ns.SourceData.Journal.Unit = "nginx.service"
+	require.NoError(t, ns.Compile())
+}
+
+func TestJSONFieldMapRequiresJSONParser(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo", JSONFieldMap: map[string]string{"request_time": "responseTime"}}
+	require.ErrorContains(t, c.Compile(), "json_field_map")
+
+	c.Parser = "json"
+	require.NoError(t, c.Compile())
+}
+
+func TestRegexParserFormatIsCompiled(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo", Parser: "regex", Format: `(?P<status>\d+)`}
+	require.NoError(t, c.Compile())
+	require.NotNil(t, c.CompiledFormatRegexp)
+
+	c.Format = `(?P<status>\d+`
+	require.ErrorContains(t, c.Compile(), "could not compile format regexp")
+
+	c.Format = `(\d+)`
+	require.ErrorContains(t, c.Compile(), "named capture groups")
+}
+
+func TestCSVParserIsValidated(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo", Parser: "csv"}
+	require.ErrorContains(t, c.Compile(), "csv_header")
+
+	c.CSVHeader = []string{"status", "request_time"}
+	require.NoError(t, c.Compile())
+
+	c.CSVDelimiter = ";;"
+	require.ErrorContains(t, c.Compile(), "csv_delimiter")
+
+	c.Parser = "text"
+	c.CSVDelimiter = ""
+	require.ErrorContains(t, c.Compile(), "csv_header")
+}
+
+func TestCSVDelimiterDefaultsToParser(t *testing.T) {
+	c := &NamespaceConfig{Parser: "tsv"}
+	d, err := c.CSVDelimiterOrDefault()
+	require.NoError(t, err)
+	require.Equal(t, '\t', d)
+
+	c.Parser = "csv"
+	d, err = c.CSVDelimiterOrDefault()
+	require.NoError(t, err)
+	require.Equal(t, ',', d)
+}
+
+func TestMultilineStartPatternIsCompiled(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo", MultilineStartPattern: `^\{`}
+	require.NoError(t, c.Compile())
+	require.True(t, c.CompiledMultilineStartPattern.MatchString("{"))
+
+	c.MultilineStartPattern = `^(`
+	require.ErrorContains(t, c.Compile(), "multiline_start_pattern")
+}
+
+func TestGroupStatusCodesReplacesStatusLabel(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo", MetricsConfig: MetricsConfig{GroupStatusCodes: true}}
+	require.NoError(t, c.Compile())
+
+	cfgs := c.OptionalRelabelConfigs()
+	require.Len(t, cfgs, 2)
+	require.Equal(t, StatusClassLabelName, cfgs[0].TargetLabel)
+	require.Equal(t, "4xx", cfgs[0].Matches[0].CompiledRegexp.ReplaceAllString("404", cfgs[0].Matches[0].Replacement))
+	require.Equal(t, "status", cfgs[1].TargetLabel)
+	require.True(t, cfgs[1].Exclude)
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The formats in which lines that failed to parse can be logged
+const (
+	ParseErrorLogFormatJSON = "json"
+	ParseErrorLogFormatText = "text"
+)
+
+// ParseErrorLogConfig describes a file that lines which failed to parse are
+// written to, instead of the exporter's own log
+type ParseErrorLogConfig struct {
+	Enabled bool   `hcl:"enabled" yaml:"enabled"`
+	Format  string `hcl:"format" yaml:"format" validate:"oneof=json text"`
+	File    string `hcl:"file" yaml:"file"`
+}
+
+// Validate checks that a file is configured if the log is enabled and that
+// the format is supported
+func (p *ParseErrorLogConfig) Validate() error {
+	if !p.Enabled {
+		return nil
+	}
+
+	if p.File == "" {
+		return errors.New("parse_error_log requires a file")
+	}
+
+	switch p.FormatOrDefault() {
+	case ParseErrorLogFormatJSON, ParseErrorLogFormatText:
+	default:
+		return fmt.Errorf("unsupported parse_error_log format '%s'; must be one of [%s, %s]", p.Format, ParseErrorLogFormatJSON, ParseErrorLogFormatText)
+	}
+
+	return nil
+}
+
+// FormatOrDefault returns the configured format or the default value (json)
+// if no configuration was provided.
+func (p *ParseErrorLogConfig) FormatOrDefault() string {
+	if p.Format == "" {
+		return ParseErrorLogFormatJSON
+	}
+
+	return p.Format
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"regexp"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/relabeling/regexcache"
 )
 
 // RelabelConfig is a struct describing a single re-labeling configuration for taking
@@ -17,8 +19,25 @@ type RelabelConfig struct {
 	OnlyCounter bool                `hcl:"only_counter" yaml:"only_counter"`
 	Exclude     bool                `hcl:"exclude" yaml:"exclude"`
 
-	WhitelistExists bool
-	WhitelistMap    map[string]interface{}
+	// Action is either empty (the value is mapped to the target label),
+	// "normalize" (the Patterns are applied to the value before mapping it),
+	// "capture" (a label is added for each named group of CaptureRegexp,
+	// and the target label is not used), or "keep_if" or "drop_if" (the log
+	// line is only counted if the value matches or does not match
+	// CaptureRegexp, respectively, and no label is added)
+	Action        string                 `hcl:"action" yaml:"action" validate:"oneof=normalize capture keep_if drop_if"`
+	Patterns      []PathNormalizePattern `hcl:"pattern" yaml:"patterns"`
+	CaptureRegexp string                 `hcl:"regexp" yaml:"regexp"`
+
+	// OnNoMatch determines what happens if CaptureRegexp does not match:
+	// either the captured labels are empty (the default), or the line is
+	// skipped
+	OnNoMatch string `hcl:"on_no_match" yaml:"on_no_match" validate:"oneof=empty skip"`
+
+	WhitelistExists       bool                   `yaml:"-"`
+	WhitelistMap          map[string]interface{} `yaml:"-"`
+	CompiledCaptureRegexp *regexp.Regexp         `yaml:"-"`
+	CompiledFilterRegexp  *regexp.Regexp         `yaml:"-"`
 }
 
 // RelabelValueMatch describes a single label match statement
@@ -26,11 +45,16 @@ type RelabelValueMatch struct {
 	RegexpString string `hcl:",key" yaml:"regexp"`
 	Replacement  string `hcl:"replacement"`
 
-	CompiledRegexp *regexp.Regexp
+	CompiledRegexp *regexp.Regexp `yaml:"-"`
 }
 
 // Compile compiles expressions and lookup tables for efficient later use
 func (c *RelabelConfig) Compile() error {
+	// the compiled expressions are stored in copies of the lists (see
+	// NamespaceConfig.Compile)
+	c.Matches = append([]RelabelValueMatch(nil), c.Matches...)
+	c.Patterns = append([]PathNormalizePattern(nil), c.Patterns...)
+
 	c.WhitelistMap = make(map[string]interface{})
 	c.WhitelistExists = len(c.Whitelist) > 0
 
@@ -40,7 +64,7 @@ func (c *RelabelConfig) Compile() error {
 
 	for i := range c.Matches {
 		if c.Matches[i].RegexpString != "" {
-			r, err := regexp.Compile(c.Matches[i].RegexpString)
+			r, err := regexcache.Compile(c.Matches[i].RegexpString)
 			if err != nil {
 				return fmt.Errorf("could not compile regexp '%s': %s", c.Matches[i].RegexpString, err.Error())
 			}
@@ -49,5 +73,112 @@ func (c *RelabelConfig) Compile() error {
 		}
 	}
 
+	switch c.Action {
+	case "":
+	case "normalize":
+		if err := c.compileNormalize(); err != nil {
+			return err
+		}
+	case "capture":
+		if err := c.compileCapture(); err != nil {
+			return err
+		}
+	case "keep_if", "drop_if":
+		if err := c.compileFilter(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported relabeling action '%s'", c.Action)
+	}
+
+	return nil
+}
+
+func (c *RelabelConfig) compileNormalize() error {
+	if len(c.Patterns) == 0 {
+		return fmt.Errorf("normalize relabeling of label '%s' requires at least one pattern", c.TargetLabel)
+	}
+
+	for i := range c.Patterns {
+		r, err := regexcache.Compile(c.Patterns[i].RegexpString)
+		if err != nil {
+			return fmt.Errorf("could not compile regexp '%s': %s", c.Patterns[i].RegexpString, err.Error())
+		}
+
+		c.Patterns[i].CompiledRegexp = r
+	}
+
+	return nil
+}
+
+func (c *RelabelConfig) compileCapture() error {
+	if c.OnNoMatch != "" && c.OnNoMatch != "empty" && c.OnNoMatch != "skip" {
+		return fmt.Errorf("on_no_match must be one of 'empty' or 'skip', got '%s'", c.OnNoMatch)
+	}
+
+	r, err := regexcache.Compile(c.CaptureRegexp)
+	if err != nil {
+		return fmt.Errorf("could not compile regexp '%s': %s", c.CaptureRegexp, err.Error())
+	}
+
+	c.CompiledCaptureRegexp = r
+
+	if len(c.TargetLabels()) == 0 {
+		return fmt.Errorf("capture regexp '%s' does not contain any named groups", c.CaptureRegexp)
+	}
+
 	return nil
 }
+
+func (c *RelabelConfig) compileFilter() error {
+	if c.SourceValue == "" {
+		return fmt.Errorf("%s relabeling '%s' requires a 'from' field", c.Action, c.TargetLabel)
+	}
+
+	r, err := regexcache.Compile(c.CaptureRegexp)
+	if err != nil {
+		return fmt.Errorf("could not compile regexp '%s': %s", c.CaptureRegexp, err.Error())
+	}
+
+	c.CompiledFilterRegexp = r
+	return nil
+}
+
+// IsFilter returns true if the relabeling decides whether a log line is
+// counted at all instead of adding a label
+func (c *RelabelConfig) IsFilter() bool {
+	return c.Action == "keep_if" || c.Action == "drop_if"
+}
+
+// IsCapture returns true if the relabeling adds a label for each named group
+// of its capture regexp
+func (c *RelabelConfig) IsCapture() bool {
+	return c.Action == "capture"
+}
+
+// TargetLabels returns the names of the labels that are added by the
+// relabeling; these are the named groups of the capture regexp for capture
+// relabelings, none for filters, and the target label otherwise. The capture
+// regexp needs to be compiled.
+func (c *RelabelConfig) TargetLabels() []string {
+	if c.IsFilter() {
+		return nil
+	}
+
+	if !c.IsCapture() {
+		return []string{c.TargetLabel}
+	}
+
+	var labels []string
+	if c.CompiledCaptureRegexp == nil {
+		return labels
+	}
+
+	for _, name := range c.CompiledCaptureRegexp.SubexpNames() {
+		if name != "" {
+			labels = append(labels, name)
+		}
+	}
+
+	return labels
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Defaults of the remote-write output
+const (
+	DefaultRemoteWriteQueueSize     = 10
+	DefaultRemoteWriteFlushInterval = 15 * time.Second
+)
+
+// RemoteWriteConfig describes a Prometheus remote-write endpoint that the
+// exporter should periodically send its metrics to
+type RemoteWriteConfig struct {
+	URL     string                `hcl:"url" yaml:"url"`
+	Headers map[string]string     `hcl:"headers" yaml:"headers"`
+	TLS     *RemoteWriteTLSConfig `hcl:"tls" yaml:"tls"`
+
+	// QueueSize is the number of metric snapshots that are kept while the
+	// endpoint is unavailable; once it is exceeded, the oldest snapshots are
+	// dropped
+	QueueSize int `hcl:"queue_size" yaml:"queue_size" validate:"min=0"`
+
+	FlushInterval string `hcl:"flush_interval" yaml:"flush_interval"`
+}
+
+// RemoteWriteTLSConfig describes how to connect to the remote-write endpoint
+// using TLS
+type RemoteWriteTLSConfig struct {
+	CAFile             string `hcl:"ca_file" yaml:"ca_file"`
+	CertFile           string `hcl:"cert_file" yaml:"cert_file"`
+	KeyFile            string `hcl:"key_file" yaml:"key_file"`
+	InsecureSkipVerify bool   `hcl:"insecure_skip_verify" yaml:"insecure_skip_verify"`
+}
+
+// Validate checks that all required settings of the remote-write output are
+// present and valid
+func (r *RemoteWriteConfig) Validate() error {
+	if r.URL == "" {
+		return errors.New("remote_write requires a url")
+	}
+
+	if r.QueueSize < 0 {
+		return fmt.Errorf("remote_write queue_size must not be negative, got %d", r.QueueSize)
+	}
+
+	if _, err := r.FlushIntervalOrDefault(); err != nil {
+		return fmt.Errorf("invalid remote_write flush_interval: %s", err.Error())
+	}
+
+	if r.TLS != nil {
+		if _, err := r.TLS.TLSConfig(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// QueueSizeOrDefault returns the configured queue size or the default value
+// if no configuration was provided.
+func (r *RemoteWriteConfig) QueueSizeOrDefault() int {
+	if r.QueueSize == 0 {
+		return DefaultRemoteWriteQueueSize
+	}
+
+	return r.QueueSize
+}
+
+// FlushIntervalOrDefault returns the configured interval at which metrics are
+// sent, or the default value if no configuration was provided.
+func (r *RemoteWriteConfig) FlushIntervalOrDefault() (time.Duration, error) {
+	if r.FlushInterval == "" {
+		return DefaultRemoteWriteFlushInterval, nil
+	}
+
+	d, err := time.ParseDuration(r.FlushInterval)
+	if err != nil {
+		return 0, err
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive, got %s", r.FlushInterval)
+	}
+
+	return d, nil
+}
+
+// TLSConfig builds the TLS client configuration for connecting to the
+// remote-write endpoint
+func (t *RemoteWriteTLSConfig) TLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+
+	if t.CAFile != "" {
+		ca, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read remote_write CA file: %s", err.Error())
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("could not parse remote_write CA file '%s'", t.CAFile)
+		}
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load remote_write client certificate: %s", err.Error())
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
@@ -1,5 +1,18 @@
 package config
 
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/relabeling/regexcache"
+)
+
 // StartupFlags is a struct containing options that can be passed via the
 // command line
 type StartupFlags struct {
@@ -10,10 +23,29 @@ type StartupFlags struct {
 	Namespace                  string
 	ListenAddress              string
 	ListenPort                 int
+	TLSCertFile                string
+	TLSKeyFile                 string
+	TLSClientCAFile            string
 	EnableExperimentalFeatures bool
 	MetricsEndpoint            string
 	VerifyConfig               bool
+	ValidateConfig             bool
+	NoEnvExpand                bool
+	AutoRegister               bool
 	Version                    bool
+	ExportConfigSchema         bool
+	MigrateConfig              bool
+	NginxConfig                string
+	NginxLogFormatName         string
+	MigrateFrom                string
+	MigrateTo                  string
+	PrintLabels                string
+	DryRun                     int
+	DebugBufferSize            int
+	PushGatewayURL             string
+	PushInterval               string
+	OTLPEndpoint               string
+	OTLPProtocol               string
 
 	LogLevel  string
 	LogFormat string
@@ -22,12 +54,104 @@ type StartupFlags struct {
 	MemProfile string
 }
 
+// EnvironmentPrefix is the prefix of the environment variables that startup
+// flags can be read from
+const EnvironmentPrefix = "NGINXLOG_"
+
+// FromEnvironment populates all flags that were not explicitly passed on the
+// command line from environment variables. The variable of a flag is named
+// after the flag, prefixed with EnvironmentPrefix (for example,
+// NGINXLOG_LISTEN_PORT for -listen-port). fs needs to be the (already parsed)
+// flag set that the fields of f are bound to. As a result, flags take
+// precedence over environment variables, which take precedence over the
+// default values.
+func (f *StartupFlags) FromEnvironment(fs *flag.FlagSet) error {
+	explicit := make(map[string]struct{})
+	fs.Visit(func(fl *flag.Flag) {
+		explicit[fl.Name] = struct{}{}
+	})
+
+	var err error
+	fs.VisitAll(func(fl *flag.Flag) {
+		if _, ok := explicit[fl.Name]; ok || err != nil {
+			return
+		}
+
+		name := EnvironmentVariableName(fl.Name)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+
+		if setErr := fl.Value.Set(value); setErr != nil {
+			err = fmt.Errorf("invalid value '%s' for environment variable %s: %s", value, name, setErr.Error())
+		}
+	})
+
+	return err
+}
+
+// EnvironmentVariableName returns the name of the environment variable that
+// a flag can be read from
+func EnvironmentVariableName(flagName string) string {
+	return EnvironmentPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
 // Config models the application's configuration
 type Config struct {
-	Listen                     ListenConfig
-	Consul                     ConsulConfig
-	Namespaces                 []NamespaceConfig `hcl:"namespace"`
-	EnableExperimentalFeatures bool              `hcl:"enable_experimental" yaml:"enable_experimental"`
+	Listen          ListenConfig
+	Consul          ConsulConfig
+	VictoriaMetrics VictoriaMetricsConfig `hcl:"victoriametrics" yaml:"victoriametrics"`
+	Namespaces      []NamespaceConfig     `hcl:"namespace"`
+	NamespaceGroups []NamespaceGroup      `hcl:"namespace_group" yaml:"namespace_groups"`
+	RegexCacheSize  int                   `hcl:"regex_cache_size" yaml:"regex_cache_size"`
+
+	// Defaults contains settings that are used by all namespaces that do not
+	// set them explicitly. It is only supported in YAML, since HCL cannot
+	// decode namespaces without a name.
+	Defaults *NamespaceConfig `hcl:"-" yaml:"defaults"`
+
+	// Include contains glob patterns of additional configuration files
+	// (relative to the including file) whose namespaces are added to the
+	// namespaces of this file
+	Include []string `hcl:"include" yaml:"include"`
+
+	// PushGatewayURL is the URL of a Prometheus Pushgateway to push metrics
+	// to. Without a PushGatewayInterval, all log files are read to their end
+	// once, their metrics are pushed and the exporter exits.
+	PushGatewayURL      string `hcl:"push_gateway_url" yaml:"push_gateway_url"`
+	PushGatewayInterval string `hcl:"push_gateway_interval" yaml:"push_gateway_interval"`
+
+	// OTLPEndpoint is the URL of an OTLP receiver that all metrics are
+	// exported to, in addition to being served for Prometheus
+	OTLPEndpoint       string            `hcl:"otlp_endpoint" yaml:"otlp_endpoint"`
+	OTLPProtocol       string            `hcl:"otlp_protocol" yaml:"otlp_protocol"`
+	OTLPHeaders        map[string]string `hcl:"otlp_headers" yaml:"otlp_headers"`
+	OTLPExportInterval string            `hcl:"otlp_export_interval" yaml:"otlp_export_interval"`
+
+	// RemoteWrite is a Prometheus remote-write endpoint that all metrics
+	// are periodically sent to
+	RemoteWrite *RemoteWriteConfig `hcl:"remote_write" yaml:"remote_write"`
+
+	// EtcdEndpoints are the URLs of etcd servers from which additional
+	// namespaces are read (from the keys below EtcdPrefix, each containing a
+	// namespace configuration in YAML); the namespaces are updated whenever
+	// one of these keys changes
+	EtcdEndpoints []string       `hcl:"etcd_endpoints" yaml:"etcd_endpoints"`
+	EtcdPrefix    string         `hcl:"etcd_prefix" yaml:"etcd_prefix"`
+	EtcdTLS       *EtcdTLSConfig `hcl:"etcd_tls" yaml:"etcd_tls"`
+	EtcdUsername  string         `hcl:"etcd_username" yaml:"etcd_username"`
+	EtcdPassword  string         `hcl:"etcd_password" yaml:"etcd_password"`
+
+	// Kubernetes enables the discovery of additional namespaces from the
+	// annotations of Kubernetes pods
+	Kubernetes *KubernetesDiscoveryConfig `hcl:"kubernetes" yaml:"kubernetes"`
+
+	// InferNamespaceLabelFromFile labels the metrics of all namespaces with
+	// the name of the config file that they were defined in
+	InferNamespaceLabelFromFile bool `hcl:"infer_namespace_label_from_file" yaml:"infer_namespace_label_from_file"`
+
+	EnableExperimentalFeatures bool `hcl:"enable_experimental" yaml:"enable_experimental"`
 
 	// In YAML, the EnableExperimentalFeatures property was originally set by the
 	// "enableexperimentalfeatures" property (although documented as "enable_experimental").
@@ -37,9 +161,47 @@ type Config struct {
 
 // ListenConfig is a struct describing the built-in webserver configuration
 type ListenConfig struct {
-	Port            int
+	Port            int `validate:"min=0,max=65535"`
 	Address         string
 	MetricsEndpoint string `hcl:"metrics_endpoint" yaml:"metrics_endpoint"`
+
+	// LivenessEndpoint and ReadinessEndpoint are the URL paths of the health
+	// checks (for example, for Kubernetes probes)
+	LivenessEndpoint  string `hcl:"liveness_endpoint" yaml:"liveness_endpoint"`
+	ReadinessEndpoint string `hcl:"readiness_endpoint" yaml:"readiness_endpoint"`
+
+	TLS       *ListenTLSConfig `hcl:"tls" yaml:"tls"`
+	BasicAuth *BasicAuthConfig `hcl:"basic_auth" yaml:"basic_auth"`
+}
+
+// BasicAuthConfig describes the credentials that are required for scraping
+// metrics. Only the bcrypt hash of the password is configured.
+type BasicAuthConfig struct {
+	Username     string `hcl:"username" yaml:"username"`
+	PasswordHash string `hcl:"password_hash" yaml:"password_hash"`
+}
+
+// Validate checks that a username is set and that the password hash looks
+// like a bcrypt hash (and not like a plaintext password)
+func (b *BasicAuthConfig) Validate() error {
+	if b.Username == "" {
+		return errors.New("basic_auth requires a username")
+	}
+
+	if !strings.HasPrefix(b.PasswordHash, "$2") {
+		return errors.New("basic_auth password_hash needs to be a bcrypt hash (use the hash-password command to create one), not a plaintext password")
+	}
+
+	return nil
+}
+
+// ListenTLSConfig describes the certificate that the HTTP server uses for
+// serving metrics via HTTPS, and optionally the CA that client certificates
+// need to be signed with
+type ListenTLSConfig struct {
+	CertFile     string `hcl:"cert_file" yaml:"cert_file"`
+	KeyFile      string `hcl:"key_file" yaml:"key_file"`
+	ClientCAFile string `hcl:"client_ca_file" yaml:"client_ca_file"`
 }
 
 // ConsulConfig describes the connection to a Consul server that the exporter should
@@ -61,6 +223,76 @@ type ConsulServiceConfig struct {
 	Tags    []string
 }
 
+// NamespaceGroup describes a group of namespaces whose metrics should
+// additionally be exported in aggregated form
+type NamespaceGroup struct {
+	Name       string   `hcl:",key" yaml:"name"`
+	Namespaces []string `hcl:"namespaces" yaml:"namespaces"`
+}
+
+// VictoriaMetricsConfig describes a VictoriaMetrics instance that the exporter
+// should periodically push its metrics to
+type VictoriaMetricsConfig struct {
+	PushURL      string            `hcl:"push_url" yaml:"push_url"`
+	PushInterval string            `hcl:"push_interval" yaml:"push_interval"`
+	ExtraLabels  map[string]string `hcl:"extra_labels" yaml:"extra_labels"`
+}
+
+// PushGatewayIntervalOrDefault returns the configured interval at which
+// metrics are pushed to the Pushgateway, or 0 if they should only be pushed
+// once after all log files were read.
+func (c *Config) PushGatewayIntervalOrDefault() (time.Duration, error) {
+	if c.PushGatewayInterval == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(c.PushGatewayInterval)
+}
+
+// OneShotSourceError returns an error if any namespace has a log source that
+// does not end by itself, which rules out reading all sources once before
+// pushing the metrics to the Pushgateway.
+func (c *Config) OneShotSourceError() error {
+	for _, ns := range c.Namespaces {
+		s := ns.SourceData
+		if s.Syslog != nil || s.Kafka != nil || s.HTTP != nil || s.Journal != nil {
+			return fmt.Errorf("namespace %s: only files and stdin can be read when pushing to a Pushgateway without push_gateway_interval", ns.Name)
+		}
+	}
+
+	return nil
+}
+
+// The protocols that metrics can be exported to an OTLP receiver with
+const (
+	OTLPProtocolGRPC = "grpc"
+	OTLPProtocolHTTP = "http/protobuf"
+)
+
+// OTLPProtocolOrDefault returns the configured OTLP protocol or the default
+// value (gRPC) if no configuration was provided.
+func (c *Config) OTLPProtocolOrDefault() (string, error) {
+	switch c.OTLPProtocol {
+	case "":
+		return OTLPProtocolGRPC, nil
+	case OTLPProtocolGRPC, OTLPProtocolHTTP:
+		return c.OTLPProtocol, nil
+	}
+
+	return "", fmt.Errorf("unsupported OTLP protocol '%s'; must be one of [%s, %s]", c.OTLPProtocol, OTLPProtocolGRPC, OTLPProtocolHTTP)
+}
+
+// OTLPExportIntervalOrDefault returns the configured interval at which
+// metrics are exported to the OTLP receiver, or the default value (30
+// seconds) if no configuration was provided.
+func (c *Config) OTLPExportIntervalOrDefault() (time.Duration, error) {
+	if c.OTLPExportInterval == "" {
+		return 30 * time.Second, nil
+	}
+
+	return time.ParseDuration(c.OTLPExportInterval)
+}
+
 // StabilityWarnings tests if the Config or any of its sub-objects uses any
 // configuration settings that are not yet declared "stable"
 func (c *Config) StabilityWarnings() error {
@@ -68,6 +300,14 @@ func (c *Config) StabilityWarnings() error {
 		return nil
 	}
 
+	if len(c.EtcdEndpoints) > 0 {
+		return errors.New("etcd namespace discovery (etcd_endpoints) is experimental")
+	}
+
+	if c.Kubernetes != nil {
+		return errors.New("Kubernetes namespace discovery (kubernetes) is experimental")
+	}
+
 	for i := range c.Namespaces {
 		if err := c.Namespaces[i].StabilityWarnings(); err != nil {
 			return err
@@ -77,6 +317,16 @@ func (c *Config) StabilityWarnings() error {
 	return nil
 }
 
+// RegexCacheSizeOrDefault returns the configured size of the compiled regex
+// cache or the default value if no configuration was provided.
+func (c *Config) RegexCacheSizeOrDefault() int {
+	if c.RegexCacheSize <= 0 {
+		return regexcache.DefaultSize
+	}
+
+	return c.RegexCacheSize
+}
+
 // MetricsEndpointOrDefault returns the configured metrics endpoint or the
 // default value if no configuration was provided.
 func (l *ListenConfig) MetricsEndpointOrDefault() string {
@@ -86,3 +336,85 @@ func (l *ListenConfig) MetricsEndpointOrDefault() string {
 
 	return l.MetricsEndpoint
 }
+
+// LivenessEndpointOrDefault returns the configured liveness endpoint or the
+// default value (/healthz) if no configuration was provided.
+func (l *ListenConfig) LivenessEndpointOrDefault() string {
+	if l.LivenessEndpoint == "" {
+		return "/healthz"
+	}
+
+	return l.LivenessEndpoint
+}
+
+// ReadinessEndpointOrDefault returns the configured readiness endpoint or the
+// default value (/readyz) if no configuration was provided.
+func (l *ListenConfig) ReadinessEndpointOrDefault() string {
+	if l.ReadinessEndpoint == "" {
+		return "/readyz"
+	}
+
+	return l.ReadinessEndpoint
+}
+
+// ServerTLSConfig builds the TLS configuration of the HTTP server. It returns
+// nil if no certificate is configured, in which case metrics are served via
+// plain HTTP. If a client CA is configured, clients need to present a
+// certificate signed by it.
+func (t *ListenTLSConfig) ServerTLSConfig() (*tls.Config, error) {
+	if t == nil || (t.CertFile == "" && t.KeyFile == "") {
+		if t != nil && t.ClientCAFile != "" {
+			return nil, errors.New("client_ca_file requires cert_file and key_file to be set")
+		}
+		return nil, nil
+	}
+
+	if t.CertFile == "" || t.KeyFile == "" {
+		return nil, errors.New("both cert_file and key_file need to be set for serving metrics via TLS")
+	}
+
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load TLS certificate: %s", err.Error())
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if t.ClientCAFile != "" {
+		ca, err := os.ReadFile(t.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read client CA file: %s", err.Error())
+		}
+
+		cfg.ClientCAs = x509.NewCertPool()
+		if !cfg.ClientCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("could not parse client CA file '%s'", t.ClientCAFile)
+		}
+
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+// PushIntervalOrDefault returns the configured push interval or the default
+// value (30 seconds) if no configuration was provided.
+func (v *VictoriaMetricsConfig) PushIntervalOrDefault() (time.Duration, error) {
+	if v.PushInterval == "" {
+		return 30 * time.Second, nil
+	}
+
+	d, err := time.ParseDuration(v.PushInterval)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse push_interval '%s': %s", v.PushInterval, err.Error())
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("push_interval must be positive, got '%s'", v.PushInterval)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,267 @@
+package config
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFlagSet(opts *StartupFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.IntVar(&opts.ListenPort, "listen-port", 4040, "")
+	fs.StringVar(&opts.Namespace, "namespace", "nginx", "")
+	fs.StringVar(&opts.ConfigFile, "config-file", "", "")
+	fs.BoolVar(&opts.EnableExperimentalFeatures, "enable-experimental", false, "")
+	return fs
+}
+
+func TestFromEnvironmentFillsFlagsThatWereNotPassed(t *testing.T) {
+	t.Setenv("NGINXLOG_LISTEN_PORT", "9999")
+	t.Setenv("NGINXLOG_NAMESPACE", "fromenv")
+	t.Setenv("NGINXLOG_ENABLE_EXPERIMENTAL", "true")
+
+	opts := StartupFlags{}
+	fs := newTestFlagSet(&opts)
+	require.NoError(t, fs.Parse([]string{"-namespace", "fromflag"}))
+
+	require.NoError(t, opts.FromEnvironment(fs))
+
+	assert.Equal(t, 9999, opts.ListenPort)
+	assert.Equal(t, "fromflag", opts.Namespace)
+	assert.True(t, opts.EnableExperimentalFeatures)
+	assert.Equal(t, "", opts.ConfigFile)
+}
+
+func TestFromEnvironmentRejectsInvalidValues(t *testing.T) {
+	t.Setenv("NGINXLOG_LISTEN_PORT", "not-a-port")
+
+	opts := StartupFlags{}
+	fs := newTestFlagSet(&opts)
+	require.NoError(t, fs.Parse(nil))
+
+	assert.ErrorContains(t, opts.FromEnvironment(fs), "NGINXLOG_LISTEN_PORT")
+}
+
+// writeSelfSignedCert writes a self-signed certificate and its key into dir
+// and returns their file names
+func writeSelfSignedCert(t *testing.T, dir string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certFile, keyFile
+}
+
+func TestServerTLSConfigIsNilWithoutCertificate(t *testing.T) {
+	t.Parallel()
+
+	var l *ListenTLSConfig
+	cfg, err := l.ServerTLSConfig()
+	require.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	_, err = (&ListenTLSConfig{CertFile: "cert.pem"}).ServerTLSConfig()
+	assert.Error(t, err)
+
+	_, err = (&ListenTLSConfig{ClientCAFile: "ca.pem"}).ServerTLSConfig()
+	assert.Error(t, err)
+}
+
+func TestServerTLSConfigRequiresClientCertificatesWithClientCA(t *testing.T) {
+	t.Parallel()
+
+	certFile, keyFile := writeSelfSignedCert(t, t.TempDir())
+
+	cfg, err := (&ListenTLSConfig{CertFile: certFile, KeyFile: keyFile}).ServerTLSConfig()
+	require.NoError(t, err)
+	assert.Len(t, cfg.Certificates, 1)
+	assert.Equal(t, tls.NoClientCert, cfg.ClientAuth)
+
+	cfg, err = (&ListenTLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile}).ServerTLSConfig()
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, cfg.ClientAuth)
+	assert.NotNil(t, cfg.ClientCAs)
+}
+
+func TestBasicAuthRejectsPlaintextPasswords(t *testing.T) {
+	t.Parallel()
+
+	b := BasicAuthConfig{Username: "prometheus", PasswordHash: "secret"}
+	assert.Error(t, b.Validate())
+
+	b.PasswordHash = "$2a$10$7EqJtq98hPqEX7fNZaFWoOhi5BWX4Z3ZQ9eBqJ4Ue8yU3f5bF1yW6"
+	assert.NoError(t, b.Validate())
+
+	b.Username = ""
+	assert.Error(t, b.Validate())
+}
+
+func TestPushGatewayIntervalDefaultsToOneShot(t *testing.T) {
+	t.Parallel()
+
+	c := Config{PushGatewayURL: "http://pushgateway:9091"}
+	interval, err := c.PushGatewayIntervalOrDefault()
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), interval)
+
+	c.PushGatewayInterval = "15s"
+	interval, err = c.PushGatewayIntervalOrDefault()
+	require.NoError(t, err)
+	assert.Equal(t, 15*time.Second, interval)
+}
+
+func TestVictoriaMetricsPushIntervalMustBePositive(t *testing.T) {
+	t.Parallel()
+
+	v := VictoriaMetricsConfig{}
+	interval, err := v.PushIntervalOrDefault()
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, interval)
+
+	v.PushInterval = "0s"
+	_, err = v.PushIntervalOrDefault()
+	assert.Error(t, err)
+
+	v.PushInterval = "-5s"
+	_, err = v.PushIntervalOrDefault()
+	assert.Error(t, err)
+}
+
+func TestOneShotSourceErrorRejectsUnboundedSources(t *testing.T) {
+	t.Parallel()
+
+	c := Config{Namespaces: []NamespaceConfig{
+		{Name: "files", SourceData: SourceData{Files: []string{"access.log"}, Stdin: true}},
+	}}
+	assert.NoError(t, c.OneShotSourceError())
+
+	c.Namespaces = append(c.Namespaces, NamespaceConfig{
+		Name:       "syslog",
+		SourceData: SourceData{Syslog: &SyslogSource{ListenAddress: "udp://127.0.0.1:5531"}},
+	})
+	assert.Error(t, c.OneShotSourceError())
+}
+
+func TestOTLPProtocolDefaultsToGRPC(t *testing.T) {
+	t.Parallel()
+
+	c := Config{}
+	protocol, err := c.OTLPProtocolOrDefault()
+	require.NoError(t, err)
+	assert.Equal(t, OTLPProtocolGRPC, protocol)
+
+	c.OTLPProtocol = OTLPProtocolHTTP
+	protocol, err = c.OTLPProtocolOrDefault()
+	require.NoError(t, err)
+	assert.Equal(t, OTLPProtocolHTTP, protocol)
+
+	c.OTLPProtocol = "http/json"
+	_, err = c.OTLPProtocolOrDefault()
+	assert.Error(t, err)
+}
+
+func TestEtcdDiscoveryIsExperimental(t *testing.T) {
+	c := &Config{EtcdEndpoints: []string{"http://etcd:2379"}}
+	assert.Error(t, c.StabilityWarnings())
+
+	c.EnableExperimentalFeatures = true
+	assert.NoError(t, c.StabilityWarnings())
+
+	assert.Equal(t, DefaultEtcdPrefix, c.EtcdPrefixOrDefault())
+}
+
+func TestKubernetesDiscoveryIsExperimental(t *testing.T) {
+	c := &Config{Kubernetes: &KubernetesDiscoveryConfig{}}
+	assert.Error(t, c.StabilityWarnings())
+
+	c.EnableExperimentalFeatures = true
+	assert.NoError(t, c.StabilityWarnings())
+}
+
+func TestKubernetesDiscoveryDefaults(t *testing.T) {
+	t.Setenv("NODE_NAME", "node-1")
+
+	k := &KubernetesDiscoveryConfig{}
+	assert.Equal(t, "node-1", k.NodeNameOrDefault())
+	assert.Equal(t, DefaultKubernetesPathAnnotation, k.PathAnnotationOrDefault())
+	assert.Equal(t, DefaultKubernetesFormatAnnotation, k.FormatAnnotationOrDefault())
+	assert.Equal(t, DefaultKubernetesMetricsPrefix, k.MetricsPrefixOrDefault())
+	assert.Equal(t, DefaultKubernetesPodLabel, k.PodLabelOrDefault())
+
+	k.NodeName = "node-2"
+	assert.Equal(t, "node-2", k.NodeNameOrDefault())
+}
+
+func TestRemoteWriteDefaults(t *testing.T) {
+	r := &RemoteWriteConfig{URL: "https://prometheus.example.com/api/v1/write"}
+	require.NoError(t, r.Validate())
+
+	interval, err := r.FlushIntervalOrDefault()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultRemoteWriteFlushInterval, interval)
+	assert.Equal(t, DefaultRemoteWriteQueueSize, r.QueueSizeOrDefault())
+}
+
+func TestRemoteWriteIsValidated(t *testing.T) {
+	assert.Error(t, (&RemoteWriteConfig{}).Validate())
+	assert.Error(t, (&RemoteWriteConfig{URL: "http://localhost", FlushInterval: "soon"}).Validate())
+	assert.Error(t, (&RemoteWriteConfig{URL: "http://localhost", FlushInterval: "-5s"}).Validate())
+	assert.Error(t, (&RemoteWriteConfig{URL: "http://localhost", TLS: &RemoteWriteTLSConfig{CAFile: "/does/not/exist"}}).Validate())
+}
+
+func TestRemoteWriteIsLoadedFromHCL(t *testing.T) {
+	const input = `
+remote_write {
+  url = "https://prometheus.example.com/api/v1/write"
+  flush_interval = "30s"
+  queue_size = 5
+
+  headers {
+    Authorization = "Bearer secret"
+  }
+}
+`
+
+	cfg := Config{}
+	require.NoError(t, loadConfigFromHCLStream(&cfg, bytes.NewBufferString(input)))
+	require.NotNil(t, cfg.RemoteWrite)
+	assert.Equal(t, "https://prometheus.example.com/api/v1/write", cfg.RemoteWrite.URL)
+	assert.Equal(t, "30s", cfg.RemoteWrite.FlushInterval)
+	assert.Equal(t, 5, cfg.RemoteWrite.QueueSizeOrDefault())
+	assert.Equal(t, map[string]string{"Authorization": "Bearer secret"}, cfg.RemoteWrite.Headers)
+}
@@ -0,0 +1,267 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// labelNamePattern matches valid Prometheus label names
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// formatVariablePattern matches the variables of a text log format
+var formatVariablePattern = regexp.MustCompile(`\$([a-zA-Z0-9_]+)`)
+
+// ValidationErrors checks the configuration against the constraints of the
+// configuration schema (the `validate` struct tags) and a number of rules that
+// the schema cannot express, and returns all violations (in contrast to
+// loading the configuration, which stops at the first error). The errors of
+// compiling the namespaces are reported as well. Properties are referred to by
+// their YAML names.
+func (c *Config) ValidationErrors() []error {
+	var errs []error
+
+	validateTags(reflect.ValueOf(c).Elem(), "", &errs)
+
+	for i := range c.Namespaces {
+		ns := &c.Namespaces[i]
+		path := fmt.Sprintf("namespaces[%d]", i)
+
+		errs = append(errs, ns.bucketErrors(path)...)
+		errs = append(errs, ns.labelNameErrors(path)...)
+		errs = append(errs, ns.relabelFieldErrors(path)...)
+	}
+
+	// compiling reports the problems that are only found when the namespaces
+	// are set up (like invalid regular expressions); a copy is compiled, so
+	// that the configuration itself is not modified
+	namespaces := append([]NamespaceConfig{}, c.Namespaces...)
+	if err := CompileNamespaces(namespaces); err != nil {
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			errs = append(errs, joined.Unwrap()...)
+		} else {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// validateTags checks all fields below v that have a `validate` struct tag
+func validateTags(v reflect.Value, path string, errs *[]error) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			validateTags(v.Elem(), path, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateTags(v.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+
+		for _, k := range keys {
+			validateTags(v.MapIndex(k), fmt.Sprintf("%s.%v", path, k.Interface()), errs)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+
+			name := yamlFieldName(f)
+			if name == "" {
+				continue
+			}
+
+			if path != "" {
+				name = path + "." + name
+			}
+
+			if err := checkValidateTag(v.Field(i), f.Tag.Get("validate")); err != nil {
+				*errs = append(*errs, fmt.Errorf("%s: %s", name, err.Error()))
+			}
+
+			validateTags(v.Field(i), name, errs)
+		}
+	}
+}
+
+// checkValidateTag checks a single value against the rules of a `validate`
+// struct tag. Empty strings are always accepted, since they select the
+// default value.
+func checkValidateTag(v reflect.Value, tag string) error {
+	if tag == "" {
+		return nil
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(rule, "=")
+
+		switch key {
+		case "min", "max":
+			limit, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+
+			var n float64
+			switch v.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				n = float64(v.Int())
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				n = float64(v.Uint())
+			case reflect.Float32, reflect.Float64:
+				n = v.Float()
+			case reflect.String:
+				if v.Len() == 0 {
+					continue
+				}
+				n = float64(v.Len())
+			default:
+				continue
+			}
+
+			if key == "min" && n < limit {
+				return fmt.Errorf("must be at least %v, got %v", limit, n)
+			}
+
+			if key == "max" && n > limit {
+				return fmt.Errorf("must be at most %v, got %v", limit, n)
+			}
+		case "oneof":
+			if v.Kind() != reflect.String || v.Len() == 0 {
+				continue
+			}
+
+			allowed := strings.Fields(value)
+			found := false
+			for _, a := range allowed {
+				found = found || a == v.String()
+			}
+
+			if !found {
+				return fmt.Errorf("must be one of [%s], got '%s'", strings.Join(allowed, ", "), v.String())
+			}
+		}
+	}
+
+	return nil
+}
+
+// bucketErrors checks that all histogram bucket lists of the namespace are
+// sorted in ascending order
+func (c *NamespaceConfig) bucketErrors(path string) []error {
+	lists := map[string][]float64{
+		"histogram_buckets":             c.HistogramBuckets,
+		"slo_thresholds":                c.SLOThresholds,
+		"metrics.upstream_peer_buckets": c.MetricsConfig.UpstreamPeerBuckets,
+		"metrics.gzip_ratio_buckets":    c.MetricsConfig.GzipRatioBuckets,
+	}
+
+	for metric, buckets := range c.HistogramBucketsByMetric {
+		lists["histogram_buckets_by_metric."+metric] = buckets
+	}
+
+	names := make([]string, 0, len(lists))
+	for name := range lists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		buckets := lists[name]
+		for i := 1; i < len(buckets); i++ {
+			if buckets[i] <= buckets[i-1] {
+				errs = append(errs, fmt.Errorf("%s.%s: buckets must be sorted in ascending order, but %v follows %v", path, name, buckets[i], buckets[i-1]))
+				break
+			}
+		}
+	}
+
+	return errs
+}
+
+// labelNameErrors checks that all label names of the namespace are valid
+// Prometheus label names
+func (c *NamespaceConfig) labelNameErrors(path string) []error {
+	var errs []error
+	check := func(property string, name string) {
+		if !labelNamePattern.MatchString(name) {
+			errs = append(errs, fmt.Errorf("%s.%s: '%s' is not a valid label name", path, property, name))
+		}
+	}
+
+	if c.NamespaceLabelName != "" {
+		check("namespace_label", c.NamespaceLabelName)
+	}
+
+	names := make([]string, 0, len(c.Labels))
+	for name := range c.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		check("labels", name)
+	}
+
+	for i := range c.RelabelConfigs {
+		r := &c.RelabelConfigs[i]
+		if r.IsFilter() || r.IsCapture() {
+			continue
+		}
+
+		check(fmt.Sprintf("relabel_configs[%d].target_label", i), r.TargetLabel)
+	}
+
+	for i, name := range c.HistogramLabels {
+		check(fmt.Sprintf("histogram_labels[%d]", i), name)
+	}
+
+	return errs
+}
+
+// relabelFieldErrors checks that the fields that relabelings read from are
+// declared in the log format. This is only possible for the text parser,
+// since the fields of the other parsers are only known when parsing.
+func (c *NamespaceConfig) relabelFieldErrors(path string) []error {
+	if (c.Parser != "" && c.Parser != "text") || c.Format == "" {
+		return nil
+	}
+
+	fields := make(map[string]struct{})
+	for _, m := range formatVariablePattern.FindAllStringSubmatch(c.Format, -1) {
+		fields[m[1]] = struct{}{}
+	}
+
+	if c.DecomposeRequest {
+		for _, f := range []string{"request_method", "request_uri", "server_protocol"} {
+			fields[f] = struct{}{}
+		}
+	}
+
+	var errs []error
+	for i := range c.RelabelConfigs {
+		from := c.RelabelConfigs[i].SourceValue
+		if from == "" {
+			continue
+		}
+
+		if _, ok := fields[from]; !ok {
+			errs = append(errs, fmt.Errorf("%s.relabel_configs[%d].from: field '%s' is not declared in the log format", path, i, from))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validateTestConfig = `
+listen:
+  port: 70000
+namespaces:
+  - name: app
+    format: "$remote_addr $request $status"
+    histogram_buckets: [1, 0.5, 2]
+    histogram_buckets_by_metric:
+      response_time: [0.1, 0.1]
+    labels:
+      app-name: foo
+    relabel_configs:
+      - target_label: user
+        from: remote_user
+      - target_label: "1method"
+        from: request_method
+    metrics:
+      parse_error_threshold: 2
+  - name: other
+    parser: xml
+    format: "$status"
+    relabel_configs:
+      - target_label: user
+        from: remote_user
+`
+
+func TestValidationErrorsReportsAllProblems(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{}
+	require.NoError(t, LoadConfigFromStream(nil, &cfg, strings.NewReader(validateTestConfig), TypeYAML))
+
+	errs := cfg.ValidationErrors()
+
+	messages := make([]string, len(errs))
+	for i := range errs {
+		messages[i] = errs[i].Error()
+	}
+
+	assert.Contains(t, messages, "listen.port: must be at most 65535, got 70000")
+	assert.Contains(t, messages, "namespaces[1].parser: must be one of [text, json, logfmt, regex, csv, tsv, cloud_run, apache], got 'xml'")
+	assert.Contains(t, messages, "namespaces[0].metrics.parse_error_threshold: must be at most 1, got 2")
+	assert.Contains(t, messages, "namespaces[0].histogram_buckets: buckets must be sorted in ascending order, but 0.5 follows 1")
+	assert.Contains(t, messages, "namespaces[0].histogram_buckets_by_metric.response_time: buckets must be sorted in ascending order, but 0.1 follows 0.1")
+	assert.Contains(t, messages, "namespaces[0].labels: 'app-name' is not a valid label name")
+	assert.Contains(t, messages, "namespaces[0].relabel_configs[1].target_label: '1method' is not a valid label name")
+	assert.Contains(t, messages, "namespaces[0].relabel_configs[0].from: field 'remote_user' is not declared in the log format")
+	assert.Contains(t, messages, "namespaces[0].relabel_configs[1].from: field 'request_method' is not declared in the log format")
+	assert.Contains(t, messages, "invalid configuration of namespace 'app': parse_error_threshold must be at least 0 and less than 1, got 2")
+
+	// relabelings are only checked against the format for the text parser
+	assert.Len(t, messages, 10)
+}
+
+func TestValidationErrorsReportsCompileErrors(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{
+		Namespaces: []NamespaceConfig{{
+			Name:   "app",
+			Format: "$remote_addr $request $status",
+			RelabelConfigs: []RelabelConfig{
+				{TargetLabel: "ignored", SourceValue: "status", Action: "drop_if", CaptureRegexp: "("},
+			},
+		}},
+	}
+
+	errs := cfg.ValidationErrors()
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "invalid configuration of namespace 'app'")
+}
+
+func TestValidationErrorsAcceptsValidConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{
+		Listen: ListenConfig{Port: 4040},
+		Namespaces: []NamespaceConfig{{
+			Name:             "app",
+			Format:           "$remote_addr $request $status",
+			DecomposeRequest: true,
+			HistogramBuckets: []float64{0.1, 0.5, 1},
+			RelabelConfigs: []RelabelConfig{
+				{TargetLabel: "method", SourceValue: "request_method"},
+				{TargetLabel: "ignored", SourceValue: "status", Action: "drop_if", CaptureRegexp: "^5"},
+			},
+		}},
+	}
+
+	assert.Empty(t, cfg.ValidationErrors())
+
+	// only a copy of the namespaces is compiled
+	assert.Nil(t, cfg.Namespaces[0].RelabelConfigs[1].CompiledCaptureRegexp)
+}
@@ -1,6 +1,8 @@
 package discovery
 
 import (
+	"os"
+
 	"github.com/hashicorp/consul/api"
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
 )
@@ -22,7 +24,7 @@ func getDefault(a string, b string) string {
 // NewConsulRegistrator is a constructor function for building a new ConsulRegistrator
 func NewConsulRegistrator(cfg *config.Config) (*ConsulRegistrator, error) {
 	config := api.Config{
-		Address:    getDefault(cfg.Consul.Address, "localhost:8500"),
+		Address:    getDefault(cfg.Consul.Address, getDefault(os.Getenv("CONSUL_HTTP_ADDR"), "localhost:8500")),
 		Datacenter: getDefault(cfg.Consul.Datacenter, "dc1"),
 		Scheme:     getDefault(cfg.Consul.Scheme, "http"),
 		Token:      cfg.Consul.Token,
@@ -65,3 +67,18 @@ func (r *ConsulRegistrator) RegisterConsul() error {
 func (r *ConsulRegistrator) UnregisterConsul() error {
 	return r.client.Agent().ServiceDeregister(r.serviceID)
 }
+
+// Name implements the Registrator interface
+func (r *ConsulRegistrator) Name() string {
+	return "Consul"
+}
+
+// Register implements the Registrator interface
+func (r *ConsulRegistrator) Register() error {
+	return r.RegisterConsul()
+}
+
+// Unregister implements the Registrator interface
+func (r *ConsulRegistrator) Unregister() error {
+	return r.UnregisterConsul()
+}
@@ -0,0 +1,115 @@
+package discovery
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+)
+
+// EtcdRegistrator registers the exporter instance as a key in etcd, using the
+// etcd v3 JSON gateway. The key is "/services/<service name>/<service ID>",
+// and the value is a JSON document containing the address of the exporter.
+type EtcdRegistrator struct {
+	endpoints []string
+	client    *http.Client
+	key       string
+	value     []byte
+}
+
+type etcdService struct {
+	Address string   `json:"address"`
+	Port    int      `json:"port"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+// NewEtcdRegistrator builds a new EtcdRegistrator for a comma-separated list
+// of etcd endpoints (like "http://etcd-0:2379,http://etcd-1:2379"). The
+// service name, ID, address and tags are taken from the Consul service
+// configuration.
+func NewEtcdRegistrator(cfg *config.Config, endpoints string) (*EtcdRegistrator, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	name := getDefault(cfg.Consul.Service.Name, "nginx-exporter")
+	serviceID := getDefault(cfg.Consul.Service.ID, hostname)
+
+	value, err := json.Marshal(etcdService{
+		Address: getDefault(cfg.Consul.Service.Address, hostname),
+		Port:    cfg.Listen.Port,
+		Tags:    cfg.Consul.Service.Tags,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r := &EtcdRegistrator{
+		client: &http.Client{Timeout: 10 * time.Second},
+		key:    fmt.Sprintf("/services/%s/%s", name, serviceID),
+		value:  value,
+	}
+
+	for _, e := range strings.Split(endpoints, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			r.endpoints = append(r.endpoints, strings.TrimSuffix(e, "/"))
+		}
+	}
+
+	return r, nil
+}
+
+// Name implements the Registrator interface
+func (r *EtcdRegistrator) Name() string {
+	return "etcd"
+}
+
+// Register implements the Registrator interface
+func (r *EtcdRegistrator) Register() error {
+	return r.call("/v3/kv/put", map[string]string{
+		"key":   base64.StdEncoding.EncodeToString([]byte(r.key)),
+		"value": base64.StdEncoding.EncodeToString(r.value),
+	})
+}
+
+// Unregister implements the Registrator interface
+func (r *EtcdRegistrator) Unregister() error {
+	return r.call("/v3/kv/deleterange", map[string]string{
+		"key": base64.StdEncoding.EncodeToString([]byte(r.key)),
+	})
+}
+
+// call sends a request to the first endpoint that responds successfully
+func (r *EtcdRegistrator) call(path string, body interface{}) error {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	err = fmt.Errorf("no etcd endpoints configured")
+	for _, endpoint := range r.endpoints {
+		var res *http.Response
+
+		res, err = r.client.Post(endpoint+path, "application/json", bytes.NewReader(buf))
+		if err != nil {
+			continue
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			err = fmt.Errorf("etcd endpoint %s responded with status %d", endpoint, res.StatusCode)
+			continue
+		}
+
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,335 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/log"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+)
+
+// etcdWatchRetryDelay is the time to wait before re-establishing a failed
+// etcd watch
+const etcdWatchRetryDelay = 5 * time.Second
+
+// EtcdNamespaceDiscovery reads namespace configurations from etcd, using the
+// etcd v3 JSON gateway. Each key below the configured prefix contains the
+// YAML configuration of a single namespace; if the configuration does not
+// contain a name, the key (without the prefix) is used as name.
+type EtcdNamespaceDiscovery struct {
+	logger    *log.Logger
+	endpoints []string
+	prefix    string
+	username  string
+	password  string
+
+	// client is used for single requests, watchClient for the long-running
+	// watch requests (and thus has no timeout)
+	client      *http.Client
+	watchClient *http.Client
+
+	// revision is the etcd revision of the most recently read namespaces
+	revision   int64
+	retryDelay time.Duration
+}
+
+type etcdHeader struct {
+	Revision int64 `json:"revision,string"`
+}
+
+type etcdKeyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+type etcdRangeResponse struct {
+	Header etcdHeader     `json:"header"`
+	KVs    []etcdKeyValue `json:"kvs"`
+}
+
+type etcdWatchResponse struct {
+	Result struct {
+		Header   etcdHeader        `json:"header"`
+		Canceled bool              `json:"canceled"`
+		Events   []json.RawMessage `json:"events"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// NewEtcdNamespaceDiscovery builds a new EtcdNamespaceDiscovery from the etcd
+// settings of the configuration
+func NewEtcdNamespaceDiscovery(logger *log.Logger, cfg *config.Config) (*EtcdNamespaceDiscovery, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.EtcdTLS != nil {
+		tlsConfig, err := cfg.EtcdTLS.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	d := &EtcdNamespaceDiscovery{
+		logger:      logger,
+		prefix:      cfg.EtcdPrefixOrDefault(),
+		username:    cfg.EtcdUsername,
+		password:    cfg.EtcdPassword,
+		client:      &http.Client{Transport: transport, Timeout: 10 * time.Second},
+		watchClient: &http.Client{Transport: transport},
+		retryDelay:  etcdWatchRetryDelay,
+	}
+
+	for _, e := range cfg.EtcdEndpoints {
+		if e = strings.TrimSpace(e); e != "" {
+			d.endpoints = append(d.endpoints, strings.TrimSuffix(e, "/"))
+		}
+	}
+
+	if len(d.endpoints) == 0 {
+		return nil, fmt.Errorf("no etcd endpoints configured")
+	}
+
+	return d, nil
+}
+
+// Namespaces reads all namespace configurations from etcd. If one of them is
+// invalid, an error is returned and none of the namespaces.
+func (d *EtcdNamespaceDiscovery) Namespaces() ([]config.NamespaceConfig, error) {
+	var res etcdRangeResponse
+	if err := d.call(d.keyRange(nil), "/v3/kv/range", &res); err != nil {
+		return nil, err
+	}
+
+	namespaces := make([]config.NamespaceConfig, 0, len(res.KVs))
+	for _, kv := range res.KVs {
+		ns := config.NamespaceConfig{Name: strings.TrimPrefix(string(kv.Key), d.prefix)}
+		if err := config.LoadNamespaceFromYAML(d.logger, &ns, kv.Value); err != nil {
+			return nil, fmt.Errorf("could not load namespace from etcd key '%s': %s", kv.Key, err.Error())
+		}
+
+		namespaces = append(namespaces, ns)
+	}
+
+	d.revision = res.Header.Revision
+	return namespaces, nil
+}
+
+// Watch watches the keys below the prefix and calls onChange with all
+// namespaces whenever one of them changes, until stopChan is closed. Errors
+// (which cause the watch to be re-established) are passed to onError.
+func (d *EtcdNamespaceDiscovery) Watch(stopChan <-chan bool, onChange func([]config.NamespaceConfig), onError func(error)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		err := d.watch(ctx, onChange, onError)
+		if ctx.Err() != nil {
+			return
+		}
+
+		onError(err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.retryDelay):
+		}
+
+		// changes may have been missed while the watch was down
+		namespaces, err := d.Namespaces()
+		if err != nil {
+			onError(err)
+			continue
+		}
+
+		onChange(namespaces)
+	}
+}
+
+func (d *EtcdNamespaceDiscovery) watch(ctx context.Context, onChange func([]config.NamespaceConfig), onError func(error)) error {
+	body := map[string]interface{}{
+		"create_request": d.keyRange(map[string]interface{}{"start_revision": d.revision + 1}),
+	}
+
+	var res *http.Response
+	err := fmt.Errorf("no etcd endpoints configured")
+	for _, endpoint := range d.endpoints {
+		if res, err = d.request(ctx, d.watchClient, endpoint, "/v3/watch", body); err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	decoder := json.NewDecoder(res.Body)
+	for {
+		var msg etcdWatchResponse
+		if err := decoder.Decode(&msg); err != nil {
+			return fmt.Errorf("etcd watch failed: %s", err.Error())
+		}
+
+		if msg.Error != nil {
+			return fmt.Errorf("etcd watch failed: %s", msg.Error.Message)
+		}
+
+		if msg.Result.Canceled {
+			return fmt.Errorf("etcd watch was canceled")
+		}
+
+		if len(msg.Result.Events) == 0 {
+			continue
+		}
+
+		namespaces, err := d.Namespaces()
+		if err != nil {
+			onError(err)
+			continue
+		}
+
+		onChange(namespaces)
+	}
+}
+
+// keyRange returns a request body for all keys below the prefix, extended by
+// the given fields
+func (d *EtcdNamespaceDiscovery) keyRange(fields map[string]interface{}) map[string]interface{} {
+	body := map[string]interface{}{
+		"key":       base64.StdEncoding.EncodeToString([]byte(d.prefix)),
+		"range_end": base64.StdEncoding.EncodeToString(etcdPrefixEnd([]byte(d.prefix))),
+	}
+
+	for k, v := range fields {
+		body[k] = v
+	}
+
+	return body
+}
+
+// call sends a request to the first endpoint that responds successfully and
+// decodes its response into result
+func (d *EtcdNamespaceDiscovery) call(body interface{}, path string, result interface{}) error {
+	err := fmt.Errorf("no etcd endpoints configured")
+	for _, endpoint := range d.endpoints {
+		var res *http.Response
+
+		res, err = d.request(context.Background(), d.client, endpoint, path, body)
+		if err != nil {
+			continue
+		}
+
+		err = json.NewDecoder(res.Body).Decode(result)
+		res.Body.Close()
+
+		if err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+func (d *EtcdNamespaceDiscovery) request(ctx context.Context, client *http.Client, endpoint string, path string, body interface{}) (*http.Response, error) {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+path, bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if d.username != "" {
+		token, err := d.authenticate(ctx, endpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", token)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("etcd endpoint %s responded with status %d", endpoint, res.StatusCode)
+	}
+
+	return res, nil
+}
+
+// authenticate requests a new authentication token from an etcd endpoint
+func (d *EtcdNamespaceDiscovery) authenticate(ctx context.Context, endpoint string) (string, error) {
+	buf, err := json.Marshal(map[string]string{"name": d.username, "password": d.password})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/v3/auth/authenticate", bytes.NewReader(buf))
+	if err != nil {
+		return "", err
+	}
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("etcd authentication at %s failed with status %d", endpoint, res.StatusCode)
+	}
+
+	var auth struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&auth); err != nil {
+		return "", err
+	}
+
+	return auth.Token, nil
+}
+
+// etcdPrefixEnd returns the end of the key range that contains all keys with
+// the given prefix
+func etcdPrefixEnd(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+
+	// the prefix consists of 0xff bytes only, so the range ends with the
+	// last key
+	return []byte{0}
+}
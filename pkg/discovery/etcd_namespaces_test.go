@@ -0,0 +1,133 @@
+package discovery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/log"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func etcdKV(key string, value string) map[string]string {
+	return map[string]string{
+		"key":   base64.StdEncoding.EncodeToString([]byte(key)),
+		"value": base64.StdEncoding.EncodeToString([]byte(value)),
+	}
+}
+
+func TestEtcdNamespaceDiscoveryReadsAndWatchesNamespaces(t *testing.T) {
+	kvs := []map[string]string{
+		etcdKV("/exporter/app1", "format: \"$status\"\nsource:\n  files: [\"/dev/null\"]\n"),
+	}
+	events := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		decoded := make(map[string]interface{})
+		_ = json.Unmarshal(body, &decoded)
+
+		switch r.URL.Path {
+		case "/v3/auth/authenticate":
+			assert.Equal(t, "exporter", decoded["name"])
+			_, _ = w.Write([]byte(`{"token": "secret-token"}`))
+		case "/v3/kv/range":
+			assert.Equal(t, "secret-token", r.Header.Get("Authorization"))
+
+			key, _ := base64.StdEncoding.DecodeString(decoded["key"].(string))
+			end, _ := base64.StdEncoding.DecodeString(decoded["range_end"].(string))
+			assert.Equal(t, "/exporter/", string(key))
+			assert.Equal(t, "/exporter0", string(end))
+
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"header": map[string]string{"revision": "7"}, "kvs": kvs})
+		case "/v3/watch":
+			create := decoded["create_request"].(map[string]interface{})
+			assert.Equal(t, float64(8), create["start_revision"])
+
+			_, _ = fmt.Fprintln(w, `{"result": {"header": {"revision": "7"}, "created": true}}`)
+			w.(http.Flusher).Flush()
+
+			select {
+			case <-events:
+				_, _ = fmt.Fprintln(w, `{"result": {"header": {"revision": "8"}, "events": [{"type": "PUT"}]}}`)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+			}
+
+			<-r.Context().Done()
+		}
+	}))
+	defer srv.Close()
+
+	logger, err := log.New("error", "console")
+	require.NoError(t, err)
+
+	d, err := NewEtcdNamespaceDiscovery(logger, &config.Config{
+		EtcdEndpoints: []string{srv.URL},
+		EtcdPrefix:    "/exporter/",
+		EtcdUsername:  "exporter",
+		EtcdPassword:  "password",
+	})
+	require.NoError(t, err)
+
+	namespaces, err := d.Namespaces()
+	require.NoError(t, err)
+	require.Len(t, namespaces, 1)
+	assert.Equal(t, "app1", namespaces[0].Name)
+	assert.Equal(t, "$status", namespaces[0].Format)
+
+	kvs = append(kvs, etcdKV("/exporter/app2", "name: other\nformat: \"$status\"\nsource:\n  files: [\"/dev/null\"]\n"))
+
+	stop := make(chan bool)
+	changes := make(chan []config.NamespaceConfig, 1)
+	done := make(chan struct{})
+	go func() {
+		d.Watch(stop, func(ns []config.NamespaceConfig) { changes <- ns }, func(err error) { t.Error(err) })
+		close(done)
+	}()
+
+	events <- struct{}{}
+
+	select {
+	case ns := <-changes:
+		require.Len(t, ns, 2)
+		assert.Equal(t, "other", ns[1].Name)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not report the changed namespaces")
+	}
+
+	close(stop)
+	<-done
+}
+
+func TestEtcdNamespaceDiscoveryRejectsInvalidNamespace(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"header": map[string]string{"revision": "1"},
+			"kvs":    []map[string]string{etcdKV(config.DefaultEtcdPrefix+"broken", "parser: csv\n")},
+		})
+	}))
+	defer srv.Close()
+
+	logger, err := log.New("error", "console")
+	require.NoError(t, err)
+
+	d, err := NewEtcdNamespaceDiscovery(logger, &config.Config{EtcdEndpoints: []string{srv.URL}})
+	require.NoError(t, err)
+
+	_, err = d.Namespaces()
+	assert.ErrorContains(t, err, "broken")
+}
+
+func TestEtcdPrefixEnd(t *testing.T) {
+	assert.Equal(t, []byte("/a0"), etcdPrefixEnd([]byte("/a/")))
+	assert.Equal(t, []byte("b"), etcdPrefixEnd([]byte{'a', 0xff}))
+	assert.Equal(t, []byte{0}, etcdPrefixEnd([]byte{0xff}))
+}
@@ -0,0 +1,169 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+)
+
+// KubernetesEndpointRegistrator registers the exporter instance for scraping
+// by annotating its own pod with the common "prometheus.io/*" annotations
+// (which are used by most Kubernetes service discovery configurations)
+type KubernetesEndpointRegistrator struct {
+	api       *kubernetesAPI
+	client    *http.Client
+	namespace string
+	pod       string
+
+	port            int
+	metricsEndpoint string
+}
+
+// NewKubernetesEndpointRegistrator builds a new KubernetesEndpointRegistrator
+// from the service account credentials in the given directory. The pod name is
+// taken from the POD_NAME environment variable, or the hostname otherwise.
+func NewKubernetesEndpointRegistrator(cfg *config.Config, serviceAccountDir string) (*KubernetesEndpointRegistrator, error) {
+	api, err := newKubernetesAPI(serviceAccountDir)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	if err != nil {
+		return nil, err
+	}
+
+	pod := os.Getenv("POD_NAME")
+	if pod == "" {
+		if pod, err = os.Hostname(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &KubernetesEndpointRegistrator{
+		api:             api,
+		client:          &http.Client{Timeout: 10 * time.Second, Transport: api.transport},
+		namespace:       strings.TrimSpace(string(namespace)),
+		pod:             pod,
+		port:            cfg.Listen.Port,
+		metricsEndpoint: cfg.Listen.MetricsEndpoint,
+	}, nil
+}
+
+// Name implements the Registrator interface
+func (r *KubernetesEndpointRegistrator) Name() string {
+	return "Kubernetes"
+}
+
+// Register implements the Registrator interface
+func (r *KubernetesEndpointRegistrator) Register() error {
+	return r.annotate(map[string]interface{}{
+		"prometheus.io/scrape": "true",
+		"prometheus.io/port":   strconv.Itoa(r.port),
+		"prometheus.io/path":   getDefault(r.metricsEndpoint, "/metrics"),
+	})
+}
+
+// Unregister implements the Registrator interface
+func (r *KubernetesEndpointRegistrator) Unregister() error {
+	// null values remove the annotations in a JSON merge patch
+	return r.annotate(map[string]interface{}{
+		"prometheus.io/scrape": nil,
+		"prometheus.io/port":   nil,
+		"prometheus.io/path":   nil,
+	})
+}
+
+func (r *KubernetesEndpointRegistrator) annotate(annotations map[string]interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", r.namespace, r.pod)
+	req, err := r.api.newRequest(context.Background(), http.MethodPatch, path, bytes.NewReader(patch))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Kubernetes API responded with status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// kubernetesAPI contains the address of the Kubernetes API server and the
+// credentials for accessing it, taken from the service account of the pod
+type kubernetesAPI struct {
+	server    string
+	transport *http.Transport
+	token     string
+}
+
+// newKubernetesAPI reads the service account credentials from the given
+// directory; the API server address is taken from the KUBERNETES_SERVICE_HOST
+// and KUBERNETES_SERVICE_PORT environment variables
+func newKubernetesAPI(serviceAccountDir string) (*kubernetesAPI, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be set")
+	}
+
+	token, err := os.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("could not parse Kubernetes CA certificate")
+	}
+
+	return &kubernetesAPI{
+		server:    "https://" + net.JoinHostPort(host, port),
+		transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		token:     strings.TrimSpace(string(token)),
+	}, nil
+}
+
+// newRequest builds an authenticated request for the given API path
+func (a *kubernetesAPI) newRequest(ctx context.Context, method string, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, a.server+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	return req, nil
+}
@@ -0,0 +1,386 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/log"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+)
+
+// kubernetesWatchRetryDelay is the time to wait before re-establishing a
+// failed watch of the Kubernetes API
+const kubernetesWatchRetryDelay = 5 * time.Second
+
+// errKubernetesResourceVersionExpired is returned by watch when the API
+// server no longer has the changes since the listed resource version (410
+// Gone); this is expected for long-running watches, and is resolved by
+// listing the pods again
+var errKubernetesResourceVersionExpired = errors.New("Kubernetes resource version expired")
+
+// KubernetesNamespaceDiscovery discovers namespaces from the annotations of
+// Kubernetes pods. Each pod with a log path annotation becomes a namespace
+// that is named after the pod and reads the annotated log files.
+type KubernetesNamespaceDiscovery struct {
+	logger *log.Logger
+	api    *kubernetesAPI
+	cfg    *config.KubernetesDiscoveryConfig
+	query  url.Values
+
+	// client is used for listing pods, watchClient for the long-running
+	// watch requests (and thus has no timeout)
+	client      *http.Client
+	watchClient *http.Client
+
+	// pods contains the namespaces of the discovered pods by Kubernetes
+	// namespace ("" if pods are watched in all namespaces) and pod, and
+	// resourceVersions the most recently listed resource version of each
+	// Kubernetes namespace
+	mu               sync.Mutex
+	pods             map[string]map[string]config.NamespaceConfig
+	resourceVersions map[string]string
+
+	retryDelay time.Duration
+}
+
+type kubernetesPod struct {
+	Metadata struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+}
+
+type kubernetesPodList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []kubernetesPod `json:"items"`
+}
+
+type kubernetesWatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// kubernetesStatus is the object of an ERROR watch event
+type kubernetesStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewKubernetesNamespaceDiscovery builds a new KubernetesNamespaceDiscovery
+// from the service account that Kubernetes mounts into each container
+func NewKubernetesNamespaceDiscovery(logger *log.Logger, cfg *config.KubernetesDiscoveryConfig) (*KubernetesNamespaceDiscovery, error) {
+	api, err := newKubernetesAPI(kubernetesServiceAccountDir)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	if cfg.LabelSelector != "" {
+		query.Set("labelSelector", cfg.LabelSelector)
+	}
+
+	if node := cfg.NodeNameOrDefault(); node != "" {
+		query.Set("fieldSelector", "spec.nodeName="+node)
+	}
+
+	d := &KubernetesNamespaceDiscovery{
+		logger:           logger,
+		api:              api,
+		cfg:              cfg,
+		query:            query,
+		client:           &http.Client{Transport: api.transport, Timeout: 10 * time.Second},
+		watchClient:      &http.Client{Transport: api.transport},
+		pods:             make(map[string]map[string]config.NamespaceConfig),
+		resourceVersions: make(map[string]string),
+		retryDelay:       kubernetesWatchRetryDelay,
+	}
+
+	return d, nil
+}
+
+// Namespaces lists the pods in all watched Kubernetes namespaces and returns
+// the namespaces of the pods that have a log path annotation
+func (d *KubernetesNamespaceDiscovery) Namespaces() ([]config.NamespaceConfig, error) {
+	for _, scope := range d.scopes() {
+		if err := d.list(scope); err != nil {
+			return nil, err
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.namespacesLocked(), nil
+}
+
+// Watch watches the pods in all watched Kubernetes namespaces and calls
+// onChange with all namespaces whenever the annotations of a pod change or a
+// pod is added or removed, until stopChan is closed. Errors (which cause the
+// watch to be re-established) are passed to onError.
+func (d *KubernetesNamespaceDiscovery) Watch(stopChan <-chan bool, onChange func([]config.NamespaceConfig), onError func(error)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, scope := range d.scopes() {
+		wg.Add(1)
+		go func(scope string) {
+			defer wg.Done()
+			d.watchScope(ctx, scope, onChange, onError)
+		}(scope)
+	}
+
+	wg.Wait()
+}
+
+func (d *KubernetesNamespaceDiscovery) watchScope(ctx context.Context, scope string, onChange func([]config.NamespaceConfig), onError func(error)) {
+	for {
+		err := d.watch(ctx, scope, onChange)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if !errors.Is(err, errKubernetesResourceVersionExpired) {
+			onError(err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d.retryDelay):
+			}
+		}
+
+		// changes may have been missed while the watch was down (or the
+		// resource version may have expired)
+		if err := d.list(scope); err != nil {
+			onError(err)
+			continue
+		}
+
+		d.mu.Lock()
+		onChange(d.namespacesLocked())
+		d.mu.Unlock()
+	}
+}
+
+func (d *KubernetesNamespaceDiscovery) watch(ctx context.Context, scope string, onChange func([]config.NamespaceConfig)) error {
+	d.mu.Lock()
+	query := d.queryWith("watch", "1", "resourceVersion", d.resourceVersions[scope])
+	d.mu.Unlock()
+
+	res, err := d.get(ctx, d.watchClient, scope, query)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	decoder := json.NewDecoder(res.Body)
+	for {
+		var event kubernetesWatchEvent
+		if err := decoder.Decode(&event); err != nil {
+			return fmt.Errorf("Kubernetes watch failed: %s", err.Error())
+		}
+
+		if event.Type == "ERROR" {
+			var status kubernetesStatus
+			if err := json.Unmarshal(event.Object, &status); err == nil && status.Code == http.StatusGone {
+				return errKubernetesResourceVersionExpired
+			}
+
+			return fmt.Errorf("Kubernetes watch failed: %s", string(event.Object))
+		}
+
+		var pod kubernetesPod
+		if err := json.Unmarshal(event.Object, &pod); err != nil {
+			return fmt.Errorf("Kubernetes watch failed: %s", err.Error())
+		}
+
+		key := pod.Metadata.Namespace + "/" + pod.Metadata.Name
+
+		ns, present := d.namespaceForPod(&pod)
+		present = present && event.Type != "DELETED"
+
+		d.mu.Lock()
+		if d.pods[scope] == nil {
+			d.pods[scope] = make(map[string]config.NamespaceConfig)
+		}
+
+		previous, existed := d.pods[scope][key]
+		if present {
+			d.pods[scope][key] = ns
+		} else {
+			delete(d.pods[scope], key)
+		}
+
+		// most pod updates (like status changes) do not change the namespace
+		if existed != present || (present && !reflect.DeepEqual(previous, ns)) {
+			onChange(d.namespacesLocked())
+		}
+		d.mu.Unlock()
+	}
+}
+
+// list replaces the discovered pods of a Kubernetes namespace with the pods
+// that are currently running in it
+func (d *KubernetesNamespaceDiscovery) list(scope string) error {
+	res, err := d.get(context.Background(), d.client, scope, d.query)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var list kubernetesPodList
+	if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+		return err
+	}
+
+	pods := make(map[string]config.NamespaceConfig, len(list.Items))
+	for i := range list.Items {
+		pod := &list.Items[i]
+		if ns, ok := d.namespaceForPod(pod); ok {
+			pods[pod.Metadata.Namespace+"/"+pod.Metadata.Name] = ns
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.pods[scope] = pods
+	d.resourceVersions[scope] = list.Metadata.ResourceVersion
+
+	return nil
+}
+
+// namespaceForPod builds the namespace of a pod, or returns false if the pod
+// has no (valid) log path annotation
+func (d *KubernetesNamespaceDiscovery) namespaceForPod(pod *kubernetesPod) (config.NamespaceConfig, bool) {
+	var files config.FileSource
+	for _, f := range strings.Split(pod.Metadata.Annotations[d.cfg.PathAnnotationOrDefault()], ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			files = append(files, f)
+		}
+	}
+
+	if len(files) == 0 {
+		return config.NamespaceConfig{}, false
+	}
+
+	format := pod.Metadata.Annotations[d.cfg.FormatAnnotationOrDefault()]
+	if format == "" {
+		format = d.cfg.Format
+	}
+
+	ns := config.NamespaceConfig{
+		Name:               pod.Metadata.Name,
+		NamespaceLabelName: d.cfg.PodLabelOrDefault(),
+		Format:             format,
+		SourceData:         config.SourceData{Files: files},
+		Labels:             map[string]string{"kubernetes_namespace": pod.Metadata.Namespace},
+	}
+
+	ns.MetricsOverride = &struct {
+		Prefix string `hcl:"prefix" yaml:"prefix"`
+		Suffix string `hcl:"suffix" yaml:"suffix"`
+	}{Prefix: d.cfg.MetricsPrefixOrDefault()}
+
+	if err := ns.Compile(); err != nil {
+		d.logger.Warnf("ignoring pod %s/%s with invalid namespace configuration: %s", pod.Metadata.Namespace, pod.Metadata.Name, err.Error())
+		return config.NamespaceConfig{}, false
+	}
+
+	return ns, true
+}
+
+// namespacesLocked returns the namespaces of all discovered pods, sorted by
+// name; d.mu needs to be held
+func (d *KubernetesNamespaceDiscovery) namespacesLocked() []config.NamespaceConfig {
+	namespaces := make([]config.NamespaceConfig, 0)
+	for _, pods := range d.pods {
+		for _, ns := range pods {
+			namespaces = append(namespaces, ns)
+		}
+	}
+
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Name < namespaces[j].Name
+	})
+
+	return namespaces
+}
+
+// scopes returns the watched Kubernetes namespaces ("" for all namespaces)
+func (d *KubernetesNamespaceDiscovery) scopes() []string {
+	if len(d.cfg.Namespaces) == 0 {
+		return []string{""}
+	}
+
+	return d.cfg.Namespaces
+}
+
+// queryWith returns the configured query parameters, extended by the given
+// key/value pairs
+func (d *KubernetesNamespaceDiscovery) queryWith(pairs ...string) url.Values {
+	query := url.Values{}
+	for k, v := range d.query {
+		query[k] = v
+	}
+
+	for i := 0; i+1 < len(pairs); i += 2 {
+		query.Set(pairs[i], pairs[i+1])
+	}
+
+	return query
+}
+
+func (d *KubernetesNamespaceDiscovery) get(ctx context.Context, client *http.Client, scope string, query url.Values) (*http.Response, error) {
+	path := "/api/v1/pods"
+	if scope != "" {
+		path = fmt.Sprintf("/api/v1/namespaces/%s/pods", url.PathEscape(scope))
+	}
+
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	req, err := d.api.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+
+		if res.StatusCode == http.StatusGone {
+			return nil, errKubernetesResourceVersionExpired
+		}
+
+		return nil, fmt.Errorf("Kubernetes API responded with status %d", res.StatusCode)
+	}
+
+	return res, nil
+}
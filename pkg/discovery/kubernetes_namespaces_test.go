@@ -0,0 +1,230 @@
+package discovery
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/log"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func kubernetesTestPod(name string, annotations map[string]string) map[string]interface{} {
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":        name,
+			"namespace":   "web",
+			"annotations": annotations,
+		},
+	}
+}
+
+// useKubernetesTestServer points the Kubernetes API client to srv, using a
+// temporary service account directory
+func useKubernetesTestServer(t *testing.T, srv *httptest.Server) {
+	dir := t.TempDir()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ca.crt"), ca, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "token"), []byte("secret-token\n"), 0o600))
+
+	host, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", host)
+	t.Setenv("KUBERNETES_SERVICE_PORT", port)
+
+	previous := kubernetesServiceAccountDir
+	kubernetesServiceAccountDir = dir
+	t.Cleanup(func() { kubernetesServiceAccountDir = previous })
+}
+
+func TestKubernetesNamespaceDiscoveryReadsAndWatchesPods(t *testing.T) {
+	events := make(chan string)
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret-token", r.Header.Get("Authorization"))
+		assert.Equal(t, "/api/v1/namespaces/web/pods", r.URL.Path)
+		assert.Equal(t, "spec.nodeName=node-1", r.URL.Query().Get("fieldSelector"))
+
+		if r.URL.Query().Get("watch") == "" {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"metadata": map[string]string{"resourceVersion": "42"},
+				"items": []interface{}{
+					kubernetesTestPod("nginx-1", map[string]string{"prometheus.io/nginxlog-path": "/var/log/nginx-1/access.log"}),
+					kubernetesTestPod("other", nil),
+				},
+			})
+			return
+		}
+
+		assert.Equal(t, "42", r.URL.Query().Get("resourceVersion"))
+		w.(http.Flusher).Flush()
+
+		for {
+			select {
+			case event := <-events:
+				_, _ = fmt.Fprintln(w, event)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	useKubernetesTestServer(t, srv)
+
+	logger, err := log.New("error", "console")
+	require.NoError(t, err)
+
+	d, err := NewKubernetesNamespaceDiscovery(logger, &config.KubernetesDiscoveryConfig{
+		Namespaces: []string{"web"},
+		NodeName:   "node-1",
+		Format:     "$status",
+	})
+	require.NoError(t, err)
+
+	namespaces, err := d.Namespaces()
+	require.NoError(t, err)
+	require.Len(t, namespaces, 1)
+	assert.Equal(t, "nginx-1", namespaces[0].Name)
+	assert.Equal(t, "$status", namespaces[0].Format)
+	assert.Equal(t, config.FileSource{"/var/log/nginx-1/access.log"}, namespaces[0].SourceData.Files)
+	assert.Equal(t, "nginx", namespaces[0].NamespacePrefix)
+	assert.Equal(t, map[string]string{"pod": "nginx-1"}, namespaces[0].NamespaceLabels)
+
+	stop := make(chan bool)
+	changes := make(chan []config.NamespaceConfig, 1)
+	done := make(chan struct{})
+	go func() {
+		d.Watch(stop, func(ns []config.NamespaceConfig) { changes <- ns }, func(err error) { t.Error(err) })
+		close(done)
+	}()
+
+	// status updates of a pod do not change its namespace
+	events <- `{"type": "MODIFIED", "object": {"metadata": {"name": "nginx-1", "namespace": "web", "annotations": {"prometheus.io/nginxlog-path": "/var/log/nginx-1/access.log"}}}}`
+	events <- `{"type": "ADDED", "object": {"metadata": {"name": "nginx-2", "namespace": "web", "annotations": {"prometheus.io/nginxlog-path": "/var/log/nginx-2/access.log", "prometheus.io/nginxlog-format": "$request_time"}}}}`
+
+	select {
+	case ns := <-changes:
+		require.Len(t, ns, 2)
+		assert.Equal(t, "nginx-2", ns[1].Name)
+		assert.Equal(t, "$request_time", ns[1].Format)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not report the added pod")
+	}
+
+	events <- `{"type": "DELETED", "object": {"metadata": {"name": "nginx-1", "namespace": "web", "annotations": {"prometheus.io/nginxlog-path": "/var/log/nginx-1/access.log"}}}}`
+
+	select {
+	case ns := <-changes:
+		require.Len(t, ns, 1)
+		assert.Equal(t, "nginx-2", ns[0].Name)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not report the deleted pod")
+	}
+
+	close(stop)
+	<-done
+}
+
+func TestKubernetesNamespaceDiscoveryListsPodsAgainWhenResourceVersionExpired(t *testing.T) {
+	var mu sync.Mutex
+	lists := 0
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.URL.Query().Get("watch") == "" {
+			lists++
+
+			pods := []interface{}{kubernetesTestPod("nginx-1", map[string]string{"prometheus.io/nginxlog-path": "/var/log/nginx-1/access.log"})}
+			if lists > 1 {
+				pods = append(pods, kubernetesTestPod("nginx-2", map[string]string{"prometheus.io/nginxlog-path": "/var/log/nginx-2/access.log"}))
+			}
+
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"metadata": map[string]string{"resourceVersion": fmt.Sprint(41 + lists)},
+				"items":    pods,
+			})
+			return
+		}
+
+		switch r.URL.Query().Get("resourceVersion") {
+		case "42":
+			// the first watch is answered with an expired resource version
+			_, _ = fmt.Fprintln(w, `{"type": "ERROR", "object": {"kind": "Status", "code": 410, "reason": "Expired", "message": "too old resource version: 42 (50)"}}`)
+		case "43":
+			// the second one comes from an API server that answers with the
+			// status code instead
+			w.WriteHeader(http.StatusGone)
+		default:
+			w.(http.Flusher).Flush()
+			mu.Unlock()
+			<-r.Context().Done()
+			mu.Lock()
+		}
+	}))
+	defer srv.Close()
+
+	useKubernetesTestServer(t, srv)
+
+	logger, err := log.New("error", "console")
+	require.NoError(t, err)
+
+	d, err := NewKubernetesNamespaceDiscovery(logger, &config.KubernetesDiscoveryConfig{Namespaces: []string{"web"}})
+	require.NoError(t, err)
+
+	// an expired resource version must not wait for the retry delay
+	d.retryDelay = time.Hour
+
+	namespaces, err := d.Namespaces()
+	require.NoError(t, err)
+	require.Len(t, namespaces, 1)
+
+	stop := make(chan bool)
+	changes := make(chan []config.NamespaceConfig, 2)
+	done := make(chan struct{})
+	go func() {
+		d.Watch(stop, func(ns []config.NamespaceConfig) { changes <- ns }, func(err error) { t.Error(err) })
+		close(done)
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case ns := <-changes:
+			require.Len(t, ns, 2)
+			assert.Equal(t, "nginx-2", ns[1].Name)
+		case <-time.After(5 * time.Second):
+			t.Fatal("watch did not list the pods again")
+		}
+	}
+
+	close(stop)
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 3, lists)
+}
+
+func TestKubernetesNamespaceDiscoveryRequiresServiceEnvironment(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+
+	logger, err := log.New("error", "console")
+	require.NoError(t, err)
+
+	_, err = NewKubernetesNamespaceDiscovery(logger, &config.KubernetesDiscoveryConfig{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,41 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+)
+
+// Registrator registers the exporter instance at a service discovery backend
+type Registrator interface {
+	// Name returns a human-readable name of the service discovery backend
+	Name() string
+
+	Register() error
+	Unregister() error
+}
+
+// kubernetesServiceAccountDir is the directory in which Kubernetes mounts the
+// service account credentials into each container
+var kubernetesServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// AutoDetect detects the service discovery backend from the environment. It
+// checks for (in this order) the CONSUL_HTTP_ADDR environment variable, the
+// ETCD_ENDPOINTS environment variable and a Kubernetes service account. If
+// none of them is present, it returns nil (and no error).
+func AutoDetect(cfg *config.Config) (Registrator, error) {
+	if os.Getenv("CONSUL_HTTP_ADDR") != "" {
+		return NewConsulRegistrator(cfg)
+	}
+
+	if endpoints := os.Getenv("ETCD_ENDPOINTS"); endpoints != "" {
+		return NewEtcdRegistrator(cfg, endpoints)
+	}
+
+	if _, err := os.Stat(filepath.Join(kubernetesServiceAccountDir, "token")); err == nil {
+		return NewKubernetesEndpointRegistrator(cfg, kubernetesServiceAccountDir)
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,62 @@
+package discovery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoDetectReturnsNilWithoutBackend(t *testing.T) {
+	t.Setenv("CONSUL_HTTP_ADDR", "")
+	t.Setenv("ETCD_ENDPOINTS", "")
+	defer func(dir string) { kubernetesServiceAccountDir = dir }(kubernetesServiceAccountDir)
+	kubernetesServiceAccountDir = t.TempDir()
+
+	r, err := AutoDetect(&config.Config{})
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+}
+
+func TestAutoDetectPrefersConsul(t *testing.T) {
+	t.Setenv("CONSUL_HTTP_ADDR", "consul:8500")
+	t.Setenv("ETCD_ENDPOINTS", "http://etcd:2379")
+
+	r, err := AutoDetect(&config.Config{})
+	require.NoError(t, err)
+	assert.IsType(t, &ConsulRegistrator{}, r)
+}
+
+func TestEtcdRegistratorPutsAndDeletesKey(t *testing.T) {
+	requests := make(map[string]map[string]string)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		decoded := make(map[string]string)
+		_ = json.Unmarshal(body, &decoded)
+		requests[r.URL.Path] = decoded
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{Listen: config.ListenConfig{Port: 4040}}
+	cfg.Consul.Service.ID = "exporter-1"
+	cfg.Consul.Service.Address = "10.0.0.1"
+
+	r, err := NewEtcdRegistrator(cfg, "http://127.0.0.1:1,"+srv.URL)
+	require.NoError(t, err)
+
+	require.NoError(t, r.Register())
+	require.NoError(t, r.Unregister())
+
+	key, _ := base64.StdEncoding.DecodeString(requests["/v3/kv/put"]["key"])
+	value, _ := base64.StdEncoding.DecodeString(requests["/v3/kv/put"]["value"])
+	assert.Equal(t, "/services/nginx-exporter/exporter-1", string(key))
+	assert.JSONEq(t, `{"address": "10.0.0.1", "port": 4040}`, string(value))
+	assert.Equal(t, requests["/v3/kv/put"]["key"], requests["/v3/kv/deleterange"]["key"])
+}
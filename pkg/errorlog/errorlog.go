@@ -0,0 +1,199 @@
+package errorlog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+)
+
+// Record describes a log line that could not be parsed
+type Record struct {
+	Timestamp time.Time `json:"timestamp"`
+	Namespace string    `json:"namespace"`
+	RawLine   string    `json:"raw_line"`
+	Error     string    `json:"error"`
+}
+
+// File is a file that records are appended to. It can be reopened (after it
+// was moved away by log rotation) while it is being written to.
+type File struct {
+	path    string
+	maxSize int64
+
+	// refs is the number of callers that opened the file and did not close
+	// it yet; it is guarded by filesMu
+	refs int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+var (
+	filesMu sync.Mutex
+	files   = make(map[string]*File)
+)
+
+// Open returns the file at path. Each file is only opened once and shared by
+// all namespaces that write to it; it is closed when all of them called Close.
+func Open(path string) (*File, error) {
+	return open(path, 0, false)
+}
+
+// OpenRotating returns the file at path like Open, but rotates the file when
+// it would grow beyond maxSize bytes (if maxSize is positive): the file is
+// renamed by appending ".1" (replacing the previously rotated file), and a new
+// file is started. If the file is already open, its size limit is replaced by
+// maxSize, so that a changed limit takes effect when the configuration is
+// reloaded.
+func OpenRotating(path string, maxSize int64) (*File, error) {
+	return open(path, maxSize, true)
+}
+
+func open(path string, maxSize int64, setMaxSize bool) (*File, error) {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+
+	if f, ok := files[path]; ok {
+		if setMaxSize {
+			f.mu.Lock()
+			f.maxSize = maxSize
+			f.mu.Unlock()
+		}
+
+		f.refs++
+		return f, nil
+	}
+
+	file, size, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{path: path, maxSize: maxSize, refs: 1, file: file, size: size}
+	files[path] = f
+
+	return f, nil
+}
+
+// Close releases a file returned by Open or OpenRotating, which must not be
+// written to by the caller afterwards. The file is closed once every caller
+// that opened it released it.
+func (f *File) Close() error {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+
+	f.refs--
+	if f.refs > 0 {
+		return nil
+	}
+
+	delete(files, f.path)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
+
+// ReopenAll reopens all opened files, so that records are written to new
+// files after the previous ones were rotated. A file that cannot be reopened
+// keeps being written to at its previous location.
+func ReopenAll() error {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+
+	var errs []error
+	for _, f := range files {
+		if err := f.reopen(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// openFile opens the file at path for appending and returns its current size
+func openFile(path string) (*os.File, int64, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not open parse error log %s: %w", path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("could not open parse error log %s: %w", path, err)
+	}
+
+	return file, info.Size(), nil
+}
+
+func (f *File) reopen() error {
+	file, size, err := openFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	previous := f.file
+	f.file = file
+	f.size = size
+	f.mu.Unlock()
+
+	return previous.Close()
+}
+
+// rotate moves the file to its rotated name and starts a new one; f.mu must
+// be held
+func (f *File) rotate() error {
+	if err := os.Rename(f.path, f.path+".1"); err != nil {
+		return fmt.Errorf("could not rotate parse error log %s: %w", f.path, err)
+	}
+
+	file, size, err := openFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	previous := f.file
+	f.file = file
+	f.size = size
+
+	return previous.Close()
+}
+
+// Write appends a record to the file, either as JSON object or (similar to
+// NGINX's error log) as text line
+func (f *File) Write(r Record, format string) error {
+	var line []byte
+	if format == config.ParseErrorLogFormatText {
+		line = []byte(fmt.Sprintf("%s [error] %s: %s, line: %s\n", r.Timestamp.Format("2006/01/02 15:04:05"), r.Namespace, r.Error, strconv.Quote(r.RawLine)))
+	} else {
+		var err error
+		if line, err = json.Marshal(r); err != nil {
+			return err
+		}
+		line = append(line, '\n')
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(line)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+
+	return err
+}
@@ -0,0 +1,155 @@
+package errorlog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestFile(t *testing.T) (*File, string) {
+	t.Helper()
+
+	return openRotatingTestFile(t, 0)
+}
+
+func openRotatingTestFile(t *testing.T, maxSize int64) (*File, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "parse_errors.log")
+
+	f, err := OpenRotating(path, maxSize)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		filesMu.Lock()
+		defer filesMu.Unlock()
+
+		f.file.Close()
+		delete(files, path)
+	})
+
+	return f, path
+}
+
+var testRecord = Record{
+	Timestamp: time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC),
+	Namespace: "app",
+	RawLine:   `garbage "line"`,
+	Error:     "access log line does not match the format",
+}
+
+func TestWritesJSONRecords(t *testing.T) {
+	f, path := openTestFile(t)
+
+	require.NoError(t, f.Write(testRecord, config.ParseErrorLogFormatJSON))
+	require.NoError(t, f.Write(testRecord, config.ParseErrorLogFormatJSON))
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	require.Len(t, lines, 2)
+
+	var r Record
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &r))
+	assert.Equal(t, testRecord, r)
+}
+
+func TestWritesTextRecords(t *testing.T) {
+	f, path := openTestFile(t)
+
+	require.NoError(t, f.Write(testRecord, config.ParseErrorLogFormatText))
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "2024/03/01 12:30:00 [error] app: access log line does not match the format, line: \"garbage \\\"line\\\"\"\n", string(contents))
+}
+
+func TestOpenSharesFiles(t *testing.T) {
+	f, path := openTestFile(t)
+
+	other, err := Open(path)
+	require.NoError(t, err)
+	assert.Same(t, f, other)
+}
+
+func TestCloseClosesFileWhenAllCallersReleasedIt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "parse_errors.log")
+
+	f, err := Open(path)
+	require.NoError(t, err)
+
+	other, err := OpenRotating(path, 1024)
+	require.NoError(t, err)
+	require.Same(t, f, other)
+
+	require.NoError(t, f.Close())
+	require.NoError(t, other.Write(testRecord, config.ParseErrorLogFormatJSON))
+
+	require.NoError(t, other.Close())
+	assert.Error(t, other.Write(testRecord, config.ParseErrorLogFormatJSON))
+
+	reopened, err := Open(path)
+	require.NoError(t, err)
+	assert.NotSame(t, f, reopened)
+	require.NoError(t, reopened.Close())
+}
+
+func TestReopenAllWritesToNewFileAfterRotation(t *testing.T) {
+	f, path := openTestFile(t)
+
+	require.NoError(t, f.Write(testRecord, config.ParseErrorLogFormatJSON))
+	require.NoError(t, os.Rename(path, path+".1"))
+
+	require.NoError(t, ReopenAll())
+	require.NoError(t, f.Write(testRecord, config.ParseErrorLogFormatJSON))
+
+	rotated, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(rotated), "\n"))
+
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(current), "\n"))
+}
+
+func TestRotatesFilesThatExceedTheirMaximumSize(t *testing.T) {
+	line, err := json.Marshal(testRecord)
+	require.NoError(t, err)
+
+	// room for two records
+	f, path := openRotatingTestFile(t, int64(2*(len(line)+1)))
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, f.Write(testRecord, config.ParseErrorLogFormatJSON))
+	}
+
+	rotated, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(rotated)), "\n"), 2)
+
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(current)), "\n"), 1)
+}
+
+func TestOpenRotatingUpdatesSizeLimitOfOpenFile(t *testing.T) {
+	f, path := openRotatingTestFile(t, 1024)
+
+	other, err := OpenRotating(path, 2048)
+	require.NoError(t, err)
+	assert.Same(t, f, other)
+	assert.Equal(t, int64(2048), f.maxSize)
+
+	// Open does not change the limit
+	_, err = Open(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2048), f.maxSize)
+}
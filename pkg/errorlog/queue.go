@@ -0,0 +1,55 @@
+package errorlog
+
+// DefaultQueueSize is the number of records that can be waiting to be written
+// before further records are dropped
+const DefaultQueueSize = 1024
+
+// Queue writes records to a File in a background goroutine, so that the
+// callers do not have to wait for the file
+type Queue struct {
+	file    *File
+	format  string
+	records chan Record
+	done    chan struct{}
+}
+
+// NewQueue starts writing the records that are enqueued to f in the given
+// format; onError is called for records that could not be written
+func NewQueue(f *File, format string, size int, onError func(error)) *Queue {
+	q := &Queue{
+		file:    f,
+		format:  format,
+		records: make(chan Record, size),
+		done:    make(chan struct{}),
+	}
+
+	go func() {
+		defer close(q.done)
+
+		for r := range q.records {
+			if err := q.file.Write(r, q.format); err != nil {
+				onError(err)
+			}
+		}
+	}()
+
+	return q
+}
+
+// Enqueue adds a record to the queue without blocking. If the queue is full,
+// the record is dropped and false is returned.
+func (q *Queue) Enqueue(r Record) bool {
+	select {
+	case q.records <- r:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close writes the remaining records and stops the queue; no records may be
+// enqueued afterwards
+func (q *Queue) Close() {
+	close(q.records)
+	<-q.done
+}
@@ -0,0 +1,46 @@
+package errorlog
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueWritesRecordsInTheBackground(t *testing.T) {
+	f, path := openTestFile(t)
+
+	q := NewQueue(f, config.ParseErrorLogFormatJSON, 10, func(err error) { t.Error(err) })
+	for i := 0; i < 5; i++ {
+		require.True(t, q.Enqueue(testRecord))
+	}
+	q.Close()
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(contents)), "\n"), 5)
+}
+
+func TestQueueDropsRecordsWhenFull(t *testing.T) {
+	f, _ := openTestFile(t)
+
+	// the writer cannot make progress while the file is locked
+	f.mu.Lock()
+	q := NewQueue(f, config.ParseErrorLogFormatJSON, 1, func(err error) { t.Error(err) })
+
+	accepted := 0
+	for i := 0; i < 5; i++ {
+		if q.Enqueue(testRecord) {
+			accepted++
+		}
+	}
+	f.mu.Unlock()
+	q.Close()
+
+	// one record in the queue and at most one taken by the writer
+	assert.GreaterOrEqual(t, accepted, 1)
+	assert.LessOrEqual(t, accepted, 2)
+}
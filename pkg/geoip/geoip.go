@@ -0,0 +1,127 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// record contains the values of a MaxMind GeoIP2/GeoLite2 database entry
+// that can be used as labels. Country and city databases contain the country
+// and city, ASN databases contain the autonomous system.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
+	AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+}
+
+// Database is a MaxMind database that can be reloaded while it is being used
+type Database struct {
+	path string
+
+	mu     sync.RWMutex
+	reader *maxminddb.Reader
+}
+
+var (
+	databasesMu sync.Mutex
+	databases   = make(map[string]*Database)
+)
+
+// Open returns the database at path. Each database is only opened once and
+// shared by all namespaces that use it.
+func Open(path string) (*Database, error) {
+	databasesMu.Lock()
+	defer databasesMu.Unlock()
+
+	if db, ok := databases[path]; ok {
+		return db, nil
+	}
+
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open GeoIP database %s: %w", path, err)
+	}
+
+	db := &Database{path: path, reader: reader}
+	databases[path] = db
+
+	return db, nil
+}
+
+// ReloadAll re-reads all opened databases from disk, for example after they
+// were updated. A database that cannot be read keeps its previous contents.
+func ReloadAll() error {
+	databasesMu.Lock()
+	defer databasesMu.Unlock()
+
+	var errs []error
+	for _, db := range databases {
+		if err := db.reload(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (d *Database) reload() error {
+	reader, err := maxminddb.Open(d.path)
+	if err != nil {
+		return fmt.Errorf("could not reload GeoIP database %s: %w", d.path, err)
+	}
+
+	d.mu.Lock()
+	previous := d.reader
+	d.reader = reader
+	d.mu.Unlock()
+
+	return previous.Close()
+}
+
+// Enrich looks up the client address of a log line (the remote_addr field)
+// and stores the requested values in the fields of the line, prefixed with
+// config.GeoIPFieldPrefix. Values that are unknown (or all values, if the
+// address cannot be looked up) are stored as empty strings.
+func (d *Database) Enrich(fields map[string]string, labels []string) {
+	var r record
+
+	if ip := net.ParseIP(fields["remote_addr"]); ip != nil {
+		d.mu.RLock()
+		err := d.reader.Lookup(ip, &r)
+		d.mu.RUnlock()
+
+		if err != nil {
+			r = record{}
+		}
+	}
+
+	for _, l := range labels {
+		var value string
+
+		switch l {
+		case config.GeoIPCountryCode:
+			value = r.Country.ISOCode
+		case config.GeoIPCity:
+			value = r.City.Names["en"]
+		case config.GeoIPASN:
+			if r.AutonomousSystemNumber != 0 {
+				value = strconv.FormatUint(uint64(r.AutonomousSystemNumber), 10)
+			}
+		case config.GeoIPOrg:
+			value = r.AutonomousSystemOrganization
+		}
+
+		fields[config.GeoIPFieldPrefix+l] = value
+	}
+}
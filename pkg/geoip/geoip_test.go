@@ -0,0 +1,150 @@
+package geoip
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The following helpers encode values in the MaxMind DB data section format
+// (see https://maxmind.github.io/MaxMind-DB/), so that tests can build small
+// databases without needing a database file.
+
+func encodeString(s string) []byte {
+	if len(s) < 29 {
+		return append([]byte{0x40 | byte(len(s))}, s...)
+	}
+
+	return append([]byte{0x40 | 29, byte(len(s) - 29)}, s...)
+}
+
+func encodeUint(typ byte, v uint32) []byte {
+	b := []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+
+	return append([]byte{typ<<5 | byte(len(b))}, b...)
+}
+
+func encodeMap(m map[string][]byte) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b := []byte{0xE0 | byte(len(m))}
+	for _, k := range keys {
+		b = append(b, encodeString(k)...)
+		b = append(b, m[k]...)
+	}
+
+	return b
+}
+
+// writeDatabase writes an IPv4 database in which all addresses of 0.0.0.0/1
+// resolve to data, and all other addresses are unknown
+func writeDatabase(t *testing.T, path string, data map[string][]byte) {
+	t.Helper()
+
+	const nodeCount = 1
+
+	// the search tree consists of a single node with two 24 bit records:
+	// the left one points to the start of the data section, the right one
+	// marks the absence of data
+	dataPointer := nodeCount + 16
+	db := []byte{
+		byte(dataPointer >> 16), byte(dataPointer >> 8), byte(dataPointer),
+		0, 0, nodeCount,
+	}
+	db = append(db, make([]byte, 16)...)
+	db = append(db, encodeMap(data)...)
+
+	db = append(db, "\xAB\xCD\xEFMaxMind.com"...)
+	db = append(db, encodeMap(map[string][]byte{
+		"binary_format_major_version": encodeUint(5, 2),
+		"binary_format_minor_version": encodeUint(5, 0),
+		"database_type":               encodeString("GeoLite2-Test"),
+		"ip_version":                  encodeUint(5, 4),
+		"node_count":                  encodeUint(6, nodeCount),
+		"record_size":                 encodeUint(5, 24),
+	})...)
+
+	require.NoError(t, os.WriteFile(path, db, 0o644))
+
+	t.Cleanup(func() {
+		databasesMu.Lock()
+		defer databasesMu.Unlock()
+
+		if d, ok := databases[path]; ok {
+			d.reader.Close()
+			delete(databases, path)
+		}
+	})
+}
+
+func cityRecord(country, city string) map[string][]byte {
+	return map[string][]byte{
+		"country":                        encodeMap(map[string][]byte{"iso_code": encodeString(country)}),
+		"city":                           encodeMap(map[string][]byte{"names": encodeMap(map[string][]byte{"en": encodeString(city)})}),
+		"autonomous_system_number":       encodeUint(6, 3320),
+		"autonomous_system_organization": encodeString("Deutsche Telekom AG"),
+	}
+}
+
+func TestEnrichAddsRequestedValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeDatabase(t, path, cityRecord("DE", "Berlin"))
+
+	db, err := Open(path)
+	require.NoError(t, err)
+
+	fields := map[string]string{"remote_addr": "1.2.3.4"}
+	db.Enrich(fields, []string{"country_code", "city", "asn", "org"})
+
+	assert.Equal(t, "DE", fields["geoip_country_code"])
+	assert.Equal(t, "Berlin", fields["geoip_city"])
+	assert.Equal(t, "3320", fields["geoip_asn"])
+	assert.Equal(t, "Deutsche Telekom AG", fields["geoip_org"])
+}
+
+func TestEnrichUsesEmptyValuesForUnknownAddresses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeDatabase(t, path, cityRecord("DE", "Berlin"))
+
+	db, err := Open(path)
+	require.NoError(t, err)
+
+	for _, addr := range []string{"200.1.2.3", "not-an-ip", ""} {
+		fields := map[string]string{"remote_addr": addr}
+		db.Enrich(fields, []string{"country_code"})
+
+		assert.Equal(t, "", fields["geoip_country_code"], addr)
+	}
+}
+
+func TestReloadAllReadsUpdatedDatabases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeDatabase(t, path, cityRecord("DE", "Berlin"))
+
+	db, err := Open(path)
+	require.NoError(t, err)
+
+	again, err := Open(path)
+	require.NoError(t, err)
+	assert.Same(t, db, again)
+
+	writeDatabase(t, path, cityRecord("FR", "Paris"))
+	require.NoError(t, ReloadAll())
+
+	fields := map[string]string{"remote_addr": "1.2.3.4"}
+	db.Enrich(fields, []string{"country_code", "city"})
+
+	assert.Equal(t, "FR", fields["geoip_country_code"])
+	assert.Equal(t, "Paris", fields["geoip_city"])
+}
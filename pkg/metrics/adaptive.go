@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// adaptiveBucketsMinObservations is the number of observations after which
+// an AdaptiveHistogramVec checks whether its buckets need to be expanded
+const adaptiveBucketsMinObservations = 100
+
+// AdaptiveHistogramVec is a histogram vector that adds a new, larger bucket
+// when too many observations exceed its largest bucket. Since the buckets of
+// a histogram cannot be changed, the histogram is replaced by a new one,
+// which resets all of its counts.
+type AdaptiveHistogramVec struct {
+	opts        prometheus.HistogramOpts
+	labelNames  []string
+	overflowPct float64
+	maxValue    float64
+	expansions  prometheus.Counter
+
+	mu           sync.RWMutex
+	vec          *prometheus.HistogramVec
+	observations int
+	overflows    int
+}
+
+// NewAdaptiveHistogramVec creates a new AdaptiveHistogramVec. Whenever more
+// than overflowPct percent of (at least 100) observations exceeded the
+// largest bucket, the largest bucket is doubled and added as a new bucket, as
+// long as it does not exceed maxValue. Each expansion is counted by
+// expansions.
+func NewAdaptiveHistogramVec(opts prometheus.HistogramOpts, labelNames []string, overflowPct float64, maxValue float64, expansions prometheus.Counter) *AdaptiveHistogramVec {
+	if len(opts.Buckets) == 0 {
+		opts.Buckets = prometheus.DefBuckets
+	}
+
+	return &AdaptiveHistogramVec{
+		opts:        opts,
+		labelNames:  labelNames,
+		overflowPct: overflowPct,
+		maxValue:    maxValue,
+		expansions:  expansions,
+		vec:         prometheus.NewHistogramVec(opts, labelNames),
+	}
+}
+
+// Buckets returns the current buckets of the histogram
+func (h *AdaptiveHistogramVec) Buckets() []float64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.opts.Buckets
+}
+
+// Observe adds a single observation to the histogram with the given label
+// values
+func (h *AdaptiveHistogramVec) Observe(labelValues []string, value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.vec.WithLabelValues(labelValues...).Observe(value)
+
+	largest := h.opts.Buckets[len(h.opts.Buckets)-1]
+
+	h.observations++
+	if value > largest {
+		h.overflows++
+	}
+
+	if h.observations < adaptiveBucketsMinObservations {
+		return
+	}
+
+	if float64(h.overflows)*100/float64(h.observations) > h.overflowPct && largest*2 <= h.maxValue {
+		buckets := make([]float64, len(h.opts.Buckets), len(h.opts.Buckets)+1)
+		copy(buckets, h.opts.Buckets)
+		h.opts.Buckets = append(buckets, largest*2)
+
+		h.vec = prometheus.NewHistogramVec(h.opts, h.labelNames)
+		h.expansions.Inc()
+	}
+
+	h.observations = 0
+	h.overflows = 0
+}
+
+// Describe implements the prometheus.Collector interface
+func (h *AdaptiveHistogramVec) Describe(ch chan<- *prometheus.Desc) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	h.vec.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface
+func (h *AdaptiveHistogramVec) Collect(ch chan<- prometheus.Metric) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	h.vec.Collect(ch)
+}
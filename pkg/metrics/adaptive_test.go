@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveHistogramExpandsOnOverflow(t *testing.T) {
+	t.Parallel()
+
+	expansions := prometheus.NewCounter(prometheus.CounterOpts{Name: "expansions"})
+	h := NewAdaptiveHistogramVec(prometheus.HistogramOpts{Name: "adaptive", Buckets: []float64{0.5, 1}}, []string{"method"}, 10, 3, expansions)
+
+	for i := 0; i < 100; i++ {
+		h.Observe([]string{"GET"}, 1.5)
+	}
+
+	assert.Equal(t, []float64{0.5, 1, 2}, h.Buckets())
+	assert.Equal(t, float64(1), testutil.ToFloat64(expansions))
+
+	// the new histogram starts with empty counts
+	assert.Equal(t, 0, testutil.CollectAndCount(h))
+
+	for i := 0; i < 100; i++ {
+		h.Observe([]string{"GET"}, 5)
+	}
+
+	// doubling the largest bucket would exceed the maximum value
+	assert.Equal(t, []float64{0.5, 1, 2}, h.Buckets())
+	assert.Equal(t, float64(1), testutil.ToFloat64(expansions))
+	assert.Equal(t, 1, testutil.CollectAndCount(h))
+}
+
+func TestAdaptiveHistogramKeepsBucketsBelowThreshold(t *testing.T) {
+	t.Parallel()
+
+	expansions := prometheus.NewCounter(prometheus.CounterOpts{Name: "expansions"})
+	h := NewAdaptiveHistogramVec(prometheus.HistogramOpts{Name: "adaptive", Buckets: []float64{1}}, nil, 10, 100, expansions)
+
+	for i := 0; i < 100; i++ {
+		if i < 5 {
+			h.Observe(nil, 10)
+		} else {
+			h.Observe(nil, 0.1)
+		}
+	}
+
+	assert.Equal(t, []float64{1}, h.Buckets())
+	assert.Equal(t, float64(0), testutil.ToFloat64(expansions))
+}
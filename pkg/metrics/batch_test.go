@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchAppliesUpdatesOnFlush(t *testing.T) {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "count_total"}, []string{"status"})
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "seconds", Buckets: []float64{1}}, []string{"status"})
+
+	b := NewBatch()
+
+	labelValues := []string{"200"}
+	b.Add(counter, labelValues, 1)
+	b.Observe(histogram, labelValues, 0.5)
+
+	// the batch must not keep a reference to the caller's label values
+	labelValues[0] = "500"
+	b.Add(counter, labelValues, 2)
+	b.Add(counter, []string{"200"}, 1)
+	b.Observe(histogram, []string{"200"}, 2)
+
+	assert.Equal(t, 0, testutil.CollectAndCount(counter))
+
+	b.Flush()
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(counter.WithLabelValues("200")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(counter.WithLabelValues("500")))
+	assert.Equal(t, 1, testutil.CollectAndCount(histogram))
+
+	// flushing again does not apply the updates twice
+	b.Flush()
+	assert.Equal(t, 2.0, testutil.ToFloat64(counter.WithLabelValues("200")))
+}
+
+func TestObservationBatchAppliesCounterIncrementsImmediately(t *testing.T) {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "count_total"}, []string{"status"})
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "seconds", Buckets: []float64{1}}, []string{"status"})
+
+	b := NewObservationBatch()
+	b.Add(counter, []string{"200"}, 1)
+	b.Observe(histogram, []string{"200"}, 0.5)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(counter.WithLabelValues("200")))
+	assert.Equal(t, 0, testutil.CollectAndCount(histogram))
+
+	b.Flush()
+	assert.Equal(t, 1, testutil.CollectAndCount(histogram))
+	assert.Equal(t, 1.0, testutil.ToFloat64(counter.WithLabelValues("200")))
+}
+
+func TestAggregateHistogramsUsesDefaultFlushInterval(t *testing.T) {
+	m := &Collection{}
+	m.Init(&config.NamespaceConfig{Name: "aggregate_histograms", MetricsConfig: config.MetricsConfig{AggregateHistograms: true}})
+
+	assert.Equal(t, time.Second, m.BatchFlushInterval)
+	assert.True(t, m.NewBatch().observationsOnly)
+
+	m = &Collection{}
+	m.Init(&config.NamespaceConfig{Name: "aggregate_histograms", MetricsConfig: config.MetricsConfig{AggregateHistograms: true, BatchFlushInterval: "5s"}})
+
+	assert.Equal(t, 5*time.Second, m.BatchFlushInterval)
+	assert.False(t, m.NewBatch().observationsOnly)
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// OverflowLabelValue replaces the values of the dynamic labels of log lines
+// whose label combination exceeds the configured maximum
+const OverflowLabelValue = "__overflow__"
+
+// LabelLimiter limits the number of distinct label value combinations. Once
+// the limit is reached, the dynamic labels of all new combinations are
+// replaced with OverflowLabelValue, so that they share a single series.
+type LabelLimiter struct {
+	max       int
+	offset    int
+	overflows prometheus.Counter
+
+	mu         sync.Mutex
+	seen       map[string]struct{}
+	key        []byte
+	overflowed bool
+}
+
+// NewLabelLimiter creates a LabelLimiter that allows up to max distinct
+// label value combinations. The labels before offset are static and are not
+// replaced; each limited combination is counted by overflows.
+func NewLabelLimiter(max int, offset int, overflows prometheus.Counter) *LabelLimiter {
+	return &LabelLimiter{
+		max:       max,
+		offset:    offset,
+		overflows: overflows,
+		seen:      make(map[string]struct{}),
+	}
+}
+
+// Limit replaces the dynamic label values in place if their combination is
+// new and the limit has already been reached. It returns whether the values
+// were replaced, and whether this was the first time that the limit was
+// exceeded.
+func (l *LabelLimiter) Limit(values []string) (limited bool, first bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.key = l.key[:0]
+	for _, v := range values {
+		l.key = append(l.key, v...)
+		l.key = append(l.key, 0xff)
+	}
+
+	// the conversion in the map lookup does not allocate
+	if _, ok := l.seen[string(l.key)]; ok {
+		return false, false
+	}
+
+	if len(l.seen) < l.max {
+		l.seen[string(l.key)] = struct{}{}
+		return false, false
+	}
+
+	for i := l.offset; i < len(values); i++ {
+		values[i] = OverflowLabelValue
+	}
+	l.overflows.Inc()
+
+	first = !l.overflowed
+	l.overflowed = true
+
+	return true, first
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabelLimiterReplacesDynamicLabelsOfNewCombinations(t *testing.T) {
+	t.Parallel()
+
+	overflows := prometheus.NewCounter(prometheus.CounterOpts{Name: "overflow_total"})
+	l := NewLabelLimiter(2, 1, overflows)
+
+	for _, path := range []string{"/a", "/b", "/a"} {
+		values := []string{"shop", path}
+		limited, _ := l.Limit(values)
+		assert.False(t, limited)
+		assert.Equal(t, []string{"shop", path}, values)
+	}
+
+	values := []string{"shop", "/c"}
+	limited, first := l.Limit(values)
+	assert.True(t, limited)
+	assert.True(t, first)
+	assert.Equal(t, []string{"shop", OverflowLabelValue}, values)
+
+	values = []string{"shop", "/d"}
+	limited, first = l.Limit(values)
+	assert.True(t, limited)
+	assert.False(t, first)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(overflows))
+}
@@ -1,19 +1,100 @@
 package metrics
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
 
 // Collection is a struct containing pointers to all metrics that should be
 // exposed to Prometheus
 type Collection struct {
-	CountTotal                 *prometheus.CounterVec
-	ResponseBytesTotal         *prometheus.CounterVec
-	RequestBytesTotal          *prometheus.CounterVec
-	UpstreamSeconds            *prometheus.SummaryVec
-	UpstreamSecondsHist        *prometheus.HistogramVec
-	UpstreamConnectSeconds     *prometheus.SummaryVec
-	UpstreamConnectSecondsHist *prometheus.HistogramVec
-	ResponseSeconds            *prometheus.SummaryVec
-	ResponseSecondsHist        *prometheus.HistogramVec
-	CurrentUsers			   *prometheus.GaugeVec
-	ParseErrorsTotal           prometheus.Counter
+	CountTotal                     *prometheus.CounterVec
+	StatusCodeCounters             *StatusCodeCounters
+	CacheHitTotal                  *prometheus.CounterVec
+	CacheMissTotal                 *prometheus.CounterVec
+	ResponseBytesTotal             *prometheus.CounterVec
+	RequestBytesTotal              *prometheus.CounterVec
+	RequestHeaderBytesTotal        *prometheus.CounterVec
+	UpstreamBytesSentTotal         *prometheus.CounterVec
+	UpstreamBytesReceivedTotal     *prometheus.CounterVec
+	UpstreamSeconds                *prometheus.SummaryVec
+	UpstreamSecondsHist            *prometheus.HistogramVec
+	UpstreamSecondsAdaptiveHist    *AdaptiveHistogramVec
+	UpstreamConnectSeconds         *prometheus.SummaryVec
+	UpstreamConnectSecondsHist     *prometheus.HistogramVec
+	UpstreamConnectByPeerSeconds   *prometheus.HistogramVec
+	UpstreamHeaderSeconds          *prometheus.SummaryVec
+	UpstreamHeaderSecondsHist      *prometheus.HistogramVec
+	SSLHandshakeSeconds            *prometheus.SummaryVec
+	SSLHandshakeSecondsHist        *prometheus.HistogramVec
+	GzipRatio                      *prometheus.HistogramVec
+	GzipRatioSum                   *prometheus.CounterVec
+	ResponseSeconds                *prometheus.SummaryVec
+	ResponseSecondsHist            *prometheus.HistogramVec
+	PathResponseSecondsHist        *prometheus.HistogramVec
+	PathNormalizer                 *PathNormalizer
+	SessionSeconds                 *prometheus.SummaryVec
+	SessionSecondsHist             *prometheus.HistogramVec
+	SLOComplianceGauge             *prometheus.GaugeVec
+	sloCompliance                  *sloComplianceCollector
+	CurrentUsers                   *prometheus.GaugeVec
+	ConcurrentConnectionsGauge     *prometheus.GaugeVec
+	ResponseBytesP99               *prometheus.GaugeVec
+	ResponseSizeBucket             *prometheus.CounterVec
+	ResponseSizeBuckets            *SizeBuckets
+	ResponseBytesWindows           *QuantileWindowVec
+	LastLineTimestampSeconds       *LatestGauge
+	CustomGauges                   []*CustomGauge
+	PanicsRecoveredTotal           prometheus.Counter
+	ParseErrorsTotal               prometheus.Counter
+	ParseErrorRate                 *ParseErrorRate
+	HistogramBucketExpansionsTotal prometheus.Counter
+	LokiPushErrorsTotal            prometheus.Counter
+	LokiDroppedLinesTotal          prometheus.Counter
+	OverflowTotal                  prometheus.Counter
+	LabelLimiter                   *LabelLimiter
+	DryRun                         *DryRunRecorder
+	ScrapeGate                     *ScrapeGate
+	RecentLines                    *RecentLines
+
+	// BatchFlushInterval is the interval at which batched updates are
+	// applied; if 0, metrics are updated for every log line
+	BatchFlushInterval time.Duration
+
+	// batchObservationsOnly indicates that only the observations of
+	// histograms and summaries are batched
+	batchObservationsOnly bool
+
+	// counterLabelNames contains the names of the labels of the counters
+	counterLabelNames []string
+
+	// histogramLabelIndices contains the positions of the histogram labels
+	// within all labels; nil if histograms use all labels
+	histogramLabelIndices []int
+}
+
+// HistogramLabelValues selects the values of the histogram labels from the
+// values of all (non-counter-only) labels
+func (m *Collection) HistogramLabelValues(labelValues []string) []string {
+	if m.histogramLabelIndices == nil {
+		return labelValues
+	}
+
+	return m.AppendHistogramLabelValues(make([]string, 0, len(m.histogramLabelIndices)), labelValues)
+}
+
+// AppendHistogramLabelValues is like HistogramLabelValues, but appends the
+// values to dst (unless histograms use all labels, in which case labelValues
+// is returned)
+func (m *Collection) AppendHistogramLabelValues(dst []string, labelValues []string) []string {
+	if m.histogramLabelIndices == nil {
+		return labelValues
+	}
+
+	for _, idx := range m.histogramLabelIndices {
+		dst = append(dst, labelValues[idx])
+	}
+
+	return dst
 }
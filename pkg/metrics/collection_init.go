@@ -6,6 +6,10 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// NativeHistogramBucketFactor is the growth factor between the buckets of
+// native histograms
+const NativeHistogramBucketFactor = 1.1
+
 // Init initializes a metrics struct
 func (m *Collection) Init(cfg *config.NamespaceConfig) {
 	cfg.MustCompile()
@@ -14,6 +18,8 @@ func (m *Collection) Init(cfg *config.NamespaceConfig) {
 	counterLabels := labels
 
 	relabelings := relabeling.NewRelabelings(cfg.RelabelConfigs)
+	relabelings = append(relabelings, relabeling.NewRelabelings(cfg.GeoIP.RelabelConfigs())...)
+	relabelings = append(relabelings, relabeling.NewRelabelings(cfg.OptionalRelabelConfigs())...)
 	relabelings = append(relabelings, relabeling.DefaultRelabelings...)
 	relabelings = relabeling.UniqueRelabelings(relabelings)
 	relabelings = relabeling.StripExcluded(relabelings)
@@ -25,86 +31,405 @@ func (m *Collection) Init(cfg *config.NamespaceConfig) {
 		counterLabels = append(counterLabels, r.TargetLabel)
 	}
 
+	m.counterLabelNames = counterLabels
+
+	histogramLabels := labels
+	if len(cfg.HistogramLabels) > 0 {
+		include := make(map[string]struct{}, len(cfg.HistogramLabels))
+		for _, l := range cfg.HistogramLabels {
+			include[l] = struct{}{}
+		}
+
+		histogramLabels = make([]string, 0, len(cfg.HistogramLabels))
+		m.histogramLabelIndices = make([]int, 0, len(cfg.HistogramLabels))
+		for i, l := range labels {
+			if _, ok := include[l]; ok {
+				histogramLabels = append(histogramLabels, l)
+				m.histogramLabelIndices = append(m.histogramLabelIndices, i)
+			}
+		}
+	}
+
+	// the max age has already been validated by MustCompile
+	summaryMaxAge, _ := cfg.MetricsConfig.SummaryMaxAgeOrDefault()
+	summaryAgeBuckets := cfg.MetricsConfig.SummaryAgeBucketsOrDefault()
+	summaryObjectives := cfg.MetricsConfig.SummaryObjectivesOrDefault()
+
+	// with native histograms, the histograms keep their explicit buckets so
+	// that they are still exposed as classic histograms, too (without
+	// explicit buckets, the client library would only expose native ones)
+	var nativeBucketFactor float64
+	if cfg.MetricsConfig.NativeHistograms {
+		nativeBucketFactor = NativeHistogramBucketFactor
+	}
+
+	histogramBuckets := func(metric string) []float64 {
+		buckets := cfg.HistogramBucketsFor(metric)
+		if len(buckets) == 0 && cfg.MetricsConfig.NativeHistograms {
+			return prometheus.DefBuckets
+		}
+
+		return buckets
+	}
+
+	// the NGINX stream module proxies plain TCP/UDP connections instead of
+	// HTTP requests, so its metrics are named accordingly
+	protocol := "http_"
+	if cfg.StreamMode {
+		protocol = "stream_"
+	}
+
 	m.CountTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace:   cfg.NamespacePrefix,
 		ConstLabels: cfg.NamespaceLabels,
-		Name:        "http_response_count_total",
-		Help:        "Amount of processed HTTP requests",
+		Name:        protocol + "response_count_total",
+		Help:        cfg.MetricHelpFor(protocol+"response_count_total", "Amount of processed HTTP requests"),
 	}, counterLabels)
 
+	if cfg.MetricsConfig.PerStatusCodeCounters {
+		m.StatusCodeCounters = NewStatusCodeCounters(cfg)
+	}
+
+	if cfg.MetricsConfig.EnableCacheMetrics {
+		m.CacheHitTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        protocol + "cache_hit_total",
+			Help:        cfg.MetricHelpFor(protocol+"cache_hit_total", "Amount of requests that were served from the cache ($upstream_cache_status HIT)"),
+		}, labels)
+
+		m.CacheMissTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        protocol + "cache_miss_total",
+			Help:        cfg.MetricHelpFor(protocol+"cache_miss_total", "Amount of requests that were not found in the cache ($upstream_cache_status MISS)"),
+		}, labels)
+	}
+
 	m.ResponseBytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace:   cfg.NamespacePrefix,
 		ConstLabels: cfg.NamespaceLabels,
-		Name:        "http_response_size_bytes",
-		Help:        "Total amount of transferred bytes",
+		Name:        protocol + "response_size_bytes",
+		Help:        cfg.MetricHelpFor(protocol+"response_size_bytes", "Total amount of transferred bytes"),
 	}, labels)
 
 	m.RequestBytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace:   cfg.NamespacePrefix,
 		ConstLabels: cfg.NamespaceLabels,
-		Name:        "http_request_size_bytes",
-		Help:        "Total amount of received bytes",
+		Name:        protocol + "request_size_bytes",
+		Help:        cfg.MetricHelpFor(protocol+"request_size_bytes", "Total amount of received bytes"),
 	}, labels)
 
-	m.UpstreamSeconds = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+	m.RequestHeaderBytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace:   cfg.NamespacePrefix,
 		ConstLabels: cfg.NamespaceLabels,
-		Name:        "http_upstream_time_seconds",
-		Help:        "Time needed by upstream servers to handle requests",
-		Objectives:  map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		Name:        protocol + "request_header_size_bytes",
+		Help:        cfg.MetricHelpFor(protocol+"request_header_size_bytes", "Total amount of received header bytes (requires $request_body_length to be logged)"),
 	}, labels)
 
-	m.UpstreamSecondsHist = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	m.UpstreamBytesSentTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace:   cfg.NamespacePrefix,
 		ConstLabels: cfg.NamespaceLabels,
-		Name:        "http_upstream_time_seconds_hist",
-		Help:        "Time needed by upstream servers to handle requests",
-		Buckets:     cfg.HistogramBuckets,
+		Name:        protocol + "upstream_sent_size_bytes",
+		Help:        cfg.MetricHelpFor(protocol+"upstream_sent_size_bytes", "Total amount of bytes sent to upstream servers"),
 	}, labels)
 
+	m.UpstreamBytesReceivedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        protocol + "upstream_received_size_bytes",
+		Help:        cfg.MetricHelpFor(protocol+"upstream_received_size_bytes", "Total amount of bytes received from upstream servers"),
+	}, labels)
+
+	m.UpstreamSeconds = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        protocol + "upstream_time_seconds",
+		Help:        cfg.MetricHelpFor(protocol+"upstream_time_seconds", "Time needed by upstream servers to handle requests"),
+		Objectives:  summaryObjectives,
+		MaxAge:      summaryMaxAge,
+		AgeBuckets:  summaryAgeBuckets,
+	}, labels)
+
+	upstreamHistOpts := prometheus.HistogramOpts{
+		Namespace:                   cfg.NamespacePrefix,
+		ConstLabels:                 cfg.NamespaceLabels,
+		Name:                        protocol + "upstream_time_seconds_hist",
+		Help:                        cfg.MetricHelpFor(protocol+"upstream_time_seconds_hist", "Time needed by upstream servers to handle requests"),
+		Buckets:                     histogramBuckets(config.HistogramBucketsUpstreamSeconds),
+		NativeHistogramBucketFactor: nativeBucketFactor,
+	}
+
+	m.UpstreamSecondsHist = prometheus.NewHistogramVec(upstreamHistOpts, histogramLabels)
+
+	if cfg.MetricsConfig.AdaptiveBuckets {
+		m.HistogramBucketExpansionsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        "histogram_bucket_expansions_total",
+			Help:        cfg.MetricHelpFor("histogram_bucket_expansions_total", "Total number of buckets that were added to adaptive histograms"),
+		})
+
+		m.UpstreamSecondsAdaptiveHist = NewAdaptiveHistogramVec(
+			upstreamHistOpts,
+			histogramLabels,
+			cfg.MetricsConfig.AdaptiveBucketsOverflowPctOrDefault(),
+			cfg.MetricsConfig.AdaptiveBucketsMaxValueOrDefault(),
+			m.HistogramBucketExpansionsTotal,
+		)
+	}
+
 	m.UpstreamConnectSeconds = prometheus.NewSummaryVec(prometheus.SummaryOpts{
 		Namespace:   cfg.NamespacePrefix,
 		ConstLabels: cfg.NamespaceLabels,
-		Name:        "http_upstream_connect_time_seconds",
-		Help:        "Time needed to connect to upstream servers",
-		Objectives:  map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		Name:        protocol + "upstream_connect_time_seconds",
+		Help:        cfg.MetricHelpFor(protocol+"upstream_connect_time_seconds", "Time needed to connect to upstream servers"),
+		Objectives:  summaryObjectives,
+		MaxAge:      summaryMaxAge,
+		AgeBuckets:  summaryAgeBuckets,
 	}, labels)
 
 	m.UpstreamConnectSecondsHist = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:                   cfg.NamespacePrefix,
+		ConstLabels:                 cfg.NamespaceLabels,
+		Name:                        protocol + "upstream_connect_time_seconds_hist",
+		Help:                        cfg.MetricHelpFor(protocol+"upstream_connect_time_seconds_hist", "Time needed to connect to upstream servers"),
+		Buckets:                     histogramBuckets(config.HistogramBucketsUpstreamConnectSeconds),
+		NativeHistogramBucketFactor: nativeBucketFactor,
+	}, histogramLabels)
+
+	m.UpstreamHeaderSeconds = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        protocol + "upstream_header_time_seconds",
+		Help:        cfg.MetricHelpFor(protocol+"upstream_header_time_seconds", "Time needed by upstream servers to send the response headers"),
+		Objectives:  summaryObjectives,
+		MaxAge:      summaryMaxAge,
+		AgeBuckets:  summaryAgeBuckets,
+	}, labels)
+
+	m.UpstreamHeaderSecondsHist = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        protocol + "upstream_header_time_seconds_hist",
+		Help:        cfg.MetricHelpFor(protocol+"upstream_header_time_seconds_hist", "Time needed by upstream servers to send the response headers"),
+		Buckets:     histogramBuckets(config.HistogramBucketsUpstreamHeaderSeconds),
+	}, histogramLabels)
+
+	m.SSLHandshakeSeconds = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        protocol + "ssl_handshake_time_seconds",
+		Help:        cfg.MetricHelpFor(protocol+"ssl_handshake_time_seconds", "Time needed for TLS handshakes"),
+		Objectives:  summaryObjectives,
+		MaxAge:      summaryMaxAge,
+		AgeBuckets:  summaryAgeBuckets,
+	}, labels)
+
+	m.SSLHandshakeSecondsHist = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        protocol + "ssl_handshake_time_seconds_hist",
+		Help:        cfg.MetricHelpFor(protocol+"ssl_handshake_time_seconds_hist", "Time needed for TLS handshakes"),
+		Buckets:     histogramBuckets(config.HistogramBucketsSSLHandshakeSeconds),
+	}, histogramLabels)
+
+	m.GzipRatio = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        protocol + "gzip_ratio",
+		Help:        cfg.MetricHelpFor(protocol+"gzip_ratio", "Compression ratio of gzipped responses"),
+		Buckets:     cfg.MetricsConfig.GzipRatioBucketsOrDefault(),
+	}, histogramLabels)
+
+	m.GzipRatioSum = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace:   cfg.NamespacePrefix,
 		ConstLabels: cfg.NamespaceLabels,
-		Name:        "http_upstream_connect_time_seconds_hist",
-		Help:        "Time needed to connect to upstream servers",
-		Buckets:     cfg.HistogramBuckets,
+		Name:        protocol + "gzip_ratio_total",
+		Help:        cfg.MetricHelpFor(protocol+"gzip_ratio_total", "Sum of the compression ratios of gzipped responses"),
 	}, labels)
 
+	m.UpstreamConnectByPeerSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        protocol + "upstream_connect_time_seconds_by_peer",
+		Help:        cfg.MetricHelpFor(protocol+"upstream_connect_time_seconds_by_peer", "Time needed to connect to upstream servers, by upstream peer"),
+		Buckets:     cfg.MetricsConfig.UpstreamPeerBucketsOrDefault(),
+	}, append(append([]string{}, histogramLabels...), "upstream_peer"))
+
 	m.ResponseSeconds = prometheus.NewSummaryVec(prometheus.SummaryOpts{
 		Namespace:   cfg.NamespacePrefix,
 		ConstLabels: cfg.NamespaceLabels,
-		Name:        "http_response_time_seconds",
-		Help:        "Time needed by NGINX to handle requests",
-		Objectives:  map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		Name:        protocol + "response_time_seconds",
+		Help:        cfg.MetricHelpFor(protocol+"response_time_seconds", "Time needed by NGINX to handle requests"),
+		Objectives:  summaryObjectives,
+		MaxAge:      summaryMaxAge,
+		AgeBuckets:  summaryAgeBuckets,
 	}, labels)
 
 	m.ResponseSecondsHist = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:                   cfg.NamespacePrefix,
+		ConstLabels:                 cfg.NamespaceLabels,
+		Name:                        protocol + "response_time_seconds_hist",
+		Help:                        cfg.MetricHelpFor(protocol+"response_time_seconds_hist", "Time needed by NGINX to handle requests"),
+		Buckets:                     histogramBuckets(config.HistogramBucketsResponseSeconds),
+		NativeHistogramBucketFactor: nativeBucketFactor,
+	}, histogramLabels)
+
+	m.PathResponseSecondsHist = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        "path_response_seconds_histogram",
+		Help:        cfg.MetricHelpFor("path_response_seconds_histogram", "Time needed by NGINX to handle requests, by normalized request path"),
+		Buckets:     histogramBuckets(config.HistogramBucketsPathResponseSeconds),
+	}, append(append([]string{}, histogramLabels...), "path"))
+
+	if cfg.PathHistogram {
+		m.PathNormalizer = NewPathNormalizer(cfg.PathHistogramPatterns, cfg.MaxPathHistogramPathsOrDefault())
+	}
+
+	m.SessionSeconds = prometheus.NewSummaryVec(prometheus.SummaryOpts{
 		Namespace:   cfg.NamespacePrefix,
 		ConstLabels: cfg.NamespaceLabels,
-		Name:        "http_response_time_seconds_hist",
-		Help:        "Time needed by NGINX to handle requests",
-		Buckets:     cfg.HistogramBuckets,
+		Name:        "stream_session_time_seconds",
+		Help:        cfg.MetricHelpFor("stream_session_time_seconds", "Time needed by NGINX to handle stream sessions"),
+		Objectives:  summaryObjectives,
+		MaxAge:      summaryMaxAge,
+		AgeBuckets:  summaryAgeBuckets,
 	}, labels)
 
+	m.SessionSecondsHist = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        "stream_session_time_seconds_hist",
+		Help:        cfg.MetricHelpFor("stream_session_time_seconds_hist", "Time needed by NGINX to handle stream sessions"),
+		Buckets:     histogramBuckets(config.HistogramBucketsSessionSeconds),
+	}, histogramLabels)
+
+	m.SLOComplianceGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        protocol + "upstream_time_slo_compliance_ratio",
+		Help:        cfg.MetricHelpFor(protocol+"upstream_time_slo_compliance_ratio", "Fraction of requests whose upstream response time met the SLO threshold"),
+	}, append(append([]string{}, histogramLabels...), "threshold"))
+
+	var upstreamHist prometheus.Collector = m.UpstreamSecondsHist
+	if m.UpstreamSecondsAdaptiveHist != nil {
+		upstreamHist = m.UpstreamSecondsAdaptiveHist
+	}
+
+	m.sloCompliance = &sloComplianceCollector{
+		hist:       upstreamHist,
+		gauge:      m.SLOComplianceGauge,
+		labelNames: histogramLabels,
+		thresholds: cfg.SLOThresholds,
+	}
+
 	m.CurrentUsers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace:   cfg.NamespacePrefix,
 		ConstLabels: cfg.NamespaceLabels,
-		Name:        "http_current_users",
-		Help:        "Current number of users",
+		Name:        protocol + "current_users",
+		Help:        cfg.MetricHelpFor(protocol+"current_users", "Current number of users"),
+	}, labels)
+
+	m.ConcurrentConnectionsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        protocol + "concurrent_connections",
+		Help:        cfg.MetricHelpFor(protocol+"concurrent_connections", "Estimated number of concurrent connections (lower bound)"),
+	}, labels)
+
+	m.ResponseBytesP99 = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        protocol + "response_size_bytes_percentile",
+		Help:        cfg.MetricHelpFor(protocol+"response_size_bytes_percentile", "Running percentile of the transferred response sizes in bytes"),
 	}, labels)
 
+	m.ResponseBytesWindows = NewQuantileWindowVec(
+		cfg.MetricsConfig.ResponseBytesPercentileOrDefault(),
+		cfg.MetricsConfig.ResponseBytesPercentileWindowOrDefault(),
+	)
+
+	m.LastLineTimestampSeconds = NewLatestGauge(prometheus.GaugeOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        "last_line_timestamp_seconds",
+		Help:        cfg.MetricHelpFor("last_line_timestamp_seconds", "Timestamp ($time_local) of the most recently processed log line"),
+	})
+
+	m.ResponseSizeBucket = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        protocol + "response_size_distribution",
+		Help:        cfg.MetricHelpFor(protocol+"response_size_distribution", "Amount of processed responses, by response size category"),
+	}, append(append([]string{}, labels...), "size_bucket"))
+
+	m.ResponseSizeBuckets = NewSizeBuckets(cfg.MetricsConfig.ResponseSizeBucketBytesOrDefault())
+
+	m.CustomGauges = make([]*CustomGauge, len(cfg.CustomGaugeMetrics))
+	for i := range cfg.CustomGaugeMetrics {
+		m.CustomGauges[i] = NewCustomGauge(cfg, cfg.CustomGaugeMetrics[i])
+	}
+
 	m.ParseErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace:   cfg.NamespacePrefix,
 		ConstLabels: cfg.NamespaceLabels,
 		Name:        "parse_errors_total",
-		Help:        "Total number of log file lines that could not be parsed",
+		Help:        cfg.MetricHelpFor("parse_errors_total", "Total number of log file lines that could not be parsed"),
 	})
+
+	if cfg.MetricsConfig.ParseErrorThreshold > 0 {
+		m.ParseErrorRate = NewParseErrorRate(prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        "parse_error_rate_threshold_exceeded",
+			Help:        cfg.MetricHelpFor("parse_error_rate_threshold_exceeded", "Whether the fraction of log lines of the last minute that could not be parsed exceeds parse_error_threshold (1) or not (0)"),
+		}), cfg.MetricsConfig.ParseErrorThreshold)
+	}
+
+	m.PanicsRecoveredTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        "panics_recovered_total",
+		Help:        cfg.MetricHelpFor("panics_recovered_total", "Total number of log file lines whose processing panicked"),
+	})
+
+	if cfg.Loki != nil {
+		m.LokiPushErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        "loki_push_errors_total",
+			Help:        cfg.MetricHelpFor("loki_push_errors_total", "Total number of batches of log lines that could not be pushed to Loki"),
+		})
+
+		m.LokiDroppedLinesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        "loki_dropped_lines_total",
+			Help:        cfg.MetricHelpFor("loki_dropped_lines_total", "Total number of log lines that were not forwarded to Loki, because the push queue was full or their batch could not be pushed"),
+		})
+	}
+
+	if cfg.MetricsConfig.MaxLabelCombinations > 0 {
+		m.OverflowTotal = prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        "overflow_total",
+			Help:        cfg.MetricHelpFor("overflow_total", "Total number of log lines whose label combination exceeded max_label_combinations"),
+		})
+		m.LabelLimiter = NewLabelLimiter(cfg.MetricsConfig.MaxLabelCombinations, len(cfg.OrderedLabelNames), m.OverflowTotal)
+	}
+
+	// the interval has already been validated by MustCompile
+	m.BatchFlushInterval, _ = cfg.MetricsConfig.BatchFlushIntervalOrDefault()
+
+	if m.BatchFlushInterval == 0 && cfg.MetricsConfig.AggregateHistograms {
+		m.BatchFlushInterval = defaultHistogramAggregationInterval
+		m.batchObservationsOnly = true
+	}
+
+	if budget := cfg.MetricsConfig.ScrapeTimeoutBudget(); budget > 0 {
+		m.ScrapeGate = NewScrapeGate(budget)
+	}
 }
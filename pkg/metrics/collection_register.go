@@ -2,16 +2,98 @@ package metrics
 
 import "github.com/prometheus/client_golang/prometheus"
 
+func (c *Collection) collectors() []prometheus.Collector {
+	collectors := []prometheus.Collector{c.CountTotal}
+	if c.StatusCodeCounters != nil {
+		collectors = append(collectors, c.StatusCodeCounters)
+	}
+
+	if c.CacheHitTotal != nil {
+		collectors = append(collectors, c.CacheHitTotal, c.CacheMissTotal)
+	}
+
+	if c.ParseErrorRate != nil {
+		collectors = append(collectors, c.ParseErrorRate)
+	}
+
+	// the adaptive histogram replaces the regular one if enabled
+	var upstreamHist prometheus.Collector = c.UpstreamSecondsHist
+	if c.UpstreamSecondsAdaptiveHist != nil {
+		upstreamHist = c.UpstreamSecondsAdaptiveHist
+		collectors = append(collectors, c.HistogramBucketExpansionsTotal)
+	}
+
+	collectors = append(collectors,
+		c.RequestBytesTotal,
+		c.RequestHeaderBytesTotal,
+		c.ResponseBytesTotal,
+		c.UpstreamBytesSentTotal,
+		c.UpstreamBytesReceivedTotal,
+		c.UpstreamSeconds,
+		upstreamHist,
+		c.UpstreamConnectSeconds,
+		c.UpstreamConnectSecondsHist,
+		c.UpstreamConnectByPeerSeconds,
+		c.UpstreamHeaderSeconds,
+		c.UpstreamHeaderSecondsHist,
+		c.SSLHandshakeSeconds,
+		c.SSLHandshakeSecondsHist,
+		c.GzipRatio,
+		c.GzipRatioSum,
+		c.ResponseSeconds,
+		c.ResponseSecondsHist,
+		c.PathResponseSecondsHist,
+		c.SessionSeconds,
+		c.SessionSecondsHist,
+		c.sloCompliance,
+		c.CurrentUsers,
+		c.ConcurrentConnectionsGauge,
+		c.ResponseBytesP99,
+		c.ResponseSizeBucket,
+		c.LastLineTimestampSeconds,
+	)
+
+	for _, g := range c.CustomGauges {
+		collectors = append(collectors, g.Gauge)
+	}
+
+	if c.LokiPushErrorsTotal != nil {
+		collectors = append(collectors, c.LokiPushErrorsTotal, c.LokiDroppedLinesTotal)
+	}
+
+	if c.LabelLimiter != nil {
+		collectors = append(collectors, c.OverflowTotal)
+	}
+
+	return append(collectors, c.ParseErrorsTotal, c.PanicsRecoveredTotal)
+}
+
+// Register registers all metrics of the collection at a registry
+func (c *Collection) Register(r prometheus.Registerer) error {
+	for _, collector := range c.collectors() {
+		if err := r.Register(collector); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (c *Collection) MustRegister(r *prometheus.Registry) {
-	r.MustRegister(c.CountTotal)
-	r.MustRegister(c.RequestBytesTotal)
-	r.MustRegister(c.ResponseBytesTotal)
-	r.MustRegister(c.UpstreamSeconds)
-	r.MustRegister(c.UpstreamSecondsHist)
-	r.MustRegister(c.UpstreamConnectSeconds)
-	r.MustRegister(c.UpstreamConnectSecondsHist)
-	r.MustRegister(c.ResponseSeconds)
-	r.MustRegister(c.ResponseSecondsHist)
-	r.MustRegister(c.CurrentUsers)
-	r.MustRegister(c.ParseErrorsTotal)
+	if err := c.Register(r); err != nil {
+		panic(err)
+	}
+}
+
+// Unregister removes all metrics of the collection from a registry and
+// returns the number of metrics that were unregistered
+func (c *Collection) Unregister(r prometheus.Registerer) int {
+	unregistered := 0
+	for _, collector := range c.collectors() {
+		if r.Unregister(collector) {
+			unregistered++
+		}
+	}
+
+	return unregistered
 }
@@ -0,0 +1,202 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramLabelsRestrictHistogramLabelValues(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.NamespaceConfig{
+		Name:            "histogram_labels",
+		Labels:          map[string]string{"app": "shop", "env": "prod"},
+		HistogramLabels: []string{"env", "status"},
+	}
+
+	m, err := NewForNamespace(cfg)
+	require.NoError(t, err)
+
+	values := m.HistogramLabelValues([]string{"shop", "prod", "GET", "200"})
+	assert.Equal(t, []string{"prod", "200"}, values)
+
+	assert.NotPanics(t, func() {
+		m.ResponseSecondsHist.WithLabelValues(values...).Observe(0.1)
+	})
+}
+
+func TestHistogramsUseAllLabelsByDefault(t *testing.T) {
+	t.Parallel()
+
+	m, err := NewForNamespace(&config.NamespaceConfig{Name: "histogram_labels_default"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"GET", "200"}, m.HistogramLabelValues([]string{"GET", "200"}))
+}
+
+func TestRequestHeaderBytesAreExported(t *testing.T) {
+	t.Parallel()
+
+	m, err := NewForNamespace(&config.NamespaceConfig{Name: "request_header_bytes", NamespacePrefix: "request_header_bytes"})
+	require.NoError(t, err)
+
+	m.RequestHeaderBytesTotal.WithLabelValues("GET", "200").Add(300)
+
+	snapshot, err := m.Snapshot()
+	require.NoError(t, err)
+	assert.Equal(t, float64(300), snapshot[`request_header_bytes_http_request_header_size_bytes{method="GET",status="200"}`])
+}
+
+func TestMetricHelpOverridesDefaultHelp(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.NamespaceConfig{
+		Name:            "metric_help",
+		NamespacePrefix: "metric_help",
+		MetricHelp:      map[string]string{"http_response_count_total": "Requests handled by the shop frontend"},
+	}
+
+	m, err := NewForNamespace(cfg)
+	require.NoError(t, err)
+
+	m.CountTotal.WithLabelValues("GET", "200").Inc()
+	m.ResponseBytesTotal.WithLabelValues("GET", "200").Add(100)
+
+	families, err := m.Gatherer().Gather()
+	require.NoError(t, err)
+
+	help := make(map[string]string)
+	for _, family := range families {
+		help[family.GetName()] = family.GetHelp()
+	}
+
+	assert.Equal(t, "Requests handled by the shop frontend", help["metric_help_http_response_count_total"])
+	assert.Equal(t, "Total amount of transferred bytes", help["metric_help_http_response_size_bytes"])
+}
+
+func TestNativeHistogramsKeepClassicBuckets(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.NamespaceConfig{
+		Name:            "native_histograms",
+		NamespacePrefix: "native_histograms",
+		MetricsConfig:   config.MetricsConfig{NativeHistograms: true},
+	}
+
+	m, err := NewForNamespace(cfg)
+	require.NoError(t, err)
+
+	m.ResponseSecondsHist.WithLabelValues("GET", "200").Observe(0.1)
+
+	families, err := m.Gatherer().Gather()
+	require.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() != "native_histograms_http_response_time_seconds_hist" {
+			continue
+		}
+
+		h := family.GetMetric()[0].GetHistogram()
+		assert.NotEmpty(t, h.GetBucket(), "classic buckets")
+		assert.NotZero(t, h.GetSchema(), "native schema")
+		return
+	}
+
+	t.Fatal("response time histogram was not gathered")
+}
+
+func TestStreamModeRenamesMetrics(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.NamespaceConfig{Name: "stream_mode", NamespacePrefix: "stream_mode", StreamMode: true}
+
+	m, err := NewForNamespace(cfg)
+	require.NoError(t, err)
+
+	m.CountTotal.WithLabelValues("", "200").Inc()
+	m.ResponseBytesTotal.WithLabelValues("", "200").Add(100)
+	m.RequestBytesTotal.WithLabelValues("", "200").Add(40)
+	m.SessionSeconds.WithLabelValues("", "200").Observe(1.5)
+	m.SessionSecondsHist.WithLabelValues("", "200").Observe(1.5)
+
+	names := gatheredNames(t, m)
+
+	assert.Contains(t, names, "stream_mode_stream_response_count_total")
+	assert.Contains(t, names, "stream_mode_stream_response_size_bytes")
+	assert.Contains(t, names, "stream_mode_stream_request_size_bytes")
+	assert.Contains(t, names, "stream_mode_stream_session_time_seconds")
+	assert.Contains(t, names, "stream_mode_stream_session_time_seconds_hist")
+	assert.NotContains(t, names, "stream_mode_http_response_count_total")
+}
+
+// gatheredNames returns the names of all metric families of a namespace
+func gatheredNames(t *testing.T, m *NamespaceMetrics) []string {
+	t.Helper()
+
+	families, err := m.Gatherer().Gather()
+	require.NoError(t, err)
+
+	names := make([]string, len(families))
+	for i, family := range families {
+		names[i] = family.GetName()
+	}
+
+	return names
+}
+
+func TestLokiMetricsAreOnlyExportedWithLoki(t *testing.T) {
+	t.Parallel()
+
+	m, err := NewForNamespace(&config.NamespaceConfig{Name: "without_loki", NamespacePrefix: "without_loki"})
+	require.NoError(t, err)
+
+	names := gatheredNames(t, m)
+	assert.NotContains(t, names, "without_loki_loki_push_errors_total")
+	assert.NotContains(t, names, "without_loki_loki_dropped_lines_total")
+
+	m, err = NewForNamespace(&config.NamespaceConfig{
+		Name:            "with_loki",
+		NamespacePrefix: "with_loki",
+		Loki:            &config.LokiConfig{PushURL: "http://loki:3100/loki/api/v1/push"},
+	})
+	require.NoError(t, err)
+
+	names = gatheredNames(t, m)
+	assert.Contains(t, names, "with_loki_loki_push_errors_total")
+	assert.Contains(t, names, "with_loki_loki_dropped_lines_total")
+}
+
+func TestBucketExpansionsAreOnlyExportedWithAdaptiveBuckets(t *testing.T) {
+	t.Parallel()
+
+	m, err := NewForNamespace(&config.NamespaceConfig{Name: "static_buckets", NamespacePrefix: "static_buckets"})
+	require.NoError(t, err)
+	assert.NotContains(t, gatheredNames(t, m), "static_buckets_histogram_bucket_expansions_total")
+
+	m, err = NewForNamespace(&config.NamespaceConfig{
+		Name:            "adaptive_buckets",
+		NamespacePrefix: "adaptive_buckets",
+		MetricsConfig:   config.MetricsConfig{AdaptiveBuckets: true},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, gatheredNames(t, m), "adaptive_buckets_histogram_bucket_expansions_total")
+}
+
+func TestOverflowsAreOnlyExportedWithLabelLimit(t *testing.T) {
+	t.Parallel()
+
+	m, err := NewForNamespace(&config.NamespaceConfig{Name: "unlimited_labels", NamespacePrefix: "unlimited_labels"})
+	require.NoError(t, err)
+	assert.NotContains(t, gatheredNames(t, m), "unlimited_labels_overflow_total")
+
+	m, err = NewForNamespace(&config.NamespaceConfig{
+		Name:            "limited_labels",
+		NamespacePrefix: "limited_labels",
+		MetricsConfig:   config.MetricsConfig{MaxLabelCombinations: 10},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, gatheredNames(t, m), "limited_labels_overflow_total")
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CustomGauge exposes the most recently observed value of a log field as a
+// gauge
+type CustomGauge struct {
+	cfg   config.CustomGaugeConfig
+	Gauge *prometheus.GaugeVec
+
+	mu       sync.Mutex
+	lastSeen map[string]customGaugeSeries
+}
+
+type customGaugeSeries struct {
+	labelValues []string
+	lastSeen    time.Time
+}
+
+// NewCustomGauge creates a new custom gauge within a namespace
+func NewCustomGauge(ns *config.NamespaceConfig, cfg config.CustomGaugeConfig) *CustomGauge {
+	help := cfg.Help
+	if help == "" {
+		help = fmt.Sprintf("Most recently observed value of $%s", cfg.SourceField)
+	}
+
+	return &CustomGauge{
+		cfg: cfg,
+		Gauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   ns.NamespacePrefix,
+			ConstLabels: ns.NamespaceLabels,
+			Name:        cfg.Name + "_gauge",
+			Help:        help,
+		}, cfg.Labels),
+		lastSeen: make(map[string]customGaugeSeries),
+	}
+}
+
+// Observe sets the gauge to the value of the source field of a log line,
+// using the values of the label fields as label values. Lines that do not
+// contain the source field are ignored.
+func (g *CustomGauge) Observe(fields map[string]string) error {
+	value, ok := fields[g.cfg.SourceField]
+	if !ok || value == "" || value == "-" {
+		return nil
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("value '%s' of field '%s' could not be parsed into float", value, g.cfg.SourceField)
+	}
+
+	labelValues := make([]string, len(g.cfg.Labels))
+	for i, l := range g.cfg.Labels {
+		labelValues[i] = fields[l]
+	}
+
+	g.Gauge.WithLabelValues(labelValues...).Set(v)
+
+	g.mu.Lock()
+	g.lastSeen[strings.Join(labelValues, "\xff")] = customGaugeSeries{
+		labelValues: labelValues,
+		lastSeen:    time.Now(),
+	}
+	g.mu.Unlock()
+
+	return nil
+}
+
+// Expire removes all label combinations that were not observed within maxAge
+// from the gauge
+func (g *CustomGauge) Expire(maxAge time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for key, s := range g.lastSeen {
+		if time.Since(s.lastSeen) > maxAge {
+			g.Gauge.DeleteLabelValues(s.labelValues...)
+			delete(g.lastSeen, key)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCustomGauge() *CustomGauge {
+	return NewCustomGauge(&config.NamespaceConfig{NamespacePrefix: "nginx"}, config.CustomGaugeConfig{
+		Name:        "upstream_cache_age",
+		SourceField: "upstream_cache_age",
+		Labels:      []string{"upstream_addr"},
+	})
+}
+
+func TestCustomGaugeTracksLatestValue(t *testing.T) {
+	t.Parallel()
+
+	g := newTestCustomGauge()
+
+	assert.NoError(t, g.Observe(map[string]string{"upstream_cache_age": "10", "upstream_addr": "10.0.0.1:80"}))
+	assert.NoError(t, g.Observe(map[string]string{"upstream_cache_age": "3", "upstream_addr": "10.0.0.1:80"}))
+	assert.NoError(t, g.Observe(map[string]string{"upstream_cache_age": "-", "upstream_addr": "10.0.0.1:80"}))
+
+	assert.Equal(t, float64(3), testutil.ToFloat64(g.Gauge.WithLabelValues("10.0.0.1:80")))
+}
+
+func TestCustomGaugeRejectsNonNumericValues(t *testing.T) {
+	t.Parallel()
+
+	g := newTestCustomGauge()
+
+	assert.Error(t, g.Observe(map[string]string{"upstream_cache_age": "old"}))
+}
+
+func TestCustomGaugeExpiresStaleLabels(t *testing.T) {
+	t.Parallel()
+
+	g := newTestCustomGauge()
+
+	assert.NoError(t, g.Observe(map[string]string{"upstream_cache_age": "10", "upstream_addr": "10.0.0.1:80"}))
+	assert.Equal(t, 1, testutil.CollectAndCount(g.Gauge))
+
+	g.Expire(time.Hour)
+	assert.Equal(t, 1, testutil.CollectAndCount(g.Gauge))
+
+	g.Expire(0)
+	assert.Equal(t, 0, testutil.CollectAndCount(g.Gauge))
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DryRunCombination is a label value combination that was produced during a
+// dry run, together with the number of log lines that produced it
+type DryRunCombination struct {
+	Labels map[string]string
+	Lines  int
+}
+
+// DryRunRecorder counts the log lines of a dry run by the label value
+// combination that they would have been counted with
+type DryRunRecorder struct {
+	labelNames []string
+
+	mu     sync.Mutex
+	read   int
+	counts map[string]int
+	values map[string][]string
+}
+
+// NewDryRunRecorder creates a DryRunRecorder for the given (counter) label
+// names
+func NewDryRunRecorder(labelNames []string) *DryRunRecorder {
+	return &DryRunRecorder{
+		labelNames: labelNames,
+		counts:     make(map[string]int),
+		values:     make(map[string][]string),
+	}
+}
+
+// EnableDryRun makes the collection record the label value combinations of
+// the processed log lines in DryRun
+func (m *Collection) EnableDryRun() {
+	m.DryRun = NewDryRunRecorder(m.counterLabelNames)
+}
+
+// Read counts a log line that was read, regardless of whether it was parsed
+// successfully
+func (r *DryRunRecorder) Read() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.read++
+}
+
+// Observe counts a log line that produced the given label values
+func (r *DryRunRecorder) Observe(values []string) {
+	key := strings.Join(values, "\xff")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.counts[key]; !ok {
+		r.values[key] = append([]string{}, values...)
+	}
+	r.counts[key]++
+}
+
+// LinesRead returns the number of log lines that were read
+func (r *DryRunRecorder) LinesRead() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.read
+}
+
+// Combinations returns the recorded label value combinations, ordered by
+// their number of lines (descending)
+func (r *DryRunRecorder) Combinations() []DryRunCombination {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := make([]string, 0, len(r.counts))
+	for key := range r.counts {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if r.counts[keys[i]] != r.counts[keys[j]] {
+			return r.counts[keys[i]] > r.counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	combinations := make([]DryRunCombination, 0, len(keys))
+	for _, key := range keys {
+		labels := make(map[string]string, len(r.labelNames))
+		for i, name := range r.labelNames {
+			labels[name] = r.values[key][i]
+		}
+
+		combinations = append(combinations, DryRunCombination{Labels: labels, Lines: r.counts[key]})
+	}
+
+	return combinations
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunRecorderCountsCombinations(t *testing.T) {
+	r := NewDryRunRecorder([]string{"method", "status"})
+
+	r.Read()
+	r.Observe([]string{"GET", "200"})
+	r.Read()
+	r.Observe([]string{"POST", "500"})
+	r.Read()
+	r.Observe([]string{"GET", "200"})
+	r.Read()
+
+	assert.Equal(t, 4, r.LinesRead())
+	assert.Equal(t, []DryRunCombination{
+		{Labels: map[string]string{"method": "GET", "status": "200"}, Lines: 2},
+		{Labels: map[string]string{"method": "POST", "status": "500"}, Lines: 1},
+	}, r.Combinations())
+}
+
+func TestDryRunRecorderCopiesLabelValues(t *testing.T) {
+	r := NewDryRunRecorder([]string{"status"})
+
+	values := []string{"200"}
+	r.Observe(values)
+	values[0] = "404"
+
+	assert.Equal(t, "200", r.Combinations()[0].Labels["status"])
+}
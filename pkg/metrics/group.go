@@ -0,0 +1,186 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// GroupCollector is a prometheus.Collector that exposes the metrics of a
+// group of namespaces, summed up across all member namespaces. Summary
+// quantiles cannot be aggregated, so only their count and sum are exposed.
+type GroupCollector struct {
+	name    string
+	members []*NamespaceMetrics
+}
+
+type groupSample struct {
+	labelValues map[string]string
+	value       float64
+	count       uint64
+	sum         float64
+	buckets     map[float64]uint64
+}
+
+type groupFamily struct {
+	name       string
+	help       string
+	typ        dto.MetricType
+	labelNames map[string]struct{}
+	samples    map[string]*groupSample
+}
+
+// NewGroupCollector creates a new collector for a namespace group
+func NewGroupCollector(name string, members []*NamespaceMetrics) *GroupCollector {
+	return &GroupCollector{
+		name:    name,
+		members: members,
+	}
+}
+
+// Describe implements the prometheus.Collector interface. The collector is
+// unchecked, since the exposed metrics depend on the member namespaces.
+func (g *GroupCollector) Describe(chan<- *prometheus.Desc) {
+}
+
+// Collect implements the prometheus.Collector interface
+func (g *GroupCollector) Collect(ch chan<- prometheus.Metric) {
+	families := make(map[string]*groupFamily)
+	familyNames := make([]string, 0)
+
+	for _, member := range g.members {
+		mfs, err := member.registry.Gather()
+		if err != nil {
+			continue
+		}
+
+		prefix := ""
+		if member.cfg.NamespacePrefix != "" {
+			prefix = member.cfg.NamespacePrefix + "_"
+		}
+
+		for _, mf := range mfs {
+			name := g.name + "_" + strings.TrimPrefix(mf.GetName(), prefix)
+
+			f, ok := families[name]
+			if !ok {
+				f = &groupFamily{
+					name:       name,
+					help:       mf.GetHelp(),
+					typ:        mf.GetType(),
+					labelNames: make(map[string]struct{}),
+					samples:    make(map[string]*groupSample),
+				}
+				families[name] = f
+				familyNames = append(familyNames, name)
+			}
+
+			if f.typ != mf.GetType() {
+				continue
+			}
+
+			for _, m := range mf.Metric {
+				f.add(m, member.cfg.NamespaceLabels)
+			}
+		}
+	}
+
+	sort.Strings(familyNames)
+
+	for _, name := range familyNames {
+		families[name].collect(ch)
+	}
+}
+
+func (f *groupFamily) add(m *dto.Metric, excludedLabels map[string]string) {
+	labelValues := make(map[string]string, len(m.Label))
+	for _, l := range m.Label {
+		if _, ok := excludedLabels[l.GetName()]; ok {
+			continue
+		}
+
+		labelValues[l.GetName()] = l.GetValue()
+		f.labelNames[l.GetName()] = struct{}{}
+	}
+
+	key := labelKey(labelValues)
+	s, ok := f.samples[key]
+	if !ok {
+		s = &groupSample{
+			labelValues: labelValues,
+			buckets:     make(map[float64]uint64),
+		}
+		f.samples[key] = s
+	}
+
+	switch f.typ {
+	case dto.MetricType_COUNTER:
+		s.value += m.GetCounter().GetValue()
+	case dto.MetricType_GAUGE:
+		s.value += m.GetGauge().GetValue()
+	case dto.MetricType_UNTYPED:
+		s.value += m.GetUntyped().GetValue()
+	case dto.MetricType_SUMMARY:
+		s.count += m.GetSummary().GetSampleCount()
+		s.sum += m.GetSummary().GetSampleSum()
+	case dto.MetricType_HISTOGRAM:
+		s.count += m.GetHistogram().GetSampleCount()
+		s.sum += m.GetHistogram().GetSampleSum()
+		for _, b := range m.GetHistogram().GetBucket() {
+			s.buckets[b.GetUpperBound()] += b.GetCumulativeCount()
+		}
+	}
+}
+
+func (f *groupFamily) collect(ch chan<- prometheus.Metric) {
+	labelNames := make([]string, 0, len(f.labelNames))
+	for n := range f.labelNames {
+		labelNames = append(labelNames, n)
+	}
+	sort.Strings(labelNames)
+
+	desc := prometheus.NewDesc(f.name, f.help, labelNames, nil)
+
+	for _, s := range f.samples {
+		values := make([]string, len(labelNames))
+		for i, n := range labelNames {
+			values[i] = s.labelValues[n]
+		}
+
+		var (
+			m   prometheus.Metric
+			err error
+		)
+
+		switch f.typ {
+		case dto.MetricType_COUNTER:
+			m, err = prometheus.NewConstMetric(desc, prometheus.CounterValue, s.value, values...)
+		case dto.MetricType_GAUGE:
+			m, err = prometheus.NewConstMetric(desc, prometheus.GaugeValue, s.value, values...)
+		case dto.MetricType_UNTYPED:
+			m, err = prometheus.NewConstMetric(desc, prometheus.UntypedValue, s.value, values...)
+		case dto.MetricType_SUMMARY:
+			m, err = prometheus.NewConstSummary(desc, s.count, s.sum, nil, values...)
+		case dto.MetricType_HISTOGRAM:
+			m, err = prometheus.NewConstHistogram(desc, s.count, s.sum, s.buckets, values...)
+		default:
+			continue
+		}
+
+		if err == nil {
+			ch <- m
+		}
+	}
+}
+
+func labelKey(labelValues map[string]string) string {
+	pairs := make([]string, 0, len(labelValues))
+	for n, v := range labelValues {
+		pairs = append(pairs, n+"\xfe"+v)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "\xff")
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupCollectorSumsMemberMetrics(t *testing.T) {
+	t.Parallel()
+
+	app1, err := NewForNamespace(&config.NamespaceConfig{Name: "group_app1"})
+	require.NoError(t, err)
+	app2, err := NewForNamespace(&config.NamespaceConfig{Name: "group_app2", NamespaceLabelName: "vhost"})
+	require.NoError(t, err)
+
+	app1.CountTotal.WithLabelValues("GET", "200").Add(2)
+	app2.CountTotal.WithLabelValues("GET", "200").Add(3)
+	app2.CountTotal.WithLabelValues("POST", "500").Inc()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewGroupCollector("all", []*NamespaceMetrics{app1, app2}))
+
+	mfs, err := registry.Gather()
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, mf := range mfs {
+		if mf.GetName() != "all_http_response_count_total" {
+			continue
+		}
+
+		for _, m := range mf.Metric {
+			require.Len(t, m.Label, 2)
+			values[m.Label[0].GetValue()+" "+m.Label[1].GetValue()] = m.GetCounter().GetValue()
+		}
+	}
+
+	assert.Equal(t, map[string]float64{"GET 200": 5, "POST 500": 1}, values)
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import "sync"
+
+// LabelValuesPool is a pool of slices for label values that are only needed
+// while a single log line is processed, so that they do not need to be
+// allocated for every line
+type LabelValuesPool struct {
+	pool sync.Pool
+}
+
+// NewLabelValuesPool creates a pool of slices with the given capacity
+func NewLabelValuesPool(capacity int) *LabelValuesPool {
+	p := &LabelValuesPool{}
+	p.pool.New = func() interface{} {
+		values := make([]string, 0, capacity)
+		return &values
+	}
+
+	return p
+}
+
+// Get returns an empty slice from the pool
+func (p *LabelValuesPool) Get() *[]string {
+	values := p.pool.Get().(*[]string)
+	*values = (*values)[:0]
+
+	return values
+}
+
+// Put returns a slice to the pool; it must not be used afterwards
+func (p *LabelValuesPool) Put(values *[]string) {
+	// the label values are cleared, so that the pool does not keep them alive
+	for i := range *values {
+		(*values)[i] = ""
+	}
+
+	p.pool.Put(values)
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabelValuesPoolReturnsEmptySlices(t *testing.T) {
+	t.Parallel()
+
+	p := NewLabelValuesPool(4)
+
+	values := p.Get()
+	assert.Empty(t, *values)
+	assert.Equal(t, 4, cap(*values))
+
+	*values = append(*values, "GET", "200")
+	p.Put(values)
+
+	assert.Empty(t, *p.Get())
+}
+
+func TestAppendHistogramLabelValues(t *testing.T) {
+	t.Parallel()
+
+	m, err := NewForNamespace(&config.NamespaceConfig{
+		Name:            "append_histogram_labels",
+		Labels:          map[string]string{"app": "shop", "env": "prod"},
+		HistogramLabels: []string{"env", "status"},
+	})
+	require.NoError(t, err)
+
+	dst := make([]string, 0, 4)
+	values := m.AppendHistogramLabelValues(dst, []string{"shop", "prod", "GET", "200"})
+	assert.Equal(t, []string{"prod", "200"}, values)
+	assert.Equal(t, &dst[:1][0], &values[0], "values are appended to dst")
+}
+
+func benchmarkPathLabelValues(b *testing.B, pooled bool) {
+	m := &Collection{}
+	m.Init(&config.NamespaceConfig{
+		Name:                  "benchmark_path_labels",
+		Labels:                map[string]string{"app": "shop", "env": "prod"},
+		PathHistogramPatterns: []config.PathNormalizePattern{{RegexpString: "[0-9]+", Replacement: ":id"}},
+	})
+
+	p := NewLabelValuesPool(maxBenchmarkLabels)
+	labelValues := []string{"shop", "prod", "GET", "200"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if !pooled {
+			pathLabelValues := append(append([]string{}, labelValues...), "/users/:id")
+			m.PathResponseSecondsHist.WithLabelValues(pathLabelValues...).Observe(0.1)
+			continue
+		}
+
+		pathLabelValues := p.Get()
+		*pathLabelValues = append(append(*pathLabelValues, labelValues...), "/users/:id")
+		m.PathResponseSecondsHist.WithLabelValues(*pathLabelValues...).Observe(0.1)
+		p.Put(pathLabelValues)
+	}
+}
+
+// maxBenchmarkLabels is the capacity of the pooled slices in the benchmarks
+const maxBenchmarkLabels = 128
+
+// BenchmarkPathLabelValues and BenchmarkPathLabelValuesPooled compare the
+// allocations of extending the label values of a line by the path label with
+// and without a pool
+func BenchmarkPathLabelValues(b *testing.B) {
+	benchmarkPathLabelValues(b, false)
+}
+
+func BenchmarkPathLabelValuesPooled(b *testing.B) {
+	benchmarkPathLabelValues(b, true)
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// LabelCombination is a distinct combination of label values that was
+// observed in a namespace, together with the number of metrics (series) that
+// carry exactly these labels
+type LabelCombination struct {
+	Labels  map[string]string `json:"labels"`
+	Metrics int               `json:"metrics"`
+}
+
+// LabelCombinations returns all distinct label value combinations of the
+// namespace's metrics that currently exist, sorted by their label values.
+// Metrics without any labels are not included.
+func (m *NamespaceMetrics) LabelCombinations() ([]LabelCombination, error) {
+	mfs, err := m.registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	combinations := make(map[string]*LabelCombination)
+
+	for _, mf := range mfs {
+		for _, metric := range mf.Metric {
+			if len(metric.Label) == 0 {
+				continue
+			}
+
+			labels := make(map[string]string, len(metric.Label))
+			for _, l := range metric.Label {
+				labels[l.GetName()] = l.GetValue()
+			}
+
+			key := labelCombinationKey(labels)
+			if c, ok := combinations[key]; ok {
+				c.Metrics++
+			} else {
+				combinations[key] = &LabelCombination{Labels: labels, Metrics: 1}
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(combinations))
+	for k := range combinations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]LabelCombination, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, *combinations[k])
+	}
+
+	return result, nil
+}
+
+func labelCombinationKey(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, name+"="+value)
+	}
+
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// LabelsHandler serves the label value combinations of a namespace as JSON at
+// `<prefix><namespace>/labels`; prefix needs to end with a slash
+func LabelsHandler(prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, prefix), "/labels")
+		if !ok || name == "" || strings.Contains(name, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		namespacesMu.Lock()
+		m, ok := namespaces[name]
+		namespacesMu.Unlock()
+
+		if !ok {
+			http.Error(w, "unknown namespace '"+name+"'", http.StatusNotFound)
+			return
+		}
+
+		combinations, err := m.LabelCombinations()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(combinations)
+	})
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabelCombinationsCountsMetricsPerCombination(t *testing.T) {
+	t.Parallel()
+
+	m, err := NewForNamespace(&config.NamespaceConfig{Name: "labels_count"})
+	require.NoError(t, err)
+
+	m.CountTotal.WithLabelValues("GET", "200").Inc()
+	m.ResponseBytesTotal.WithLabelValues("GET", "200").Add(100)
+	m.CountTotal.WithLabelValues("POST", "500").Inc()
+
+	combinations, err := m.LabelCombinations()
+	require.NoError(t, err)
+
+	assert.Equal(t, []LabelCombination{
+		{Labels: map[string]string{"method": "GET", "status": "200"}, Metrics: 2},
+		{Labels: map[string]string{"method": "POST", "status": "500"}, Metrics: 1},
+	}, combinations)
+}
+
+func TestLabelsHandlerServesNamespaceLabels(t *testing.T) {
+	t.Parallel()
+
+	m, err := NewForNamespace(&config.NamespaceConfig{Name: "labels_handler"})
+	require.NoError(t, err)
+
+	m.CountTotal.WithLabelValues("GET", "200").Inc()
+
+	handler := LabelsHandler("/api/v1/namespaces/")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/namespaces/labels_handler/labels", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var combinations []LabelCombination
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &combinations))
+	assert.Equal(t, []LabelCombination{{Labels: map[string]string{"method": "GET", "status": "200"}, Metrics: 1}}, combinations)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/namespaces/unknown/labels", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LatestGauge is a gauge that never moves backwards: setting a value that is
+// smaller than the current value has no effect. It is used for the timestamps
+// of log lines, which may be processed out of order by multiple workers.
+type LatestGauge struct {
+	prometheus.Gauge
+
+	mu    sync.Mutex
+	value float64
+	set   bool
+}
+
+// NewLatestGauge creates a LatestGauge from the given gauge options
+func NewLatestGauge(opts prometheus.GaugeOpts) *LatestGauge {
+	return &LatestGauge{Gauge: prometheus.NewGauge(opts)}
+}
+
+// Set sets the gauge to v, unless it already has a larger value
+func (g *LatestGauge) Set(v float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.set && v <= g.value {
+		return
+	}
+
+	g.value = v
+	g.set = true
+	g.Gauge.Set(v)
+}
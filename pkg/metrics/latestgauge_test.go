@@ -0,0 +1,22 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatestGaugeDoesNotMoveBackwards(t *testing.T) {
+	t.Parallel()
+
+	g := NewLatestGauge(prometheus.GaugeOpts{Name: "last_line_timestamp_seconds"})
+
+	g.Set(100)
+	g.Set(90)
+	assert.Equal(t, 100.0, testutil.ToFloat64(g))
+
+	g.Set(110)
+	assert.Equal(t, 110.0, testutil.ToFloat64(g))
+}
@@ -1,10 +1,26 @@
 package metrics
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// NamespaceMetricsUnregisteredTotal counts the metrics that were unregistered
+// because their namespace was removed
+var NamespaceMetricsUnregisteredTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "prometheus_nginxlog_exporter",
+	Name:      "namespace_metrics_unregistered_total",
+	Help:      "Total number of metrics that were unregistered because their namespace was removed",
+})
+
+var (
+	namespacesMu sync.Mutex
+	namespaces   = make(map[string]*NamespaceMetrics)
+)
+
 type NamespaceMetrics struct {
 	cfg      *config.NamespaceConfig
 	registry *prometheus.Registry
@@ -12,15 +28,108 @@ type NamespaceMetrics struct {
 	Collection
 }
 
-func NewForNamespace(cfg *config.NamespaceConfig) *NamespaceMetrics {
+// NewForNamespace creates and registers the metrics of a namespace. It fails
+// if metrics for a namespace of the same name already exist (and were not
+// removed using ResetForNamespace).
+func NewForNamespace(cfg *config.NamespaceConfig) (*NamespaceMetrics, error) {
+	namespacesMu.Lock()
+	_, ok := namespaces[cfg.Name]
+	namespacesMu.Unlock()
+
+	if ok {
+		return nil, fmt.Errorf("metrics for namespace '%s' are already registered", cfg.Name)
+	}
+
+	m, err := PrepareForNamespace(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ActivateForNamespace(m)
+
+	return m, nil
+}
+
+// PrepareForNamespace creates the metrics of a namespace, but does not make
+// them the metrics of the namespace yet (see ActivateForNamespace). This
+// allows creating the metrics of all changed namespaces before any of them is
+// replaced.
+func PrepareForNamespace(cfg *config.NamespaceConfig) (*NamespaceMetrics, error) {
 	m := &NamespaceMetrics{
 		cfg:      cfg,
 		registry: prometheus.NewRegistry(),
 	}
 	m.Init(cfg)
-	m.MustRegister(m.registry)
 
-	return m
+	if err := m.Register(m.registry); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// ActivateForNamespace makes metrics created by PrepareForNamespace the
+// metrics of their namespace, unregistering the previous metrics of the
+// namespace (if there are any)
+func ActivateForNamespace(m *NamespaceMetrics) {
+	namespacesMu.Lock()
+	defer namespacesMu.Unlock()
+
+	if previous, ok := namespaces[m.cfg.Name]; ok && previous != m {
+		NamespaceMetricsUnregisteredTotal.Add(float64(previous.Unregister(previous.registry)))
+	}
+
+	namespaces[m.cfg.Name] = m
+}
+
+// ResetForNamespace unregisters all metrics of a namespace (for example, when
+// it was removed from the configuration), so that a namespace of the same name
+// can be created again later
+func ResetForNamespace(ns *config.NamespaceConfig) error {
+	namespacesMu.Lock()
+	defer namespacesMu.Unlock()
+
+	m, ok := namespaces[ns.Name]
+	if !ok {
+		return fmt.Errorf("no metrics registered for namespace '%s'", ns.Name)
+	}
+
+	NamespaceMetricsUnregisteredTotal.Add(float64(m.Unregister(m.registry)))
+	delete(namespaces, ns.Name)
+
+	return nil
+}
+
+// ReloadForNamespace returns the metrics for a namespace whose configuration
+// was reloaded. If neither the label names nor the other metric settings
+// (like buckets or the metric prefix) changed, the existing metrics are kept
+// (including their values); otherwise, they are replaced by metrics created
+// from the new configuration, which resets all values. If creating the new
+// metrics fails, the existing metrics are kept. The second return value tells
+// if the metrics were created again.
+func ReloadForNamespace(oldCfg, newCfg *config.NamespaceConfig) (*NamespaceMetrics, bool, error) {
+	namespacesMu.Lock()
+	m, ok := namespaces[oldCfg.Name]
+	namespacesMu.Unlock()
+
+	if ok && oldCfg.Name == newCfg.Name && oldCfg.SameMetrics(newCfg) {
+		return m, false, nil
+	}
+
+	m, err := PrepareForNamespace(newCfg)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if ok && oldCfg.Name != newCfg.Name {
+		if err := ResetForNamespace(oldCfg); err != nil {
+			return nil, false, err
+		}
+	}
+
+	ActivateForNamespace(m)
+
+	return m, true, nil
 }
 
 func (m *NamespaceMetrics) Gatherer() prometheus.Gatherer {
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespaceCanBeRecreatedAfterReset(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.NamespaceConfig{Name: "reset"}
+
+	m, err := NewForNamespace(cfg)
+	require.NoError(t, err)
+
+	_, err = NewForNamespace(cfg)
+	assert.Error(t, err)
+
+	before := testutil.ToFloat64(NamespaceMetricsUnregisteredTotal)
+	require.NoError(t, ResetForNamespace(cfg))
+	assert.Equal(t, float64(len(m.collectors())), testutil.ToFloat64(NamespaceMetricsUnregisteredTotal)-before)
+
+	mfs, err := m.Gatherer().Gather()
+	require.NoError(t, err)
+	assert.Empty(t, mfs)
+
+	_, err = NewForNamespace(cfg)
+	assert.NoError(t, err)
+}
+
+func TestResetOfUnknownNamespaceFails(t *testing.T) {
+	t.Parallel()
+
+	assert.Error(t, ResetForNamespace(&config.NamespaceConfig{Name: "unknown"}))
+}
+
+func TestReloadKeepsMetricsWithSameLabels(t *testing.T) {
+	t.Parallel()
+
+	oldCfg := &config.NamespaceConfig{Name: "reload_same", Labels: map[string]string{"app": "shop", "env": "prod"}}
+	newCfg := &config.NamespaceConfig{Name: "reload_same", Labels: map[string]string{"env": "prod", "app": "shop"}}
+	require.NoError(t, newCfg.Compile())
+
+	m, err := NewForNamespace(oldCfg)
+	require.NoError(t, err)
+
+	reloaded, recreated, err := ReloadForNamespace(oldCfg, newCfg)
+	require.NoError(t, err)
+	assert.False(t, recreated)
+	assert.Same(t, m, reloaded)
+}
+
+func TestReloadRecreatesMetricsWithChangedLabels(t *testing.T) {
+	t.Parallel()
+
+	oldCfg := &config.NamespaceConfig{Name: "reload_changed", Labels: map[string]string{"app": "shop"}}
+	newCfg := &config.NamespaceConfig{Name: "reload_changed", Labels: map[string]string{"app": "shop", "env": "prod"}}
+	require.NoError(t, newCfg.Compile())
+
+	m, err := NewForNamespace(oldCfg)
+	require.NoError(t, err)
+
+	reloaded, recreated, err := ReloadForNamespace(oldCfg, newCfg)
+	require.NoError(t, err)
+	assert.True(t, recreated)
+	assert.NotSame(t, m, reloaded)
+
+	assert.NotPanics(t, func() {
+		reloaded.CountTotal.WithLabelValues("shop", "prod", "GET", "200").Inc()
+	})
+}
+
+func TestReloadRecreatesMetricsWithChangedBuckets(t *testing.T) {
+	t.Parallel()
+
+	oldCfg := &config.NamespaceConfig{Name: "reload_buckets", HistogramBuckets: []float64{0.1, 1}}
+	newCfg := &config.NamespaceConfig{Name: "reload_buckets", HistogramBuckets: []float64{0.5, 5}}
+	require.NoError(t, newCfg.Compile())
+
+	m, err := NewForNamespace(oldCfg)
+	require.NoError(t, err)
+
+	reloaded, recreated, err := ReloadForNamespace(oldCfg, newCfg)
+	require.NoError(t, err)
+	assert.True(t, recreated)
+	assert.NotSame(t, m, reloaded)
+}
+
+func TestReloadKeepsMetricsIfNewMetricsCannotBeCreated(t *testing.T) {
+	t.Parallel()
+
+	oldCfg := &config.NamespaceConfig{Name: "reload_failed"}
+	newCfg := &config.NamespaceConfig{Name: "reload_failed", CustomGaugeMetrics: []config.CustomGaugeConfig{
+		{Name: "queue_length", SourceField: "queue_length"},
+		{Name: "queue_length", SourceField: "queue_length"},
+	}}
+	require.NoError(t, newCfg.Compile())
+
+	m, err := NewForNamespace(oldCfg)
+	require.NoError(t, err)
+
+	_, _, err = ReloadForNamespace(oldCfg, newCfg)
+	require.Error(t, err)
+
+	mfs, err := m.Gatherer().Gather()
+	require.NoError(t, err)
+	assert.NotEmpty(t, mfs)
+
+	// the existing metrics are still registered for the namespace
+	_, err = NewForNamespace(oldCfg)
+	assert.Error(t, err)
+}
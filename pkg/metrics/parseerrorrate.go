@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// parseErrorRateWindowSeconds is the length of the rolling window (in
+// seconds) over which the parse error rate is computed
+const parseErrorRateWindowSeconds = 60
+
+type parseErrorRateBucket struct {
+	second int64
+	lines  uint64
+	errors uint64
+}
+
+// ParseErrorRate tracks the fraction of log lines that could not be parsed
+// during the last minute, and sets a gauge to 1 whenever this fraction
+// exceeds a threshold (and to 0 otherwise). The gauge is updated when it is
+// collected, so that it drops back to 0 once the errors left the window, even
+// if no more lines are processed.
+type ParseErrorRate struct {
+	threshold float64
+	gauge     prometheus.Gauge
+	now       func() time.Time
+
+	mu      sync.Mutex
+	buckets [parseErrorRateWindowSeconds]parseErrorRateBucket
+}
+
+// NewParseErrorRate creates a new ParseErrorRate that updates gauge
+func NewParseErrorRate(gauge prometheus.Gauge, threshold float64) *ParseErrorRate {
+	return &ParseErrorRate{
+		threshold: threshold,
+		gauge:     gauge,
+		now:       time.Now,
+	}
+}
+
+// Observe records a processed line and whether it could not be parsed
+func (r *ParseErrorRate) Observe(failed bool) {
+	second := r.now().Unix()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b := &r.buckets[second%parseErrorRateWindowSeconds]
+	if b.second != second {
+		*b = parseErrorRateBucket{second: second}
+	}
+
+	b.lines++
+	if failed {
+		b.errors++
+	}
+}
+
+// Rate returns the fraction of the lines of the last minute that could not be
+// parsed, or 0 if no lines were processed
+func (r *ParseErrorRate) Rate() float64 {
+	now := r.now().Unix()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var lines, errors uint64
+	for _, b := range r.buckets {
+		if now-b.second < parseErrorRateWindowSeconds {
+			lines += b.lines
+			errors += b.errors
+		}
+	}
+
+	if lines == 0 {
+		return 0
+	}
+
+	return float64(errors) / float64(lines)
+}
+
+// Describe implements the prometheus.Collector interface
+func (r *ParseErrorRate) Describe(ch chan<- *prometheus.Desc) {
+	r.gauge.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface
+func (r *ParseErrorRate) Collect(ch chan<- prometheus.Metric) {
+	if r.Rate() > r.threshold {
+		r.gauge.Set(1)
+	} else {
+		r.gauge.Set(0)
+	}
+
+	r.gauge.Collect(ch)
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestParseErrorRate(threshold float64) (*ParseErrorRate, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	r := NewParseErrorRate(prometheus.NewGauge(prometheus.GaugeOpts{Name: "parse_error_rate_threshold_exceeded"}), threshold)
+	r.now = func() time.Time { return now }
+
+	return r, &now
+}
+
+func TestParseErrorRateIsComputedOverLastMinute(t *testing.T) {
+	t.Parallel()
+
+	r, now := newTestParseErrorRate(0.05)
+	assert.Equal(t, float64(0), r.Rate())
+
+	for i := 0; i < 9; i++ {
+		r.Observe(false)
+	}
+	r.Observe(true)
+	assert.InDelta(t, 0.1, r.Rate(), 1e-9)
+
+	*now = now.Add(30 * time.Second)
+	for i := 0; i < 10; i++ {
+		r.Observe(false)
+	}
+	assert.InDelta(t, 0.05, r.Rate(), 1e-9)
+
+	*now = now.Add(31 * time.Second)
+	assert.Equal(t, float64(0), r.Rate())
+}
+
+func TestParseErrorRateSetsGaugeWhenThresholdIsExceeded(t *testing.T) {
+	t.Parallel()
+
+	r, now := newTestParseErrorRate(0.05)
+
+	r.Observe(false)
+	assert.Equal(t, float64(0), testutil.ToFloat64(r))
+
+	r.Observe(true)
+	assert.Equal(t, float64(1), testutil.ToFloat64(r))
+
+	*now = now.Add(time.Minute)
+	assert.Equal(t, float64(0), testutil.ToFloat64(r))
+}
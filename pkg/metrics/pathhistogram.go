@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+)
+
+// OtherPath is the label value that is used for all paths once the maximum
+// number of distinct paths has been reached
+const OtherPath = "__other__"
+
+// PathNormalizer extracts normalized request paths from $request values,
+// limiting the number of distinct paths that it returns
+type PathNormalizer struct {
+	patterns []config.PathNormalizePattern
+	maxPaths int
+
+	mu    sync.Mutex
+	paths map[string]struct{}
+}
+
+// NewPathNormalizer creates a new PathNormalizer that applies the given
+// (compiled) patterns and returns at most maxPaths distinct paths
+func NewPathNormalizer(patterns []config.PathNormalizePattern, maxPaths int) *PathNormalizer {
+	return &PathNormalizer{
+		patterns: patterns,
+		maxPaths: maxPaths,
+		paths:    make(map[string]struct{}),
+	}
+}
+
+// Normalize returns the normalized path of a $request value (like
+// "GET /users/123?page=2 HTTP/1.1"). If the maximum number of distinct paths
+// has been reached, paths that were not seen before are mapped to OtherPath.
+func (n *PathNormalizer) Normalize(request string) (string, bool) {
+	parts := strings.Split(request, " ")
+	if len(parts) < 2 {
+		return "", false
+	}
+
+	path := parts[1]
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+
+	for _, p := range n.patterns {
+		path = p.CompiledRegexp.ReplaceAllString(path, p.Replacement)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, ok := n.paths[path]; ok {
+		return path, true
+	}
+
+	if len(n.paths) >= n.maxPaths {
+		return OtherPath, true
+	}
+
+	n.paths[path] = struct{}{}
+	return path, true
+}
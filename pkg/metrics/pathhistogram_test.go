@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathNormalizerAppliesPatterns(t *testing.T) {
+	t.Parallel()
+
+	n := NewPathNormalizer([]config.PathNormalizePattern{
+		{Replacement: "/:id", CompiledRegexp: regexp.MustCompile(`/[0-9]+`)},
+	}, 10)
+
+	path, ok := n.Normalize("GET /users/123/orders/456?page=2 HTTP/1.1")
+	assert.True(t, ok)
+	assert.Equal(t, "/users/:id/orders/:id", path)
+
+	_, ok = n.Normalize("-")
+	assert.False(t, ok)
+}
+
+func TestPathNormalizerCapsDistinctPaths(t *testing.T) {
+	t.Parallel()
+
+	n := NewPathNormalizer(nil, 2)
+
+	a, _ := n.Normalize("GET /a HTTP/1.1")
+	b, _ := n.Normalize("GET /b HTTP/1.1")
+	c, _ := n.Normalize("GET /c HTTP/1.1")
+	a2, _ := n.Normalize("GET /a HTTP/1.1")
+
+	assert.Equal(t, "/a", a)
+	assert.Equal(t, "/b", b)
+	assert.Equal(t, OtherPath, c)
+	assert.Equal(t, "/a", a2)
+}
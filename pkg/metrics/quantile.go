@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// quantileWindowMaxIdle is the time after which the window of a label
+// combination that is no longer observed is removed; windows are much larger
+// than metric series, so they must not pile up for label combinations that
+// were seen only once
+const quantileWindowMaxIdle = 10 * time.Minute
+
+// QuantileWindow estimates a quantile over a sliding window of the most
+// recent observations
+type QuantileWindow struct {
+	quantile float64
+	ring     []float64
+	sorted   []float64
+	next     int
+}
+
+// NewQuantileWindow creates a new QuantileWindow that estimates the given
+// quantile (0 < quantile <= 1) over the last size observations
+func NewQuantileWindow(quantile float64, size int) *QuantileWindow {
+	return &QuantileWindow{
+		quantile: quantile,
+		ring:     make([]float64, 0, size),
+		sorted:   make([]float64, 0, size),
+	}
+}
+
+// Observe adds a new value to the window (evicting the oldest one if the
+// window is full) and returns the updated quantile estimation
+func (w *QuantileWindow) Observe(v float64) float64 {
+	if len(w.ring) < cap(w.ring) {
+		w.ring = append(w.ring, v)
+	} else {
+		evicted := w.ring[w.next]
+		w.ring[w.next] = v
+		w.next = (w.next + 1) % len(w.ring)
+
+		i := sort.SearchFloat64s(w.sorted, evicted)
+		w.sorted = append(w.sorted[:i], w.sorted[i+1:]...)
+	}
+
+	i := sort.SearchFloat64s(w.sorted, v)
+	w.sorted = append(w.sorted, 0)
+	copy(w.sorted[i+1:], w.sorted[i:])
+	w.sorted[i] = v
+
+	return w.Value()
+}
+
+// Value returns the current quantile estimation (using the nearest-rank
+// method), or 0 if nothing has been observed yet
+func (w *QuantileWindow) Value() float64 {
+	if len(w.sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(w.quantile*float64(len(w.sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+
+	return w.sorted[rank]
+}
+
+// QuantileWindowVec maintains a separate QuantileWindow for each distinct
+// combination of label values; it is safe for concurrent use. Windows that
+// were not observed for quantileWindowMaxIdle are removed, so that their
+// estimation starts over when their label combination is observed again.
+type QuantileWindowVec struct {
+	quantile float64
+	size     int
+	maxIdle  time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	windows   map[string]*quantileWindowEntry
+	lastSweep time.Time
+}
+
+type quantileWindowEntry struct {
+	window   *QuantileWindow
+	lastSeen time.Time
+}
+
+// NewQuantileWindowVec creates a new QuantileWindowVec
+func NewQuantileWindowVec(quantile float64, size int) *QuantileWindowVec {
+	return &QuantileWindowVec{
+		quantile:  quantile,
+		size:      size,
+		maxIdle:   quantileWindowMaxIdle,
+		now:       time.Now,
+		windows:   make(map[string]*quantileWindowEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// Observe adds a new value to the window identified by labelValues and
+// returns the updated quantile estimation for that window
+func (v *QuantileWindowVec) Observe(labelValues []string, value float64) float64 {
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := v.now()
+	if now.Sub(v.lastSweep) > v.maxIdle {
+		v.sweep(now)
+	}
+
+	e, ok := v.windows[key]
+	if !ok {
+		e = &quantileWindowEntry{window: NewQuantileWindow(v.quantile, v.size)}
+		v.windows[key] = e
+	}
+	e.lastSeen = now
+
+	return e.window.Observe(value)
+}
+
+// sweep removes all windows that were not observed for maxIdle; the caller
+// must hold v.mu
+func (v *QuantileWindowVec) sweep(now time.Time) {
+	for key, e := range v.windows {
+		if now.Sub(e.lastSeen) > v.maxIdle {
+			delete(v.windows, key)
+		}
+	}
+	v.lastSweep = now
+}
+
+// Len returns the number of windows that are currently maintained
+func (v *QuantileWindowVec) Len() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return len(v.windows)
+}
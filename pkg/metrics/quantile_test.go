@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuantileWindowEstimatesQuantile(t *testing.T) {
+	t.Parallel()
+
+	w := NewQuantileWindow(0.9, 100)
+	for i := 1; i <= 100; i++ {
+		w.Observe(float64(i))
+	}
+
+	assert.Equal(t, float64(90), w.Value())
+}
+
+func TestQuantileWindowEvictsOldestObservations(t *testing.T) {
+	t.Parallel()
+
+	w := NewQuantileWindow(1, 3)
+	w.Observe(100)
+	w.Observe(1)
+	w.Observe(2)
+
+	assert.Equal(t, float64(100), w.Value())
+	assert.Equal(t, float64(3), w.Observe(3))
+}
+
+func TestQuantileWindowVecSeparatesLabelValues(t *testing.T) {
+	t.Parallel()
+
+	v := NewQuantileWindowVec(1, 10)
+	v.Observe([]string{"GET", "200"}, 1000)
+
+	assert.Equal(t, float64(10), v.Observe([]string{"POST", "200"}, 10))
+	assert.Equal(t, float64(1000), v.Observe([]string{"GET", "200"}, 10))
+}
+
+func TestQuantileWindowVecRemovesIdleWindows(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0)
+
+	v := NewQuantileWindowVec(1, 10)
+	v.now = func() time.Time { return now }
+	v.lastSweep = now
+
+	v.Observe([]string{"GET", "200"}, 1000)
+	v.Observe([]string{"GET", "404"}, 10)
+
+	now = now.Add(quantileWindowMaxIdle / 2)
+	v.Observe([]string{"GET", "200"}, 10)
+	assert.Equal(t, 2, v.Len())
+
+	now = now.Add(quantileWindowMaxIdle/2 + time.Second)
+	v.Observe([]string{"GET", "200"}, 10)
+	assert.Equal(t, 1, v.Len())
+
+	// the estimation of a removed window starts over
+	assert.Equal(t, float64(1), v.Observe([]string{"GET", "404"}, 1))
+	assert.Equal(t, float64(1000), v.Observe([]string{"GET", "200"}, 10))
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// RecentLines is a ring buffer of the most recent raw log lines of a
+// namespace
+type RecentLines struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+// NewRecentLines creates a RecentLines buffer that keeps the last size lines
+func NewRecentLines(size int) *RecentLines {
+	return &RecentLines{lines: make([]string, size)}
+}
+
+// EnableRecentLines makes the collection keep the last size raw log lines in
+// RecentLines (unless it already does)
+func (m *Collection) EnableRecentLines(size int) {
+	if m.RecentLines == nil {
+		m.RecentLines = NewRecentLines(size)
+	}
+}
+
+// Add adds a line to the buffer, replacing the oldest line if the buffer is
+// full
+func (b *RecentLines) Add(line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lines[b.next] = line
+	b.next++
+	if b.next == len(b.lines) {
+		b.next = 0
+		b.full = true
+	}
+}
+
+// Lines returns the buffered lines, from the oldest to the most recent one
+func (b *RecentLines) Lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.full {
+		return append([]string{}, b.lines[:b.next]...)
+	}
+
+	return append(append([]string{}, b.lines[b.next:]...), b.lines[:b.next]...)
+}
+
+// RecentLinesHandler serves the recent raw log lines of the namespace given by
+// the `namespace` query parameter as a JSON array
+func RecentLinesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("namespace")
+		if name == "" {
+			http.Error(w, "the namespace parameter is required", http.StatusBadRequest)
+			return
+		}
+
+		namespacesMu.Lock()
+		m, ok := namespaces[name]
+		namespacesMu.Unlock()
+
+		if !ok {
+			http.Error(w, "unknown namespace '"+name+"'", http.StatusNotFound)
+			return
+		}
+
+		lines := []string{}
+		if m.RecentLines != nil {
+			lines = m.RecentLines.Lines()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(lines)
+	})
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecentLinesKeepsMostRecentLines(t *testing.T) {
+	b := NewRecentLines(3)
+	assert.Empty(t, b.Lines())
+
+	b.Add("a")
+	b.Add("b")
+	assert.Equal(t, []string{"a", "b"}, b.Lines())
+
+	b.Add("c")
+	b.Add("d")
+	b.Add("e")
+	assert.Equal(t, []string{"c", "d", "e"}, b.Lines())
+}
+
+func TestRecentLinesHandlerServesNamespaceLines(t *testing.T) {
+	t.Parallel()
+
+	m, err := NewForNamespace(&config.NamespaceConfig{Name: "recent_lines_handler"})
+	require.NoError(t, err)
+
+	m.EnableRecentLines(10)
+	m.RecentLines.Add(`127.0.0.1 - - "GET / HTTP/1.1" 200`)
+
+	handler := RecentLinesHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/recent-lines?namespace=recent_lines_handler", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var lines []string
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &lines))
+	assert.Equal(t, []string{`127.0.0.1 - - "GET / HTTP/1.1" 200`}, lines)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/recent-lines?namespace=unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/recent-lines", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
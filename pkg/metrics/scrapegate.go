@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// scrapeGatePollInterval is the interval at which WaitForScrapes checks
+// whether the scrapes are done
+const scrapeGatePollInterval = 10 * time.Millisecond
+
+// ScrapeGate pauses the periodic cleanup work of a namespace while its
+// metrics are being scraped, so that the cleanup does not compete with the
+// scrape for CPU time. Scrapes hold the gate for at most the budget. Beginning
+// a scrape never blocks.
+type ScrapeGate struct {
+	budget time.Duration
+
+	// active is the number of running scrapes, and until is the time (in
+	// Unix nanoseconds) at which the budget of the most recently started
+	// scrape ends
+	active atomic.Int64
+	until  atomic.Int64
+}
+
+// NewScrapeGate creates a ScrapeGate that pauses the cleanup work for at most
+// budget per scrape
+func NewScrapeGate(budget time.Duration) *ScrapeGate {
+	return &ScrapeGate{budget: budget}
+}
+
+// BeginScrape holds the gate until the returned function is called (when the
+// scrape is finished) or the budget elapsed. Concurrent scrapes may hold the
+// gate at the same time.
+func (g *ScrapeGate) BeginScrape() (end func()) {
+	if g == nil {
+		return func() {}
+	}
+
+	g.active.Add(1)
+
+	deadline := time.Now().Add(g.budget).UnixNano()
+	for {
+		until := g.until.Load()
+		if until >= deadline || g.until.CompareAndSwap(until, deadline) {
+			break
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			g.active.Add(-1)
+		})
+	}
+}
+
+// WaitForScrapes blocks until no scrape holds the gate anymore; the cleanup
+// work calls it before running. Since scrapes may overlap, it waits for at
+// most the budget, so that the cleanup cannot be delayed indefinitely.
+func (g *ScrapeGate) WaitForScrapes() {
+	if g == nil {
+		return
+	}
+
+	limit := time.Now().Add(g.budget)
+	for g.active.Load() > 0 {
+		deadline := time.Unix(0, g.until.Load())
+		if limit.Before(deadline) {
+			deadline = limit
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return
+		}
+
+		if remaining > scrapeGatePollInterval {
+			remaining = scrapeGatePollInterval
+		}
+
+		time.Sleep(remaining)
+	}
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func waitsForScrapes(g *ScrapeGate, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		g.WaitForScrapes()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return false
+	case <-time.After(timeout):
+		<-done
+		return true
+	}
+}
+
+func TestScrapeGatePausesCleanupUntilScrapeIsDone(t *testing.T) {
+	g := NewScrapeGate(time.Minute)
+
+	end := g.BeginScrape()
+	time.AfterFunc(100*time.Millisecond, end)
+
+	assert.True(t, waitsForScrapes(g, 50*time.Millisecond))
+	assert.False(t, waitsForScrapes(g, 50*time.Millisecond))
+}
+
+func TestScrapeGateReleasesAfterBudget(t *testing.T) {
+	g := NewScrapeGate(50 * time.Millisecond)
+	g.BeginScrape()
+
+	start := time.Now()
+	g.WaitForScrapes()
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+}
+
+func TestScrapeGateDoesNotBlockScrapesWhileCleanupWaits(t *testing.T) {
+	g := NewScrapeGate(time.Minute)
+
+	end := g.BeginScrape()
+	go g.WaitForScrapes()
+	time.Sleep(20 * time.Millisecond)
+
+	begun := make(chan struct{})
+	go func() {
+		g.BeginScrape()()
+		close(begun)
+	}()
+
+	select {
+	case <-begun:
+	case <-time.After(time.Second):
+		t.Fatal("scrape was blocked by the waiting cleanup")
+	}
+
+	end()
+}
+
+func TestNilScrapeGateDoesNotPause(t *testing.T) {
+	var g *ScrapeGate
+	g.BeginScrape()()
+	assert.False(t, waitsForScrapes(g, 50*time.Millisecond))
+}
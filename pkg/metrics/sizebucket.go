@@ -0,0 +1,45 @@
+package metrics
+
+import "strconv"
+
+// sizeBucketNames are the human-readable names of the default response size
+// buckets (see config.DefaultResponseSizeBucketBytes)
+var sizeBucketNames = []string{"tiny", "small", "medium", "large", "huge"}
+
+// SizeBuckets classifies response sizes into named categories
+type SizeBuckets struct {
+	bounds []int64
+	names  []string
+}
+
+// NewSizeBuckets creates a new SizeBuckets from a list of ascending upper
+// bounds (in bytes). With four bounds, the categories are named "tiny",
+// "small", "medium", "large" and "huge"; otherwise, they are named after
+// their upper bounds ("lt_<bytes>", and "ge_<bytes>" for the last one).
+func NewSizeBuckets(bounds []int64) *SizeBuckets {
+	names := sizeBucketNames
+	if len(bounds) != len(sizeBucketNames)-1 {
+		names = make([]string, 0, len(bounds)+1)
+		for _, b := range bounds {
+			names = append(names, "lt_"+strconv.FormatInt(b, 10))
+		}
+		if len(bounds) > 0 {
+			names = append(names, "ge_"+strconv.FormatInt(bounds[len(bounds)-1], 10))
+		} else {
+			names = append(names, "all")
+		}
+	}
+
+	return &SizeBuckets{bounds: bounds, names: names}
+}
+
+// Name returns the name of the category that a response size falls into
+func (b *SizeBuckets) Name(size float64) string {
+	for i, bound := range b.bounds {
+		if size < float64(bound) {
+			return b.names[i]
+		}
+	}
+
+	return b.names[len(b.names)-1]
+}
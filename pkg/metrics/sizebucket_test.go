@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSizeBucketsUseHumanReadableNames(t *testing.T) {
+	t.Parallel()
+
+	b := NewSizeBuckets([]int64{1024, 10240, 102400, 1048576})
+
+	assert.Equal(t, "tiny", b.Name(0))
+	assert.Equal(t, "tiny", b.Name(1023))
+	assert.Equal(t, "small", b.Name(1024))
+	assert.Equal(t, "medium", b.Name(50000))
+	assert.Equal(t, "large", b.Name(102400))
+	assert.Equal(t, "huge", b.Name(1048576))
+}
+
+func TestSizeBucketsNameCustomBoundsAfterBounds(t *testing.T) {
+	t.Parallel()
+
+	b := NewSizeBuckets([]int64{100, 1000})
+
+	assert.Equal(t, "lt_100", b.Name(99))
+	assert.Equal(t, "lt_1000", b.Name(100))
+	assert.Equal(t, "ge_1000", b.Name(1000))
+}
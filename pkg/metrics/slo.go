@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// sloComplianceCollector updates an SLO compliance gauge from the buckets of
+// a histogram whenever it is collected, so that the compliance is always
+// consistent with the histogram that is exposed in the same scrape
+type sloComplianceCollector struct {
+	hist       prometheus.Collector
+	gauge      *prometheus.GaugeVec
+	labelNames []string
+	thresholds []float64
+}
+
+// Describe implements the prometheus.Collector interface
+func (c *sloComplianceCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.gauge.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface
+func (c *sloComplianceCollector) Collect(ch chan<- prometheus.Metric) {
+	if len(c.thresholds) > 0 {
+		c.update()
+	}
+
+	c.gauge.Collect(ch)
+}
+
+func (c *sloComplianceCollector) update() {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		c.hist.Collect(metrics)
+		close(metrics)
+	}()
+
+	for m := range metrics {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil || pb.Histogram.GetSampleCount() == 0 {
+			continue
+		}
+
+		labels := make(map[string]string, len(pb.Label))
+		for _, l := range pb.Label {
+			labels[l.GetName()] = l.GetValue()
+		}
+
+		labelValues := make([]string, len(c.labelNames), len(c.labelNames)+1)
+		for i, name := range c.labelNames {
+			labelValues[i] = labels[name]
+		}
+
+		count := float64(pb.Histogram.GetSampleCount())
+
+		for _, threshold := range c.thresholds {
+			for _, b := range pb.Histogram.Bucket {
+				if b.GetUpperBound() == threshold {
+					values := append(labelValues, strconv.FormatFloat(threshold, 'f', -1, 64))
+					c.gauge.WithLabelValues(values...).Set(float64(b.GetCumulativeCount()) / count)
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSLOComplianceIsComputedFromHistogramBuckets(t *testing.T) {
+	t.Parallel()
+
+	hist := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "upstream_time_seconds_hist",
+		Buckets: []float64{0.1, 0.5, 1},
+	}, []string{"method"})
+
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "upstream_time_slo_compliance_ratio",
+	}, []string{"method", "threshold"})
+
+	c := &sloComplianceCollector{
+		hist:       hist,
+		gauge:      gauge,
+		labelNames: []string{"method"},
+		thresholds: []float64{0.5},
+	}
+
+	hist.WithLabelValues("GET").Observe(0.05)
+	hist.WithLabelValues("GET").Observe(0.2)
+	hist.WithLabelValues("GET").Observe(0.3)
+	hist.WithLabelValues("GET").Observe(0.9)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+
+	_, err := reg.Gather()
+	assert.NoError(t, err)
+	assert.Equal(t, 0.75, testutil.ToFloat64(gauge.WithLabelValues("GET", "0.5")))
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Snapshot returns the current values of all metrics of the collection,
+// keyed by their fully qualified name including all labels (like
+// `nginx_http_response_count_total{method="GET",status="200"}`). Summaries
+// and histograms are represented by their "_sum" and "_count" series (and
+// histograms additionally by their "_bucket" series).
+func (c *Collection) Snapshot() (map[string]float64, error) {
+	registry := prometheus.NewRegistry()
+	if err := c.Register(registry); err != nil {
+		return nil, err
+	}
+
+	mfs, err := registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := make(map[string]float64)
+
+	for _, mf := range mfs {
+		name := mf.GetName()
+
+		for _, m := range mf.Metric {
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				snapshot[snapshotKey(name, m.Label)] = m.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				snapshot[snapshotKey(name, m.Label)] = m.GetGauge().GetValue()
+			case dto.MetricType_UNTYPED:
+				snapshot[snapshotKey(name, m.Label)] = m.GetUntyped().GetValue()
+			case dto.MetricType_SUMMARY:
+				snapshot[snapshotKey(name+"_sum", m.Label)] = m.GetSummary().GetSampleSum()
+				snapshot[snapshotKey(name+"_count", m.Label)] = float64(m.GetSummary().GetSampleCount())
+			case dto.MetricType_HISTOGRAM:
+				snapshot[snapshotKey(name+"_sum", m.Label)] = m.GetHistogram().GetSampleSum()
+				snapshot[snapshotKey(name+"_count", m.Label)] = float64(m.GetHistogram().GetSampleCount())
+
+				for _, b := range m.GetHistogram().Bucket {
+					le := strconv.FormatFloat(b.GetUpperBound(), 'g', -1, 64)
+					snapshot[snapshotKey(name+"_bucket", m.Label, "le", le)] = float64(b.GetCumulativeCount())
+				}
+			}
+		}
+	}
+
+	return snapshot, nil
+}
+
+func snapshotKey(name string, labels []*dto.LabelPair, extra ...string) string {
+	pairs := make([]string, 0, len(labels)+len(extra)/2)
+	for _, l := range labels {
+		pairs = append(pairs, l.GetName()+"="+strconv.Quote(l.GetValue()))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"="+strconv.Quote(extra[i+1]))
+	}
+
+	if len(pairs) == 0 {
+		return name
+	}
+
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotContainsMetricValues(t *testing.T) {
+	t.Parallel()
+
+	m, err := NewForNamespace(&config.NamespaceConfig{
+		Name:             "snapshot",
+		HistogramBuckets: []float64{0.1, 1},
+	})
+	require.NoError(t, err)
+
+	m.CountTotal.WithLabelValues("GET", "200").Add(3)
+	m.ResponseSecondsHist.WithLabelValues("GET", "200").Observe(0.5)
+	m.ParseErrorsTotal.Inc()
+
+	snapshot, err := m.Snapshot()
+	require.NoError(t, err)
+
+	assert.Equal(t, float64(3), snapshot[`snapshot_http_response_count_total{method="GET",status="200"}`])
+	assert.Equal(t, float64(1), snapshot[`snapshot_parse_errors_total`])
+	assert.Equal(t, float64(1), snapshot[`snapshot_http_response_time_seconds_hist_count{method="GET",status="200"}`])
+	assert.Equal(t, float64(0), snapshot[`snapshot_http_response_time_seconds_hist_bucket{le="0.1",method="GET",status="200"}`])
+	assert.Equal(t, float64(1), snapshot[`snapshot_http_response_time_seconds_hist_bucket{le="1",method="GET",status="200"}`])
+}
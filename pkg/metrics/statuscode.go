@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// knownStatusCodes are the HTTP status codes that get their own counter when
+// per-status-code counters are enabled
+var knownStatusCodes = []string{
+	"200", "201", "202", "204", "206",
+	"301", "302", "303", "304", "307", "308",
+	"400", "401", "403", "404", "405", "408", "409", "410", "413", "429", "499",
+	"500", "501", "502", "503", "504",
+}
+
+// StatusCodeCounters counts responses with a separate counter per HTTP status
+// code
+type StatusCodeCounters struct {
+	counters map[string]prometheus.Counter
+	other    prometheus.Counter
+}
+
+// NewStatusCodeCounters creates the counters for all known status codes
+func NewStatusCodeCounters(cfg *config.NamespaceConfig) *StatusCodeCounters {
+	newCounter := func(name string) prometheus.Counter {
+		return prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        name + "_total",
+			Help:        cfg.MetricHelpFor(name+"_total", "Amount of processed HTTP requests with status code "+name),
+		})
+	}
+
+	c := &StatusCodeCounters{
+		counters: make(map[string]prometheus.Counter, len(knownStatusCodes)),
+		other:    newCounter("other"),
+	}
+
+	for _, code := range knownStatusCodes {
+		c.counters[code] = newCounter(code)
+	}
+
+	return c
+}
+
+// Inc increments the counter of a status code; unknown status codes are
+// counted by a shared "other" counter
+func (c *StatusCodeCounters) Inc(status string) {
+	c.Add(status, 1)
+}
+
+// Add adds v to the counter of a status code, like Inc
+func (c *StatusCodeCounters) Add(status string, v float64) {
+	if counter, ok := c.counters[status]; ok {
+		counter.Add(v)
+		return
+	}
+
+	c.other.Add(v)
+}
+
+// Describe implements the prometheus.Collector interface
+func (c *StatusCodeCounters) Describe(ch chan<- *prometheus.Desc) {
+	for _, code := range knownStatusCodes {
+		c.counters[code].Describe(ch)
+	}
+	c.other.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface
+func (c *StatusCodeCounters) Collect(ch chan<- prometheus.Metric) {
+	for _, code := range knownStatusCodes {
+		c.counters[code].Collect(ch)
+	}
+	c.other.Collect(ch)
+}
@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusCodeCountersCountKnownAndOtherCodes(t *testing.T) {
+	t.Parallel()
+
+	c := NewStatusCodeCounters(&config.NamespaceConfig{NamespacePrefix: "nginx"})
+
+	c.Inc("200")
+	c.Inc("200")
+	c.Inc("404")
+	c.Inc("418")
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(c.counters["200"]))
+	assert.Equal(t, float64(1), testutil.ToFloat64(c.counters["404"]))
+	assert.Equal(t, float64(1), testutil.ToFloat64(c.other))
+	assert.Equal(t, len(knownStatusCodes)+1, testutil.CollectAndCount(c))
+}
+
+func TestStatusCodeCountersAddScaledValues(t *testing.T) {
+	t.Parallel()
+
+	c := NewStatusCodeCounters(&config.NamespaceConfig{NamespacePrefix: "nginx"})
+
+	c.Add("200", 10)
+	c.Add("418", 2.5)
+
+	assert.Equal(t, float64(10), testutil.ToFloat64(c.counters["200"]))
+	assert.Equal(t, 2.5, testutil.ToFloat64(c.other))
+}
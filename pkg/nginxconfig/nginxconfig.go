@@ -0,0 +1,209 @@
+// Package nginxconfig extracts log_format definitions from NGINX configuration
+// files, so that they do not have to be copied into the exporter configuration.
+package nginxconfig
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CombinedFormat is the "combined" log format that is predefined by NGINX
+const CombinedFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`
+
+// LogFormats reads an NGINX configuration file (including all files that it
+// includes) and returns the log formats defined in it, keyed by their names.
+// Since the log_format directive has a predictable structure, the files are
+// not fully parsed; instead, they are scanned for log_format and include
+// directives regardless of the block ("http" or "stream") they appear in.
+func LogFormats(filename string) (map[string]string, error) {
+	formats := map[string]string{
+		"combined": CombinedFormat,
+	}
+
+	if err := readFile(filename, filepath.Dir(filename), formats, make(map[string]struct{})); err != nil {
+		return nil, err
+	}
+
+	return formats, nil
+}
+
+func readFile(filename string, prefix string, formats map[string]string, seen map[string]struct{}) error {
+	if _, ok := seen[filename]; ok {
+		return fmt.Errorf("include loop detected at '%s'", filename)
+	}
+	seen[filename] = struct{}{}
+	defer delete(seen, filename)
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	statement := ""
+
+	for scanner.Scan() {
+		line := stripComment(scanner.Text())
+
+		for line != "" {
+			// log_format and include are simple directives, which end with a
+			// semicolon; everything in between can span multiple lines
+			end := statementEnd(line)
+			if end < 0 {
+				statement += line + " "
+				break
+			}
+
+			statement += line[:end]
+			line = strings.TrimSpace(line[end+1:])
+
+			if err := handleStatement(statement, prefix, formats, seen); err != nil {
+				return fmt.Errorf("%s: %s", filename, err.Error())
+			}
+			statement = ""
+		}
+	}
+
+	return scanner.Err()
+}
+
+func handleStatement(statement string, prefix string, formats map[string]string, seen map[string]struct{}) error {
+	tokens, err := tokenize(statement)
+	if err != nil {
+		return err
+	}
+
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	switch tokens[0] {
+	case "log_format":
+		args := tokens[1:]
+		if len(args) < 2 {
+			return fmt.Errorf("log_format directive needs a name and a format")
+		}
+
+		name := args[0]
+		args = args[1:]
+		if strings.HasPrefix(args[0], "escape=") {
+			args = args[1:]
+		}
+
+		formats[name] = strings.Join(args, "")
+	case "include":
+		if len(tokens) != 2 {
+			return fmt.Errorf("include directive needs exactly one argument")
+		}
+
+		pattern := tokens[1]
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(prefix, pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range matches {
+			if err := readFile(m, prefix, formats, seen); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// stripComment removes a trailing comment (starting with an unquoted "#")
+// from a line
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '\'' || r == '"'):
+			quote = r
+		case quote == 0 && r == '#':
+			return strings.TrimSpace(line[:i])
+		}
+	}
+
+	return strings.TrimSpace(line)
+}
+
+// statementEnd returns the position of the first unquoted semicolon in a line,
+// or -1 if there is none
+func statementEnd(line string) int {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '\'' || r == '"'):
+			quote = r
+		case quote == 0 && r == ';':
+			return i
+		}
+	}
+
+	return -1
+}
+
+// tokenize splits a directive into its tokens, removing the quotes around
+// quoted strings. Block openings and closings (like "http {" or "}") that
+// precede the directive are skipped.
+func tokenize(statement string) ([]string, error) {
+	tokens := make([]string, 0)
+	current := strings.Builder{}
+	inToken := false
+
+	var quote rune
+	escaped := false
+
+	for _, r := range statement {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case quote != 0 && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inToken = true
+		case r == '{' || r == '}':
+			tokens = tokens[:0]
+			current.Reset()
+			inToken = false
+		case r == ' ' || r == '\t':
+			if inToken {
+				tokens = append(tokens, current.String())
+				current.Reset()
+				inToken = false
+			}
+		default:
+			current.WriteRune(r)
+			inToken = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quoted string in '%s'", statement)
+	}
+
+	if inToken {
+		tokens = append(tokens, current.String())
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,78 @@
+package nginxconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const mainConfig = `
+user nginx;
+
+http {
+    # log_format commented '$remote_addr';
+    log_format main '$remote_addr - $remote_user [$time_local] "$request" '
+                    '$status $body_bytes_sent "$http_referer" '
+                    '"$http_user_agent" "$http_x_forwarded_for"';
+
+    log_format timing escape=json 'rt=$request_time; urt="$upstream_response_time"';
+
+    include conf.d/*.conf;
+
+    server {
+        listen 80;
+        access_log /var/log/nginx/access.log main;
+    }
+}
+
+stream {
+    log_format proxy '$remote_addr [$time_local] $protocol $status $bytes_sent $bytes_received $session_time';
+}
+`
+
+const includedConfig = `
+log_format upstream "$remote_addr \"$request\" $upstream_addr";
+`
+
+func writeConfig(t *testing.T) string {
+	dir := t.TempDir()
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "conf.d"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nginx.conf"), []byte(mainConfig), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "conf.d", "upstream.conf"), []byte(includedConfig), 0o644))
+
+	return filepath.Join(dir, "nginx.conf")
+}
+
+func TestLogFormatsAreExtracted(t *testing.T) {
+	t.Parallel()
+
+	formats, err := LogFormats(writeConfig(t))
+	require.NoError(t, err)
+
+	assert.Equal(t, `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_x_forwarded_for"`, formats["main"])
+	assert.Equal(t, `rt=$request_time; urt="$upstream_response_time"`, formats["timing"])
+	assert.Equal(t, `$remote_addr [$time_local] $protocol $status $bytes_sent $bytes_received $session_time`, formats["proxy"])
+	assert.NotContains(t, formats, "commented")
+}
+
+func TestLogFormatsFollowIncludes(t *testing.T) {
+	t.Parallel()
+
+	formats, err := LogFormats(writeConfig(t))
+	require.NoError(t, err)
+
+	assert.Equal(t, `$remote_addr "$request" $upstream_addr`, formats["upstream"])
+}
+
+func TestCombinedFormatIsPredefined(t *testing.T) {
+	t.Parallel()
+
+	formats, err := LogFormats(writeConfig(t))
+	require.NoError(t, err)
+
+	assert.Equal(t, CombinedFormat, formats["combined"])
+}
@@ -0,0 +1,107 @@
+package apacheparser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// combinedFields are the NGINX variable names of the fields of the Apache
+// Combined Log Format (%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i"),
+// in order. The identity (%l) has no NGINX counterpart and is dropped.
+var combinedFields = []string{
+	"remote_addr",
+	"",
+	"remote_user",
+	"time_local",
+	"request",
+	"status",
+	"body_bytes_sent",
+	"http_referer",
+	"http_user_agent",
+}
+
+// ApacheParser parses log lines in the Apache Combined Log Format.
+type ApacheParser struct{}
+
+// NewApacheParser returns a new Apache parser.
+func NewApacheParser() *ApacheParser {
+	return &ApacheParser{}
+}
+
+// ParseString implements the Parser interface.
+// The fields are mapped to the NGINX variable names that are used throughout
+// the rest of the exporter. Additional fields after the user agent are
+// ignored.
+func (a *ApacheParser) ParseString(line string) (map[string]string, error) {
+	fields := make(map[string]string, len(combinedFields))
+	rest := line
+
+	for _, name := range combinedFields {
+		value, r, err := nextField(rest)
+		if err != nil {
+			return nil, fmt.Errorf("apache log parsing err: %w", err)
+		}
+		rest = r
+
+		if name != "" {
+			fields[name] = value
+		}
+	}
+
+	// Apache logs "-" instead of 0 if no body was sent
+	if fields["body_bytes_sent"] == "-" {
+		fields["body_bytes_sent"] = "0"
+	}
+
+	return fields, nil
+}
+
+// nextField reads a single (bare, [bracketed] or "quoted") field from the
+// beginning of line and returns it together with the remainder of the line
+func nextField(line string) (string, string, error) {
+	line = strings.TrimLeft(line, " ")
+	if line == "" {
+		return "", "", fmt.Errorf("line ended unexpectedly")
+	}
+
+	switch line[0] {
+	case '"':
+		return quotedField(line[1:])
+	case '[':
+		end := strings.IndexByte(line, ']')
+		if end < 0 {
+			return "", "", fmt.Errorf("missing closing bracket")
+		}
+		return line[1:end], line[end+1:], nil
+	default:
+		end := strings.IndexByte(line, ' ')
+		if end < 0 {
+			return line, "", nil
+		}
+		return line[:end], line[end:], nil
+	}
+}
+
+// quotedField reads a quoted field whose opening quote was already consumed.
+// Quotes and backslashes inside the field are escaped with a backslash.
+func quotedField(line string) (string, string, error) {
+	var value strings.Builder
+
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; c {
+		case '"':
+			return value.String(), line[i+1:], nil
+		case '\\':
+			if i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\\') {
+				i++
+				value.WriteByte(line[i])
+			} else {
+				value.WriteByte(c)
+			}
+		default:
+			value.WriteByte(c)
+		}
+	}
+
+	return "", "", fmt.Errorf("missing closing quote")
+}
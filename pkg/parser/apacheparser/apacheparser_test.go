@@ -0,0 +1,74 @@
+package apacheparser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApacheParse(t *testing.T) {
+	parser := NewApacheParser()
+	line := `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`
+
+	got, err := parser.ParseString(line)
+	require.NoError(t, err)
+
+	want := map[string]string{
+		"remote_addr":     "127.0.0.1",
+		"remote_user":     "frank",
+		"time_local":      "10/Oct/2000:13:55:36 -0700",
+		"request":         "GET /apache_pb.gif HTTP/1.0",
+		"status":          "200",
+		"body_bytes_sent": "2326",
+		"http_referer":    "http://www.example.com/start.html",
+		"http_user_agent": "Mozilla/4.08 [en] (Win98; I ;Nav)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ApacheParser.Parse() = %v, want %v", got, want)
+	}
+}
+
+func TestApacheParseEscapedQuotes(t *testing.T) {
+	parser := NewApacheParser()
+	line := `10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /search?q=\"foo\" HTTP/1.1" 404 - "-" "agent \"with\" quotes\\"`
+
+	got, err := parser.ParseString(line)
+	require.NoError(t, err)
+
+	require.Equal(t, `GET /search?q="foo" HTTP/1.1`, got["request"])
+	require.Equal(t, `agent "with" quotes\`, got["http_user_agent"])
+	require.Equal(t, "0", got["body_bytes_sent"])
+	require.Equal(t, "404", got["status"])
+}
+
+func TestApacheParseIgnoresAdditionalFields(t *testing.T) {
+	parser := NewApacheParser()
+	line := `10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.1" 200 12 "-" "curl/7.68.0" 0.123 "extra"`
+
+	got, err := parser.ParseString(line)
+	require.NoError(t, err)
+	require.Equal(t, "curl/7.68.0", got["http_user_agent"])
+}
+
+func TestApacheParseRejectsIncompleteLines(t *testing.T) {
+	parser := NewApacheParser()
+
+	for _, line := range []string{
+		`10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.1" 200`,
+		`10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.1 200 12 "-" "curl`,
+		`10.0.0.1 - - [10/Oct/2000:13:55:36 -0700 "GET / HTTP/1.1" 200 12 "-" "curl"`,
+	} {
+		_, err := parser.ParseString(line)
+		require.Error(t, err, line)
+	}
+}
+
+func BenchmarkParseApache(b *testing.B) {
+	parser := NewApacheParser()
+	line := `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`
+
+	for i := 0; i < b.N; i++ {
+		_, _ = parser.ParseString(line)
+	}
+}
@@ -0,0 +1,116 @@
+package cloudrunparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// CloudRunParser parses the structured JSON logs written by Google Cloud Run.
+type CloudRunParser struct{}
+
+type cloudRunEntry struct {
+	HTTPRequest *cloudRunHTTPRequest `json:"httpRequest"`
+}
+
+type cloudRunHTTPRequest struct {
+	RequestMethod string      `json:"requestMethod"`
+	RequestURL    string      `json:"requestUrl"`
+	RequestSize   json.Number `json:"requestSize"`
+	Status        json.Number `json:"status"`
+	ResponseSize  json.Number `json:"responseSize"`
+	UserAgent     string      `json:"userAgent"`
+	RemoteIP      string      `json:"remoteIp"`
+	ServerIP      string      `json:"serverIp"`
+	Referer       string      `json:"referer"`
+	Latency       string      `json:"latency"`
+	Protocol      string      `json:"protocol"`
+}
+
+// NewCloudRunParser returns a new Cloud Run parser.
+func NewCloudRunParser() *CloudRunParser {
+	return &CloudRunParser{}
+}
+
+// ParseString implements the Parser interface.
+// The Cloud Run field names are mapped to the NGINX variable names that are
+// used throughout the rest of the exporter.
+func (c *CloudRunParser) ParseString(line string) (map[string]string, error) {
+	var entry cloudRunEntry
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		return nil, fmt.Errorf("cloud run log parsing err: %w", err)
+	}
+
+	r := entry.HTTPRequest
+	if r == nil {
+		return nil, fmt.Errorf("cloud run log parsing err: no httpRequest in log entry")
+	}
+
+	fields := make(map[string]string, 12)
+	setIfPresent(fields, "request_method", r.RequestMethod)
+	setIfPresent(fields, "status", r.Status.String())
+	setIfPresent(fields, "body_bytes_sent", r.ResponseSize.String())
+	setIfPresent(fields, "request_length", r.RequestSize.String())
+	setIfPresent(fields, "http_user_agent", r.UserAgent)
+	setIfPresent(fields, "http_referer", r.Referer)
+	setIfPresent(fields, "remote_addr", r.RemoteIP)
+	setIfPresent(fields, "server_addr", r.ServerIP)
+	setIfPresent(fields, "server_protocol", r.Protocol)
+
+	if r.RequestURL != "" {
+		requestURI := r.RequestURL
+		if u, err := url.Parse(r.RequestURL); err == nil {
+			requestURI = u.RequestURI()
+		}
+
+		fields["request_uri"] = requestURI
+		fields["request"] = strings.TrimSpace(strings.Join([]string{r.RequestMethod, requestURI, r.Protocol}, " "))
+	}
+
+	if r.Latency != "" {
+		latency, err := parseLatency(r.Latency)
+		if err != nil {
+			return nil, fmt.Errorf("cloud run log parsing err: %w", err)
+		}
+
+		fields["request_time"] = strconv.FormatFloat(latency, 'f', -1, 64)
+	}
+
+	return fields, nil
+}
+
+func setIfPresent(fields map[string]string, name, value string) {
+	if value != "" {
+		fields[name] = value
+	}
+}
+
+// parseLatency converts a latency string with unit (like "0.123s", "12ms"
+// or "250µs") into seconds
+func parseLatency(latency string) (float64, error) {
+	units := []struct {
+		suffix string
+		factor float64
+	}{
+		{"ms", 1e-3},
+		{"µs", 1e-6},
+		{"us", 1e-6},
+		{"ns", 1e-9},
+		{"s", 1},
+	}
+
+	for _, u := range units {
+		if strings.HasSuffix(latency, u.suffix) {
+			f, err := strconv.ParseFloat(strings.TrimSuffix(latency, u.suffix), 64)
+			if err != nil {
+				return 0, fmt.Errorf("latency '%s' could not be parsed into float", latency)
+			}
+
+			return f * u.factor, nil
+		}
+	}
+
+	return 0, fmt.Errorf("latency '%s' has unsupported unit", latency)
+}
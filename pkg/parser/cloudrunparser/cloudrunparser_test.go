@@ -0,0 +1,69 @@
+package cloudrunparser
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloudRunParse(t *testing.T) {
+	parser := NewCloudRunParser()
+	line := `{"httpRequest":{"requestMethod":"GET","requestUrl":"https://service-abc.a.run.app/order/2145?foo=bar","requestSize":"123","status":200,"responseSize":"518","userAgent":"curl/7.68.0","remoteIp":"10.0.0.1","referer":"https://example.com/","latency":"0.544s","protocol":"HTTP/1.1"},"severity":"INFO","timestamp":"2021-02-03T03:22:33.123Z"}`
+
+	got, err := parser.ParseString(line)
+	require.NoError(t, err)
+
+	want := map[string]string{
+		"request_method":  "GET",
+		"request_uri":     "/order/2145?foo=bar",
+		"request":         "GET /order/2145?foo=bar HTTP/1.1",
+		"request_length":  "123",
+		"status":          "200",
+		"body_bytes_sent": "518",
+		"http_user_agent": "curl/7.68.0",
+		"http_referer":    "https://example.com/",
+		"remote_addr":     "10.0.0.1",
+		"server_protocol": "HTTP/1.1",
+		"request_time":    "0.544",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CloudRunParser.Parse() = %v, want %v", got, want)
+	}
+}
+
+func TestCloudRunParseLatencyUnits(t *testing.T) {
+	parser := NewCloudRunParser()
+
+	for latency, expected := range map[string]string{
+		"1.5s":  "1.5",
+		"250ms": "0.25",
+		"500µs": "0.0005",
+		"500us": "0.0005",
+	} {
+		got, err := parser.ParseString(fmt.Sprintf(`{"httpRequest":{"latency":"%s"}}`, latency))
+		require.NoError(t, err)
+		require.Equal(t, expected, got["request_time"], "latency %s", latency)
+	}
+}
+
+func TestCloudRunParseRequiresHTTPRequest(t *testing.T) {
+	parser := NewCloudRunParser()
+
+	_, err := parser.ParseString(`{"severity":"INFO","textPayload":"container started"}`)
+	require.Error(t, err)
+}
+
+func BenchmarkParseCloudRun(b *testing.B) {
+	parser := NewCloudRunParser()
+	line := `{"httpRequest":{"requestMethod":"GET","requestUrl":"https://service-abc.a.run.app/order/2145","requestSize":"123","status":200,"responseSize":"518","userAgent":"curl/7.68.0","remoteIp":"10.0.0.1","latency":"0.544s","protocol":"HTTP/1.1"}}`
+
+	for i := 0; i < b.N; i++ {
+		res, err := parser.ParseString(line)
+		if err != nil {
+			b.Error(err)
+		}
+		_ = fmt.Sprintf("%v", res)
+	}
+}
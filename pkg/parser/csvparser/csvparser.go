@@ -0,0 +1,42 @@
+package csvparser
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strings"
+)
+
+// CSVParser parses log lines that contain delimiter-separated values (CSV or
+// TSV), quoted according to RFC 4180.
+type CSVParser struct {
+	header    []string
+	delimiter rune
+}
+
+// NewCSVParser returns a new CSV parser that uses the given header as field
+// names for the columns.
+func NewCSVParser(header []string, delimiter rune) *CSVParser {
+	return &CSVParser{
+		header:    header,
+		delimiter: delimiter,
+	}
+}
+
+// ParseString implements the Parser interface.
+func (c *CSVParser) ParseString(line string) (map[string]string, error) {
+	reader := csv.NewReader(strings.NewReader(line))
+	reader.Comma = c.delimiter
+	reader.FieldsPerRecord = len(c.header)
+
+	record, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("csv log parsing err: %w", err)
+	}
+
+	fields := make(map[string]string, len(c.header))
+	for i, name := range c.header {
+		fields[name] = record[i]
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,37 @@
+package csvparser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVParse(t *testing.T) {
+	parser := NewCSVParser([]string{"remote_addr", "request", "status", "http_user_agent"}, ',')
+
+	got, err := parser.ParseString(`10.0.0.1,GET /order/2145 HTTP/1.1,200,"Mozilla/5.0 (X11, ""Linux"")"`)
+	require.NoError(t, err)
+
+	want := map[string]string{
+		"remote_addr":     "10.0.0.1",
+		"request":         "GET /order/2145 HTTP/1.1",
+		"status":          "200",
+		"http_user_agent": `Mozilla/5.0 (X11, "Linux")`,
+	}
+	require.Equal(t, want, got)
+}
+
+func TestTSVParse(t *testing.T) {
+	parser := NewCSVParser([]string{"status", "request_time"}, '\t')
+
+	got, err := parser.ParseString("200\t0.544")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"status": "200", "request_time": "0.544"}, got)
+}
+
+func TestCSVParseRejectsWrongNumberOfColumns(t *testing.T) {
+	parser := NewCSVParser([]string{"status", "request_time"}, ',')
+
+	_, err := parser.ParseString("200,0.544,extra")
+	require.Error(t, err)
+}
@@ -6,13 +6,22 @@ import (
 )
 
 // JsonParser parse a JSON string.
-type JsonParser struct{}
+type JsonParser struct {
+	fieldMap map[string]string
+}
 
 // NewJsonParser returns a new json parser.
 func NewJsonParser() *JsonParser {
 	return &JsonParser{}
 }
 
+// NewJsonParserWithFieldMap returns a new json parser that renames the JSON
+// keys to canonical field names. The keys of fieldMap are the canonical
+// names, the values the keys used in the JSON log lines.
+func NewJsonParserWithFieldMap(fieldMap map[string]string) *JsonParser {
+	return &JsonParser{fieldMap: fieldMap}
+}
+
 // ParseString implements the Parser interface.
 // The value in the map is not necessarily a string, so it needs to be converted.
 func (j *JsonParser) ParseString(line string) (map[string]string, error) {
@@ -30,5 +39,31 @@ func (j *JsonParser) ParseString(line string) (map[string]string, error) {
 			fields[k] = fmt.Sprintf("%v", v)
 		}
 	}
+
+	if len(j.fieldMap) > 0 {
+		fields = j.mapFields(fields)
+	}
+
 	return fields, nil
 }
+
+func (j *JsonParser) mapFields(fields map[string]string) map[string]string {
+	mapped := make(map[string]string, len(fields))
+	for k, v := range fields {
+		mapped[k] = v
+	}
+
+	// the JSON keys are removed before the canonical names are set, so that a
+	// key that happens to be a canonical name of another field is not lost
+	for _, key := range j.fieldMap {
+		delete(mapped, key)
+	}
+
+	for canonical, key := range j.fieldMap {
+		if v, ok := fields[key]; ok {
+			mapped[canonical] = v
+		}
+	}
+
+	return mapped
+}
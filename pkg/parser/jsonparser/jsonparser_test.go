@@ -30,6 +30,35 @@ func TestJsonParse(t *testing.T) {
 	}
 }
 
+func TestJsonParseWithFieldMap(t *testing.T) {
+	parser := NewJsonParserWithFieldMap(map[string]string{
+		"request_time": "responseTime",
+		"status":       "statusCode",
+	})
+	line := `{"request_method":"GET","statusCode":200,"responseTime":0.544}`
+
+	got, err := parser.ParseString(line)
+	require.NoError(t, err)
+
+	want := map[string]string{
+		"request_method": "GET",
+		"status":         "200",
+		"request_time":   "0.544",
+	}
+	require.Equal(t, want, got)
+}
+
+func TestJsonParseWithSwappedFieldMap(t *testing.T) {
+	parser := NewJsonParserWithFieldMap(map[string]string{
+		"status":       "request_time",
+		"request_time": "status",
+	})
+
+	got, err := parser.ParseString(`{"status":0.1,"request_time":200}`)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"status": "200", "request_time": "0.1"}, got)
+}
+
 func BenchmarkParseJson(b *testing.B) {
 	parser := NewJsonParser()
 	line := `{"time_local":"2021-02-03T11:22:33+08:00","request_length":123,"request_method":"GET","request":"GET /order/2145 HTTP/1.1","body_bytes_sent":518,"status": 200,"request_time":0.544,"upstream_response_time":"0.543"}`
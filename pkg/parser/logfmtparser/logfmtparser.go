@@ -0,0 +1,34 @@
+package logfmtparser
+
+import (
+	"fmt"
+
+	"github.com/kr/logfmt"
+)
+
+// LogfmtParser parses log lines in the logfmt format (key=value key2="value 2").
+type LogfmtParser struct{}
+
+// NewLogfmtParser returns a new logfmt parser.
+func NewLogfmtParser() *LogfmtParser {
+	return &LogfmtParser{}
+}
+
+// ParseString implements the Parser interface.
+func (l *LogfmtParser) ParseString(line string) (map[string]string, error) {
+	fields := make(map[string]string)
+	handler := logfmt.HandlerFunc(func(key, val []byte) error {
+		fields[string(key)] = string(val)
+		return nil
+	})
+
+	if err := logfmt.Unmarshal([]byte(line), handler); err != nil {
+		return nil, fmt.Errorf("logfmt log parsing err: %w", err)
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("logfmt log parsing err: no fields in log line")
+	}
+
+	return fields, nil
+}
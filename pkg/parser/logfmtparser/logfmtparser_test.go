@@ -0,0 +1,30 @@
+package logfmtparser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogfmtParse(t *testing.T) {
+	parser := NewLogfmtParser()
+	line := `remote_addr=10.0.0.1 request="GET /order/2145 HTTP/1.1" status=200 body_bytes_sent=518 request_time=0.544 http_referer=`
+
+	got, err := parser.ParseString(line)
+	require.NoError(t, err)
+
+	want := map[string]string{
+		"remote_addr":     "10.0.0.1",
+		"request":         "GET /order/2145 HTTP/1.1",
+		"status":          "200",
+		"body_bytes_sent": "518",
+		"request_time":    "0.544",
+		"http_referer":    "",
+	}
+	require.Equal(t, want, got)
+}
+
+func TestLogfmtParseRejectsEmptyLine(t *testing.T) {
+	_, err := NewLogfmtParser().ParseString("")
+	require.Error(t, err)
+}
@@ -1,8 +1,16 @@
 package parser
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/parser/apacheparser"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/parser/cloudrunparser"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/parser/csvparser"
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/parser/jsonparser"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/parser/logfmtparser"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/parser/regexparser"
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/parser/textparser"
 )
 
@@ -11,14 +19,78 @@ type Parser interface {
 	ParseString(line string) (map[string]string, error)
 }
 
+// DecomposeRequest splits the $request field ("GET /path HTTP/1.1") into the
+// request_method, request_uri and server_protocol fields, unless the parsed
+// line already contains them. The parts that cannot be extracted from
+// malformed request lines (for example, without a protocol) are left empty.
+func DecomposeRequest(fields map[string]string) {
+	var method, uri, protocol string
+
+	if parts := strings.Fields(fields["request"]); len(parts) > 0 {
+		method, parts = parts[0], parts[1:]
+
+		if len(parts) > 1 && strings.HasPrefix(parts[len(parts)-1], "HTTP/") {
+			protocol, parts = parts[len(parts)-1], parts[:len(parts)-1]
+		}
+
+		uri = strings.Join(parts, " ")
+	}
+
+	setIfAbsent := func(name string, value string) {
+		if _, ok := fields[name]; !ok {
+			fields[name] = value
+		}
+	}
+
+	setIfAbsent("request_method", method)
+	setIfAbsent("request_uri", uri)
+	setIfAbsent("server_protocol", protocol)
+}
+
 // NewParser returns a Parser with the given config.NamespaceConfig.
 func NewParser(nsCfg *config.NamespaceConfig) Parser {
-	switch nsCfg.Parser {
-	case "text":
+	if nsCfg.Parser == "json" && len(nsCfg.JSONFieldMap) > 0 {
+		return jsonparser.NewJsonParserWithFieldMap(nsCfg.JSONFieldMap)
+	}
+
+	if nsCfg.Parser == "csv" || nsCfg.Parser == "tsv" {
+		if delimiter, err := nsCfg.CSVDelimiterOrDefault(); err == nil {
+			return csvparser.NewCSVParser(nsCfg.CSVHeader, delimiter)
+		}
+	}
+
+	if nsCfg.Parser == "regex" && nsCfg.CompiledFormatRegexp != nil {
+		if p, err := regexparser.NewRegexParserFromRegexp(nsCfg.CompiledFormatRegexp); err == nil {
+			return p
+		}
+	}
+
+	p, err := NewCustomParser(nsCfg.Format, nsCfg.Parser)
+	if err != nil {
 		return textparser.NewTextParser(nsCfg.Format)
+	}
+
+	return p
+}
+
+// NewCustomParser returns a Parser for the given parser type (one of "text",
+// "json", "logfmt", "regex", "cloud_run" or "apache"; "text" if empty), independently
+// of a namespace config. The format is only used by the text and regex parsers.
+func NewCustomParser(format string, parserType string) (Parser, error) {
+	switch parserType {
+	case "text", "":
+		return textparser.NewTextParser(format), nil
 	case "json":
-		return jsonparser.NewJsonParser()
+		return jsonparser.NewJsonParser(), nil
+	case "logfmt":
+		return logfmtparser.NewLogfmtParser(), nil
+	case "regex":
+		return regexparser.NewRegexParser(format)
+	case "cloud_run":
+		return cloudrunparser.NewCloudRunParser(), nil
+	case "apache":
+		return apacheparser.NewApacheParser(), nil
 	default:
-		return textparser.NewTextParser(nsCfg.Format)
+		return nil, fmt.Errorf("unsupported parser type '%s'", parserType)
 	}
 }
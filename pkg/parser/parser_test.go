@@ -0,0 +1,123 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecomposeRequest(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		request string
+		want    map[string]string
+	}{
+		{
+			request: "GET /order/2145?foo=bar HTTP/1.1",
+			want:    map[string]string{"request_method": "GET", "request_uri": "/order/2145?foo=bar", "server_protocol": "HTTP/1.1"},
+		},
+		{
+			request: "GET /path with spaces HTTP/1.0",
+			want:    map[string]string{"request_method": "GET", "request_uri": "/path with spaces", "server_protocol": "HTTP/1.0"},
+		},
+		{
+			request: "GET /",
+			want:    map[string]string{"request_method": "GET", "request_uri": "/", "server_protocol": ""},
+		},
+		{
+			request: "\x16\x03\x01",
+			want:    map[string]string{"request_method": "\x16\x03\x01", "request_uri": "", "server_protocol": ""},
+		},
+		{
+			request: "",
+			want:    map[string]string{"request_method": "", "request_uri": "", "server_protocol": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		fields := map[string]string{"request": tt.request}
+		DecomposeRequest(fields)
+		delete(fields, "request")
+		assert.Equal(t, tt.want, fields, tt.request)
+	}
+}
+
+func TestDecomposeRequestKeepsExistingFields(t *testing.T) {
+	t.Parallel()
+
+	fields := map[string]string{"request": "GET / HTTP/1.1", "request_method": "HEAD"}
+	DecomposeRequest(fields)
+	assert.Equal(t, "HEAD", fields["request_method"])
+	assert.Equal(t, "/", fields["request_uri"])
+}
+
+func TestNewCustomParserCreatesTextParser(t *testing.T) {
+	t.Parallel()
+
+	p, err := NewCustomParser(`$remote_addr "$request" $status`, "")
+	require.NoError(t, err)
+
+	fields, err := p.ParseString(`10.0.0.1 "GET / HTTP/1.1" 200`)
+	require.NoError(t, err)
+	assert.Equal(t, "200", fields["status"])
+}
+
+func TestNewCustomParserCreatesJSONParser(t *testing.T) {
+	t.Parallel()
+
+	p, err := NewCustomParser("", "json")
+	require.NoError(t, err)
+
+	fields, err := p.ParseString(`{"status": "200"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "200", fields["status"])
+}
+
+func TestNewCustomParserCreatesLogfmtParser(t *testing.T) {
+	t.Parallel()
+
+	p, err := NewCustomParser("", "logfmt")
+	require.NoError(t, err)
+
+	fields, err := p.ParseString(`status=200 request="GET / HTTP/1.1"`)
+	require.NoError(t, err)
+	assert.Equal(t, "200", fields["status"])
+}
+
+func TestNewCustomParserCreatesRegexParser(t *testing.T) {
+	t.Parallel()
+
+	p, err := NewCustomParser(`^(?P<remote_addr>\S+) (?P<status>\d+)$`, "regex")
+	require.NoError(t, err)
+
+	fields, err := p.ParseString(`10.0.0.1 200`)
+	require.NoError(t, err)
+	assert.Equal(t, "200", fields["status"])
+}
+
+func TestNewCustomParserRejectsInvalidRegex(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewCustomParser(`(?P<status>\d+`, "regex")
+	assert.Error(t, err)
+}
+
+func TestNewCustomParserCreatesApacheParser(t *testing.T) {
+	t.Parallel()
+
+	p, err := NewCustomParser("", "apache")
+	require.NoError(t, err)
+
+	fields, err := p.ParseString(`10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.1" 200 12 "-" "curl/7.68.0"`)
+	require.NoError(t, err)
+	assert.Equal(t, "200", fields["status"])
+}
+
+func TestNewCustomParserRejectsUnknownType(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewCustomParser("", "xml")
+	assert.Error(t, err)
+}
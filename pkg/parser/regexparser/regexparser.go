@@ -0,0 +1,53 @@
+package regexparser
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// RegexParser parses log lines using a regular expression with named capture
+// groups; the names of the groups are used as field names.
+type RegexParser struct {
+	re *regexp.Regexp
+}
+
+// NewRegexParser compiles the given regular expression and returns a new
+// regex parser for it.
+func NewRegexParser(expr string) (*RegexParser, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("could not compile format regexp '%s': %w", expr, err)
+	}
+
+	return NewRegexParserFromRegexp(re)
+}
+
+// NewRegexParserFromRegexp returns a new regex parser for an already compiled
+// regular expression.
+func NewRegexParserFromRegexp(re *regexp.Regexp) (*RegexParser, error) {
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			return &RegexParser{re: re}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("format regexp '%s' does not contain any named capture groups", re.String())
+}
+
+// ParseString implements the Parser interface.
+func (r *RegexParser) ParseString(line string) (map[string]string, error) {
+	match := r.re.FindStringSubmatch(line)
+	if match == nil {
+		return nil, fmt.Errorf("regex log parsing err: line does not match format regexp")
+	}
+
+	names := r.re.SubexpNames()
+	fields := make(map[string]string, len(names))
+	for i, name := range names {
+		if name != "" {
+			fields[name] = match[i]
+		}
+	}
+
+	return fields, nil
+}
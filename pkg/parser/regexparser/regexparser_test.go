@@ -0,0 +1,41 @@
+package regexparser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegexParse(t *testing.T) {
+	parser, err := NewRegexParser(`^(?P<remote_addr>\S+) \[(?P<time_local>[^\]]+)\] "(?P<request>[^"]*)" (?P<status>\d+)`)
+	require.NoError(t, err)
+
+	got, err := parser.ParseString(`10.0.0.1 [03/Feb/2021:11:22:33 +0800] "GET /order/2145 HTTP/1.1" 200 legacy trailer`)
+	require.NoError(t, err)
+
+	want := map[string]string{
+		"remote_addr": "10.0.0.1",
+		"time_local":  "03/Feb/2021:11:22:33 +0800",
+		"request":     "GET /order/2145 HTTP/1.1",
+		"status":      "200",
+	}
+	require.Equal(t, want, got)
+}
+
+func TestRegexParseRejectsNonMatchingLine(t *testing.T) {
+	parser, err := NewRegexParser(`^(?P<status>\d+)$`)
+	require.NoError(t, err)
+
+	_, err = parser.ParseString("not a status")
+	require.Error(t, err)
+}
+
+func TestNewRegexParserRejectsInvalidRegexp(t *testing.T) {
+	_, err := NewRegexParser(`(?P<status>\d+`)
+	require.ErrorContains(t, err, "could not compile format regexp")
+}
+
+func TestNewRegexParserRequiresNamedGroups(t *testing.T) {
+	_, err := NewRegexParser(`(\d+)`)
+	require.ErrorContains(t, err, "named capture groups")
+}
@@ -0,0 +1,235 @@
+package push
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+)
+
+const lokiFlushInterval = time.Second
+
+// lokiErrorInterval is the minimum interval between two reported errors;
+// while Loki is unavailable, every batch fails, which would flood the log
+const lokiErrorInterval = time.Minute
+
+// LokiPusher is a helper struct that forwards parsed log lines to the push
+// API of a Grafana Loki instance. Log lines are sent in batches by a
+// background goroutine, so that forwarding does not block log processing.
+type LokiPusher struct {
+	url       string
+	labels    map[string]string
+	fields    []string
+	batchSize int
+
+	entries chan lokiEntry
+	client  *http.Client
+
+	onError        func(error)
+	onPushFailed   func(lines int)
+	onLinesDropped func(lines int)
+
+	errorInterval    time.Duration
+	errMu            sync.Mutex
+	lastError        time.Time
+	suppressedErrors int
+}
+
+type lokiEntry struct {
+	timestamp time.Time
+	labels    map[string]string
+	line      string
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type lokiPushRequest struct {
+	Streams []*lokiStream `json:"streams"`
+}
+
+// NewLokiPusher is a constructor function for building a new LokiPusher
+func NewLokiPusher(cfg *config.LokiConfig) *LokiPusher {
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	return &LokiPusher{
+		url:       cfg.PushURL,
+		labels:    cfg.Labels,
+		fields:    cfg.LokiFields,
+		batchSize: batchSize,
+		entries:   make(chan lokiEntry, batchSize*10),
+		client:    &http.Client{Timeout: 10 * time.Second},
+
+		onError:        func(error) {},
+		onPushFailed:   func(int) {},
+		onLinesDropped: func(int) {},
+		errorInterval:  lokiErrorInterval,
+	}
+}
+
+// OnError registers a callback that is invoked when log lines could not be
+// forwarded to Loki. It is invoked at most once per minute; the error states
+// how many errors were not reported in the meantime.
+func (p *LokiPusher) OnError(cb func(error)) {
+	p.onError = cb
+}
+
+// OnPushFailed registers a callback that is invoked for every batch that
+// could not be pushed to Loki, with the number of log lines in it
+func (p *LokiPusher) OnPushFailed(cb func(lines int)) {
+	p.onPushFailed = cb
+}
+
+// OnLinesDropped registers a callback that is invoked for log lines that were
+// dropped before being added to a batch, because the queue was full or the
+// line could not be encoded
+func (p *LokiPusher) OnLinesDropped(cb func(lines int)) {
+	p.onLinesDropped = cb
+}
+
+// reportError passes err to the error callback, unless another error was
+// reported less than errorInterval ago
+func (p *LokiPusher) reportError(err error) {
+	p.errMu.Lock()
+	now := time.Now()
+	if !p.lastError.IsZero() && now.Sub(p.lastError) < p.errorInterval {
+		p.suppressedErrors++
+		p.errMu.Unlock()
+		return
+	}
+
+	suppressed := p.suppressedErrors
+	p.lastError, p.suppressedErrors = now, 0
+	p.errMu.Unlock()
+
+	if suppressed > 0 {
+		err = fmt.Errorf("%w (%d more errors since the last report)", err, suppressed)
+	}
+	p.onError(err)
+}
+
+// Enqueue adds a parsed log line to the next batch. If the queue is full, the
+// line is dropped instead of blocking the caller.
+func (p *LokiPusher) Enqueue(fields map[string]string) {
+	line, err := json.Marshal(fields)
+	if err != nil {
+		p.onLinesDropped(1)
+		p.reportError(err)
+		return
+	}
+
+	labels := make(map[string]string, len(p.labels)+len(p.fields))
+	for k, v := range p.labels {
+		labels[k] = v
+	}
+	for _, f := range p.fields {
+		if v, ok := fields[f]; ok {
+			labels[f] = v
+		}
+	}
+
+	select {
+	case p.entries <- lokiEntry{timestamp: time.Now(), labels: labels, line: string(line)}:
+	default:
+		p.onLinesDropped(1)
+		p.reportError(fmt.Errorf("loki push queue is full, dropping log lines"))
+	}
+}
+
+// Run sends batches of log lines to Loki until the stopChan is closed
+func (p *LokiPusher) Run(stopChan <-chan bool, stopHandlers *sync.WaitGroup) {
+	ticker := time.NewTicker(lokiFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]lokiEntry, 0, p.batchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := p.push(batch); err != nil {
+			p.onPushFailed(len(batch))
+			p.reportError(err)
+		}
+
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case e := <-p.entries:
+			batch = append(batch, e)
+			if len(batch) >= p.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-stopChan:
+			for len(p.entries) > 0 {
+				batch = append(batch, <-p.entries)
+			}
+
+			flush()
+			stopHandlers.Done()
+			return
+		}
+	}
+}
+
+func (p *LokiPusher) push(batch []lokiEntry) error {
+	streams := make(map[string]*lokiStream)
+	req := lokiPushRequest{}
+
+	for _, e := range batch {
+		key := labelKey(e.labels)
+
+		s, ok := streams[key]
+		if !ok {
+			s = &lokiStream{Stream: e.labels}
+			streams[key] = s
+			req.Streams = append(req.Streams, s)
+		}
+
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(e.timestamp.UnixNano(), 10), e.line})
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Post(p.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to push log lines to Loki: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d while pushing log lines to Loki", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func labelKey(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for n, v := range labels {
+		pairs = append(pairs, n+"="+v)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,127 @@
+package push
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLokiPusherSendsBatchedStreams(t *testing.T) {
+	t.Parallel()
+
+	var req lokiPushRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	pusher := NewLokiPusher(&config.LokiConfig{
+		PushURL:    server.URL,
+		Labels:     map[string]string{"job": "nginx"},
+		BatchSize:  3,
+		LokiFields: []string{"status"},
+	})
+	pusher.OnError(func(err error) {
+		t.Error(err)
+	})
+
+	stopChan := make(chan bool)
+	stopHandlers := sync.WaitGroup{}
+	stopHandlers.Add(1)
+
+	go pusher.Run(stopChan, &stopHandlers)
+
+	pusher.Enqueue(map[string]string{"status": "200", "request": "GET / HTTP/1.1"})
+	pusher.Enqueue(map[string]string{"status": "500", "request": "GET /error HTTP/1.1"})
+	pusher.Enqueue(map[string]string{"status": "200", "request": "GET /foo HTTP/1.1"})
+
+	close(stopChan)
+	stopHandlers.Wait()
+
+	require.Len(t, req.Streams, 2)
+	assert.Equal(t, map[string]string{"job": "nginx", "status": "200"}, req.Streams[0].Stream)
+	assert.Len(t, req.Streams[0].Values, 2)
+	assert.JSONEq(t, `{"status": "500", "request": "GET /error HTTP/1.1"}`, req.Streams[1].Values[0][1])
+}
+
+func TestLokiPusherCountsFailedBatchesAndLimitsErrors(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	pusher := NewLokiPusher(&config.LokiConfig{PushURL: server.URL, BatchSize: 2})
+
+	var errs []error
+	var failedBatches, droppedLines int
+	pusher.OnError(func(err error) { errs = append(errs, err) })
+	pusher.OnPushFailed(func(lines int) {
+		failedBatches++
+		droppedLines += lines
+	})
+
+	stopChan := make(chan bool)
+	stopHandlers := sync.WaitGroup{}
+	stopHandlers.Add(1)
+
+	for i := 0; i < 4; i++ {
+		pusher.Enqueue(map[string]string{"status": "503"})
+	}
+
+	go pusher.Run(stopChan, &stopHandlers)
+
+	assert.Eventually(t, func() bool { return requests.Load() == 2 }, time.Second, 10*time.Millisecond)
+
+	close(stopChan)
+	stopHandlers.Wait()
+
+	assert.Equal(t, 2, failedBatches)
+	assert.Equal(t, 4, droppedLines)
+	require.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], "unexpected status code 503 while pushing log lines to Loki")
+}
+
+func TestLokiPusherReportsSuppressedErrors(t *testing.T) {
+	t.Parallel()
+
+	pusher := NewLokiPusher(&config.LokiConfig{PushURL: "http://localhost", BatchSize: 1})
+	pusher.errorInterval = 0
+
+	var errs []error
+	var droppedLines int
+	pusher.OnError(func(err error) { errs = append(errs, err) })
+	pusher.OnLinesDropped(func(lines int) { droppedLines += lines })
+
+	// the queue holds 10 lines; without a running pusher, the other lines are dropped
+	for i := 0; i < 12; i++ {
+		pusher.Enqueue(map[string]string{"status": "200"})
+	}
+
+	assert.Equal(t, 2, droppedLines)
+	require.Len(t, errs, 2)
+	assert.EqualError(t, errs[0], "loki push queue is full, dropping log lines")
+
+	pusher.errorInterval = time.Hour
+	for i := 0; i < 3; i++ {
+		pusher.Enqueue(map[string]string{"status": "200"})
+	}
+
+	pusher.errorInterval = 0
+	pusher.Enqueue(map[string]string{"status": "200"})
+
+	require.Len(t, errs, 3)
+	assert.EqualError(t, errs[2], "loki push queue is full, dropping log lines (3 more errors since the last report)")
+}
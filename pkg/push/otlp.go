@@ -0,0 +1,73 @@
+package push
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	prometheusbridge "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// OTLPExporter periodically exports all metrics of a gatherer to an
+// OpenTelemetry collector (or any other OTLP receiver). Prometheus counters,
+// gauges, histograms and summaries are mapped to their OTLP counterparts.
+type OTLPExporter struct {
+	provider *sdkmetric.MeterProvider
+}
+
+// NewOTLPExporter is a constructor function for building a new OTLPExporter
+// that starts exporting immediately
+func NewOTLPExporter(ctx context.Context, cfg *config.Config, gatherer prometheus.Gatherer) (*OTLPExporter, error) {
+	protocol, err := cfg.OTLPProtocolOrDefault()
+	if err != nil {
+		return nil, err
+	}
+
+	interval, err := cfg.OTLPExportIntervalOrDefault()
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP export interval: %w", err)
+	}
+
+	var exporter sdkmetric.Exporter
+	switch protocol {
+	case config.OTLPProtocolHTTP:
+		exporter, err = otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(cfg.OTLPEndpoint), otlpmetrichttp.WithHeaders(cfg.OTLPHeaders))
+	default:
+		exporter, err = otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithEndpointURL(cfg.OTLPEndpoint), otlpmetricgrpc.WithHeaders(cfg.OTLPHeaders))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	// the OTEL_RESOURCE_ATTRIBUTES and OTEL_SERVICE_NAME environment
+	// variables take precedence over the default service name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "prometheus-nginxlog-exporter")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OTLP resource: %w", err)
+	}
+
+	reader := sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithInterval(interval),
+		sdkmetric.WithProducer(prometheusbridge.NewMetricProducer(prometheusbridge.WithGatherer(gatherer))),
+	)
+
+	return &OTLPExporter{
+		provider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithResource(res)),
+	}, nil
+}
+
+// Shutdown exports the metrics one last time and stops exporting
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	return e.provider.Shutdown(ctx)
+}
@@ -0,0 +1,65 @@
+package push
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOTLPExporterExportsOnShutdown(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var paths []string
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		paths = append(paths, r.URL.Path)
+		authorization = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	counter := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "http_response_count_total",
+		Help: "Amount of processed HTTP requests",
+	})
+	counter.Add(3)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(counter)
+
+	exporter, err := NewOTLPExporter(context.Background(), &config.Config{
+		OTLPEndpoint: server.URL + "/v1/metrics",
+		OTLPProtocol: config.OTLPProtocolHTTP,
+		OTLPHeaders:  map[string]string{"Authorization": "Bearer secret"},
+	}, registry)
+	require.NoError(t, err)
+
+	require.NoError(t, exporter.Shutdown(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, []string{"/v1/metrics"}, paths)
+	assert.Equal(t, "Bearer secret", authorization)
+}
+
+func TestOTLPExporterRejectsUnknownProtocol(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewOTLPExporter(context.Background(), &config.Config{
+		OTLPEndpoint: "http://localhost:4317",
+		OTLPProtocol: "thrift",
+	}, prometheus.NewRegistry())
+	assert.Error(t, err)
+}
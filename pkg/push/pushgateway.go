@@ -0,0 +1,38 @@
+package push
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	pgpush "github.com/prometheus/client_golang/prometheus/push"
+)
+
+// PushGatewayJob is the job name under which metrics are pushed to a
+// Prometheus Pushgateway
+const PushGatewayJob = "prometheus_nginxlog_exporter"
+
+// PushGatewayPusher is a helper struct that pushes metrics to a Prometheus
+// Pushgateway
+type PushGatewayPusher struct {
+	url    string
+	pusher *pgpush.Pusher
+}
+
+// NewPushGatewayPusher is a constructor function for building a new
+// PushGatewayPusher
+func NewPushGatewayPusher(url string, gatherer prometheus.Gatherer) *PushGatewayPusher {
+	return &PushGatewayPusher{
+		url:    url,
+		pusher: pgpush.New(url, PushGatewayJob).Gatherer(gatherer),
+	}
+}
+
+// Push gathers all metrics and sends them to the Pushgateway, replacing all
+// metrics that were previously pushed by the exporter
+func (p *PushGatewayPusher) Push() error {
+	if err := p.pusher.Push(); err != nil {
+		return fmt.Errorf("failed to push metrics to Pushgateway at %s: %w", p.url, err)
+	}
+
+	return nil
+}
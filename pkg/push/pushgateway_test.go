@@ -0,0 +1,50 @@
+package push
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushGatewayPushReplacesJobMetrics(t *testing.T) {
+	t.Parallel()
+
+	var method, path string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	counter := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "http_response_count_total",
+		Help: "Amount of processed HTTP requests",
+	})
+	counter.Add(3)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(counter)
+
+	require.NoError(t, NewPushGatewayPusher(server.URL, registry).Push())
+	assert.Equal(t, http.MethodPut, method)
+	assert.Equal(t, "/metrics/job/"+PushGatewayJob, path)
+	assert.NotEmpty(t, body)
+}
+
+func TestPushGatewayPushFailsOnErrorStatus(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	assert.Error(t, NewPushGatewayPusher(server.URL, prometheus.NewRegistry()).Push())
+}
@@ -0,0 +1,254 @@
+package push
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RemoteWritePusher is a helper struct that sends metrics to a Prometheus
+// remote-write endpoint. Snapshots that cannot be sent are queued and sent
+// with the next push.
+type RemoteWritePusher struct {
+	url       string
+	headers   map[string]string
+	gatherer  prometheus.Gatherer
+	client    *http.Client
+	queueSize int
+
+	// now returns the time that the samples of a snapshot are recorded at
+	now func() time.Time
+
+	mu    sync.Mutex
+	queue [][]byte
+}
+
+// remoteWriteStatusError is returned when the endpoint responds with an
+// error status; snapshots are only sent again for server errors and rate
+// limiting, since other errors would recur
+type remoteWriteStatusError struct {
+	status int
+}
+
+func (e *remoteWriteStatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d while sending metrics to remote-write endpoint", e.status)
+}
+
+func (e *remoteWriteStatusError) retryable() bool {
+	return e.status >= 500 || e.status == http.StatusTooManyRequests
+}
+
+// NewRemoteWritePusher is a constructor function for building a new
+// RemoteWritePusher
+func NewRemoteWritePusher(cfg *config.RemoteWriteConfig, gatherer prometheus.Gatherer) (*RemoteWritePusher, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.TLS != nil {
+		tlsConfig, err := cfg.TLS.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &RemoteWritePusher{
+		url:       cfg.URL,
+		headers:   cfg.Headers,
+		gatherer:  gatherer,
+		client:    &http.Client{Timeout: 10 * time.Second, Transport: transport},
+		queueSize: cfg.QueueSizeOrDefault(),
+		now:       time.Now,
+	}, nil
+}
+
+// Push gathers all metrics and sends them, together with all previously
+// queued snapshots, to the remote-write endpoint
+func (p *RemoteWritePusher) Push() error {
+	mfs, err := p.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("failed to gather metrics: %w", err)
+	}
+
+	snapshot := snappy.Encode(nil, encodeWriteRequest(mfs, p.now().UnixMilli()))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.queue = append(p.queue, snapshot)
+	if dropped := len(p.queue) - p.queueSize; dropped > 0 {
+		p.queue = p.queue[dropped:]
+	}
+
+	for len(p.queue) > 0 {
+		err := p.send(p.queue[0])
+		if statusErr, ok := err.(*remoteWriteStatusError); ok && !statusErr.retryable() {
+			p.queue = p.queue[1:]
+			return err
+		}
+
+		if err != nil {
+			return fmt.Errorf("%w (%d snapshots queued)", err, len(p.queue))
+		}
+
+		p.queue = p.queue[1:]
+	}
+
+	return nil
+}
+
+func (p *RemoteWritePusher) send(snapshot []byte) error {
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(snapshot))
+	if err != nil {
+		return err
+	}
+
+	for name, value := range p.headers {
+		req.Header.Set(name, value)
+	}
+
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send metrics to remote-write endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return &remoteWriteStatusError{status: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// remoteWriteSample is a single sample of a time series, whose labels
+// include the metric name (as __name__)
+type remoteWriteSample struct {
+	labels map[string]string
+	value  float64
+}
+
+// encodeWriteRequest encodes metric families as remote-write WriteRequest
+// protobuf message, with one time series per sample. Histograms and
+// summaries are split into their _bucket (or quantile), _sum and _count
+// series, like in the text exposition format.
+func encodeWriteRequest(mfs []*dto.MetricFamily, timestampMs int64) []byte {
+	var buf []byte
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			ts := timestampMs
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+
+			for _, s := range remoteWriteSamples(mf, m) {
+				buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+				buf = protowire.AppendBytes(buf, encodeTimeSeries(s, ts))
+			}
+		}
+	}
+
+	return buf
+}
+
+func remoteWriteSamples(mf *dto.MetricFamily, m *dto.Metric) []remoteWriteSample {
+	name := mf.GetName()
+	sample := func(suffix string, value float64, extraName string, extraValue string) remoteWriteSample {
+		labels := make(map[string]string, len(m.Label)+2)
+		for _, l := range m.Label {
+			labels[l.GetName()] = l.GetValue()
+		}
+
+		labels["__name__"] = name + suffix
+		if extraName != "" {
+			labels[extraName] = extraValue
+		}
+
+		return remoteWriteSample{labels: labels, value: value}
+	}
+
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER:
+		return []remoteWriteSample{sample("", m.GetCounter().GetValue(), "", "")}
+	case dto.MetricType_GAUGE:
+		return []remoteWriteSample{sample("", m.GetGauge().GetValue(), "", "")}
+	case dto.MetricType_SUMMARY:
+		s := m.GetSummary()
+		samples := make([]remoteWriteSample, 0, len(s.Quantile)+2)
+		for _, q := range s.Quantile {
+			samples = append(samples, sample("", q.GetValue(), "quantile", formatFloat(q.GetQuantile())))
+		}
+
+		return append(samples,
+			sample("_sum", s.GetSampleSum(), "", ""),
+			sample("_count", float64(s.GetSampleCount()), "", ""),
+		)
+	case dto.MetricType_HISTOGRAM:
+		h := m.GetHistogram()
+		samples := make([]remoteWriteSample, 0, len(h.Bucket)+3)
+		for _, b := range h.Bucket {
+			samples = append(samples, sample("_bucket", float64(b.GetCumulativeCount()), "le", formatFloat(b.GetUpperBound())))
+		}
+
+		if len(h.Bucket) == 0 || !math.IsInf(h.Bucket[len(h.Bucket)-1].GetUpperBound(), 1) {
+			samples = append(samples, sample("_bucket", float64(h.GetSampleCount()), "le", "+Inf"))
+		}
+
+		return append(samples,
+			sample("_sum", h.GetSampleSum(), "", ""),
+			sample("_count", float64(h.GetSampleCount()), "", ""),
+		)
+	default:
+		return []remoteWriteSample{sample("", m.GetUntyped().GetValue(), "", "")}
+	}
+}
+
+// encodeTimeSeries encodes a TimeSeries message; remote-write requires its
+// labels to be sorted by name
+func encodeTimeSeries(s remoteWriteSample, timestampMs int64) []byte {
+	names := make([]string, 0, len(s.labels))
+	for name := range s.labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf []byte
+	for _, name := range names {
+		var label []byte
+		label = protowire.AppendTag(label, 1, protowire.BytesType)
+		label = protowire.AppendString(label, name)
+		label = protowire.AppendTag(label, 2, protowire.BytesType)
+		label = protowire.AppendString(label, s.labels[name])
+
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, label)
+	}
+
+	var sample []byte
+	sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+	sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+	sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, uint64(timestampMs))
+
+	buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+	buf = protowire.AppendBytes(buf, sample)
+
+	return buf
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,196 @@
+package push
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodedSeries is a time series decoded from a WriteRequest
+type decodedSeries struct {
+	labels      [][2]string
+	value       float64
+	timestampMs int64
+}
+
+// decodeWriteRequest decodes the fields of a WriteRequest that are written by
+// encodeWriteRequest
+func decodeWriteRequest(t *testing.T, buf []byte) []decodedSeries {
+	var series []decodedSeries
+
+	forEachField := func(buf []byte, cb func(num protowire.Number, typ protowire.Type, buf []byte) int) {
+		for len(buf) > 0 {
+			num, typ, n := protowire.ConsumeTag(buf)
+			require.GreaterOrEqual(t, n, 0)
+			buf = buf[n:]
+
+			n = cb(num, typ, buf)
+			require.GreaterOrEqual(t, n, 0)
+			buf = buf[n:]
+		}
+	}
+
+	forEachField(buf, func(_ protowire.Number, _ protowire.Type, buf []byte) int {
+		ts, n := protowire.ConsumeBytes(buf)
+		s := decodedSeries{}
+
+		forEachField(ts, func(num protowire.Number, _ protowire.Type, buf []byte) int {
+			msg, n := protowire.ConsumeBytes(buf)
+
+			switch num {
+			case 1:
+				label := [2]string{}
+				forEachField(msg, func(num protowire.Number, _ protowire.Type, buf []byte) int {
+					v, n := protowire.ConsumeString(buf)
+					label[num-1] = v
+					return n
+				})
+				s.labels = append(s.labels, label)
+			case 2:
+				forEachField(msg, func(num protowire.Number, _ protowire.Type, buf []byte) int {
+					if num == 1 {
+						v, n := protowire.ConsumeFixed64(buf)
+						s.value = math.Float64frombits(v)
+						return n
+					}
+
+					v, n := protowire.ConsumeVarint(buf)
+					s.timestampMs = int64(v)
+					return n
+				})
+			}
+
+			return n
+		})
+
+		series = append(series, s)
+		return n
+	})
+
+	return series
+}
+
+func TestRemoteWritePushesSnappyEncodedSamples(t *testing.T) {
+	t.Parallel()
+
+	var (
+		body    []byte
+		headers http.Header
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_response_count_total",
+		Help: "Amount of processed HTTP requests",
+	}, []string{"status"})
+	counter.WithLabelValues("200").Add(3)
+
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "http_response_time_seconds",
+		Help:    "Time needed by NGINX to handle requests",
+		Buckets: []float64{0.5},
+	})
+	histogram.Observe(0.1)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(counter, histogram)
+
+	pusher, err := NewRemoteWritePusher(&config.RemoteWriteConfig{
+		URL:     server.URL,
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+	}, registry)
+	require.NoError(t, err)
+	pusher.now = func() time.Time { return time.UnixMilli(1700000000000) }
+
+	require.NoError(t, pusher.Push())
+
+	assert.Equal(t, "snappy", headers.Get("Content-Encoding"))
+	assert.Equal(t, "application/x-protobuf", headers.Get("Content-Type"))
+	assert.Equal(t, "Bearer secret", headers.Get("Authorization"))
+
+	decoded, err := snappy.Decode(nil, body)
+	require.NoError(t, err)
+
+	series := decodeWriteRequest(t, decoded)
+	require.Len(t, series, 5)
+
+	assert.Equal(t, [][2]string{{"__name__", "http_response_count_total"}, {"status", "200"}}, series[0].labels)
+	assert.Equal(t, 3.0, series[0].value)
+	assert.Equal(t, int64(1700000000000), series[0].timestampMs)
+
+	assert.Equal(t, [][2]string{{"__name__", "http_response_time_seconds_bucket"}, {"le", "0.5"}}, series[1].labels)
+	assert.Equal(t, 1.0, series[1].value)
+	assert.Equal(t, [][2]string{{"__name__", "http_response_time_seconds_bucket"}, {"le", "+Inf"}}, series[2].labels)
+	assert.Equal(t, [][2]string{{"__name__", "http_response_time_seconds_sum"}}, series[3].labels)
+	assert.Equal(t, 0.1, series[3].value)
+	assert.Equal(t, [][2]string{{"__name__", "http_response_time_seconds_count"}}, series[4].labels)
+}
+
+func TestRemoteWriteQueuesSnapshotsWhileEndpointFails(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu       sync.Mutex
+		status   = http.StatusServiceUnavailable
+		received int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if status == http.StatusNoContent {
+			received++
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	pusher, err := NewRemoteWritePusher(&config.RemoteWriteConfig{URL: server.URL, QueueSize: 2}, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	assert.Error(t, pusher.Push())
+	assert.Error(t, pusher.Push())
+	assert.Error(t, pusher.Push())
+
+	mu.Lock()
+	status = http.StatusNoContent
+	mu.Unlock()
+
+	// one snapshot exceeded the queue size and was dropped
+	require.NoError(t, pusher.Push())
+	assert.Equal(t, 2, received)
+}
+
+func TestRemoteWriteDropsSnapshotsOnClientErrors(t *testing.T) {
+	t.Parallel()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	pusher, err := NewRemoteWritePusher(&config.RemoteWriteConfig{URL: server.URL}, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	assert.Error(t, pusher.Push())
+	assert.Error(t, pusher.Push())
+	assert.Equal(t, 2, requests)
+}
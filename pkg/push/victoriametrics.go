@@ -0,0 +1,79 @@
+package push
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// VictoriaMetricsPusher is a helper struct that pushes metrics to the
+// Prometheus text format import API of a VictoriaMetrics instance
+type VictoriaMetricsPusher struct {
+	url         string
+	extraLabels []*dto.LabelPair
+	gatherer    prometheus.Gatherer
+	client      *http.Client
+}
+
+// NewVictoriaMetricsPusher is a constructor function for building a new
+// VictoriaMetricsPusher
+func NewVictoriaMetricsPusher(cfg *config.VictoriaMetricsConfig, gatherer prometheus.Gatherer) *VictoriaMetricsPusher {
+	names := make([]string, 0, len(cfg.ExtraLabels))
+	for name := range cfg.ExtraLabels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	extraLabels := make([]*dto.LabelPair, len(names))
+	for i := range names {
+		name, value := names[i], cfg.ExtraLabels[names[i]]
+		extraLabels[i] = &dto.LabelPair{Name: &name, Value: &value}
+	}
+
+	return &VictoriaMetricsPusher{
+		url:         cfg.PushURL,
+		extraLabels: extraLabels,
+		gatherer:    gatherer,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Push gathers all metrics and sends them to VictoriaMetrics
+func (p *VictoriaMetricsPusher) Push() error {
+	mfs, err := p.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("failed to gather metrics: %w", err)
+	}
+
+	buf := bytes.Buffer{}
+	enc := expfmt.NewEncoder(&buf, expfmt.FmtText)
+
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			m.Label = append(m.Label, p.extraLabels...)
+		}
+
+		if err := enc.Encode(mf); err != nil {
+			return fmt.Errorf("failed to encode metric family %s: %w", mf.GetName(), err)
+		}
+	}
+
+	resp, err := p.client.Post(p.url, string(expfmt.FmtText), &buf)
+	if err != nil {
+		return fmt.Errorf("failed to push metrics to VictoriaMetrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d while pushing metrics to VictoriaMetrics", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package push
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushAddsExtraLabels(t *testing.T) {
+	t.Parallel()
+
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_response_count_total",
+		Help: "Amount of processed HTTP requests",
+	}, []string{"status"})
+	counter.WithLabelValues("200").Add(3)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(counter)
+
+	pusher := NewVictoriaMetricsPusher(&config.VictoriaMetricsConfig{
+		PushURL:     server.URL + "/api/v1/import/prometheus",
+		ExtraLabels: map[string]string{"instance": "web-1"},
+	}, registry)
+
+	require.NoError(t, pusher.Push())
+	assert.Contains(t, body, `http_response_count_total{status="200",instance="web-1"} 3`)
+}
+
+func TestPushFailsOnErrorStatus(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	pusher := NewVictoriaMetricsPusher(&config.VictoriaMetricsConfig{PushURL: server.URL}, prometheus.NewRegistry())
+
+	assert.Error(t, pusher.Push())
+}
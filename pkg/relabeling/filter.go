@@ -0,0 +1,46 @@
+package relabeling
+
+import "github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+
+// Filter decides whether a log line is counted at all, based on the raw value
+// of a single field
+type Filter struct {
+	config.RelabelConfig
+}
+
+// NewFilters creates a filter for each keep_if and drop_if relabeling
+// configuration (the other configurations are ignored)
+func NewFilters(cfgs []config.RelabelConfig) []*Filter {
+	var f []*Filter
+
+	for i := range cfgs {
+		if cfgs[i].IsFilter() {
+			f = append(f, &Filter{RelabelConfig: cfgs[i]})
+		}
+	}
+
+	return f
+}
+
+// Keep returns true if the log line with the given fields passes the filter.
+// Missing fields are treated as empty values.
+func (f *Filter) Keep(fields map[string]string) bool {
+	matches := f.CompiledFilterRegexp.MatchString(fields[f.SourceValue])
+	if f.Action == "drop_if" {
+		return !matches
+	}
+
+	return matches
+}
+
+// KeepLine returns true if the log line with the given fields passes all
+// filters
+func KeepLine(filters []*Filter, fields map[string]string) bool {
+	for _, f := range filters {
+		if !f.Keep(fields) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,44 @@
+package relabeling
+
+import (
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFiltersKeepAndDropLines(t *testing.T) {
+	t.Parallel()
+
+	cfgs := []config.RelabelConfig{
+		{TargetLabel: "healthcheck", SourceValue: "request_uri", Action: "drop_if", CaptureRegexp: "^/healthz"},
+		{TargetLabel: "api", SourceValue: "host", Action: "keep_if", CaptureRegexp: `^api\.`},
+		{TargetLabel: "user", SourceValue: "remote_user"},
+	}
+	for i := range cfgs {
+		require.NoError(t, cfgs[i].Compile())
+	}
+
+	filters := NewFilters(cfgs)
+	require.Len(t, filters, 2)
+
+	assert.True(t, KeepLine(filters, map[string]string{"request_uri": "/users", "host": "api.example.com"}))
+	assert.False(t, KeepLine(filters, map[string]string{"request_uri": "/healthz", "host": "api.example.com"}))
+	assert.False(t, KeepLine(filters, map[string]string{"request_uri": "/users", "host": "www.example.com"}))
+	assert.False(t, KeepLine(filters, map[string]string{"request_uri": "/users"}), "missing field")
+}
+
+func TestNewRelabelingsSkipsFilters(t *testing.T) {
+	t.Parallel()
+
+	cfgs := []config.RelabelConfig{
+		{TargetLabel: "healthcheck", SourceValue: "request_uri", Action: "drop_if", CaptureRegexp: "^/healthz"},
+		{TargetLabel: "user", SourceValue: "remote_user"},
+	}
+	require.NoError(t, cfgs[0].Compile())
+
+	relabelings := NewRelabelings(cfgs)
+	require.Len(t, relabelings, 1)
+	assert.Equal(t, "user", relabelings[0].TargetLabel)
+}
@@ -1,9 +1,13 @@
 package relabeling
 
 import (
+	"errors"
 	"strings"
 )
 
+// ErrSkipLine is returned by Map if the log line should not be counted at all
+var ErrSkipLine = errors.New("capture regexp did not match; skipping line")
+
 // Map maps a sourceValue from the access log line according to the relabeling
 // config (matching against whitelists, regular expressions etc.)
 func (r *Relabeling) Map(sourceValue string) (string, error) {
@@ -22,6 +26,14 @@ func (r *Relabeling) Map(sourceValue string) (string, error) {
 		}
 	}
 
+	if r.captureGroup > 0 {
+		return r.capture(sourceValue)
+	}
+
+	if r.Action == "normalize" {
+		sourceValue = r.normalize(sourceValue)
+	}
+
 	if r.WhitelistExists {
 		if _, ok := r.WhitelistMap[sourceValue]; ok {
 			return sourceValue, nil
@@ -43,3 +55,27 @@ func (r *Relabeling) Map(sourceValue string) (string, error) {
 
 	return sourceValue, nil
 }
+
+// capture returns the value of the relabeling's named group
+func (r *Relabeling) capture(sourceValue string) (string, error) {
+	match := r.CompiledCaptureRegexp.FindStringSubmatch(sourceValue)
+	if match == nil {
+		if r.OnNoMatch == "skip" {
+			return "", ErrSkipLine
+		}
+
+		return "", nil
+	}
+
+	return match[r.captureGroup], nil
+}
+
+// normalize applies all patterns of the relabeling in order, each replacing
+// all of its matches in the value
+func (r *Relabeling) normalize(sourceValue string) string {
+	for i := range r.Patterns {
+		sourceValue = r.Patterns[i].CompiledRegexp.ReplaceAllString(sourceValue, r.Patterns[i].Replacement)
+	}
+
+	return sourceValue
+}
@@ -53,3 +53,86 @@ func TestRequestURIMapping(t *testing.T) {
 	assertMapping(t, r, "GET /users/12345/about HTTP/1.1", "/users/:id/about")
 	assertMapping(t, r, "GET /v1/users/12345 HTTP/1.1", "")
 }
+
+func TestCaptureMappingAddsLabelForEachNamedGroup(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.RelabelConfig{
+		SourceValue:   "request_uri",
+		Action:        "capture",
+		CaptureRegexp: `^/api/(?P<version>v\d+)/(?P<resource>\w+)`,
+	}
+	if err := cfg.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	relabelings := NewRelabelings([]config.RelabelConfig{cfg})
+	if len(relabelings) != 2 {
+		t.Fatalf("expected 2 relabelings, got %d", len(relabelings))
+	}
+
+	if relabelings[0].TargetLabel != "version" || relabelings[1].TargetLabel != "resource" {
+		t.Errorf("expected labels 'version' and 'resource', got '%s' and '%s'", relabelings[0].TargetLabel, relabelings[1].TargetLabel)
+	}
+
+	assertMapping(t, relabelings[0], "/api/v2/users", "v2")
+	assertMapping(t, relabelings[1], "/api/v2/users", "users")
+	assertMapping(t, relabelings[0], "/health", "")
+}
+
+func TestCaptureMappingSkipsLineWithoutMatch(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.RelabelConfig{
+		SourceValue:   "request_uri",
+		Action:        "capture",
+		CaptureRegexp: `^/api/(?P<version>v\d+)/`,
+		OnNoMatch:     "skip",
+	}
+	if err := cfg.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRelabelings([]config.RelabelConfig{cfg})[0]
+
+	if _, err := r.Map("/health"); err != ErrSkipLine {
+		t.Errorf("expected ErrSkipLine, got %v", err)
+	}
+
+	assertMapping(t, r, "/api/v1/users", "v1")
+}
+
+func TestNormalizeMappingAppliesAllPatterns(t *testing.T) {
+	t.Parallel()
+
+	r, err := buildRelabeling(config.RelabelConfig{
+		Split:  2,
+		Action: "normalize",
+		Patterns: []config.PathNormalizePattern{
+			{RegexpString: `/users/\d+`, Replacement: "/users/:id"},
+			{RegexpString: `/orders/\d+`, Replacement: "/orders/:id"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertMapping(t, r, "GET /users/12345/orders/67890 HTTP/1.1", "/users/:id/orders/:id")
+	assertMapping(t, r, "GET /health HTTP/1.1", "/health")
+}
+
+func TestNormalizeMappingIsCombinedWithWhitelist(t *testing.T) {
+	t.Parallel()
+
+	r, err := buildRelabeling(config.RelabelConfig{
+		Action:    "normalize",
+		Patterns:  []config.PathNormalizePattern{{RegexpString: `\d+`, Replacement: ":id"}},
+		Whitelist: []string{"/users/:id"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertMapping(t, r, "/users/12", "/users/:id")
+	assertMapping(t, r, "/admin/12", "other")
+}
@@ -0,0 +1,118 @@
+package regexcache
+
+import (
+	"container/list"
+	"regexp"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultSize is the number of compiled regular expressions that the default
+// cache holds if not configured otherwise
+const DefaultSize = 256
+
+var (
+	// RegexCacheHitsTotal counts the lookups that could be served from a cache
+	RegexCacheHitsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "prometheus_nginxlog_exporter",
+		Name:      "regex_cache_hits_total",
+		Help:      "Total number of regular expressions that were served from the compiled regex cache",
+	})
+
+	// RegexCacheMissesTotal counts the lookups that required compiling a
+	// regular expression
+	RegexCacheMissesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "prometheus_nginxlog_exporter",
+		Name:      "regex_cache_misses_total",
+		Help:      "Total number of regular expressions that needed to be compiled because they were not cached",
+	})
+
+	// Default is the cache that is used for compiling relabeling expressions
+	Default = New(DefaultSize)
+)
+
+// Cache is a goroutine-safe LRU cache of compiled regular expressions, keyed
+// by their pattern string
+type Cache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type entry struct {
+	pattern string
+	regexp  *regexp.Regexp
+}
+
+// New creates a new cache that holds up to size compiled regular expressions
+func New(size int) *Cache {
+	return &Cache{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Compile returns the compiled regular expression for pattern, compiling it
+// only if it is not already cached
+func (c *Cache) Compile(pattern string) (*regexp.Regexp, error) {
+	c.mu.Lock()
+	if e, ok := c.items[pattern]; ok {
+		c.order.MoveToFront(e)
+		c.mu.Unlock()
+
+		RegexCacheHitsTotal.Inc()
+		return e.Value.(*entry).regexp, nil
+	}
+	c.mu.Unlock()
+
+	RegexCacheMissesTotal.Inc()
+
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.items[pattern]; !ok {
+		c.items[pattern] = c.order.PushFront(&entry{pattern: pattern, regexp: r})
+		c.evict()
+	}
+
+	return r, nil
+}
+
+// Resize changes the maximum number of cached regular expressions, evicting
+// the least recently used ones if necessary
+func (c *Cache) Resize(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.size = size
+	c.evict()
+}
+
+// Len returns the number of currently cached regular expressions
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *Cache) evict() {
+	for c.order.Len() > c.size && c.order.Len() > 0 {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry).pattern)
+	}
+}
+
+// Compile compiles a regular expression using the default cache
+func Compile(pattern string) (*regexp.Regexp, error) {
+	return Default.Compile(pattern)
+}
@@ -0,0 +1,62 @@
+package regexcache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileReturnsCachedRegexp(t *testing.T) {
+	t.Parallel()
+
+	c := New(2)
+
+	r1, err := c.Compile("^/users/[0-9]+")
+	require.NoError(t, err)
+
+	r2, err := c.Compile("^/users/[0-9]+")
+	require.NoError(t, err)
+
+	assert.Same(t, r1, r2)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestCompileEvictsLeastRecentlyUsed(t *testing.T) {
+	t.Parallel()
+
+	c := New(2)
+
+	a, _ := c.Compile("a")
+	_, _ = c.Compile("b")
+	_, _ = c.Compile("a")
+	_, _ = c.Compile("c")
+
+	assert.Equal(t, 2, c.Len())
+
+	a2, _ := c.Compile("a")
+	assert.Same(t, a, a2)
+}
+
+func TestCompileReturnsError(t *testing.T) {
+	t.Parallel()
+
+	c := New(2)
+
+	_, err := c.Compile("(")
+	assert.Error(t, err)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestResizeEvictsEntries(t *testing.T) {
+	t.Parallel()
+
+	c := New(3)
+	_, _ = c.Compile("a")
+	_, _ = c.Compile("b")
+	_, _ = c.Compile("c")
+
+	c.Resize(1)
+
+	assert.Equal(t, 1, c.Len())
+}
@@ -6,15 +6,31 @@ import "github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
 // executing the rules specified in the original configuration
 type Relabeling struct {
 	config.RelabelConfig
+
+	// captureGroup is the index of the submatch that is used as label value
+	// by capture relabelings
+	captureGroup int
 }
 
 // NewRelabelings creates a new set of relabelling runners from a list of
-// configurations (which are typically read from the config file)
+// configurations (which are typically read from the config file). A capture
+// relabeling results in one runner for each named group of its (compiled)
+// regular expression. Filters do not add labels and are thus skipped (see
+// NewFilters).
 func NewRelabelings(cfgs []config.RelabelConfig) []*Relabeling {
-	r := make([]*Relabeling, len(cfgs))
+	r := make([]*Relabeling, 0, len(cfgs))
 
 	for i := range cfgs {
-		r[i] = NewRelabeling(&cfgs[i])
+		if cfgs[i].IsFilter() {
+			continue
+		}
+
+		if cfgs[i].IsCapture() {
+			r = append(r, newCaptureRelabelings(&cfgs[i])...)
+			continue
+		}
+
+		r = append(r, NewRelabeling(&cfgs[i]))
 	}
 
 	return r
@@ -22,10 +38,30 @@ func NewRelabelings(cfgs []config.RelabelConfig) []*Relabeling {
 
 // NewRelabeling creates a single new relabelling runner
 func NewRelabeling(cfg *config.RelabelConfig) *Relabeling {
-	return &Relabeling{*cfg}
+	return &Relabeling{RelabelConfig: *cfg}
+}
+
+func newCaptureRelabelings(cfg *config.RelabelConfig) []*Relabeling {
+	var r []*Relabeling
+
+	for i, name := range cfg.CompiledCaptureRegexp.SubexpNames() {
+		if name == "" {
+			continue
+		}
+
+		c := &Relabeling{RelabelConfig: *cfg, captureGroup: i}
+		c.TargetLabel = name
+		r = append(r, c)
+	}
+
+	return r
 }
 
 // UniqueRelabelings creates a unique relabelings, the duplicated one at the end will discard.
+// Relabelings are considered duplicates when they have the same target label
+// (regardless of their other settings), since a metric cannot have the same
+// label twice. Deduplication uses a set of the seen target labels and thus
+// takes linear time.
 func UniqueRelabelings(relabelings []*Relabeling) []*Relabeling {
 	result := make([]*Relabeling, 0, len(relabelings))
 	found := make(map[string]struct{})
@@ -51,16 +87,36 @@ func StripExcluded(relabelings []*Relabeling) []*Relabeling {
 	return result
 }
 
-// StripOnlyCounterValues strips all values that are associated to relabelings only intended for the request counter
-func StripOnlyCounterValues(values []string, relabelings []*Relabeling) []string {
-	result := make([]string, 0, len(values))
-	offset := len(values) - len(relabelings)
+// Stripper strips all values that are associated to relabelings only
+// intended for the request counter. The positions of these values are
+// computed once, so that stripping does not need to look at the relabelings
+// for every log line.
+type Stripper struct {
+	onlyCounter []bool
+}
+
+// NewStripper creates a Stripper for label values that end with the values
+// of the given relabelings
+func NewStripper(relabelings []*Relabeling) Stripper {
+	s := Stripper{onlyCounter: make([]bool, len(relabelings))}
+	for i, r := range relabelings {
+		s.onlyCounter[i] = r.OnlyCounter
+	}
+	return s
+}
+
+// Strip copies all values that are not only intended for the request counter
+// into output and returns the filled part of output. It does not allocate if
+// output has enough capacity (which is at most len(values)).
+func (s Stripper) Strip(values []string, output []string) []string {
+	output = output[:0]
+	offset := len(values) - len(s.onlyCounter)
 	for i := range values {
-		if i >= offset && relabelings[i-offset].OnlyCounter {
+		if i >= offset && s.onlyCounter[i-offset] {
 			// skip if relabeling and only enabled for counter
 			continue
 		}
-		result = append(result, values[i])
+		output = append(output, values[i])
 	}
-	return result
+	return output
 }
@@ -0,0 +1,73 @@
+package relabeling
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+)
+
+func TestUniqueRelabelingsKeepsFirstOfEachTargetLabel(t *testing.T) {
+	t.Parallel()
+
+	relabelings := NewRelabelings([]config.RelabelConfig{
+		{TargetLabel: "user", SourceValue: "remote_user"},
+		{TargetLabel: "method", SourceValue: "request_method"},
+		{TargetLabel: "user", SourceValue: "http_x_user"},
+	})
+
+	unique := UniqueRelabelings(relabelings)
+
+	if len(unique) != 2 {
+		t.Fatalf("expected 2 relabelings, got %d", len(unique))
+	}
+
+	if unique[0].TargetLabel != "user" || unique[0].SourceValue != "remote_user" {
+		t.Errorf("expected first relabeling for 'user' to be kept, got %+v", unique[0].RelabelConfig)
+	}
+
+	if unique[1].TargetLabel != "method" {
+		t.Errorf("expected 'method' relabeling, got '%s'", unique[1].TargetLabel)
+	}
+}
+
+func benchmarkUniqueRelabelings(b *testing.B, n int) {
+	cfgs := make([]config.RelabelConfig, 0, 2*n)
+	for i := 0; i < n; i++ {
+		cfgs = append(cfgs, config.RelabelConfig{TargetLabel: fmt.Sprintf("label_%d", i), SourceValue: fmt.Sprintf("field_%d", i)})
+	}
+	cfgs = append(cfgs, cfgs...)
+
+	relabelings := NewRelabelings(cfgs)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		UniqueRelabelings(relabelings)
+	}
+}
+
+// The time per operation should grow linearly between these benchmarks
+func BenchmarkUniqueRelabelings1000(b *testing.B)  { benchmarkUniqueRelabelings(b, 1000) }
+func BenchmarkUniqueRelabelings10000(b *testing.B) { benchmarkUniqueRelabelings(b, 10000) }
+
+func TestStripperRemovesOnlyCounterValues(t *testing.T) {
+	stripper := NewStripper(NewRelabelings([]config.RelabelConfig{
+		{TargetLabel: "user", OnlyCounter: true},
+		{TargetLabel: "vhost"},
+	}))
+
+	values := []string{"static", "GET", "alice", "example.com"}
+	output := make([]string, 0, len(values))
+
+	stripped := stripper.Strip(values, output)
+	if fmt.Sprint(stripped) != fmt.Sprint([]string{"static", "GET", "example.com"}) {
+		t.Errorf("unexpected stripped values %v", stripped)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		stripper.Strip(values, output)
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+}
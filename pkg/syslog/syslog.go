@@ -5,11 +5,21 @@ import (
 	"net/url"
 	"os"
 
+	"github.com/prometheus/client_golang/prometheus"
+
 	"gopkg.in/mcuadros/go-syslog.v2"
 	"gopkg.in/mcuadros/go-syslog.v2/format"
 )
 
-func openListener(s *syslog.Server, c string) (func() error, error) {
+// SyslogReconnectsTotal counts how often a syslog server was restarted after
+// it stopped unexpectedly
+var SyslogReconnectsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "prometheus_nginxlog_exporter",
+	Name:      "syslog_reconnects_total",
+	Help:      "Number of times a syslog server was restarted after it stopped unexpectedly",
+}, []string{"listen_address"})
+
+func openListener(s *syslog.Server, c string, f format.Format, handler syslog.Handler, maxConnections int) (func() error, error) {
 	u, err := url.Parse(c)
 	if err != nil {
 		return nil, err
@@ -17,10 +27,15 @@ func openListener(s *syslog.Server, c string) (func() error, error) {
 
 	switch u.Scheme {
 	case "tcp":
-		return nil, s.ListenTCP(u.Host)
+		l, err := listenTCP(u.Host, f, handler, maxConnections)
+		if err != nil {
+			return nil, err
+		}
+
+		return l.close, nil
 
 	case "udp":
-		return nil, s.ListenUDP(u.Host)
+		return func() error { return nil }, s.ListenUDP(u.Host)
 
 	case "unix":
 		socketPath := u.Host + u.Path
@@ -38,8 +53,10 @@ func openListener(s *syslog.Server, c string) (func() error, error) {
 	}
 }
 
-// Listen opens up a new syslog server on either a TCP or UDP port
-func Listen(conn string, formatSpec string) (syslog.LogPartsChannel, *syslog.Server, func() error, error) {
+// Listen opens up a new syslog server on either a TCP or UDP port or a UNIX
+// socket. For TCP, maxConnections limits the number of simultaneous client
+// connections (0 means unlimited).
+func Listen(conn string, formatSpec string, maxConnections int) (syslog.LogPartsChannel, *syslog.Server, func() error, error) {
 	channel := make(syslog.LogPartsChannel)
 	handler := syslog.NewChannelHandler(channel)
 
@@ -66,7 +83,7 @@ func Listen(conn string, formatSpec string) (syslog.LogPartsChannel, *syslog.Ser
 	server.SetFormat(format)
 	server.SetHandler(handler)
 
-	closeListener, err := openListener(server, conn)
+	closeListener, err := openListener(server, conn, format, handler, maxConnections)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -0,0 +1,165 @@
+package syslog
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/mcuadros/go-syslog.v2"
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+// SyslogActiveConnectionsGauge tracks the number of clients that are currently
+// connected to a TCP syslog server
+var SyslogActiveConnectionsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "prometheus_nginxlog_exporter",
+	Name:      "syslog_active_connections",
+	Help:      "Number of clients that are currently connected to a TCP syslog server",
+}, []string{"listen_address"})
+
+// tcpListener accepts syslog messages from multiple simultaneous TCP
+// connections. It replaces the TCP listener built into the syslog library,
+// which neither limits nor exposes the number of client connections.
+type tcpListener struct {
+	listener net.Listener
+	format   format.Format
+	handler  syslog.Handler
+	active   prometheus.Gauge
+
+	// slots limits the number of simultaneous connections; nil if unlimited
+	slots chan struct{}
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func listenTCP(address string, f format.Format, handler syslog.Handler, maxConnections int) (*tcpListener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	return serveTCP(listener, address, f, handler, maxConnections), nil
+}
+
+// serveTCP accepts syslog connections from listener in the background
+func serveTCP(listener net.Listener, address string, f format.Format, handler syslog.Handler, maxConnections int) *tcpListener {
+	l := &tcpListener{
+		listener: listener,
+		format:   f,
+		handler:  handler,
+		active:   SyslogActiveConnectionsGauge.WithLabelValues("tcp://" + address),
+		conns:    make(map[net.Conn]struct{}),
+	}
+
+	if maxConnections > 0 {
+		l.slots = make(chan struct{}, maxConnections)
+	}
+
+	go l.accept()
+
+	return l
+}
+
+// maxAcceptDelay is the longest time that accept waits before retrying after
+// an error (like running out of file descriptors)
+const maxAcceptDelay = time.Second
+
+func (l *tcpListener) accept() {
+	// like net/http.Server, back off exponentially on errors, so that a
+	// persistent error does not make the loop spin
+	var delay time.Duration
+
+	for {
+		conn, err := l.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			if delay == 0 {
+				delay = 5 * time.Millisecond
+			} else if delay *= 2; delay > maxAcceptDelay {
+				delay = maxAcceptDelay
+			}
+
+			time.Sleep(delay)
+			continue
+		}
+
+		delay = 0
+
+		if l.slots != nil {
+			select {
+			case l.slots <- struct{}{}:
+			default:
+				// connection limit reached
+				conn.Close()
+				continue
+			}
+		}
+
+		l.mu.Lock()
+		l.conns[conn] = struct{}{}
+		l.mu.Unlock()
+
+		l.active.Inc()
+
+		go l.scan(conn)
+	}
+}
+
+func (l *tcpListener) scan(conn net.Conn) {
+	defer func() {
+		conn.Close()
+
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+
+		if l.slots != nil {
+			<-l.slots
+		}
+
+		l.active.Dec()
+	}()
+
+	client := conn.RemoteAddr().String()
+
+	scanner := bufio.NewScanner(conn)
+	if sf := l.format.GetSplitFunc(); sf != nil {
+		scanner.Split(sf)
+	}
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		parser := l.format.GetParser(line)
+		err := parser.Parse()
+
+		logParts := parser.Dump()
+		logParts["client"] = client
+		if logParts["hostname"] == "" {
+			if i := strings.LastIndex(client, ":"); i > 1 {
+				logParts["hostname"] = client[:i]
+			}
+		}
+		logParts["tls_peer"] = ""
+
+		l.handler.Handle(logParts, int64(len(line)), err)
+	}
+}
+
+func (l *tcpListener) close() error {
+	err := l.listener.Close()
+
+	l.mu.Lock()
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.mu.Unlock()
+
+	return err
+}
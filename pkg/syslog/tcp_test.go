@@ -0,0 +1,139 @@
+package syslog
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mcuadros/go-syslog.v2"
+)
+
+func listenTestTCP(t *testing.T, maxConnections int) (*tcpListener, syslog.LogPartsChannel) {
+	t.Helper()
+
+	channel := make(syslog.LogPartsChannel, 10)
+
+	l, err := listenTCP("127.0.0.1:0", syslog.RFC6587, syslog.NewChannelHandler(channel), maxConnections)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = l.close()
+	})
+
+	return l, channel
+}
+
+func dialTestTCP(t *testing.T, l *tcpListener) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", l.listener.Addr().String())
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	return conn
+}
+
+func TestTCPListenerSplitsOctetCountedFrames(t *testing.T) {
+	l, channel := listenTestTCP(t, 0)
+	conn := dialTestTCP(t, l)
+
+	messages := []string{
+		`<34>1 2024-03-01T12:30:00.000Z web1 nginx - - - GET /first`,
+		`<34>1 2024-03-01T12:30:01.000Z web1 nginx - - - GET /second`,
+	}
+
+	var frames string
+	for _, m := range messages {
+		frames += fmt.Sprintf("%d %s", len(m), m)
+	}
+
+	_, err := conn.Write([]byte(frames))
+	require.NoError(t, err)
+
+	for _, want := range []string{"GET /first", "GET /second"} {
+		select {
+		case parts := <-channel:
+			assert.Equal(t, want, parts["message"])
+			assert.Equal(t, "web1", parts["hostname"])
+			assert.Equal(t, conn.LocalAddr().String(), parts["client"])
+		case <-time.After(time.Second):
+			t.Fatalf("did not receive message %q", want)
+		}
+	}
+}
+
+func TestTCPListenerLimitsConnections(t *testing.T) {
+	l, _ := listenTestTCP(t, 1)
+
+	first := dialTestTCP(t, l)
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(l.active) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// the second connection is closed by the server
+	second := dialTestTCP(t, l)
+	require.NoError(t, second.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err := second.Read(make([]byte, 1))
+	assert.Error(t, err)
+	assert.Equal(t, 1.0, testutil.ToFloat64(l.active))
+
+	// closing the first connection frees its slot
+	first.Close()
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(l.active) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	dialTestTCP(t, l)
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(l.active) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+// failingListener is a net.Listener whose Accept always fails (until it is
+// closed)
+type failingListener struct {
+	net.Listener
+
+	accepts   atomic.Int32
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (f *failingListener) Accept() (net.Conn, error) {
+	f.accepts.Add(1)
+
+	select {
+	case <-f.closed:
+		return nil, net.ErrClosed
+	default:
+		return nil, errors.New("too many open files")
+	}
+}
+
+func (f *failingListener) Close() error {
+	f.closeOnce.Do(func() {
+		close(f.closed)
+	})
+	return nil
+}
+
+func TestTCPListenerBacksOffOnAcceptErrors(t *testing.T) {
+	listener := &failingListener{closed: make(chan struct{})}
+	l := serveTCP(listener, "failing", syslog.RFC6587, syslog.NewChannelHandler(make(syslog.LogPartsChannel)), 0)
+
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, l.close())
+
+	// 5ms, 10ms, 20ms and 40ms delays fit into 100ms
+	assert.LessOrEqual(t, listener.accepts.Load(), int32(7))
+}
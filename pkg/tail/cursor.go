@@ -0,0 +1,75 @@
+package tail
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// fileCursor is the position in a log file up to which its lines were
+// emitted. The inode tells if the file was rotated in the meantime.
+type fileCursor struct {
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+}
+
+// readFileCursor reads a cursor file; it returns false if the file does not
+// exist
+func readFileCursor(path string) (fileCursor, bool, error) {
+	var c fileCursor
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, false, nil
+	}
+	if err != nil {
+		return c, false, err
+	}
+
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, false, err
+	}
+
+	return c, true, nil
+}
+
+func writeFileCursor(path string, c fileCursor) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomically(path, data)
+}
+
+// fileInode returns the inode of a file, or 0 if the platform has no inodes
+func fileInode(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+
+	return 0
+}
+
+// writeFileAtomically replaces a file with data, so that the file is never
+// left half-written
+func writeFileAtomically(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,137 @@
+package tail
+
+import (
+	"os"
+	"sync"
+	"syscall"
+)
+
+type fifoFollower struct {
+	filename string
+	line     chan string
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	// file is the currently opened pipe
+	mu   sync.Mutex
+	file *os.File
+
+	errMu          sync.Mutex
+	errorCallbacks []func(error)
+}
+
+// isFIFO returns true if filename refers to a named pipe
+func isFIFO(filename string) bool {
+	info, err := os.Stat(filename)
+	return err == nil && info.Mode().Type() == os.ModeNamedPipe
+}
+
+// newFIFOFollower creates a Follower for a named pipe. Since a pipe reaches
+// EOF whenever its writer disconnects, it is reopened (which blocks until the
+// next writer connects) instead of being tailed like a regular file.
+func newFIFOFollower(filename string) *fifoFollower {
+	f := &fifoFollower{
+		filename: filename,
+		line:     make(chan string),
+		stop:     make(chan struct{}),
+	}
+
+	go f.run()
+
+	return f
+}
+
+func (f *fifoFollower) stopped() bool {
+	select {
+	case <-f.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (f *fifoFollower) run() {
+	defer close(f.line)
+
+	for {
+		file, err := os.OpenFile(f.filename, os.O_RDONLY, 0)
+		if err != nil {
+			if !f.stopped() {
+				f.reportError(err)
+			}
+			return
+		}
+
+		f.mu.Lock()
+		if f.stopped() {
+			f.mu.Unlock()
+			file.Close()
+			return
+		}
+		f.file = file
+		f.mu.Unlock()
+
+		scanner := newLineScanner(file)
+		for scanner.Scan() {
+			select {
+			case f.line <- scanner.Text():
+			case <-f.stop:
+			}
+		}
+
+		f.mu.Lock()
+		f.file = nil
+		f.mu.Unlock()
+		file.Close()
+
+		if f.stopped() {
+			return
+		}
+
+		if err := scanner.Err(); err != nil {
+			f.reportError(err)
+			return
+		}
+	}
+}
+
+func (f *fifoFollower) OnError(cb func(error)) {
+	f.errMu.Lock()
+	defer f.errMu.Unlock()
+
+	f.errorCallbacks = append(f.errorCallbacks, cb)
+}
+
+func (f *fifoFollower) reportError(err error) {
+	f.errMu.Lock()
+	defer f.errMu.Unlock()
+
+	for _, cb := range f.errorCallbacks {
+		cb(err)
+	}
+}
+
+func (f *fifoFollower) Lines() chan string {
+	return f.line
+}
+
+// Stop closes the currently opened pipe, or (if the follower is waiting for
+// a writer) briefly connects as a writer so that opening the pipe returns
+func (f *fifoFollower) Stop() error {
+	f.stopOnce.Do(func() {
+		close(f.stop)
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		if f.file != nil {
+			f.file.Close()
+			return
+		}
+
+		if w, err := os.OpenFile(f.filename, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+			w.Close()
+		}
+	})
+	return nil
+}
@@ -0,0 +1,74 @@
+//go:build unix
+
+package tail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeFIFO(t *testing.T) string {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "access.log")
+	require.NoError(t, syscall.Mkfifo(filename, 0o600))
+
+	return filename
+}
+
+func writeToFIFO(t *testing.T, filename string, lines ...string) {
+	t.Helper()
+
+	w, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	require.NoError(t, err)
+	defer w.Close()
+
+	for _, line := range lines {
+		_, err := fmt.Fprintln(w, line)
+		require.NoError(t, err)
+	}
+}
+
+func TestFileFollowerReopensFIFOForNextWriter(t *testing.T) {
+	t.Parallel()
+
+	filename := makeFIFO(t)
+	logger, _ := log.New("panic", "console")
+
+	f, err := NewFileFollower(logger, filename, "")
+	require.NoError(t, err)
+	require.IsType(t, &fifoFollower{}, f)
+	defer f.Stop()
+
+	go writeToFIFO(t, filename, "first", "second")
+	assert.Equal(t, "first", receive(t, f))
+	assert.Equal(t, "second", receive(t, f))
+
+	go writeToFIFO(t, filename, "third")
+	assert.Equal(t, "third", receive(t, f))
+}
+
+func TestFIFOFollowerStopsWhileWaitingForWriter(t *testing.T) {
+	t.Parallel()
+
+	f := newFIFOFollower(makeFIFO(t))
+
+	// give the follower some time to block on opening the pipe
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, f.Stop())
+
+	select {
+	case _, ok := <-f.Lines():
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("line channel was not closed")
+	}
+}
@@ -0,0 +1,150 @@
+package tail
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// GlobEvent describes a file matching a glob pattern that was created or
+// removed
+type GlobEvent struct {
+	Path    string
+	Removed bool
+}
+
+// GlobWatcher watches the directories of glob patterns and reports files
+// that match one of the patterns and are created or removed. Renaming a file
+// is reported as removal (of the old name) and creation (of the new name).
+type GlobWatcher struct {
+	patterns []string
+	watcher  *fsnotify.Watcher
+	events   chan GlobEvent
+	done     chan struct{}
+
+	mu             sync.Mutex
+	errorCallbacks []func(error)
+}
+
+// NewGlobWatcher creates a new GlobWatcher. Only the directories that exist
+// when the watcher is created are watched; wildcards in the directory part of
+// a pattern are resolved once.
+func NewGlobWatcher(patterns []string) (*GlobWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	watched := make(map[string]struct{})
+	for _, pattern := range patterns {
+		dirs, err := filepath.Glob(filepath.Dir(pattern))
+		if err != nil {
+			watcher.Close()
+			return nil, err
+		}
+
+		for _, dir := range dirs {
+			if _, ok := watched[dir]; ok {
+				continue
+			}
+
+			if err := watcher.Add(dir); err != nil {
+				watcher.Close()
+				return nil, err
+			}
+			watched[dir] = struct{}{}
+		}
+	}
+
+	w := &GlobWatcher{
+		patterns: patterns,
+		watcher:  watcher,
+		events:   make(chan GlobEvent),
+		done:     make(chan struct{}),
+	}
+
+	go w.run()
+
+	return w, nil
+}
+
+func (w *GlobWatcher) run() {
+	defer close(w.events)
+
+	for {
+		select {
+		case ev, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+
+			if !w.matches(ev.Name) {
+				continue
+			}
+
+			var e GlobEvent
+			switch {
+			case ev.Op&fsnotify.Create != 0:
+				e = GlobEvent{Path: ev.Name}
+			case ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+				e = GlobEvent{Path: ev.Name, Removed: true}
+			default:
+				continue
+			}
+
+			select {
+			case w.events <- e:
+			case <-w.done:
+				return
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+
+			w.reportError(err)
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *GlobWatcher) matches(path string) bool {
+	for _, pattern := range w.patterns {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Events returns the channel that the created and removed files are sent to.
+// It is closed when the watcher is closed.
+func (w *GlobWatcher) Events() <-chan GlobEvent {
+	return w.events
+}
+
+// OnError registers a callback for errors while watching the directories
+func (w *GlobWatcher) OnError(cb func(error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.errorCallbacks = append(w.errorCallbacks, cb)
+}
+
+func (w *GlobWatcher) reportError(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, cb := range w.errorCallbacks {
+		cb(err)
+	}
+}
+
+// Close stops watching the directories
+func (w *GlobWatcher) Close() error {
+	close(w.done)
+	return w.watcher.Close()
+}
@@ -0,0 +1,59 @@
+package tail
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func nextGlobEvent(t *testing.T, w *GlobWatcher) GlobEvent {
+	t.Helper()
+
+	select {
+	case ev, ok := <-w.Events():
+		require.True(t, ok, "event channel was closed")
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for glob event")
+	}
+
+	return GlobEvent{}
+}
+
+func TestGlobWatcherReportsMatchingFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := NewGlobWatcher([]string{filepath.Join(dir, "*_access.log")})
+	require.NoError(t, err)
+	defer w.Close()
+
+	ignored := filepath.Join(dir, "main_error.log")
+	require.NoError(t, os.WriteFile(ignored, []byte("foo\n"), 0o600))
+
+	created := filepath.Join(dir, "main_access.log")
+	require.NoError(t, os.WriteFile(created, []byte("foo\n"), 0o600))
+
+	assert.Equal(t, GlobEvent{Path: created}, nextGlobEvent(t, w))
+
+	require.NoError(t, os.Remove(created))
+
+	assert.Equal(t, GlobEvent{Path: created, Removed: true}, nextGlobEvent(t, w))
+}
+
+func TestGlobWatcherClosesEventChannel(t *testing.T) {
+	w, err := NewGlobWatcher([]string{filepath.Join(t.TempDir(), "*.log")})
+	require.NoError(t, err)
+
+	require.NoError(t, w.Close())
+
+	select {
+	case _, ok := <-w.Events():
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("event channel was not closed")
+	}
+}
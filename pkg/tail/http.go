@@ -0,0 +1,134 @@
+package tail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type httpFollower struct {
+	client       *http.Client
+	url          string
+	bearerToken  string
+	pollInterval time.Duration
+	line         chan string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu             sync.Mutex
+	errorCallbacks []func(error)
+}
+
+// NewHTTPFollower creates a new Follower that requests the given URL every
+// pollInterval and emits each line of the response body. The endpoint is
+// expected to only return lines that were not returned before. Failed
+// requests are reported to the error callbacks and retried with the next
+// poll. The follower stops (and closes its line channel) when stopChan is
+// closed.
+func NewHTTPFollower(url string, bearerToken string, tlsSkipVerify bool, pollInterval time.Duration, stopChan <-chan bool) Follower {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	f := &httpFollower{
+		client:       &http.Client{Transport: transport},
+		url:          url,
+		bearerToken:  bearerToken,
+		pollInterval: pollInterval,
+		line:         make(chan string),
+	}
+	f.ctx, f.cancel = context.WithCancel(context.Background())
+
+	go func() {
+		select {
+		case <-stopChan:
+			f.cancel()
+		case <-f.ctx.Done():
+		}
+	}()
+
+	go f.run()
+
+	return f
+}
+
+func (f *httpFollower) run() {
+	defer close(f.line)
+
+	ticker := time.NewTicker(f.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := f.poll(); err != nil && f.ctx.Err() == nil {
+			f.reportError(err)
+		}
+
+		select {
+		case <-f.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (f *httpFollower) poll() error {
+	req, err := http.NewRequestWithContext(f.ctx, http.MethodGet, f.url, nil)
+	if err != nil {
+		return err
+	}
+
+	if f.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+f.bearerToken)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("log endpoint %s responded with status %d", f.url, resp.StatusCode)
+	}
+
+	scanner := newLineScanner(resp.Body)
+	for scanner.Scan() {
+		select {
+		case f.line <- scanner.Text():
+		case <-f.ctx.Done():
+			return nil
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (f *httpFollower) OnError(cb func(error)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.errorCallbacks = append(f.errorCallbacks, cb)
+}
+
+func (f *httpFollower) reportError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, cb := range f.errorCallbacks {
+		cb(err)
+	}
+}
+
+func (f *httpFollower) Lines() chan string {
+	return f.line
+}
+
+func (f *httpFollower) Stop() error {
+	f.cancel()
+	return nil
+}
@@ -0,0 +1,61 @@
+package tail
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPFollowerEmitsLinesOfEachPoll(t *testing.T) {
+	t.Parallel()
+
+	var polls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+		n := atomic.AddInt32(&polls, 1)
+		fmt.Fprintf(w, "poll %d line 1\npoll %d line 2\n", n, n)
+	}))
+	defer server.Close()
+
+	stopChan := make(chan bool)
+	defer close(stopChan)
+
+	f := NewHTTPFollower(server.URL, "secret", false, 10*time.Millisecond, stopChan)
+
+	assert.Equal(t, "poll 1 line 1", receive(t, f))
+	assert.Equal(t, "poll 1 line 2", receive(t, f))
+	assert.Equal(t, "poll 2 line 1", receive(t, f))
+}
+
+func TestHTTPFollowerReportsFailedRequests(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	errs := make(chan error, 10)
+	f := NewHTTPFollower(server.URL, "", false, 10*time.Millisecond, make(chan bool))
+	f.OnError(func(err error) {
+		errs <- err
+	})
+
+	select {
+	case err := <-errs:
+		assert.ErrorContains(t, err, "status 401")
+	case <-time.After(time.Second):
+		t.Fatal("no error reported")
+	}
+
+	require.NoError(t, f.Stop())
+	for range f.Lines() {
+	}
+}
@@ -0,0 +1,195 @@
+package tail
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// journal is the part of the sdjournal API that the journal follower uses
+type journal interface {
+	AddMatch(match string) error
+	SeekCursor(cursor string) error
+	SeekTail() error
+	Next() (uint64, error)
+	Previous() (uint64, error)
+	GetDataValue(field string) (string, error)
+	GetCursor() (string, error)
+	Wait(timeout time.Duration) int
+	Close() error
+}
+
+// errJournalUnsupported is returned when opening the journal in a build
+// without journal support
+var errJournalUnsupported = errors.New("this build does not support reading from the systemd journal; build the exporter with the 'journal' build tag (which requires cgo and the libsystemd headers)")
+
+// journalWaitTimeout limits how long the follower waits for new messages
+// before checking if it was stopped
+const journalWaitTimeout = time.Second
+
+type journalFollower struct {
+	journal    journal
+	cursorFile string
+	line       chan string
+	stop       chan struct{}
+	stopOnce   sync.Once
+
+	mu             sync.Mutex
+	errorCallbacks []func(error)
+}
+
+// NewJournalFollower creates a new Follower that emits the messages that a
+// systemd unit writes to the journal. If cursorFile exists, reading continues
+// after the message at the cursor stored in it; otherwise, only new messages
+// are emitted. If cursorFile is not empty, the cursor of each emitted message
+// is written to it. The follower stops (and closes its line channel) when
+// stopChan is closed.
+func NewJournalFollower(unit string, cursorFile string, stopChan <-chan bool) (Follower, error) {
+	j, err := openJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	return newJournalFollower(j, unit, cursorFile, stopChan)
+}
+
+func newJournalFollower(j journal, unit string, cursorFile string, stopChan <-chan bool) (*journalFollower, error) {
+	if err := j.AddMatch("_SYSTEMD_UNIT=" + unit); err != nil {
+		j.Close()
+		return nil, err
+	}
+
+	if err := seekJournal(j, cursorFile); err != nil {
+		j.Close()
+		return nil, err
+	}
+
+	f := &journalFollower{
+		journal:    j,
+		cursorFile: cursorFile,
+		line:       make(chan string),
+		stop:       make(chan struct{}),
+	}
+
+	go f.run(stopChan)
+
+	return f, nil
+}
+
+// seekJournal positions the journal so that the next call of Next returns the
+// first message that was not emitted yet
+func seekJournal(j journal, cursorFile string) error {
+	if cursorFile != "" {
+		cursor, err := os.ReadFile(cursorFile)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if c := strings.TrimSpace(string(cursor)); c != "" {
+			if err := j.SeekCursor(c); err != nil {
+				return err
+			}
+
+			// the message at the cursor has already been emitted
+			_, err := j.Next()
+			return err
+		}
+	}
+
+	if err := j.SeekTail(); err != nil {
+		return err
+	}
+
+	// SeekTail positions the journal after the last message; stepping back
+	// makes Next return the first message that is written afterwards
+	_, err := j.Previous()
+	return err
+}
+
+func (f *journalFollower) run(stopChan <-chan bool) {
+	defer close(f.line)
+	defer f.journal.Close()
+
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-f.stop:
+			return
+		default:
+		}
+
+		n, err := f.journal.Next()
+		if err != nil {
+			f.reportError(err)
+			return
+		}
+
+		if n == 0 {
+			f.journal.Wait(journalWaitTimeout)
+			continue
+		}
+
+		message, err := f.journal.GetDataValue("MESSAGE")
+		if err != nil {
+			f.reportError(err)
+			continue
+		}
+
+		select {
+		case f.line <- message:
+		case <-stopChan:
+			return
+		case <-f.stop:
+			return
+		}
+
+		if err := f.writeCursor(); err != nil {
+			f.reportError(err)
+		}
+	}
+}
+
+// writeCursor stores the cursor of the current message in the cursor file.
+// The file is replaced atomically, so that it is never left half-written.
+func (f *journalFollower) writeCursor() error {
+	if f.cursorFile == "" {
+		return nil
+	}
+
+	cursor, err := f.journal.GetCursor()
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomically(f.cursorFile, []byte(cursor))
+}
+
+func (f *journalFollower) OnError(cb func(error)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.errorCallbacks = append(f.errorCallbacks, cb)
+}
+
+func (f *journalFollower) reportError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, cb := range f.errorCallbacks {
+		cb(err)
+	}
+}
+
+func (f *journalFollower) Lines() chan string {
+	return f.line
+}
+
+func (f *journalFollower) Stop() error {
+	f.stopOnce.Do(func() {
+		close(f.stop)
+	})
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build linux && cgo && journal
+
+package tail
+
+import "github.com/coreos/go-systemd/v22/sdjournal"
+
+func openJournal() (journal, error) {
+	j, err := sdjournal.NewJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
@@ -0,0 +1,179 @@
+package tail
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeJournalEntry struct {
+	cursor  string
+	message string
+}
+
+// fakeJournal mimics the positioning semantics of sdjournal: pos is the
+// index of the current entry, and Next and Previous move it
+type fakeJournal struct {
+	mu      sync.Mutex
+	entries []fakeJournalEntry
+	pos     int
+	matches []string
+	closed  bool
+}
+
+func (j *fakeJournal) append(cursor, message string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.entries = append(j.entries, fakeJournalEntry{cursor: cursor, message: message})
+}
+
+func (j *fakeJournal) AddMatch(match string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.matches = append(j.matches, match)
+	return nil
+}
+
+func (j *fakeJournal) SeekCursor(cursor string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i := range j.entries {
+		if j.entries[i].cursor == cursor {
+			j.pos = i - 1
+			return nil
+		}
+	}
+
+	return os.ErrNotExist
+}
+
+func (j *fakeJournal) SeekTail() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.pos = len(j.entries)
+	return nil
+}
+
+func (j *fakeJournal) Next() (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.pos+1 >= len(j.entries) {
+		return 0, nil
+	}
+
+	j.pos++
+	return 1, nil
+}
+
+func (j *fakeJournal) Previous() (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.pos < 0 {
+		return 0, nil
+	}
+
+	j.pos--
+	if j.pos < 0 {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+func (j *fakeJournal) GetDataValue(field string) (string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.entries[j.pos].message, nil
+}
+
+func (j *fakeJournal) GetCursor() (string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.entries[j.pos].cursor, nil
+}
+
+func (j *fakeJournal) Wait(timeout time.Duration) int {
+	time.Sleep(5 * time.Millisecond)
+	return 0
+}
+
+func (j *fakeJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.closed = true
+	return nil
+}
+
+func TestJournalFollowerStartsAtTheEndWithoutCursor(t *testing.T) {
+	t.Parallel()
+
+	j := &fakeJournal{}
+	j.append("c1", "old line")
+
+	stopChan := make(chan bool)
+	defer close(stopChan)
+
+	f, err := newJournalFollower(j, "nginx.service", "", stopChan)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"_SYSTEMD_UNIT=nginx.service"}, j.matches)
+
+	j.append("c2", "new line")
+	assert.Equal(t, "new line", receive(t, f))
+}
+
+func TestJournalFollowerContinuesAfterPersistedCursor(t *testing.T) {
+	t.Parallel()
+
+	cursorFile := filepath.Join(t.TempDir(), "cursor")
+	require.NoError(t, os.WriteFile(cursorFile, []byte("c1\n"), 0o644))
+
+	j := &fakeJournal{}
+	j.append("c1", "processed line")
+	j.append("c2", "missed line")
+
+	stopChan := make(chan bool)
+	defer close(stopChan)
+
+	f, err := newJournalFollower(j, "nginx.service", cursorFile, stopChan)
+	require.NoError(t, err)
+
+	assert.Equal(t, "missed line", receive(t, f))
+
+	j.append("c3", "new line")
+	assert.Equal(t, "new line", receive(t, f))
+
+	require.Eventually(t, func() bool {
+		cursor, err := os.ReadFile(cursorFile)
+		return err == nil && string(cursor) == "c3"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestJournalFollowerClosesJournalWhenStopped(t *testing.T) {
+	t.Parallel()
+
+	j := &fakeJournal{}
+	f, err := newJournalFollower(j, "nginx.service", "", make(chan bool))
+	require.NoError(t, err)
+
+	require.NoError(t, f.Stop())
+
+	_, ok := <-f.Lines()
+	assert.False(t, ok)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	assert.True(t, j.closed)
+}
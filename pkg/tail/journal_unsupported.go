@@ -0,0 +1,7 @@
+//go:build !(linux && cgo && journal)
+
+package tail
+
+func openJournal() (journal, error) {
+	return nil, errJournalUnsupported
+}
@@ -0,0 +1,171 @@
+package tail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// kafkaRetryDelay is the time to wait before joining the consumer group
+// again after consuming failed
+const kafkaRetryDelay = 5 * time.Second
+
+type kafkaFollower struct {
+	group sarama.ConsumerGroup
+	topic string
+	line  chan string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu             sync.Mutex
+	errorCallbacks []func(error)
+}
+
+// NewKafkaFollower creates a new Follower that joins the consumer group
+// groupID and emits the body of each message of the given topic as a log
+// line. If fromEarliest is set, a consumer group without committed offsets
+// starts at the earliest available message instead of only consuming new
+// ones; tlsConfig may be nil for unencrypted connections. The follower stops
+// (and closes its line channel) when stopChan is closed.
+func NewKafkaFollower(brokers []string, topic string, groupID string, fromEarliest bool, tlsConfig *tls.Config, stopChan <-chan bool, stopHandlers *sync.WaitGroup) (Follower, error) {
+	cfg := sarama.NewConfig()
+	cfg.ClientID = "prometheus-nginxlog-exporter"
+	cfg.Consumer.Return.Errors = true
+
+	if fromEarliest {
+		cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+	}
+
+	if tlsConfig != nil {
+		cfg.Net.TLS.Enable = true
+		cfg.Net.TLS.Config = tlsConfig
+	}
+
+	group, err := sarama.NewConsumerGroup(brokers, groupID, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return newKafkaFollower(group, topic, stopChan, stopHandlers), nil
+}
+
+func newKafkaFollower(group sarama.ConsumerGroup, topic string, stopChan <-chan bool, stopHandlers *sync.WaitGroup) *kafkaFollower {
+	f := &kafkaFollower{
+		group: group,
+		topic: topic,
+		line:  make(chan string),
+	}
+	f.ctx, f.cancel = context.WithCancel(context.Background())
+
+	go func() {
+		select {
+		case <-stopChan:
+			f.cancel()
+		case <-f.ctx.Done():
+		}
+	}()
+
+	go func() {
+		for err := range group.Errors() {
+			f.reportError(err)
+		}
+	}()
+
+	stopHandlers.Add(1)
+	go func() {
+		defer stopHandlers.Done()
+		f.run()
+	}()
+
+	return f
+}
+
+func (f *kafkaFollower) run() {
+	defer close(f.line)
+
+	for {
+		err := f.group.Consume(f.ctx, []string{f.topic}, f)
+		if f.ctx.Err() != nil {
+			break
+		}
+
+		if err != nil {
+			f.reportError(err)
+
+			select {
+			case <-f.ctx.Done():
+			case <-time.After(kafkaRetryDelay):
+			}
+		}
+	}
+
+	if err := f.group.Close(); err != nil {
+		f.reportError(err)
+	}
+}
+
+// Setup implements the sarama.ConsumerGroupHandler interface
+func (f *kafkaFollower) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup implements the sarama.ConsumerGroupHandler interface
+func (f *kafkaFollower) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim implements the sarama.ConsumerGroupHandler interface. A
+// message is marked as consumed once its line has been emitted.
+func (f *kafkaFollower) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case <-session.Context().Done():
+			return nil
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+
+			select {
+			case f.line <- string(msg.Value):
+				session.MarkMessage(msg, "")
+			case <-session.Context().Done():
+				return nil
+			}
+		}
+	}
+}
+
+func (f *kafkaFollower) OnError(cb func(error)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.errorCallbacks = append(f.errorCallbacks, cb)
+}
+
+func (f *kafkaFollower) reportError(err error) {
+	if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, cb := range f.errorCallbacks {
+		cb(err)
+	}
+}
+
+func (f *kafkaFollower) Lines() chan string {
+	return f.line
+}
+
+func (f *kafkaFollower) Stop() error {
+	f.cancel()
+	return nil
+}
@@ -0,0 +1,114 @@
+package tail
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeConsumerGroup struct {
+	sarama.ConsumerGroup
+
+	messages chan *sarama.ConsumerMessage
+	errors   chan error
+
+	mu     sync.Mutex
+	marked []int64
+	closed bool
+}
+
+func (g *fakeConsumerGroup) Consume(ctx context.Context, _ []string, handler sarama.ConsumerGroupHandler) error {
+	return handler.ConsumeClaim(&fakeSession{ctx: ctx, group: g}, &fakeClaim{messages: g.messages})
+}
+
+func (g *fakeConsumerGroup) Errors() <-chan error {
+	return g.errors
+}
+
+func (g *fakeConsumerGroup) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.closed = true
+	close(g.errors)
+	return nil
+}
+
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+
+	ctx   context.Context
+	group *fakeConsumerGroup
+}
+
+func (s *fakeSession) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.group.mu.Lock()
+	defer s.group.mu.Unlock()
+
+	s.group.marked = append(s.group.marked, msg.Offset)
+}
+
+type fakeClaim struct {
+	sarama.ConsumerGroupClaim
+
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+func TestKafkaFollowerEmitsMessageBodies(t *testing.T) {
+	t.Parallel()
+
+	group := &fakeConsumerGroup{messages: make(chan *sarama.ConsumerMessage), errors: make(chan error)}
+	stopChan := make(chan bool)
+	stopHandlers := sync.WaitGroup{}
+
+	f := newKafkaFollower(group, "nginx", stopChan, &stopHandlers)
+
+	go func() {
+		group.messages <- &sarama.ConsumerMessage{Offset: 1, Value: []byte("first")}
+		group.messages <- &sarama.ConsumerMessage{Offset: 2, Value: []byte("second")}
+	}()
+
+	assert.Equal(t, "first", receive(t, f))
+	assert.Equal(t, "second", receive(t, f))
+
+	close(stopChan)
+	stopHandlers.Wait()
+
+	_, ok := <-f.Lines()
+	assert.False(t, ok)
+
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	assert.True(t, group.closed)
+	assert.Equal(t, []int64{1, 2}, group.marked)
+}
+
+func TestKafkaFollowerStops(t *testing.T) {
+	t.Parallel()
+
+	group := &fakeConsumerGroup{messages: make(chan *sarama.ConsumerMessage), errors: make(chan error)}
+	stopHandlers := sync.WaitGroup{}
+
+	f := newKafkaFollower(group, "nginx", make(chan bool), &stopHandlers)
+	require.NoError(t, f.Stop())
+
+	select {
+	case _, ok := <-f.Lines():
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("line channel was not closed")
+	}
+}
@@ -0,0 +1,84 @@
+package tail
+
+import (
+	"sync"
+)
+
+// LineLimit limits the total number of lines that are emitted by a group of
+// followers. Once the limit is reached, all followers of the group are
+// stopped.
+type LineLimit struct {
+	mu        sync.Mutex
+	remaining int
+	followers []Follower
+}
+
+// NewLineLimit creates a LineLimit that allows n lines to be emitted
+func NewLineLimit(n int) *LineLimit {
+	return &LineLimit{remaining: n}
+}
+
+type limitedFollower struct {
+	Follower
+
+	limit *LineLimit
+	line  chan string
+}
+
+// Follow wraps a Follower so that its lines count towards the limit
+func (l *LineLimit) Follow(f Follower) Follower {
+	l.mu.Lock()
+	l.followers = append(l.followers, f)
+	exhausted := l.remaining <= 0
+	l.mu.Unlock()
+
+	if exhausted {
+		_ = f.Stop()
+	}
+
+	return &limitedFollower{
+		Follower: f,
+		limit:    l,
+		line:     make(chan string),
+	}
+}
+
+// take reserves one line of the limit; it returns false if the limit has
+// already been reached
+func (l *LineLimit) take() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.remaining <= 0 {
+		return false
+	}
+
+	l.remaining--
+	if l.remaining == 0 {
+		for _, f := range l.followers {
+			// stopping may block until the follower's pending lines have
+			// been consumed, which happens in the forwarding goroutines
+			go f.Stop()
+		}
+	}
+
+	return true
+}
+
+func (f *limitedFollower) Lines() chan string {
+	lines := f.Follower.Lines()
+
+	go func() {
+		defer close(f.line)
+
+		// lines beyond the limit are discarded until the follower has
+		// stopped and closed its channel
+		for l := range lines {
+			if f.limit.take() {
+				f.line <- l
+			}
+		}
+	}()
+
+	return f.line
+}
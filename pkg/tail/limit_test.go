@@ -0,0 +1,53 @@
+package tail
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineLimitStopsAllFollowers(t *testing.T) {
+	t.Parallel()
+
+	limit := NewLineLimit(3)
+	a := limit.Follow(NewReaderFollower(strings.NewReader("a1\na2\na3\na4\n")))
+	b := limit.Follow(NewReaderFollower(strings.NewReader("b1\nb2\nb3\nb4\n")))
+
+	results := make(chan []string, 2)
+	for _, f := range []Follower{a, b} {
+		go func(f Follower) {
+			lines := make([]string, 0)
+			for line := range f.Lines() {
+				lines = append(lines, line)
+			}
+			results <- lines
+		}(f)
+	}
+
+	total := 0
+	for i := 0; i < 2; i++ {
+		select {
+		case lines := <-results:
+			total += len(lines)
+		case <-time.After(5 * time.Second):
+			t.Fatal("followers were not stopped")
+		}
+	}
+
+	assert.Equal(t, 3, total)
+}
+
+func TestReaderFollowerStopsEarly(t *testing.T) {
+	t.Parallel()
+
+	f := NewReaderFollower(strings.NewReader("line 1\nline 2\nline 3\n"))
+	lines := f.Lines()
+
+	assert.Equal(t, "line 1", <-lines)
+	assert.NoError(t, f.Stop())
+
+	for range lines {
+	}
+}
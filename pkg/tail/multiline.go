@@ -0,0 +1,80 @@
+package tail
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// multilineFlushTimeout is the time after which a buffered record is emitted
+// when no further lines arrive; otherwise, the last record of a followed file
+// would only be emitted once the next record starts
+const multilineFlushTimeout = time.Second
+
+type multilineFollower struct {
+	Follower
+
+	start        *regexp.Regexp
+	flushTimeout time.Duration
+	line         chan string
+}
+
+// NewMultilineFollower wraps a Follower so that log records spanning multiple
+// lines are emitted as a single (newline-joined) line. A new record starts
+// with each line that matches the start pattern; all following lines that do
+// not match it are appended to that record.
+func NewMultilineFollower(f Follower, start *regexp.Regexp) Follower {
+	return &multilineFollower{
+		Follower:     f,
+		start:        start,
+		flushTimeout: multilineFlushTimeout,
+		line:         make(chan string),
+	}
+}
+
+func (f *multilineFollower) Lines() chan string {
+	lines := f.Follower.Lines()
+
+	go func() {
+		defer close(f.line)
+
+		var record []string
+		flush := func() {
+			if len(record) > 0 {
+				f.line <- strings.Join(record, "\n")
+				record = nil
+			}
+		}
+
+		idle := time.NewTimer(f.flushTimeout)
+		idle.Stop()
+
+		for {
+			select {
+			case l, ok := <-lines:
+				if !ok {
+					flush()
+					return
+				}
+
+				if f.start.MatchString(l) {
+					flush()
+				}
+
+				record = append(record, l)
+
+				if !idle.Stop() {
+					select {
+					case <-idle.C:
+					default:
+					}
+				}
+				idle.Reset(f.flushTimeout)
+			case <-idle.C:
+				flush()
+			}
+		}
+	}()
+
+	return f.line
+}
@@ -0,0 +1,55 @@
+package tail
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultilineFollowerJoinsRecords(t *testing.T) {
+	t.Parallel()
+
+	r := strings.NewReader("{\n  \"status\": 200\n}\n{\n  \"status\": 404\n}\n")
+	f := NewMultilineFollower(NewReaderFollower(r), regexp.MustCompile(`^\{`))
+
+	lines := make([]string, 0)
+	for line := range f.Lines() {
+		lines = append(lines, line)
+	}
+
+	assert.Equal(t, []string{"{\n  \"status\": 200\n}", "{\n  \"status\": 404\n}"}, lines)
+}
+
+type chanFollower struct {
+	line chan string
+}
+
+func (f *chanFollower) Lines() chan string  { return f.line }
+func (f *chanFollower) OnError(func(error)) {}
+func (f *chanFollower) Stop() error         { close(f.line); return nil }
+
+func TestMultilineFollowerFlushesIdleRecord(t *testing.T) {
+	t.Parallel()
+
+	inner := &chanFollower{line: make(chan string)}
+	f := NewMultilineFollower(inner, regexp.MustCompile(`^\{`)).(*multilineFollower)
+	f.flushTimeout = 10 * time.Millisecond
+
+	lines := f.Lines()
+	inner.line <- "{"
+	inner.line <- "}"
+
+	select {
+	case line := <-lines:
+		assert.Equal(t, "{\n}", line)
+	case <-time.After(time.Second):
+		t.Fatal("record was not flushed")
+	}
+
+	_ = f.Stop()
+	_, ok := <-lines
+	assert.False(t, ok)
+}
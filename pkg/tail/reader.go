@@ -0,0 +1,104 @@
+package tail
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sync"
+)
+
+// maxLineSize is the maximum length of a line read by a scanner; the default
+// limit of bufio.Scanner (64 KiB) is easily exceeded by log lines containing
+// long URLs, cookies or JSON payloads
+const maxLineSize = 1024 * 1024
+
+// newLineScanner creates a scanner for the lines of a reader that accepts
+// lines of up to maxLineSize bytes
+func newLineScanner(reader io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
+	return scanner
+}
+
+type readerFollower struct {
+	reader io.ReadSeeker
+	closer io.Closer
+	line   chan string
+	err    chan error
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewReaderFollower creates a new Follower that emits all lines of a reader
+// (from its beginning) and closes its line channel when the end of the reader
+// is reached. In contrast to the file follower, it does not wait for new lines
+// to be written; this makes it useful for processing static log content, like
+// in tests.
+func NewReaderFollower(reader io.ReadSeeker) Follower {
+	return &readerFollower{
+		reader: reader,
+		line:   make(chan string),
+		err:    make(chan error, 1),
+		stop:   make(chan struct{}),
+	}
+}
+
+// NewFileReaderFollower creates a new Follower that emits all lines of a file
+// (given by name) like NewReaderFollower, and closes the file when the end of
+// it is reached or the follower is stopped.
+func NewFileReaderFollower(filename string) (Follower, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	f := NewReaderFollower(file).(*readerFollower)
+	f.closer = file
+	return f, nil
+}
+
+func (f *readerFollower) OnError(cb func(error)) {
+	go func() {
+		if err := <-f.err; err != nil {
+			cb(err)
+		}
+	}()
+}
+
+func (f *readerFollower) Lines() chan string {
+	go func() {
+		defer close(f.line)
+
+		if f.closer != nil {
+			defer f.closer.Close()
+		}
+
+		if _, err := f.reader.Seek(0, io.SeekStart); err != nil {
+			f.err <- err
+			return
+		}
+
+		scanner := newLineScanner(f.reader)
+		for scanner.Scan() {
+			select {
+			case f.line <- scanner.Text():
+			case <-f.stop:
+				f.err <- nil
+				return
+			}
+		}
+
+		f.err <- scanner.Err()
+	}()
+	return f.line
+}
+
+// Stop stops reading before the end of the reader is reached; otherwise, the
+// follower stops by itself at the end of the reader
+func (f *readerFollower) Stop() error {
+	f.stopOnce.Do(func() {
+		close(f.stop)
+	})
+	return nil
+}
@@ -0,0 +1,90 @@
+package tail
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderFollowerEmitsAllLines(t *testing.T) {
+	t.Parallel()
+
+	r := strings.NewReader("line 1\nline 2\nline 3\n")
+	_, _ = r.Seek(0, io.SeekEnd)
+
+	lines := make([]string, 0)
+	for line := range NewReaderFollower(r).Lines() {
+		lines = append(lines, line)
+	}
+
+	assert.Equal(t, []string{"line 1", "line 2", "line 3"}, lines)
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func (failingReader) Seek(int64, int) (int64, error) {
+	return 0, nil
+}
+
+func TestReaderFollowerReportsErrors(t *testing.T) {
+	t.Parallel()
+
+	f := NewReaderFollower(failingReader{})
+
+	errs := make(chan error, 1)
+	f.OnError(func(err error) { errs <- err })
+
+	for range f.Lines() {
+	}
+
+	select {
+	case err := <-errs:
+		assert.EqualError(t, err, "read failed")
+	case <-time.After(time.Second):
+		t.Fatal("expected error")
+	}
+}
+
+func TestReaderFollowerEmitsLongLines(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("a", 200*1024)
+
+	lines := make([]string, 0)
+	for line := range NewReaderFollower(strings.NewReader(long + "\nshort\n")).Lines() {
+		lines = append(lines, line)
+	}
+
+	assert.Equal(t, []string{long, "short"}, lines)
+}
+
+func TestFileReaderFollowerEmitsAllLines(t *testing.T) {
+	t.Parallel()
+
+	filename := filepath.Join(t.TempDir(), "access.log")
+	require.NoError(t, os.WriteFile(filename, []byte("line 1\nline 2\n"), 0o644))
+
+	f, err := NewFileReaderFollower(filename)
+	require.NoError(t, err)
+
+	lines := make([]string, 0)
+	for line := range f.Lines() {
+		lines = append(lines, line)
+	}
+
+	assert.Equal(t, []string{"line 1", "line 2"}, lines)
+
+	_, err = NewFileReaderFollower(filepath.Join(t.TempDir(), "missing.log"))
+	assert.Error(t, err)
+}
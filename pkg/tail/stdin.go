@@ -0,0 +1,127 @@
+package tail
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// lineSource reads the lines of a reader in the background, so that they can
+// be consumed by followers that come and go
+type lineSource struct {
+	lines chan string
+
+	// err is set before lines is closed
+	err error
+}
+
+func newLineSource(reader io.Reader) *lineSource {
+	s := &lineSource{lines: make(chan string)}
+
+	go func() {
+		scanner := newLineScanner(reader)
+		for scanner.Scan() {
+			s.lines <- scanner.Text()
+		}
+
+		s.err = scanner.Err()
+		close(s.lines)
+	}()
+
+	return s
+}
+
+var (
+	stdinOnce   sync.Once
+	stdinSource *lineSource
+)
+
+type stdinFollower struct {
+	source   *lineSource
+	line     chan string
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	mu             sync.Mutex
+	errorCallbacks []func(error)
+}
+
+// NewStdinFollower creates a new Follower that emits the lines read from
+// os.Stdin. Its line channel is closed when stdin is closed, or when the
+// follower is stopped (either by closing stopChan or by calling Stop).
+// Stdin is only read once, so a follower that is created after another one
+// was stopped continues with the next line.
+func NewStdinFollower(stopChan <-chan bool) Follower {
+	stdinOnce.Do(func() {
+		stdinSource = newLineSource(os.Stdin)
+	})
+
+	return newSourceFollower(stdinSource, stopChan)
+}
+
+func newSourceFollower(source *lineSource, stopChan <-chan bool) *stdinFollower {
+	f := &stdinFollower{
+		source: source,
+		line:   make(chan string),
+		stop:   make(chan struct{}),
+	}
+
+	go f.run(stopChan)
+
+	return f
+}
+
+func (f *stdinFollower) run(stopChan <-chan bool) {
+	defer close(f.line)
+
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-f.stop:
+			return
+		case line, ok := <-f.source.lines:
+			if !ok {
+				if f.source.err != nil {
+					f.reportError(f.source.err)
+				}
+				return
+			}
+
+			select {
+			case f.line <- line:
+			case <-stopChan:
+				return
+			case <-f.stop:
+				return
+			}
+		}
+	}
+}
+
+func (f *stdinFollower) OnError(cb func(error)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.errorCallbacks = append(f.errorCallbacks, cb)
+}
+
+func (f *stdinFollower) reportError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, cb := range f.errorCallbacks {
+		cb(err)
+	}
+}
+
+func (f *stdinFollower) Lines() chan string {
+	return f.line
+}
+
+func (f *stdinFollower) Stop() error {
+	f.stopOnce.Do(func() {
+		close(f.stop)
+	})
+	return nil
+}
@@ -0,0 +1,58 @@
+package tail
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceFollowerEmitsLinesUntilEOF(t *testing.T) {
+	t.Parallel()
+
+	f := newSourceFollower(newLineSource(strings.NewReader("first\nsecond\n")), make(chan bool))
+
+	var lines []string
+	for line := range f.Lines() {
+		lines = append(lines, line)
+	}
+
+	assert.Equal(t, []string{"first", "second"}, lines)
+}
+
+func TestSourceFollowerStopsOnStopChan(t *testing.T) {
+	t.Parallel()
+
+	source := &lineSource{lines: make(chan string)}
+	stopChan := make(chan bool)
+	f := newSourceFollower(source, stopChan)
+
+	close(stopChan)
+
+	select {
+	case _, ok := <-f.Lines():
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("line channel was not closed")
+	}
+}
+
+func TestSourceFollowerHandsOverToNextFollower(t *testing.T) {
+	t.Parallel()
+
+	source := &lineSource{lines: make(chan string)}
+
+	first := newSourceFollower(source, make(chan bool))
+	go func() { source.lines <- "one" }()
+	assert.Equal(t, "one", receive(t, first))
+
+	require.NoError(t, first.Stop())
+	for range first.Lines() {
+	}
+
+	second := newSourceFollower(source, make(chan bool))
+	go func() { source.lines <- "two" }()
+	assert.Equal(t, "two", receive(t, second))
+}
@@ -4,4 +4,8 @@ package tail
 type Follower interface {
 	Lines() chan string
 	OnError(func(error))
+
+	// Stop stops following; the line channel is closed once all pending
+	// lines have been emitted
+	Stop() error
 }
@@ -1,49 +1,171 @@
 package tail
 
 import (
+	"sync"
+	"time"
+
 	"gopkg.in/mcuadros/go-syslog.v2"
 )
 
+// SyslogListenFunc opens a syslog server and returns the channel on which it
+// emits received messages, as well as a function for closing it (see
+// syslog.Listen)
+type SyslogListenFunc func() (syslog.LogPartsChannel, *syslog.Server, func() error, error)
+
 type syslogFollower struct {
-	tag  string
 	line chan string
 
-	channel syslog.LogPartsChannel
-	server  *syslog.Server
+	mu             sync.Mutex
+	errorCallbacks []func(error)
 }
 
-// NewSyslogFollower builds a new syslog follower from a previously constructed
-// syslog server & channel
-func NewSyslogFollower(tag string, server *syslog.Server, channel syslog.LogPartsChannel) (Follower, error) {
-	s := &syslogFollower{
-		tag:     tag,
-		channel: channel,
-		line:    make(chan string),
-		server:  server,
+func (s *syslogFollower) OnError(cb func(error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.errorCallbacks = append(s.errorCallbacks, cb)
+}
+
+func (s *syslogFollower) reportError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, cb := range s.errorCallbacks {
+		cb(err)
 	}
-	return s, nil
 }
 
-func (s *syslogFollower) OnError(cb func(error)) {
+func (s *syslogFollower) Lines() chan string {
+	return s.line
+}
+
+// Stop does nothing, since syslog followers are stopped together with their
+// server (see NewSyslogFollowers)
+func (s *syslogFollower) Stop() error {
+	return nil
+}
+
+// syslogDispatcher distributes the messages of a syslog server to the
+// followers of their tags, and re-opens the server if its channel closes
+type syslogDispatcher struct {
+	listen         SyslogListenFunc
+	reconnectDelay time.Duration
+	onReconnect    func()
+
+	followers map[string]*syslogFollower
+	stopChan  <-chan bool
+}
+
+// NewSyslogFollowers opens a syslog server using listen and returns a
+// follower for each of the given tags. If the server's channel closes
+// unexpectedly, the server is closed and opened again after reconnectDelay;
+// onReconnect is called before each attempt, and failed attempts are reported
+// to the followers' error callbacks. The server is closed (and the followers'
+// line channels with it) when stopChan is closed.
+func NewSyslogFollowers(tags []string, listen SyslogListenFunc, reconnectDelay time.Duration, onReconnect func(), stopChan <-chan bool, stopHandlers *sync.WaitGroup) ([]Follower, error) {
+	channel, _, closeServer, err := listen()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &syslogDispatcher{
+		listen:         listen,
+		reconnectDelay: reconnectDelay,
+		onReconnect:    onReconnect,
+		followers:      make(map[string]*syslogFollower),
+		stopChan:       stopChan,
+	}
+
+	followers := make([]Follower, 0, len(tags))
+	for _, tag := range tags {
+		if _, ok := d.followers[tag]; ok {
+			continue
+		}
+
+		f := &syslogFollower{line: make(chan string)}
+		d.followers[tag] = f
+		followers = append(followers, f)
+	}
+
+	stopHandlers.Add(1)
 	go func() {
-		err := s.server.GetLastError()
-		if err != nil {
-			cb(err)
+		defer stopHandlers.Done()
+		d.run(channel, closeServer)
+
+		for _, f := range d.followers {
+			close(f.line)
 		}
 	}()
+
+	return followers, nil
 }
 
-func (s *syslogFollower) Lines() chan string {
-	go func() {
-		for line := range s.channel {
-			if _, ok := line["tag"].(string); !ok {
+func (d *syslogDispatcher) reportError(err error) {
+	for _, f := range d.followers {
+		f.reportError(err)
+	}
+}
+
+func (d *syslogDispatcher) run(channel syslog.LogPartsChannel, closeServer func() error) {
+	for {
+		stopped := d.dispatch(channel)
+
+		if err := closeServer(); err != nil {
+			d.reportError(err)
+		}
+
+		if stopped {
+			return
+		}
+
+		for {
+			d.onReconnect()
+
+			select {
+			case <-d.stopChan:
+				return
+			case <-time.After(d.reconnectDelay):
+			}
+
+			var err error
+			if channel, _, closeServer, err = d.listen(); err == nil {
+				break
+			}
+
+			d.reportError(err)
+		}
+	}
+}
+
+// dispatch forwards messages until either the channel is closed (returning
+// false) or the dispatcher is stopped (returning true)
+func (d *syslogDispatcher) dispatch(channel syslog.LogPartsChannel) bool {
+	for {
+		select {
+		case <-d.stopChan:
+			return true
+		case line, ok := <-channel:
+			if !ok {
+				return false
+			}
+
+			tag, ok := line["tag"].(string)
+			if !ok {
 				continue
 			}
 
-			if line["tag"].(string) == s.tag {
-				s.line <- line["content"].(string)
+			f, ok := d.followers[tag]
+			if !ok {
+				continue
+			}
+
+			content, _ := line["content"].(string)
+
+			select {
+			case f.line <- content:
+			case <-d.stopChan:
+				return true
 			}
 		}
-	}()
-	return s.line
+	}
 }
@@ -0,0 +1,94 @@
+package tail
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mcuadros/go-syslog.v2"
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+func receive(t *testing.T, f Follower) string {
+	t.Helper()
+
+	select {
+	case line := <-f.Lines():
+		return line
+	case <-time.After(time.Second):
+		t.Fatal("no line received")
+		return ""
+	}
+}
+
+func TestSyslogFollowersDispatchByTag(t *testing.T) {
+	t.Parallel()
+
+	channel := make(syslog.LogPartsChannel)
+	listen := func() (syslog.LogPartsChannel, *syslog.Server, func() error, error) {
+		return channel, nil, func() error { return nil }, nil
+	}
+
+	stopChan := make(chan bool)
+	stopHandlers := sync.WaitGroup{}
+
+	followers, err := NewSyslogFollowers([]string{"nginx", "proxy"}, listen, 0, func() {}, stopChan, &stopHandlers)
+	require.NoError(t, err)
+	require.Len(t, followers, 2)
+
+	channel <- format.LogParts{"tag": "proxy", "content": "proxy line"}
+	assert.Equal(t, "proxy line", receive(t, followers[1]))
+
+	channel <- format.LogParts{"tag": "other", "content": "ignored"}
+	channel <- format.LogParts{"tag": "nginx", "content": "nginx line"}
+	assert.Equal(t, "nginx line", receive(t, followers[0]))
+
+	close(stopChan)
+	stopHandlers.Wait()
+}
+
+func TestSyslogFollowersReconnectWhenChannelCloses(t *testing.T) {
+	t.Parallel()
+
+	channels := make(chan syslog.LogPartsChannel, 2)
+	closed := make(chan struct{}, 2)
+	attempts := 0
+
+	listen := func() (syslog.LogPartsChannel, *syslog.Server, func() error, error) {
+		attempts++
+		if attempts == 2 {
+			return nil, nil, nil, errors.New("address in use")
+		}
+
+		c := make(syslog.LogPartsChannel)
+		channels <- c
+		return c, nil, func() error { closed <- struct{}{}; return nil }, nil
+	}
+
+	stopChan := make(chan bool)
+	stopHandlers := sync.WaitGroup{}
+	reconnects := make(chan struct{}, 3)
+	errs := make(chan error, 1)
+
+	followers, err := NewSyslogFollowers([]string{"nginx"}, listen, time.Millisecond, func() { reconnects <- struct{}{} }, stopChan, &stopHandlers)
+	require.NoError(t, err)
+	followers[0].OnError(func(err error) { errs <- err })
+
+	close(<-channels)
+
+	second := <-channels
+	second <- format.LogParts{"tag": "nginx", "content": "after reconnect"}
+	assert.Equal(t, "after reconnect", receive(t, followers[0]))
+
+	assert.Len(t, reconnects, 2)
+	assert.Len(t, closed, 1)
+	assert.EqualError(t, <-errs, "address in use")
+
+	close(stopChan)
+	stopHandlers.Wait()
+
+	assert.Len(t, closed, 2)
+}
@@ -3,25 +3,72 @@ package tail
 import (
 	"io"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/log"
 	"github.com/nxadm/tail"
 )
 
+// cursorSaveInterval is the interval at which the cursor of a followed file
+// is saved; saving it for every line would be too expensive for busy logs
+const cursorSaveInterval = time.Second
+
 type followerImpl struct {
 	logger *log.Logger
 
-	filename string
-	t        *tail.Tail
-	line     chan string
+	filename   string
+	fromStart  bool
+	cursorFile string
+	t          *tail.Tail
+	line       chan string
+
+	// offset is the position after the last emitted line
+	mu     sync.Mutex
+	offset int64
+	saved  int64
 }
 
-// NewFileFollower creates a new Follower instance for a given file (given by name)
-func NewFileFollower(logger *log.Logger, filename string) (Follower, error) {
+// NewFileFollower creates a new Follower instance for a given file (given by
+// name). If the file is a named pipe, it is read by a FIFO follower instead.
+// If cursorFile is not empty, the position after the emitted lines is saved
+// in it, and following continues at that position after a restart (unless
+// the file was rotated in the meantime, in which case the new file is read
+// from its beginning).
+func NewFileFollower(logger *log.Logger, filename string, cursorFile string) (Follower, error) {
+	if isFIFO(filename) {
+		return newFIFOFollower(filename), nil
+	}
+
 	f := &followerImpl{
-		filename: filename,
-		line:     make(chan string),
-		logger:   logger,
+		filename:   filename,
+		cursorFile: cursorFile,
+		line:       make(chan string),
+		logger:     logger,
+	}
+
+	if err := f.start(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// NewCreatedFileFollower creates a new Follower for a file that was just
+// created. In contrast to NewFileFollower, the file is read from its
+// beginning (unless cursorFile contains a position within it), so that the
+// lines that were written before the follower was started are not lost.
+func NewCreatedFileFollower(logger *log.Logger, filename string, cursorFile string) (Follower, error) {
+	if isFIFO(filename) {
+		return newFIFOFollower(filename), nil
+	}
+
+	f := &followerImpl{
+		filename:   filename,
+		fromStart:  true,
+		cursorFile: cursorFile,
+		line:       make(chan string),
+		logger:     logger,
 	}
 
 	if err := f.start(); err != nil {
@@ -34,12 +81,14 @@ func NewFileFollower(logger *log.Logger, filename string) (Follower, error) {
 func (f *followerImpl) start() error {
 	var seekInfo *tail.SeekInfo
 
-	_, err := os.Stat(f.filename)
+	info, err := os.Stat(f.filename)
 	if err != nil {
 		if !os.IsNotExist(err) {
 			return err
 		}
-	} else {
+	} else if seekInfo, err = f.cursorSeekInfo(info); err != nil {
+		return err
+	} else if seekInfo == nil && !f.fromStart {
 		seekInfo = &tail.SeekInfo{Offset: 0, Whence: io.SeekEnd}
 	}
 
@@ -59,6 +108,55 @@ func (f *followerImpl) start() error {
 	return nil
 }
 
+// cursorSeekInfo returns where to start following according to the cursor
+// file, or nil if there is no cursor. A cursor of another (rotated) file, or
+// beyond the end of the (truncated) file, makes following start at the
+// beginning of the file.
+func (f *followerImpl) cursorSeekInfo(info os.FileInfo) (*tail.SeekInfo, error) {
+	if f.cursorFile == "" {
+		return nil, nil
+	}
+
+	c, ok, err := readFileCursor(f.cursorFile)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	if c.Inode != fileInode(info) || c.Offset > info.Size() {
+		f.logger.Infof("file %s was rotated or truncated since its cursor was saved; reading it from the beginning", f.filename)
+		return &tail.SeekInfo{Offset: 0, Whence: io.SeekStart}, nil
+	}
+
+	f.offset, f.saved = c.Offset, c.Offset
+	return &tail.SeekInfo{Offset: c.Offset, Whence: io.SeekStart}, nil
+}
+
+// saveCursor saves the position after the last emitted line, if it changed
+func (f *followerImpl) saveCursor() {
+	f.mu.Lock()
+	offset, changed := f.offset, f.offset != f.saved
+	f.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	info, err := os.Stat(f.filename)
+	if err != nil {
+		f.logger.Errorf("error while saving the cursor of file %s: %s", f.filename, err.Error())
+		return
+	}
+
+	if err := writeFileCursor(f.cursorFile, fileCursor{Inode: fileInode(info), Offset: offset}); err != nil {
+		f.logger.Errorf("error while saving the cursor of file %s: %s", f.filename, err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	f.saved = offset
+	f.mu.Unlock()
+}
+
 func (f *followerImpl) OnError(cb func(error)) {
 	go func() {
 		err := f.t.Wait()
@@ -69,10 +167,43 @@ func (f *followerImpl) OnError(cb func(error)) {
 }
 
 func (f *followerImpl) Lines() chan string {
+	done := make(chan struct{})
+
+	if f.cursorFile != "" {
+		go func() {
+			ticker := time.NewTicker(cursorSaveInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					f.saveCursor()
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
 	go func() {
+		defer close(f.line)
+		defer close(done)
+
 		for n := range f.t.Lines {
 			f.line <- n.Text
+
+			f.mu.Lock()
+			f.offset = n.SeekInfo.Offset
+			f.mu.Unlock()
+		}
+
+		if f.cursorFile != "" {
+			f.saveCursor()
 		}
 	}()
 	return f.line
 }
+
+func (f *followerImpl) Stop() error {
+	return f.t.Stop()
+}
@@ -0,0 +1,90 @@
+package tail
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// followLines follows a file until n lines were emitted, then stops the
+// follower (which saves its cursor)
+func followLines(t *testing.T, f Follower, n int) []string {
+	lines := f.Lines()
+
+	result := make([]string, 0, n)
+	for len(result) < n {
+		select {
+		case line := <-lines:
+			result = append(result, line)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %d lines, got %v", n, result)
+		}
+	}
+
+	require.NoError(t, f.Stop())
+	for range lines {
+	}
+
+	return result
+}
+
+func TestFileFollowerContinuesAtCursor(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "access.log")
+	cursorFile := filepath.Join(dir, "access.log.cursor")
+
+	logger, err := log.New("error", "console")
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filename, []byte("line 1\nline 2\n"), 0o600))
+
+	info, err := os.Stat(filename)
+	require.NoError(t, err)
+	require.NoError(t, writeFileCursor(cursorFile, fileCursor{Inode: fileInode(info), Offset: 7}))
+
+	f, err := NewFileFollower(logger, filename, cursorFile)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"line 2"}, followLines(t, f, 1))
+
+	c, ok, err := readFileCursor(cursorFile)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, int64(14), c.Offset)
+
+	// lines written while the exporter was not running are not lost
+	appendLines(t, filename, "line 3\n")
+
+	f, err = NewFileFollower(logger, filename, cursorFile)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"line 3"}, followLines(t, f, 1))
+}
+
+func TestFileFollowerReadsRotatedFileFromBeginning(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "access.log")
+	cursorFile := filepath.Join(dir, "access.log.cursor")
+
+	logger, err := log.New("error", "console")
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filename, []byte("new 1\nnew 2\n"), 0o600))
+	require.NoError(t, writeFileCursor(cursorFile, fileCursor{Inode: 1, Offset: 6}))
+
+	f, err := NewFileFollower(logger, filename, cursorFile)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new 1", "new 2"}, followLines(t, f, 2))
+}
+
+func appendLines(t *testing.T, filename string, lines string) {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	defer file.Close()
+
+	_, err = file.WriteString(lines)
+	require.NoError(t, err)
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/log"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/config"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// dynamicGatherers is a prometheus.Gatherer whose namespace gatherers can be
+// replaced while metrics are being served
+type dynamicGatherers struct {
+	static prometheus.Gatherers
+
+	mu         sync.RWMutex
+	namespaces prometheus.Gatherers
+
+	// endpoints contains the gatherers of the namespaces that have their
+	// own metrics endpoint, by URL path
+	endpoints map[string]prometheus.Gatherer
+}
+
+// Gather implements the prometheus.Gatherer interface
+func (g *dynamicGatherers) Gather() ([]*dto.MetricFamily, error) {
+	g.mu.RLock()
+	all := append(append(prometheus.Gatherers{}, g.static...), g.namespaces...)
+	g.mu.RUnlock()
+
+	return all.Gather()
+}
+
+func (g *dynamicGatherers) setNamespaces(namespaces prometheus.Gatherers, endpoints map[string]prometheus.Gatherer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.namespaces = namespaces
+	g.endpoints = endpoints
+}
+
+// endpoint returns the gatherer of the namespace whose metrics endpoint is
+// the given URL path
+func (g *dynamicGatherers) endpoint(path string) (prometheus.Gatherer, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	gatherer, ok := g.endpoints[path]
+	return gatherer, ok
+}
+
+// runningNamespace is a namespace whose log sources are being processed
+type runningNamespace struct {
+	cfg     *config.NamespaceConfig
+	metrics *metrics.NamespaceMetrics
+	stop    chan bool
+	done    chan struct{}
+
+	stopOnce sync.Once
+}
+
+func (r *runningNamespace) requestStop() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+}
+
+// namespaceManager starts and stops the processing of namespaces, so that
+// the set of namespaces can be changed when the configuration is reloaded
+type namespaceManager struct {
+	logger       *log.Logger
+	stopChan     <-chan bool
+	stopHandlers *sync.WaitGroup
+	gatherers    *dynamicGatherers
+	readiness    *readiness
+
+	// readToEOF makes namespaces read their log files once instead of
+	// following them
+	readToEOF bool
+
+	// lineLimit stops the sources of each namespace once that many lines
+	// have been read (if greater than zero), and dryRun makes namespaces
+	// record the label value combinations of the lines
+	lineLimit int
+	dryRun    bool
+
+	// debugBufferSize is the number of recent raw log lines that each
+	// namespace keeps for debugging (if greater than zero)
+	debugBufferSize int
+
+	mu      sync.Mutex
+	running map[string]*runningNamespace
+
+	// cfg is the most recently applied configuration, and discovered
+	// contains the namespaces read from each discovery backend (like etcd),
+	// which are added to the namespaces of cfg
+	cfg        *config.Config
+	discovered map[string][]config.NamespaceConfig
+}
+
+func newNamespaceManager(logger *log.Logger, gatherers *dynamicGatherers, stopChan <-chan bool, stopHandlers *sync.WaitGroup) *namespaceManager {
+	return &namespaceManager{
+		logger:       logger,
+		stopChan:     stopChan,
+		stopHandlers: stopHandlers,
+		gatherers:    gatherers,
+		readiness:    newReadiness(),
+		running:      make(map[string]*runningNamespace),
+		discovered:   make(map[string][]config.NamespaceConfig),
+	}
+}
+
+// apply makes the set of running namespaces match the namespaces of cfg.
+// Namespaces whose configuration did not change keep running; removed
+// namespaces are stopped and their metrics unregistered, and added or changed
+// namespaces are (re)started. Changed namespaces keep their metric values if
+// their labels and metric settings did not change.
+func (m *namespaceManager) apply(cfg *config.Config) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	previous := m.cfg
+	m.cfg = cfg
+	if err := m.applyLocked(); err != nil {
+		m.cfg = previous
+		return err
+	}
+
+	return nil
+}
+
+// setDiscovered replaces the namespaces that were read from a discovery
+// backend and applies them together with the most recently applied
+// configuration (if there is one yet)
+func (m *namespaceManager) setDiscovered(backend string, namespaces []config.NamespaceConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	previous := m.discovered[backend]
+	m.discovered[backend] = namespaces
+	if m.cfg == nil {
+		return nil
+	}
+
+	if err := m.applyLocked(); err != nil {
+		m.discovered[backend] = previous
+		return err
+	}
+
+	return nil
+}
+
+func (m *namespaceManager) applyLocked() error {
+	backends := make([]string, 0, len(m.discovered))
+	for backend := range m.discovered {
+		backends = append(backends, backend)
+	}
+	sort.Strings(backends)
+
+	cfg := *m.cfg
+	cfg.Namespaces = append([]config.NamespaceConfig{}, m.cfg.Namespaces...)
+	for _, backend := range backends {
+		cfg.Namespaces = append(cfg.Namespaces, m.discovered[backend]...)
+	}
+
+	wanted := make(map[string]*config.NamespaceConfig, len(cfg.Namespaces))
+	names := make(map[string]struct{}, len(cfg.Namespaces))
+	if err := config.CompileNamespaces(cfg.Namespaces); err != nil {
+		return err
+	}
+
+	for i := range cfg.Namespaces {
+		ns := &cfg.Namespaces[i]
+		if _, ok := wanted[ns.Name]; ok && i >= len(m.cfg.Namespaces) {
+			return fmt.Errorf("discovered namespace %s is already defined", ns.Name)
+		}
+
+		wanted[ns.Name] = ns
+		names[ns.Name] = struct{}{}
+	}
+
+	for _, group := range cfg.NamespaceGroups {
+		for _, name := range group.Namespaces {
+			if _, ok := wanted[name]; !ok {
+				return fmt.Errorf("namespace group %s references unknown namespace %s", group.Name, name)
+			}
+		}
+	}
+
+	// the metrics of added and changed namespaces are created before any
+	// namespace is stopped, so that the running namespaces are kept if this
+	// fails
+	prepared := make(map[string]*metrics.NamespaceMetrics)
+	for i := range cfg.Namespaces {
+		ns := &cfg.Namespaces[i]
+		if r, ok := m.running[ns.Name]; ok && (reflect.DeepEqual(r.cfg, ns) || r.cfg.SameMetrics(ns)) {
+			continue
+		}
+
+		nsMetrics, err := metrics.PrepareForNamespace(ns)
+		if err != nil {
+			return fmt.Errorf("could not create metrics of namespace %s: %s", ns.Name, err.Error())
+		}
+
+		prepared[ns.Name] = nsMetrics
+	}
+
+	for name, r := range m.running {
+		if _, ok := wanted[name]; ok {
+			continue
+		}
+
+		m.logger.Infof("stopping listener for removed namespace %s", name)
+		m.stopNamespace(r)
+
+		if err := metrics.ResetForNamespace(r.cfg); err != nil {
+			m.logger.Errorf("error while removing metrics of namespace %s: %s", name, err.Error())
+		}
+
+		delete(m.running, name)
+	}
+
+	gatherers := make(prometheus.Gatherers, 0, len(cfg.Namespaces)+len(cfg.NamespaceGroups))
+	namespaceMetrics := make(map[string]*metrics.NamespaceMetrics, len(cfg.Namespaces))
+	endpoints := make(map[string]prometheus.Gatherer)
+
+	for i := range cfg.Namespaces {
+		ns := &cfg.Namespaces[i]
+
+		r, ok := m.running[ns.Name]
+		nsMetrics, recreate := prepared[ns.Name]
+		switch {
+		case ok && reflect.DeepEqual(r.cfg, ns):
+			m.logger.Debugf("configuration of namespace %s did not change", ns.Name)
+		case ok:
+			m.logger.Infof("restarting listener for changed namespace %s", ns.Name)
+			m.stopNamespace(r)
+
+			if recreate {
+				metrics.ActivateForNamespace(nsMetrics)
+			} else {
+				nsMetrics = r.metrics
+			}
+
+			m.running[ns.Name] = m.startNamespace(ns, nsMetrics)
+		default:
+			metrics.ActivateForNamespace(nsMetrics)
+			m.running[ns.Name] = m.startNamespace(ns, nsMetrics)
+		}
+
+		gatherers = append(gatherers, m.running[ns.Name].metrics.Gatherer())
+		namespaceMetrics[ns.Name] = m.running[ns.Name].metrics
+
+		if ns.MetricsEndpoint != "" {
+			endpoints[ns.MetricsEndpoint] = m.running[ns.Name].metrics.Gatherer()
+		}
+	}
+
+	for _, group := range cfg.NamespaceGroups {
+		members := make([]*metrics.NamespaceMetrics, 0, len(group.Namespaces))
+		for _, name := range group.Namespaces {
+			members = append(members, namespaceMetrics[name])
+		}
+
+		groupRegistry := prometheus.NewRegistry()
+		groupRegistry.MustRegister(metrics.NewGroupCollector(group.Name, members))
+		gatherers = append(gatherers, groupRegistry)
+	}
+
+	m.gatherers.setNamespaces(gatherers, endpoints)
+	m.readiness.setNamespaces(names)
+
+	return nil
+}
+
+func (m *namespaceManager) startNamespace(ns *config.NamespaceConfig, nsMetrics *metrics.NamespaceMetrics) *runningNamespace {
+	r := &runningNamespace{
+		cfg:     ns,
+		metrics: nsMetrics,
+		stop:    make(chan bool),
+		done:    make(chan struct{}),
+	}
+
+	// the namespace stops when it is removed or when the exporter shuts down
+	go func() {
+		select {
+		case <-m.stopChan:
+			r.requestStop()
+		case <-r.done:
+		}
+	}()
+
+	if m.dryRun {
+		nsMetrics.Collection.EnableDryRun()
+	}
+
+	if m.debugBufferSize > 0 {
+		nsMetrics.Collection.EnableRecentLines(m.debugBufferSize)
+	}
+
+	m.logger.Infof("starting listener for namespace %s", ns.Name)
+	go func() {
+		defer close(r.done)
+		if err := processNamespace(m.logger, ns, &(nsMetrics.Collection), m.readiness.track(ns.Name), m.readToEOF, m.lineLimit, r.stop, m.stopHandlers); err != nil {
+			m.logger.Errorf("error while processing namespace %s: %s", ns.Name, err.Error())
+		}
+	}()
+
+	return r
+}
+
+// scrapeHandler pauses the periodic cleanup work of all running namespaces
+// that have a scrape timeout budget while next serves a scrape
+func (m *namespaceManager) scrapeHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		gates := make([]*metrics.ScrapeGate, 0, len(m.running))
+		for _, ns := range m.running {
+			gates = append(gates, ns.metrics.Collection.ScrapeGate)
+		}
+		m.mu.Unlock()
+
+		ends := make([]func(), 0, len(gates))
+		for _, g := range gates {
+			ends = append(ends, g.BeginScrape())
+		}
+
+		defer func() {
+			for _, end := range ends {
+				end()
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// stopNamespace stops a running namespace and waits until it has finished
+// processing its log sources
+func (m *namespaceManager) stopNamespace(r *runningNamespace) {
+	r.requestStop()
+	<-r.done
+}
+
+// wait blocks until all running namespaces have finished processing their log
+// sources
+func (m *namespaceManager) wait() {
+	m.mu.Lock()
+	running := make([]*runningNamespace, 0, len(m.running))
+	for _, r := range m.running {
+		running = append(running, r)
+	}
+	m.mu.Unlock()
+
+	for _, r := range running {
+		<-r.done
+	}
+}
@@ -0,0 +1,387 @@
+// Package integration contains tests that run the exporter binary against
+// known log lines and compare the scraped metrics with golden files. Run
+// `go test ./test/integration -update` to rewrite the golden files after an
+// intended change of the metric output.
+package integration
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the current metric output")
+
+var exporterBinary string
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	dir, err := os.MkdirTemp("", "nginxlog-exporter-integration")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	exporterBinary = filepath.Join(dir, "prometheus-nginxlog-exporter")
+
+	build := exec.Command("go", "build", "-o", exporterBinary, "github.com/martin-helmich/prometheus-nginxlog-exporter")
+	build.Stdout = os.Stdout
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// exporter is a running exporter process
+type exporter struct {
+	cmd        *exec.Cmd
+	configFile string
+	port       int
+	logFile    string
+	syslogPort int
+	metricsURL string
+}
+
+func freePort(t *testing.T, network string) int {
+	t.Helper()
+
+	if network == "udp" {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		return conn.LocalAddr().(*net.UDPAddr).Port
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// startExporter renders the config file testdata/<name>.yaml and starts an
+// exporter with it. The log file referenced by the config does not exist
+// yet, so that the exporter reads it from the beginning once it is written.
+func startExporter(t *testing.T, name string) *exporter {
+	t.Helper()
+
+	dir := t.TempDir()
+	e := &exporter{
+		logFile:    filepath.Join(dir, "access.log"),
+		syslogPort: freePort(t, "udp"),
+	}
+
+	e.port = freePort(t, "tcp")
+	e.metricsURL = fmt.Sprintf("http://127.0.0.1:%d/metrics", e.port)
+	e.configFile = filepath.Join(dir, "config.yaml")
+	e.writeConfig(t, name)
+
+	e.cmd = exec.Command(exporterBinary, "-config-file", e.configFile)
+	require.NoError(t, e.cmd.Start())
+
+	t.Cleanup(func() {
+		_ = e.cmd.Process.Kill()
+		_ = e.cmd.Wait()
+	})
+
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(e.metricsURL)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 10*time.Second, 50*time.Millisecond, "exporter did not start")
+
+	return e
+}
+
+// writeConfig renders the config file testdata/<name>.yaml to the
+// exporter's config file
+func (e *exporter) writeConfig(t *testing.T, name string) {
+	t.Helper()
+
+	tmpl, err := template.ParseFiles(filepath.Join("testdata", name+".yaml"))
+	require.NoError(t, err)
+
+	configFile, err := os.Create(e.configFile)
+	require.NoError(t, err)
+	require.NoError(t, tmpl.Execute(configFile, map[string]interface{}{
+		"Port":       e.port,
+		"LogFile":    e.logFile,
+		"SyslogPort": e.syslogPort,
+	}))
+	require.NoError(t, configFile.Close())
+}
+
+// reload replaces the exporter's config file with testdata/<name>.yaml and
+// makes the exporter reload it
+func (e *exporter) reload(t *testing.T, name string) {
+	t.Helper()
+
+	e.writeConfig(t, name)
+	require.NoError(t, e.cmd.Process.Signal(syscall.SIGHUP))
+}
+
+// writeLogFile appends the lines of testdata/<name>.log to the log file
+func (e *exporter) writeLogFile(t *testing.T, name string) {
+	t.Helper()
+
+	lines, err := os.ReadFile(filepath.Join("testdata", name+".log"))
+	require.NoError(t, err)
+
+	f, err := os.OpenFile(e.logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = f.Write(lines)
+	require.NoError(t, err)
+}
+
+// sendSyslog sends the lines of testdata/<name>.log as RFC3164 syslog messages
+func (e *exporter) sendSyslog(t *testing.T, name string) {
+	t.Helper()
+
+	conn, err := net.Dial("udp", fmt.Sprintf("127.0.0.1:%d", e.syslogPort))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	f, err := os.Open(filepath.Join("testdata", name+".log"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		_, err := fmt.Fprintf(conn, "<14>%s localhost nginx: %s", time.Now().Format(time.Stamp), scanner.Text())
+		require.NoError(t, err)
+	}
+	require.NoError(t, scanner.Err())
+}
+
+// scrape returns the metrics of a namespace; metrics of the Go runtime and
+// the exporter itself are left out, since they are not deterministic
+func (e *exporter) scrape(t *testing.T, namespace string) string {
+	t.Helper()
+
+	resp, err := http.Get(e.metricsURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	var out strings.Builder
+	for _, line := range strings.Split(string(body), "\n") {
+		name := strings.TrimPrefix(strings.TrimPrefix(line, "# HELP "), "# TYPE ")
+		if strings.HasPrefix(name, namespace+"_") {
+			out.WriteString(line + "\n")
+		}
+	}
+
+	return out.String()
+}
+
+// assertGolden waits until the metrics of a namespace match the golden file
+// testdata/<name>.golden.txt (or rewrites it when running with -update)
+func (e *exporter) assertGolden(t *testing.T, name string, namespace string) {
+	t.Helper()
+
+	golden := filepath.Join("testdata", name+".golden.txt")
+
+	if *update {
+		// there is no expected output to wait for, so give the exporter
+		// some time to process all lines
+		time.Sleep(2 * time.Second)
+		require.NoError(t, os.WriteFile(golden, []byte(e.scrape(t, namespace)), 0o644))
+		return
+	}
+
+	expected, err := os.ReadFile(golden)
+	require.NoError(t, err)
+
+	var actual string
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if actual = e.scrape(t, namespace); actual == string(expected) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	assert.Equal(t, string(expected), actual)
+}
+
+func TestGoldenFiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		syslog    bool
+	}{
+		{name: "text_parser", namespace: "text"},
+		{name: "json_parser", namespace: "json"},
+		{name: "relabeling", namespace: "relabel"},
+		{name: "disable_flags", namespace: "disabled"},
+		{name: "upstream_bytes", namespace: "upstream"},
+		{name: "ssl_handshake", namespace: "ssl"},
+		{name: "cache_metrics", namespace: "cache"},
+		{name: "request_completion", namespace: "completion"},
+		{name: "gzip_ratio", namespace: "gzip"},
+		{name: "multiline_json", namespace: "multiline"},
+		{name: "decompose_request", namespace: "decompose"},
+		{name: "filter_actions", namespace: "filter"},
+		{name: "status_groups", namespace: "groups"},
+		{name: "syslog", namespace: "syslog", syslog: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			e := startExporter(t, tt.name)
+
+			if tt.syslog {
+				e.sendSyslog(t, tt.name)
+			} else {
+				e.writeLogFile(t, tt.name)
+			}
+
+			e.assertGolden(t, tt.name, tt.namespace)
+		})
+	}
+}
+
+func TestLabelExpiryRemovesCustomGaugeSeries(t *testing.T) {
+	if testing.Short() {
+		t.Skip("label expiry is only checked every 15 seconds")
+	}
+	t.Parallel()
+
+	e := startExporter(t, "label_expiry")
+	e.writeLogFile(t, "label_expiry")
+
+	series := `expiry_upstream_queue_length_gauge{upstream_addr="10.0.0.1:80"} 3`
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(e.scrape(t, "expiry"), series)
+	}, 10*time.Second, 100*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		return !strings.Contains(e.scrape(t, "expiry"), series)
+	}, 30*time.Second, 500*time.Millisecond)
+}
+
+func TestReloadOnSIGHUP(t *testing.T) {
+	t.Parallel()
+
+	e := startExporter(t, "reload")
+	e.writeLogFile(t, "text_parser")
+
+	series := `reload_http_response_count_total{method="GET",status="200"} 2`
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(e.scrape(t, "reload"), series)
+	}, 10*time.Second, 100*time.Millisecond)
+
+	e.reload(t, "reload_added")
+
+	require.Eventually(t, func() bool {
+		return e.scrape(t, "added") != ""
+	}, 10*time.Second, 100*time.Millisecond, "added namespace was not started")
+
+	assert.Contains(t, e.scrape(t, "reload"), series, "unchanged namespace lost its metrics")
+}
+
+func TestReadinessWaitsForFirstParsedLine(t *testing.T) {
+	t.Parallel()
+
+	e := startExporter(t, "text_parser")
+	base := strings.TrimSuffix(e.metricsURL, "/metrics")
+
+	status := func(path string) int {
+		resp, err := http.Get(base + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, status("/healthz"))
+	assert.Equal(t, http.StatusServiceUnavailable, status("/readyz"))
+
+	e.writeLogFile(t, "text_parser")
+
+	require.Eventually(t, func() bool {
+		return status("/readyz") == http.StatusOK
+	}, 10*time.Second, 100*time.Millisecond)
+}
+
+func TestSamplingScalesCounters(t *testing.T) {
+	t.Parallel()
+
+	e := startExporter(t, "sampling")
+
+	const lines = 2000
+	line := `172.17.0.1 - - [23/Jun/2016:16:04:20 +0000] "GET /api/users HTTP/1.1" 200 612 "-" "curl/7.29.0" 120 0.050 0.040` + "\n"
+	require.NoError(t, os.WriteFile(e.logFile, []byte(strings.Repeat(line, lines)), 0o644))
+
+	// half of the lines are processed, and each of them is counted twice;
+	// the bounds are more than ten standard deviations away from the
+	// expected value
+	prefix := `sampling_http_response_count_total{method="GET",status="200"} `
+	require.Eventually(t, func() bool {
+		for _, l := range strings.Split(e.scrape(t, "sampling"), "\n") {
+			if v, ok := strings.CutPrefix(l, prefix); ok {
+				count, err := strconv.Atoi(v)
+				return err == nil && count%2 == 0 && count >= lines*0.8 && count <= lines*1.2
+			}
+		}
+		return false
+	}, 10*time.Second, 100*time.Millisecond)
+}
+
+func TestNamespaceMetricsEndpoint(t *testing.T) {
+	t.Parallel()
+
+	e := startExporter(t, "metrics_endpoint")
+	e.writeLogFile(t, "text_parser")
+
+	series := `_http_response_count_total{method="GET",status="200"} 2`
+
+	require.Eventually(t, func() bool {
+		all := e.scrape(t, "tenant_a") + e.scrape(t, "tenant_b")
+		return strings.Contains(all, "tenant_a"+series) && strings.Contains(all, "tenant_b"+series)
+	}, 10*time.Second, 100*time.Millisecond, "global endpoint does not serve all namespaces")
+
+	resp, err := http.Get(e.metricsURL + "/tenant_a")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(body), "tenant_a"+series)
+	assert.NotContains(t, string(body), "tenant_b_")
+}